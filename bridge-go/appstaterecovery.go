@@ -0,0 +1,148 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/appstate"
+)
+
+// App state patches are encrypted with keys the primary device shares with
+// linked devices. When a key never arrived, every sync of the collections it
+// encrypts fails and contacts, mutes, pins... silently stop updating.
+// WmClientRecoverAppState walks through the recovery: it syncs each collection
+// to find those failing on a missing key (whatsmeow then asks the primary
+// device for the keys it lacks), waits for the keys by retrying those
+// collections with a backoff, and re-runs a full sync of each once it
+// decrypts. Progress is reported as app_state_recovery events carrying the
+// recovery_id returned at the end; the call blocks until every collection is
+// recovered or timeout_ms ran out.
+
+var nextRecoveryID atomic.Uint64
+
+type appStateRecoveryResult struct {
+	Name string `json:"name"`
+	// ok (no key was missing), recovered, failed (another error) or
+	// missing_key (still missing at the timeout)
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+func emitRecoveryStage(cli *wa.Client, id uint64, name appstate.WAPatchName, stage string, fields map[string]any) {
+	ev := map[string]any{"type": "app_state_recovery", "recovery_id": id, "stage": stage}
+	if name != "" {
+		ev["name"] = string(name)
+	}
+	for k, v := range fields {
+		ev[k] = v
+	}
+	emitBridgeEvent(cli, ev)
+}
+
+//export WmClientRecoverAppState
+func WmClientRecoverAppState(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		// collections to check, all of them when empty
+		Names     []string `json:"names"`
+		TimeoutMs int64    `json:"timeout_ms"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if !cli.IsLoggedIn() {
+		return fail(wa.ErrNotLoggedIn)
+	}
+	names := appstate.AllPatchNames[:]
+	if len(payload.Names) > 0 {
+		names = make([]appstate.WAPatchName, 0, len(payload.Names))
+		for _, name := range payload.Names {
+			if !slices.Contains(appstate.AllPatchNames[:], appstate.WAPatchName(name)) {
+				return fail(fmt.Errorf("unknown app state collection %q", name))
+			}
+			names = append(names, appstate.WAPatchName(name))
+		}
+	}
+	if payload.TimeoutMs <= 0 {
+		payload.TimeoutMs = 60_000
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(payload.TimeoutMs)*time.Millisecond)
+	defer cancel()
+	id := nextRecoveryID.Add(1)
+
+	results := make(map[appstate.WAPatchName]*appStateRecoveryResult, len(names))
+	var pending []appstate.WAPatchName
+	for _, name := range names {
+		res := &appStateRecoveryResult{Name: string(name), Status: "ok", Attempts: 1}
+		results[name] = res
+		err := cli.FetchAppState(ctx, name, false, false)
+		switch {
+		case errors.Is(err, appstate.ErrKeyNotFound):
+			res.Status, res.Error = "missing_key", err.Error()
+			pending = append(pending, name)
+			emitRecoveryStage(cli, id, name, "missing_key", map[string]any{"error": err.Error()})
+		case err != nil:
+			res.Status, res.Error = "failed", err.Error()
+			emitRecoveryStage(cli, id, name, "failed", map[string]any{"error": err.Error()})
+		}
+	}
+
+	delay := 2 * time.Second
+	for len(pending) > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		delay = min(delay*2, 15*time.Second)
+		remaining := pending[:0]
+		for _, name := range pending {
+			res := results[name]
+			res.Attempts++
+			emitRecoveryStage(cli, id, name, "retrying", map[string]any{"attempt": res.Attempts})
+			// a full sync, since the state built without the key can't be trusted
+			err := cli.FetchAppState(ctx, name, true, false)
+			switch {
+			case err == nil:
+				res.Status, res.Error = "recovered", ""
+				emitRecoveryStage(cli, id, name, "recovered", map[string]any{"attempt": res.Attempts})
+			case errors.Is(err, appstate.ErrKeyNotFound):
+				res.Error = err.Error()
+				remaining = append(remaining, name)
+			default:
+				res.Status, res.Error = "failed", err.Error()
+				emitRecoveryStage(cli, id, name, "failed", map[string]any{"attempt": res.Attempts, "error": err.Error()})
+			}
+		}
+		pending = remaining
+	}
+
+	list := make([]*appStateRecoveryResult, 0, len(names))
+	recovered := true
+	for _, name := range names {
+		list = append(list, results[name])
+		if res := results[name]; res.Status == "failed" || res.Status == "missing_key" {
+			recovered = false
+		}
+	}
+	emitRecoveryStage(cli, id, "", "done", map[string]any{"recovered": recovered})
+	return success(map[string]any{"recovery_id": id, "recovered": recovered, "results": list})
+}
@@ -0,0 +1,227 @@
+package main
+
+import "C"
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// The message archive keeps received messages (including our own messages sent
+// from other devices) in the container DB so bridge features can look up
+// originals after a restart. Normal chats are only archived when enabled per
+// client; status broadcasts are always kept, but only until they expire (expired
+// ones are pruned whenever a new status is archived), and so are polls, which are
+// needed to make sense of incoming votes.
+
+type archivedMessage struct {
+	Chat      types.JID
+	Sender    types.JID
+	ID        types.MessageID
+	Timestamp time.Time
+	FromMe    bool
+	Type      string
+	Message   *waE2E.Message
+}
+
+func messageContentType(msg *waE2E.Message) string {
+	if _, kind, _ := downloadableFromMessage(msg); kind != "" {
+		return kind
+	}
+	switch {
+	case msg.GetConversation() != "" || msg.GetExtendedTextMessage() != nil:
+		return "text"
+	case msg.GetReactionMessage() != nil:
+		return "reaction"
+	case msg.GetPollCreationMessage() != nil || msg.GetPollCreationMessageV2() != nil || msg.GetPollCreationMessageV3() != nil:
+		return "poll"
+	case msg.GetProtocolMessage() != nil:
+		return "protocol"
+	default:
+		return "other"
+	}
+}
+
+func archiveMessage(cli *wa.Client, evt *events.Message) {
+	if evt.Message == nil {
+		return
+	}
+	// statuses and polls are always kept, status downloads and poll vote decryption depend on them
+	if evt.Info.Chat != types.StatusBroadcastJID && pollCreationOf(evt.Message) == nil {
+		cfg := configFor(cli)
+		cfg.mu.RLock()
+		enabled := cfg.archiveMessages
+		cfg.mu.RUnlock()
+		if !enabled {
+			return
+		}
+	}
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	ourJID := cli.Store.GetJID().ToNonAD().String()
+	if pm := evt.Message.GetProtocolMessage(); pm != nil && pm.GetType() == waE2E.ProtocolMessage_REVOKE {
+		_, err = db.db.ExecContext(ctx, `DELETE FROM wmnode_messages WHERE our_jid=$1 AND chat=$2 AND message_id=$3`,
+			ourJID, evt.Info.Chat.String(), pm.GetKey().GetID())
+		if err != nil {
+			cli.Log.Warnf("Failed to delete revoked message %s from archive: %v", pm.GetKey().GetID(), err)
+		}
+		return
+	}
+	if editOf(evt.Message) != nil {
+		// applied to the original message by linkMessageEdit
+		return
+	}
+	if err = storeArchivedMessage(ctx, db, ourJID, &archivedMessage{
+		Chat:      evt.Info.Chat,
+		Sender:    evt.Info.Sender.ToNonAD(),
+		ID:        evt.Info.ID,
+		Timestamp: evt.Info.Timestamp,
+		FromMe:    evt.Info.IsFromMe,
+		Message:   evt.Message,
+	}); err != nil {
+		cli.Log.Warnf("Failed to archive message %s: %v", evt.Info.ID, err)
+	}
+	if evt.Info.Chat == types.StatusBroadcastJID {
+		if err = pruneExpiredStatuses(ctx, db, ourJID); err != nil {
+			cli.Log.Warnf("Failed to prune expired statuses: %v", err)
+		}
+	}
+}
+
+func storeArchivedMessage(ctx context.Context, db *bridgeDB, ourJID string, msg *archivedMessage) error {
+	data, err := proto.Marshal(msg.Message)
+	if err != nil {
+		return err
+	}
+	_, err = db.db.ExecContext(ctx, `
+		INSERT INTO wmnode_messages (our_jid, chat, sender, message_id, timestamp, from_me, message_type, message)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (our_jid, chat, message_id) DO UPDATE
+			SET sender=excluded.sender, timestamp=excluded.timestamp, from_me=excluded.from_me,
+				message_type=excluded.message_type, message=excluded.message
+	`, ourJID, msg.Chat.String(), msg.Sender.String(), string(msg.ID), msg.Timestamp.UnixMilli(), msg.FromMe,
+		messageContentType(msg.Message), base64.StdEncoding.EncodeToString(data))
+	return err
+}
+
+func scanArchivedMessage(row interface{ Scan(...any) error }) (*archivedMessage, error) {
+	var msg archivedMessage
+	var chat, sender, id, data string
+	var ts int64
+	if err := row.Scan(&chat, &sender, &id, &ts, &msg.FromMe, &msg.Type, &data); err != nil {
+		return nil, err
+	}
+	msg.Chat, _ = types.ParseJID(chat)
+	msg.Sender, _ = types.ParseJID(sender)
+	msg.ID = types.MessageID(id)
+	msg.Timestamp = time.UnixMilli(ts)
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+	msg.Message = &waE2E.Message{}
+	if err := proto.Unmarshal(raw, msg.Message); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+const archivedMessageColumns = `chat, sender, message_id, timestamp, from_me, message_type, message`
+
+// getArchivedMessage returns the archived message or nil if it isn't in the archive.
+func getArchivedMessage(ctx context.Context, cli *wa.Client, chat types.JID, id types.MessageID) (*archivedMessage, error) {
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return nil, err
+	}
+	row := db.db.QueryRowContext(ctx, `SELECT `+archivedMessageColumns+` FROM wmnode_messages WHERE our_jid=$1 AND chat=$2 AND message_id=$3`,
+		cli.Store.GetJID().ToNonAD().String(), chat.String(), string(id))
+	msg, err := scanArchivedMessage(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return msg, err
+}
+
+func serializeArchivedMessage(msg *archivedMessage) map[string]any {
+	return map[string]any{
+		"chat":         msg.Chat.String(),
+		"sender":       msg.Sender.String(),
+		"id":           string(msg.ID),
+		"timestamp":    msg.Timestamp.Format(time.RFC3339),
+		"is_from_me":   msg.FromMe,
+		"message_type": msg.Type,
+		"message":      marshalProtoToMap(msg.Message),
+	}
+}
+
+//export WmClientSetMessageArchive
+func WmClientSetMessageArchive(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client  uint64 `json:"client"`
+		Enabled bool   `json:"enabled"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if _, err := bridgeDBForDevice(cli.Store); err != nil {
+		return fail(err)
+	}
+	cfg := configFor(cli)
+	cfg.mu.Lock()
+	cfg.archiveMessages = payload.Enabled
+	cfg.mu.Unlock()
+	return success(map[string]any{"enabled": payload.Enabled})
+}
+
+//export WmClientGetArchivedMessage
+func WmClientGetArchivedMessage(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		Chat   string `json:"chat"`
+		ID     string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	chat, err := types.ParseJID(payload.Chat)
+	if err != nil {
+		return fail(err)
+	}
+	msg, err := getArchivedMessage(context.Background(), cli, chat, types.MessageID(payload.ID))
+	if err != nil {
+		return fail(err)
+	}
+	if msg == nil {
+		return success(map[string]any{"found": false})
+	}
+	out := serializeArchivedMessage(msg)
+	out["found"] = true
+	return success(out)
+}
@@ -0,0 +1,261 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// autoDownloader fetches media of incoming messages in the background. The
+// message event gets an "auto_download" field with where the file will end up,
+// and a media_auto_downloaded / media_auto_download_failed event follows once
+// the download is done. Without a directory, media is kept in a bounded
+// in-memory cache readable with WmClientGetCachedMedia.
+type autoDownloader struct {
+	maxBytes map[string]uint64 // media type -> size limit, 0 means unlimited
+	dir      string
+	retries  int
+	sem      chan struct{}
+	cache    *mediaCache
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+type autoDownloadRule struct {
+	Type     string `json:"type"`
+	MaxBytes uint64 `json:"max_bytes"`
+}
+
+type mediaCache struct {
+	mu      sync.Mutex
+	limit   int
+	size    int
+	order   []string
+	entries map[string]cachedMedia
+}
+
+type cachedMedia struct {
+	data     []byte
+	mimetype string
+}
+
+func mediaCacheKey(chat types.JID, id types.MessageID) string {
+	return chat.String() + "/" + string(id)
+}
+
+func (c *mediaCache) put(key string, entry cachedMedia) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.entries[key]; ok {
+		c.size -= len(old.data)
+	} else {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = entry
+	c.size += len(entry.data)
+	// evict oldest first, but always keep the entry that was just added
+	for c.size > c.limit && len(c.order) > 1 {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		c.size -= len(c.entries[oldest].data)
+		delete(c.entries, oldest)
+	}
+}
+
+func (c *mediaCache) get(key string) (cachedMedia, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+func (cfg *clientConfig) autoDownloader() *autoDownloader {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.autoDownload
+}
+
+func stopAutoDownload(cli *wa.Client) {
+	cfg := configFor(cli)
+	cfg.mu.Lock()
+	if cfg.autoDownload != nil {
+		cfg.autoDownload.cancel()
+		cfg.autoDownload = nil
+	}
+	cfg.mu.Unlock()
+}
+
+// scheduleAutoDownload starts downloading the media of evt if a rule matches and
+// returns the fields to attach to the message event.
+func scheduleAutoDownload(cli *wa.Client, evt *events.Message) map[string]any {
+	ad := configFor(cli).autoDownloader()
+	if ad == nil || evt.Message == nil {
+		return nil
+	}
+	dl, kind, mimetype := downloadableFromMessage(evt.Message)
+	if dl == nil {
+		return nil
+	}
+	limit, ok := ad.maxBytes[kind]
+	if !ok {
+		return nil
+	}
+	var size uint64
+	if sized, ok := dl.(interface{ GetFileLength() uint64 }); ok {
+		size = sized.GetFileLength()
+	}
+	info := map[string]any{"media_type": kind, "size": size}
+	if limit > 0 && size > limit {
+		info["status"] = "skipped"
+		info["reason"] = "too_large"
+		return map[string]any{"auto_download": info}
+	}
+	item := mediaJobItem{chat: evt.Info.Chat, id: evt.Info.ID, kind: kind, mimetype: mimetype, timestamp: evt.Info.Timestamp, msg: dl}
+	info["status"] = "pending"
+	if ad.dir != "" {
+		info["path"] = mediaFilePath(ad.dir, item)
+	} else {
+		info["cache_key"] = mediaCacheKey(item.chat, item.id)
+	}
+	submitTask(cli, func() { ad.download(cli, item) })
+	return map[string]any{"auto_download": info}
+}
+
+func (ad *autoDownloader) download(cli *wa.Client, item mediaJobItem) {
+	select {
+	case ad.sem <- struct{}{}:
+		defer func() { <-ad.sem }()
+	case <-ad.ctx.Done():
+		return
+	}
+	ev := map[string]any{"chat": item.chat.String(), "id": string(item.id), "media_type": item.kind, "mimetype": item.mimetype}
+	data, err := downloadWithRetry(ad.ctx, cli, item.msg, ad.retries, time.Second)
+	if err == nil && ad.dir != "" {
+		path := mediaFilePath(ad.dir, item)
+		if err = os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+			err = os.WriteFile(path, data, 0o644)
+		}
+		ev["path"] = path
+	} else if err == nil {
+		key := mediaCacheKey(item.chat, item.id)
+		ad.cache.put(key, cachedMedia{data: data, mimetype: item.mimetype})
+		ev["cache_key"] = key
+	}
+	if ad.ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		ev["type"] = "media_auto_download_failed"
+		ev["error"] = err.Error()
+	} else {
+		ev["type"] = "media_auto_downloaded"
+		ev["size"] = len(data)
+	}
+	emitBridgeEvent(cli, ev)
+}
+
+//export WmClientSetAutoDownload
+func WmClientSetAutoDownload(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client      uint64             `json:"client"`
+		Rules       []autoDownloadRule `json:"rules"`
+		Dir         string             `json:"dir"`
+		Concurrency int                `json:"concurrency"`
+		Retries     *int               `json:"retries"`
+		CacheBytes  int                `json:"cache_bytes"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	maxBytes := make(map[string]uint64, len(payload.Rules))
+	for _, rule := range payload.Rules {
+		switch rule.Type {
+		case "image", "video", "audio", "document", "sticker":
+		default:
+			return fail(fmt.Errorf("unknown media type: %s", rule.Type))
+		}
+		maxBytes[rule.Type] = rule.MaxBytes
+	}
+	if payload.Retries != nil && *payload.Retries < 0 {
+		return fail(errors.New("retries can't be negative"))
+	}
+	stopAutoDownload(cli)
+	if len(maxBytes) == 0 {
+		return success(map[string]any{"enabled": false})
+	}
+	if payload.Concurrency <= 0 {
+		payload.Concurrency = 2
+	}
+	if payload.Retries == nil {
+		retries := 2
+		payload.Retries = &retries
+	}
+	if payload.CacheBytes <= 0 {
+		payload.CacheBytes = 64 << 20
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ad := &autoDownloader{
+		maxBytes: maxBytes,
+		dir:      payload.Dir,
+		retries:  *payload.Retries,
+		sem:      make(chan struct{}, payload.Concurrency),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	if ad.dir == "" {
+		ad.cache = &mediaCache{limit: payload.CacheBytes, entries: map[string]cachedMedia{}}
+	}
+	cfg := configFor(cli)
+	cfg.mu.Lock()
+	cfg.autoDownload = ad
+	cfg.mu.Unlock()
+	return success(map[string]any{"enabled": true})
+}
+
+//export WmClientGetCachedMedia
+func WmClientGetCachedMedia(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		Chat   string `json:"chat"`
+		ID     string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	chat, err := types.ParseJID(payload.Chat)
+	if err != nil {
+		return fail(err)
+	}
+	ad := configFor(cli).autoDownloader()
+	if ad == nil || ad.cache == nil {
+		return success(map[string]any{"found": false})
+	}
+	entry, ok := ad.cache.get(mediaCacheKey(chat, types.MessageID(payload.ID)))
+	if !ok {
+		return success(map[string]any{"found": false})
+	}
+	return success(map[string]any{"found": true, "data": base64.StdEncoding.EncodeToString(entry.data), "mimetype": entry.mimetype})
+}
@@ -0,0 +1,81 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// WmClientCallBatch runs several WmClientCall-style calls in one crossing. By
+// default they run in order and a failure doesn't stop the rest (stop_on_error
+// skips the remaining ones); concurrent runs them all at once. Each call gets
+// its own result entry, shaped like a normal response.
+
+type batchCall struct {
+	Method         string          `json:"method"`
+	Args           json.RawMessage `json:"args"`
+	OpID           uint64          `json:"op_id"`
+	IdempotencyKey string          `json:"idempotency_key"`
+}
+
+func runBatchCall(cli *wa.Client, call batchCall) (resp jsonResp) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = panicResp(r)
+		}
+	}()
+	data, err := invokeClientMethod(cli, call.Method, call.Args, call.OpID, call.IdempotencyKey)
+	if err != nil {
+		return jsonResp{Ok: false, Error: err.Error()}
+	}
+	return jsonResp{Ok: true, Data: data}
+}
+
+//export WmClientCallBatch
+func WmClientCallBatch(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client      uint64      `json:"client"`
+		Calls       []batchCall `json:"calls"`
+		Concurrent  bool        `json:"concurrent"`
+		StopOnError bool        `json:"stop_on_error"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if payload.Concurrent && payload.StopOnError {
+		return fail(errors.New("stop_on_error can't be used with concurrent"))
+	}
+	results := make([]jsonResp, len(payload.Calls))
+	if payload.Concurrent {
+		var wg sync.WaitGroup
+		for i, call := range payload.Calls {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i] = runBatchCall(cli, call)
+			}()
+		}
+		wg.Wait()
+	} else {
+		for i, call := range payload.Calls {
+			results[i] = runBatchCall(cli, call)
+			if payload.StopOnError && !results[i].Ok {
+				for j := i + 1; j < len(results); j++ {
+					results[j] = jsonResp{Ok: false, Error: "skipped after an earlier error"}
+				}
+				break
+			}
+		}
+	}
+	return success(map[string]any{"results": results})
+}
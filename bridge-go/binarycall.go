@@ -0,0 +1,229 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"unsafe"
+)
+
+// WmCallBinary is an alternate entry point for every export. The input is a
+// pointer and length instead of a NUL-terminated string, and the output is a
+// malloc'd buffer starting with its payload length as a little-endian uint32,
+// freed with WmFreeBuffer.
+//
+// Only calls in binaryCalls read the input in place, so only their payloads
+// may contain NUL bytes. Every other export is reached through exportsByName, which still converts at the
+// boundary: its input is cut at the first NUL, which valid JSON never holds
+// since encoding/json escapes it. New exports must be added to exportsByName.
+
+// binaryCalls are exports with a []byte implementation. The input slice points
+// into caller memory and is only valid for the duration of the call.
+var binaryCalls = map[string]func(input []byte) (any, error){
+	"WmClientCall": clientCall,
+}
+
+var exportsByName = map[string]func(*C.char) *C.char{
+	"WmCancel":                            WmCancel,
+	"WmClientAcceptGroupInvite":           WmClientAcceptGroupInvite,
+	"WmClientCallBatch":                   WmClientCallBatch,
+	"WmClientConnect":                     WmClientConnect,
+	"WmClientCreateNewsletter":            WmClientCreateNewsletter,
+	"WmClientDecryptPollVote":             WmClientDecryptPollVote,
+	"WmClientDeleteMessageForMe":          WmClientDeleteMessageForMe,
+	"WmClientDeleteSignalSession":         WmClientDeleteSignalSession,
+	"WmClientDeriveMessageKey":            WmClientDeriveMessageKey,
+	"WmClientDisconnect":                  WmClientDisconnect,
+	"WmClientDownloadByPath":              WmClientDownloadByPath,
+	"WmClientDownloadStatus":              WmClientDownloadStatus,
+	"WmClientDumpContactNames":            WmClientDumpContactNames,
+	"WmClientGetArchivedMessage":          WmClientGetArchivedMessage,
+	"WmClientGetCachedMedia":              WmClientGetCachedMedia,
+	"WmClientGetCatalog":                  WmClientGetCatalog,
+	"WmClientGetChatSettings":             WmClientGetChatSettings,
+	"WmClientGetDisappearingTimer":        WmClientGetDisappearingTimer,
+	"WmClientGetEditHistory":              WmClientGetEditHistory,
+	"WmClientGetGroupInviteLink":          WmClientGetGroupInviteLink,
+	"WmClientGetLocale":                   WmClientGetLocale,
+	"WmClientGetMessageSecret":            WmClientGetMessageSecret,
+	"WmClientGetNewsletterInfo":           WmClientGetNewsletterInfo,
+	"WmClientGetNewsletterInfoWithInvite": WmClientGetNewsletterInfoWithInvite,
+	"WmClientGetOrderDetails":             WmClientGetOrderDetails,
+	"WmClientGetQRChannel":                WmClientGetQRChannel,
+	"WmClientGetRetryStats":               WmClientGetRetryStats,
+	"WmClientGetSafetyNumber":             WmClientGetSafetyNumber,
+	"WmClientGetSelfProfile":              WmClientGetSelfProfile,
+	"WmClientGetWarmupQuota":              WmClientGetWarmupQuota,
+	"WmClientHasStoreID":                  WmClientHasStoreID,
+	"WmClientHealth":                      WmClientHealth,
+	"WmClientIsLoggedIn":                  WmClientIsLoggedIn,
+	"WmClientListMethods":                 WmClientListMethods,
+	"WmClientListSignalSessions":          WmClientListSignalSessions,
+	"WmClientListStatuses":                WmClientListStatuses,
+	"WmClientMarkStatusViewed":            WmClientMarkStatusViewed,
+	"WmClientNewsletterLiveSubscriptions": WmClientNewsletterLiveSubscriptions,
+	"WmClientNewsletterLiveUpdates":       WmClientNewsletterLiveUpdates,
+	"WmClientPreKeyStatus":                WmClientPreKeyStatus,
+	"WmClientPutMessageSecrets":           WmClientPutMessageSecrets,
+	"WmClientReconnectNow":                WmClientReconnectNow,
+	"WmClientRecoverAppState":             WmClientRecoverAppState,
+	"WmClientRejectCall":                  WmClientRejectCall,
+	"WmClientResetSession":                WmClientResetSession,
+	"WmClientResolveNewsletterLink":       WmClientResolveNewsletterLink,
+	"WmClientSendChatPresence":            WmClientSendChatPresence,
+	"WmClientSendComment":                 WmClientSendComment,
+	"WmClientSendFBMessage":               WmClientSendFBMessage,
+	"WmClientSendGroupInvite":             WmClientSendGroupInvite,
+	"WmClientSendIQ":                      WmClientSendIQ,
+	"WmClientSendInteractive":             WmClientSendInteractive,
+	"WmClientSendInteractiveResponse":     WmClientSendInteractiveResponse,
+	"WmClientSendInvoice":                 WmClientSendInvoice,
+	"WmClientSendNode":                    WmClientSendNode,
+	"WmClientSendPaymentRequest":          WmClientSendPaymentRequest,
+	"WmClientSendPresence":                WmClientSendPresence,
+	"WmClientSendProduct":                 WmClientSendProduct,
+	"WmClientSendReaction":                WmClientSendReaction,
+	"WmClientSetAutoDownload":             WmClientSetAutoDownload,
+	"WmClientSetAutoReconnect":            WmClientSetAutoReconnect,
+	"WmClientSetCallPolicy":               WmClientSetCallPolicy,
+	"WmClientSetDedupe":                   WmClientSetDedupe,
+	"WmClientSetDefaultDeadline":          WmClientSetDefaultDeadline,
+	"WmClientSetEventJournal":             WmClientSetEventJournal,
+	"WmClientSetFlags":                    WmClientSetFlags,
+	"WmClientSetIdentityPolicy":           WmClientSetIdentityPolicy,
+	"WmClientSetIdlePolicy":               WmClientSetIdlePolicy,
+	"WmClientSetLocale":                   WmClientSetLocale,
+	"WmClientSetLogSink":                  WmClientSetLogSink,
+	"WmClientSetMessageArchive":           WmClientSetMessageArchive,
+	"WmClientSetMessageRecovery":          WmClientSetMessageRecovery,
+	"WmClientSetMessengerConfig":          WmClientSetMessengerConfig,
+	"WmClientSetPairApproval":             WmClientSetPairApproval,
+	"WmClientSetPreKeyWatermark":          WmClientSetPreKeyWatermark,
+	"WmClientSetProxy":                    WmClientSetProxy,
+	"WmClientSetPushNameStorage":          WmClientSetPushNameStorage,
+	"WmClientSetRetryPolicy":              WmClientSetRetryPolicy,
+	"WmClientSetSendDefaults":             WmClientSetSendDefaults,
+	"WmClientSetStanzaTap":                WmClientSetStanzaTap,
+	"WmClientSetWarmup":                   WmClientSetWarmup,
+	"WmClientSetWebhook":                  WmClientSetWebhook,
+	"WmClientSignalDecrypt":               WmClientSignalDecrypt,
+	"WmClientSignalEncrypt":               WmClientSignalEncrypt,
+	"WmClientStartEvents":                 WmClientStartEvents,
+	"WmClientSubscribePresence":           WmClientSubscribePresence,
+	"WmClientUpload":                      WmClientUpload,
+	"WmClientUploadPreKeys":               WmClientUploadPreKeys,
+	"WmClientWaitForConnection":           WmClientWaitForConnection,
+	"WmClientWebhookStatus":               WmClientWebhookStatus,
+	"WmConnectAll":                        WmConnectAll,
+	"WmContainerCall":                     WmContainerCall,
+	"WmContainerGetAllDevices":            WmContainerGetAllDevices,
+	"WmContainerGetDevice":                WmContainerGetDevice,
+	"WmContainerGetFirstDevice":           WmContainerGetFirstDevice,
+	"WmContainerGetVersion":               WmContainerGetVersion,
+	"WmContainerPrune":                    WmContainerPrune,
+	"WmContainerUpgrade":                  WmContainerUpgrade,
+	"WmDeviceCall":                        WmDeviceCall,
+	"WmDeviceGetInfo":                     WmDeviceGetInfo,
+	"WmDeviceUseStoreBackend":             WmDeviceUseStoreBackend,
+	"WmDisconnectAll":                     WmDisconnectAll,
+	"WmEventGetBody":                      WmEventGetBody,
+	"WmEventJournalTrim":                  WmEventJournalTrim,
+	"WmEventNext":                         WmEventNext,
+	"WmEventReplay":                       WmEventReplay,
+	"WmEventSchema":                       WmEventSchema,
+	"WmEventSocketListen":                 WmEventSocketListen,
+	"WmEventStats":                        WmEventStats,
+	"WmGetPollResults":                    WmGetPollResults,
+	"WmGetReactions":                      WmGetReactions,
+	"WmHistoryMediaJobStart":              WmHistoryMediaJobStart,
+	"WmHistorySyncMarkProcessed":          WmHistorySyncMarkProcessed,
+	"WmHistorySyncStatus":                 WmHistorySyncStatus,
+	"WmLeaseRenew":                        WmLeaseRenew,
+	"WmLeaseSet":                          WmLeaseSet,
+	"WmListClients":                       WmListClients,
+	"WmListHandles":                       WmListHandles,
+	"WmLogNext":                           WmLogNext,
+	"WmLogStreamStart":                    WmLogStreamStart,
+	"WmMediaJobNext":                      WmMediaJobNext,
+	"WmNewClient":                         WmNewClient,
+	"WmOpNew":                             WmOpNew,
+	"WmOpenContainer":                     WmOpenContainer,
+	"WmQRNext":                            WmQRNext,
+	"WmRelease":                           WmRelease,
+	"WmRequestUnavailableMessage":         WmRequestUnavailableMessage,
+	"WmResolveDecision":                   WmResolveDecision,
+	"WmRestServerStart":                   WmRestServerStart,
+	"WmRuntimeStats":                      WmRuntimeStats,
+	"WmSetCompression":                    WmSetCompression,
+	"WmSetKeepalive":                      WmSetKeepalive,
+	"WmSetLogOptions":                     WmSetLogOptions,
+	"WmSetMediaConcurrency":               WmSetMediaConcurrency,
+	"WmSetRateLimits":                     WmSetRateLimits,
+	"WmSetSchedulerOptions":               WmSetSchedulerOptions,
+	"WmSetWAVersion":                      WmSetWAVersion,
+	"WmShutdown":                          WmShutdown,
+	"WmStoreBackendCreate":                WmStoreBackendCreate,
+	"WmStoreNext":                         WmStoreNext,
+	"WmStoreRespond":                      WmStoreRespond,
+	"WmTrustIdentity":                     WmTrustIdentity,
+	"WmVersion":                           WmVersion,
+}
+
+func callByName(name string, input []byte) (ret []byte) {
+	defer recoverBinary(&ret)
+	if call, ok := binaryCalls[name]; ok {
+		data, err := call(input)
+		var resp jsonResp
+		if err != nil {
+			resp = jsonResp{Ok: false, Error: err.Error()}
+		} else {
+			resp = jsonResp{Ok: true, Data: data}
+		}
+		b, err := json.Marshal(resp)
+		if err != nil {
+			b, _ = json.Marshal(jsonResp{Ok: false, Error: fmt.Sprintf("failed to encode response: %v", err)})
+		} else if packed, _ := compressResponse(b); resp.Ok && packed != nil {
+			return packed
+		}
+		return b
+	}
+	fn, ok := exportsByName[name]
+	if ok && name != "WmShutdown" && checkShutdown() != nil {
+		b, _ := json.Marshal(jsonResp{Ok: false, Error: errShuttingDown.Error()})
+		return b
+	}
+	if !ok {
+		b, _ := json.Marshal(jsonResp{Ok: false, Error: "unknown function " + name})
+		return b
+	}
+	in := C.CString(string(input))
+	defer C.free(unsafe.Pointer(in))
+	out := fn(in)
+	defer C.free(unsafe.Pointer(out))
+	return []byte(C.GoString(out))
+}
+
+//export WmCallBinary
+func WmCallBinary(name *C.char, input unsafe.Pointer, inputLen C.size_t) unsafe.Pointer {
+	var in []byte
+	if inputLen > 0 {
+		in = unsafe.Slice((*byte)(input), int(inputLen))
+	}
+	out := callByName(C.GoString(name), in)
+	buf := C.malloc(C.size_t(4 + len(out)))
+	dst := unsafe.Slice((*byte)(buf), 4+len(out))
+	binary.LittleEndian.PutUint32(dst, uint32(len(out)))
+	copy(dst[4:], out)
+	return buf
+}
+
+//export WmFreeBuffer
+func WmFreeBuffer(buf unsafe.Pointer) {
+	if buf != nil {
+		C.free(buf)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// nodeToJSON converts a binary XML node into a generic tree of
+// {tag, attrs, children, content_b64} that survives the trip to Node.
+func nodeToJSON(n *waBinary.Node) map[string]any {
+	if n == nil {
+		return nil
+	}
+	out := map[string]any{"tag": n.Tag}
+	if len(n.Attrs) > 0 {
+		attrs := make(map[string]any, len(n.Attrs))
+		for k, v := range n.Attrs {
+			attrs[k] = nodeAttrToJSON(v)
+		}
+		out["attrs"] = attrs
+	}
+	switch content := n.Content.(type) {
+	case nil:
+	case []waBinary.Node:
+		children := make([]map[string]any, len(content))
+		for i := range content {
+			children[i] = nodeToJSON(&content[i])
+		}
+		out["children"] = children
+	case []byte:
+		out["content_b64"] = base64.StdEncoding.EncodeToString(content)
+	case string:
+		out["content"] = content
+	default:
+		out["content"] = fmt.Sprint(content)
+	}
+	return out
+}
+
+func nodeAttrToJSON(v any) any {
+	switch tv := v.(type) {
+	case types.JID:
+		return tv.String()
+	case *types.JID:
+		if tv == nil {
+			return ""
+		}
+		return tv.String()
+	case string, bool, int, int32, int64, uint, uint32, uint64, float64:
+		return tv
+	default:
+		return fmt.Sprint(tv)
+	}
+}
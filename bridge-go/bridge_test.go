@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// callExport runs an export by name the way WmCallBinary does and returns its
+// data, failing the test if the call failed.
+func callExport(t *testing.T, name string, payload any) json.RawMessage {
+	t.Helper()
+	data, err := tryExport(t, name, payload)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return data
+}
+
+func tryExport(t *testing.T, name string, payload any) (json.RawMessage, error) {
+	t.Helper()
+	input, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp struct {
+		Ok    bool            `json:"ok"`
+		Data  json.RawMessage `json:"data"`
+		Error string          `json:"error"`
+	}
+	if err = json.Unmarshal(callByName(name, input), &resp); err != nil {
+		t.Fatalf("%s: invalid response: %v", name, err)
+	}
+	if !resp.Ok {
+		return nil, &exportError{resp.Error}
+	}
+	return resp.Data, nil
+}
+
+type exportError struct{ msg string }
+
+func (e *exportError) Error() string { return e.msg }
+
+// newTestClient opens a sqlite container in a temporary directory and returns
+// the handle of a client whose device looks paired as jid. It isn't connected.
+func newTestClient(t *testing.T, jid string) (uint64, *wa.Client) {
+	t.Helper()
+	var cont struct {
+		Handle uint64 `json:"handle"`
+	}
+	address := "file:" + filepath.Join(t.TempDir(), "store.db") + "?_foreign_keys=on"
+	data := callExport(t, "WmOpenContainer", map[string]any{"dialect": "sqlite3", "address": address})
+	if err := json.Unmarshal(data, &cont); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _, _ = tryExport(t, "WmRelease", map[string]any{"handle": cont.Handle}) })
+	containersMu.RLock()
+	container := containers[handle(cont.Handle)]
+	containersMu.RUnlock()
+
+	dev := container.NewDevice()
+	id, err := types.ParseJID(jid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev.ID = &id
+	if err = dev.Save(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	cli := wa.NewClient(dev, nil)
+	h := newHandle()
+	clientsMu.Lock()
+	clients[h] = cli
+	clientsMu.Unlock()
+	t.Cleanup(func() {
+		clientsMu.Lock()
+		delete(clients, h)
+		clientsMu.Unlock()
+	})
+	return uint64(h), cli
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+)
+
+// bridgeDB holds the raw database behind a sqlstore.Container so the bridge can
+// keep its own bookkeeping tables next to the whatsmeow ones. All queries use
+// $n placeholders, which both lib/pq and go-sqlite3 accept.
+type bridgeDB struct {
+	db      *sql.DB
+	dialect string
+}
+
+var (
+	bridgeDBsMu sync.RWMutex
+	bridgeDBs   = map[*sqlstore.Container]*bridgeDB{}
+)
+
+// bridgeSchema is applied after the whatsmeow upgrade whenever a container is opened.
+var bridgeSchema = []string{
+	`CREATE TABLE IF NOT EXISTS wmnode_history_sync (
+		our_jid       TEXT    NOT NULL,
+		sync_type     TEXT    NOT NULL,
+		chunk_order   BIGINT  NOT NULL,
+		progress      BIGINT  NOT NULL DEFAULT 0,
+		conversations BIGINT  NOT NULL DEFAULT 0,
+		messages      BIGINT  NOT NULL DEFAULT 0,
+		delivered_at  BIGINT  NOT NULL,
+		processed_at  BIGINT  NOT NULL DEFAULT 0,
+		PRIMARY KEY (our_jid, sync_type, chunk_order)
+	)`,
+	`CREATE TABLE IF NOT EXISTS wmnode_messages (
+		our_jid      TEXT    NOT NULL,
+		chat         TEXT    NOT NULL,
+		sender       TEXT    NOT NULL,
+		message_id   TEXT    NOT NULL,
+		timestamp    BIGINT  NOT NULL,
+		from_me      BOOLEAN NOT NULL,
+		message_type TEXT    NOT NULL,
+		message      TEXT    NOT NULL,
+		PRIMARY KEY (our_jid, chat, message_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS wmnode_messages_chat_ts_idx ON wmnode_messages (our_jid, chat, timestamp)`,
+	`CREATE TABLE IF NOT EXISTS wmnode_event_journal (
+		our_jid    TEXT   NOT NULL,
+		seq        BIGINT NOT NULL,
+		event_type TEXT   NOT NULL,
+		created_at BIGINT NOT NULL,
+		payload    TEXT   NOT NULL,
+		PRIMARY KEY (our_jid, seq)
+	)`,
+	`CREATE TABLE IF NOT EXISTS wmnode_webhook_queue (
+		our_jid         TEXT   NOT NULL,
+		id              BIGINT NOT NULL,
+		event_type      TEXT   NOT NULL,
+		payload         TEXT   NOT NULL,
+		attempts        BIGINT NOT NULL DEFAULT 0,
+		next_attempt_at BIGINT NOT NULL,
+		last_error      TEXT   NOT NULL DEFAULT '',
+		PRIMARY KEY (our_jid, id)
+	)`,
+	// the last webhook event ID of each account, kept once its row is delivered
+	`CREATE TABLE IF NOT EXISTS wmnode_webhook_seq (
+		our_jid TEXT   PRIMARY KEY,
+		last_id BIGINT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS wmnode_reactions (
+		our_jid    TEXT   NOT NULL,
+		chat       TEXT   NOT NULL,
+		message_id TEXT   NOT NULL,
+		sender     TEXT   NOT NULL,
+		emoji      TEXT   NOT NULL,
+		timestamp  BIGINT NOT NULL,
+		PRIMARY KEY (our_jid, chat, message_id, sender)
+	)`,
+	`CREATE TABLE IF NOT EXISTS wmnode_message_edits (
+		our_jid          TEXT   NOT NULL,
+		chat             TEXT   NOT NULL,
+		message_id       TEXT   NOT NULL,
+		edit_id          TEXT   NOT NULL,
+		timestamp        BIGINT NOT NULL,
+		previous_message TEXT   NOT NULL,
+		PRIMARY KEY (our_jid, chat, message_id, edit_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS wmnode_poll_votes (
+		our_jid   TEXT   NOT NULL,
+		chat      TEXT   NOT NULL,
+		poll_id   TEXT   NOT NULL,
+		voter     TEXT   NOT NULL,
+		options   TEXT   NOT NULL,
+		unknown   TEXT   NOT NULL,
+		timestamp BIGINT NOT NULL,
+		PRIMARY KEY (our_jid, chat, poll_id, voter)
+	)`,
+	`CREATE TABLE IF NOT EXISTS wmnode_newsletter_posts (
+		our_jid    TEXT   NOT NULL,
+		chat       TEXT   NOT NULL,
+		message_id TEXT   NOT NULL,
+		server_id  BIGINT NOT NULL,
+		PRIMARY KEY (our_jid, chat, message_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS wmnode_newsletter_posts_server_idx ON wmnode_newsletter_posts (our_jid, chat, server_id)`,
+	`CREATE TABLE IF NOT EXISTS wmnode_chat_ephemeral (
+		our_jid    TEXT   NOT NULL,
+		chat       TEXT   NOT NULL,
+		timer      BIGINT NOT NULL,
+		setting_ts BIGINT NOT NULL,
+		source     TEXT   NOT NULL,
+		PRIMARY KEY (our_jid, chat)
+	)`,
+	`CREATE TABLE IF NOT EXISTS wmnode_warmup (
+		our_jid    TEXT   PRIMARY KEY,
+		profile    TEXT   NOT NULL,
+		started_at BIGINT NOT NULL,
+		day        BIGINT NOT NULL,
+		sent       BIGINT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS wmnode_identity_quarantine (
+		our_jid TEXT   NOT NULL,
+		jid     TEXT   NOT NULL,
+		since   BIGINT NOT NULL,
+		PRIMARY KEY (our_jid, jid)
+	)`,
+}
+
+func (b *bridgeDB) upgrade(ctx context.Context) error {
+	for _, stmt := range bridgeSchema {
+		if _, err := b.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create bridge tables: %w", err)
+		}
+	}
+	return nil
+}
+
+func registerBridgeDB(cont *sqlstore.Container, db *bridgeDB) {
+	bridgeDBsMu.Lock()
+	bridgeDBs[cont] = db
+	bridgeDBsMu.Unlock()
+}
+
+func unregisterBridgeDB(cont *sqlstore.Container) {
+	bridgeDBsMu.Lock()
+	delete(bridgeDBs, cont)
+	bridgeDBsMu.Unlock()
+}
+
+var errNoBridgeDB = errors.New("container database not available")
+
+// bridgeDBForDevice returns the bookkeeping database of the container the device was loaded from.
+func bridgeDBForDevice(dev *store.Device) (*bridgeDB, error) {
+	cont, ok := dev.Container.(*sqlstore.Container)
+	if !ok || cont == nil {
+		return nil, errNoBridgeDB
+	}
+	bridgeDBsMu.RLock()
+	db := bridgeDBs[cont]
+	bridgeDBsMu.RUnlock()
+	if db == nil {
+		return nil, errNoBridgeDB
+	}
+	return db, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Calls can only be declined: whatsmeow has no media stack, so accepting or
+// terminating an established call isn't something the bridge can offer, and the
+// protocol has no known busy or unavailable signal either. Every decline is sent
+// as whatsmeow's reject stanza; a policy reply is the way to tell the caller more.
+
+// checkCallResponse rejects the busy/unavailable responses older callers may still
+// send, since they would be sent as a plain reject anyway.
+func checkCallResponse(resp string) error {
+	switch resp {
+	case "", "reject":
+		return nil
+	default:
+		return fmt.Errorf("unsupported call response %q, calls can only be rejected", resp)
+	}
+}
+
+//export WmClientRejectCall
+func WmClientRejectCall(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client   uint64 `json:"client"`
+		CallID   string `json:"call_id"`
+		From     string `json:"from"`
+		Response string `json:"response"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if payload.CallID == "" {
+		return fail(errors.New("call_id is required"))
+	}
+	if err := checkCallResponse(payload.Response); err != nil {
+		return fail(err)
+	}
+	from, err := types.ParseJID(payload.From)
+	if err != nil {
+		return fail(err)
+	}
+	if err := cli.RejectCall(from, payload.CallID); err != nil {
+		return fail(err)
+	}
+	return success(map[string]any{})
+}
+
+const (
+	callPolicyNever           = "never"
+	callPolicyAlways          = "always"
+	callPolicyFromNonContacts = "from-non-contacts"
+)
+
+type callPolicy struct {
+	Mode  string `json:"mode"`
+	Reply string `json:"reply"`
+}
+
+// isAddressBookContact reports whether jid is saved in the account's address book,
+// as opposed to only being known through a push name.
+func isAddressBookContact(ctx context.Context, cli *wa.Client, jid types.JID) bool {
+	if jid.Server == types.HiddenUserServer {
+		if pn, err := cli.Store.LIDs.GetPNForLID(ctx, jid); err == nil && !pn.IsEmpty() {
+			jid = pn
+		}
+	}
+	info, err := cli.Store.Contacts.GetContact(ctx, jid.ToNonAD())
+	return err == nil && info.Found && (info.FullName != "" || info.FirstName != "")
+}
+
+func shouldAutoReject(ctx context.Context, cli *wa.Client, policy callPolicy, from types.JID) bool {
+	switch policy.Mode {
+	case callPolicyAlways:
+		return true
+	case callPolicyFromNonContacts:
+		return !isAddressBookContact(ctx, cli, from)
+	default:
+		return false
+	}
+}
+
+func autoRejectCall(cli *wa.Client, meta types.BasicCallMeta) {
+	cfg := configFor(cli)
+	cfg.mu.RLock()
+	policy := cfg.callPolicy
+	cfg.mu.RUnlock()
+	ctx := context.Background()
+	if !shouldAutoReject(ctx, cli, policy, meta.From) {
+		return
+	}
+	out := map[string]any{"type": "call_auto_rejected", "call_id": meta.CallID, "from": meta.From.String(), "policy": policy.Mode, "reply_sent": false}
+	if err := cli.RejectCall(meta.From, meta.CallID); err != nil {
+		out["error"] = err.Error()
+		emitBridgeEvent(cli, out)
+		return
+	}
+	if policy.Reply != "" {
+		if err := throttleSend(ctx, cli, meta.From); err != nil {
+			out["reply_error"] = err.Error()
+			emitBridgeEvent(cli, out)
+			return
+		}
+		_, err := cli.SendMessage(ctx, meta.From.ToNonAD(), &waE2E.Message{Conversation: proto.String(policy.Reply)}, sendExtra(cli, nil, "")...)
+		if err != nil {
+			out["reply_error"] = err.Error()
+		} else {
+			out["reply_sent"] = true
+		}
+	}
+	emitBridgeEvent(cli, out)
+}
+
+//export WmClientSetCallPolicy
+func WmClientSetCallPolicy(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client   uint64 `json:"client"`
+		Response string `json:"response"`
+		callPolicy
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	switch payload.Mode {
+	case "":
+		payload.Mode = callPolicyNever
+	case callPolicyNever, callPolicyAlways, callPolicyFromNonContacts:
+	default:
+		return fail(fmt.Errorf("unknown call policy mode: %s", payload.Mode))
+	}
+	if err := checkCallResponse(payload.Response); err != nil {
+		return fail(err)
+	}
+	cfg := configFor(cli)
+	cfg.mu.Lock()
+	cfg.callPolicy = payload.callPolicy
+	cfg.mu.Unlock()
+	return success(map[string]any{"mode": payload.Mode, "reply": payload.Reply})
+}
@@ -0,0 +1,260 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// whatsmeow has no catalog queries, so WmClientGetCatalog sends the w:biz:catalog
+// IQ the official clients use and flattens the product nodes. Products found
+// that way can be shared with WmClientSendProduct as product messages.
+
+func childText(node waBinary.Node, tag string) string {
+	child, ok := node.GetOptionalChildByTag(tag)
+	if !ok {
+		return ""
+	}
+	content, _ := child.Content.([]byte)
+	return string(content)
+}
+
+// iqError turns an IQ error response into an error.
+func iqError(resp *waBinary.Node) error {
+	if resp.Attrs["type"] != "error" {
+		return nil
+	}
+	errNode, ok := resp.GetOptionalChildByTag("error")
+	if !ok {
+		return errors.New("server returned an error")
+	}
+	return fmt.Errorf("server returned error %v: %v", errNode.Attrs["code"], errNode.Attrs["text"])
+}
+
+func serializeProductNode(node waBinary.Node) map[string]any {
+	product := map[string]any{
+		"id":          childText(node, "id"),
+		"name":        childText(node, "name"),
+		"description": childText(node, "description"),
+		"retailer_id": childText(node, "retailer_id"),
+		"url":         childText(node, "url"),
+		"currency":    childText(node, "currency"),
+		"is_hidden":   node.AttrGetter().OptionalString("is_hidden") == "true",
+	}
+	// prices are in thousandths of the currency unit
+	if price, err := strconv.ParseInt(childText(node, "price"), 10, 64); err == nil {
+		product["price_amount_1000"] = price
+	}
+	if status, ok := node.GetOptionalChildByTag("status_info"); ok {
+		product["review_status"] = childText(status, "status")
+	}
+	images := []map[string]string{}
+	if media, ok := node.GetOptionalChildByTag("media"); ok {
+		for _, img := range media.GetChildrenByTag("image") {
+			images = append(images, map[string]string{
+				"id":           childText(img, "id"),
+				"request_url":  childText(img, "request_image_url"),
+				"original_url": childText(img, "original_image_url"),
+			})
+		}
+	}
+	product["images"] = images
+	return product
+}
+
+//export WmClientGetCatalog
+func WmClientGetCatalog(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		JID    string `json:"jid"`
+		Limit  int    `json:"limit"`
+		// next_cursor of the previous page
+		Cursor    string `json:"cursor"`
+		Width     int    `json:"image_width"`
+		Height    int    `json:"image_height"`
+		TimeoutMs int64  `json:"timeout_ms"`
+		OpID      uint64 `json:"op_id"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := clientForRaw(payload.Client)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	jid, err := types.ParseJID(payload.JID)
+	if err != nil {
+		return fail(err)
+	}
+	if payload.Limit <= 0 {
+		payload.Limit = 10
+	}
+	if payload.Width <= 0 {
+		payload.Width = 100
+	}
+	if payload.Height <= 0 {
+		payload.Height = 100
+	}
+	text := func(tag string, v string) waBinary.Node {
+		return waBinary.Node{Tag: tag, Content: []byte(v)}
+	}
+	query := []waBinary.Node{
+		text("limit", strconv.Itoa(payload.Limit)),
+		text("width", strconv.Itoa(payload.Width)),
+		text("height", strconv.Itoa(payload.Height)),
+	}
+	if payload.Cursor != "" {
+		query = append(query, text("after", payload.Cursor))
+	}
+	id := cli.DangerousInternals().GenerateRequestID()
+	node := waBinary.Node{
+		Tag: "iq",
+		Attrs: waBinary.Attrs{
+			"id":    id,
+			"to":    types.ServerJID,
+			"type":  "get",
+			"xmlns": "w:biz:catalog",
+		},
+		Content: []waBinary.Node{{
+			Tag:     "product_catalog",
+			Attrs:   waBinary.Attrs{"jid": jid.ToNonAD(), "allow_shop_source": "true"},
+			Content: query,
+		}},
+	}
+	resp, err := sendNodeAndWait(cli, node, rawTimeout(payload.TimeoutMs), payload.OpID)
+	if err != nil {
+		return fail(err)
+	}
+	if err = iqError(resp); err != nil {
+		return fail(err)
+	}
+	products := []map[string]any{}
+	out := map[string]any{"jid": jid.ToNonAD().String()}
+	if catalog, ok := resp.GetOptionalChildByTag("product_catalog"); ok {
+		for _, product := range catalog.GetChildrenByTag("product") {
+			products = append(products, serializeProductNode(product))
+		}
+		if paging, ok := catalog.GetOptionalChildByTag("paging"); ok {
+			if after := childText(paging, "after"); after != "" {
+				out["next_cursor"] = after
+			}
+		}
+	}
+	out["products"] = products
+	return success(out)
+}
+
+//export WmClientSendProduct
+func WmClientSendProduct(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		To     string `json:"to"`
+		// the business the product belongs to, ourselves if empty
+		BusinessOwner string `json:"business_owner"`
+		Product       struct {
+			ID              string `json:"id"`
+			Title           string `json:"title"`
+			Description     string `json:"description"`
+			Currency        string `json:"currency"`
+			PriceAmount1000 int64  `json:"price_amount_1000"`
+			SaleAmount1000  int64  `json:"sale_price_amount_1000"`
+			RetailerID      string `json:"retailer_id"`
+			URL             string `json:"url"`
+			ImageCount      uint32 `json:"image_count"`
+			// an uploaded imageMessage in protojson form
+			Image json.RawMessage `json:"image"`
+		} `json:"product"`
+		Catalog *struct {
+			Title       string          `json:"title"`
+			Description string          `json:"description"`
+			Image       json.RawMessage `json:"image"`
+		} `json:"catalog"`
+		Body           string `json:"body"`
+		Footer         string `json:"footer"`
+		IdempotencyKey string `json:"idempotency_key"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	to, err := types.ParseJID(payload.To)
+	if err != nil {
+		return fail(err)
+	}
+	if payload.Product.ID == "" {
+		return fail(errors.New("product.id is required"))
+	}
+	owner := cli.Store.GetJID().ToNonAD()
+	if payload.BusinessOwner != "" {
+		if owner, err = types.ParseJID(payload.BusinessOwner); err != nil {
+			return fail(err)
+		}
+	}
+	p := payload.Product
+	snapshot := &waE2E.ProductMessage_ProductSnapshot{
+		ProductID:         proto.String(p.ID),
+		Title:             proto.String(p.Title),
+		Description:       proto.String(p.Description),
+		CurrencyCode:      proto.String(p.Currency),
+		PriceAmount1000:   proto.Int64(p.PriceAmount1000),
+		RetailerID:        proto.String(p.RetailerID),
+		URL:               proto.String(p.URL),
+		ProductImageCount: proto.Uint32(max(p.ImageCount, 1)),
+	}
+	if p.SaleAmount1000 > 0 {
+		snapshot.SalePriceAmount1000 = proto.Int64(p.SaleAmount1000)
+	}
+	if len(p.Image) > 0 {
+		snapshot.ProductImage = &waE2E.ImageMessage{}
+		if err = protojson.Unmarshal(p.Image, snapshot.ProductImage); err != nil {
+			return fail(fmt.Errorf("invalid product.image: %w", err))
+		}
+	}
+	product := &waE2E.ProductMessage{Product: snapshot, BusinessOwnerJID: proto.String(owner.String())}
+	if payload.Body != "" {
+		product.Body = proto.String(payload.Body)
+	}
+	if payload.Footer != "" {
+		product.Footer = proto.String(payload.Footer)
+	}
+	if c := payload.Catalog; c != nil {
+		product.Catalog = &waE2E.ProductMessage_CatalogSnapshot{Title: proto.String(c.Title), Description: proto.String(c.Description)}
+		if len(c.Image) > 0 {
+			product.Catalog.CatalogImage = &waE2E.ImageMessage{}
+			if err = protojson.Unmarshal(c.Image, product.Catalog.CatalogImage); err != nil {
+				return fail(fmt.Errorf("invalid catalog.image: %w", err))
+			}
+		}
+	}
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	if err := throttleSend(ctx, cli, to); err != nil {
+		return fail(err)
+	}
+	resp, err := cli.SendMessage(ctx, to, &waE2E.Message{ProductMessage: product}, sendExtra(cli, nil, payload.IdempotencyKey)...)
+	if err != nil {
+		return fail(err)
+	}
+	enc, err := encodeReturn(reflect.ValueOf(resp))
+	if err != nil {
+		return fail(err)
+	}
+	return success(enc)
+}
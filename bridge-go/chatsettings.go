@@ -0,0 +1,75 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// WmClientGetChatSettings reads what the app state sync stored about a chat:
+// whether it's muted (and until when), pinned or archived, as the phone shows
+// it. Settings synced under the other form of a user chat (phone number or
+// LID) are found too. found is false for chats the sync never mentioned.
+
+//export WmClientGetChatSettings
+func WmClientGetChatSettings(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		JID    string `json:"jid"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	chat, err := types.ParseJID(payload.JID)
+	if err != nil {
+		return fail(err)
+	}
+	chat = chat.ToNonAD()
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	settings, err := cli.Store.ChatSettings.GetChatSettings(ctx, chat)
+	if err != nil {
+		return fail(err)
+	}
+	if !settings.Found {
+		var other types.JID
+		switch chat.Server {
+		case types.DefaultUserServer:
+			other, _ = cli.Store.LIDs.GetLIDForPN(ctx, chat)
+		case types.HiddenUserServer:
+			other, _ = cli.Store.LIDs.GetPNForLID(ctx, chat)
+		}
+		if !other.IsEmpty() {
+			if settings, err = cli.Store.ChatSettings.GetChatSettings(ctx, other.ToNonAD()); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	out := map[string]any{
+		"chat":          chat.String(),
+		"found":         settings.Found,
+		"muted":         false,
+		"muted_until":   nil,
+		"muted_forever": false,
+		"pinned":        settings.Pinned,
+		"archived":      settings.Archived,
+	}
+	switch until := settings.MutedUntil; {
+	case until.IsZero():
+	case until.Unix() < 0:
+		// the phone sends -1 for "always"
+		out["muted"], out["muted_forever"] = true, true
+	case until.After(time.Now()):
+		out["muted"], out["muted_until"] = true, until.UnixMilli()
+	}
+	return success(out)
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+// Built as a plain binary (go build -o whatsmeow-bridge .) the bridge is a
+// small CLI, so the Go layer can be smoke-tested and scripted without Node:
+//
+//	whatsmeow-bridge call <Function> [json|-]   one export, input from the argument or stdin
+//	whatsmeow-bridge serve                      JSON lines {id, function, input} on stdin,
+//	                                            {id, response} lines on stdout
+//	whatsmeow-bridge login [-phone N]           pair the session (QR codes or a pairing code)
+//	whatsmeow-bridge send -to JID -text T       send a text message
+//	whatsmeow-bridge listen [-include a,b]      print the client's events as JSON lines
+//
+// Everything goes through callByName, the same entry point as WmCallBinary
+// and the REST server. The session commands take -db (a SQLite file) or
+// -dialect and -address for another database.
+
+const cliUsage = `usage: whatsmeow-bridge <command> [flags]
+
+commands:
+  call <Function> [json|-]  call an export and print its response
+  serve                     read {"id","function","input"} lines from stdin
+  login                     link the first device of the database
+  send                      send a text message
+  listen                    print events as JSON lines until interrupted
+`
+
+// main only runs in a plain binary; c-shared builds are driven through the exports.
+func main() {
+	os.Exit(runCLI(os.Args[1:]))
+}
+
+func runCLI(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return 2
+	}
+	var err error
+	switch args[0] {
+	case "call":
+		err = cliCallCommand(args[1:])
+	case "serve":
+		err = cliServe(os.Stdin, os.Stdout)
+	case "login":
+		err = cliLogin(args[1:])
+	case "send":
+		err = cliSend(args[1:])
+	case "listen":
+		err = cliListen(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, cliUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n%s", args[0], cliUsage)
+		return 2
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// cliCall calls an export and decodes the data of a successful response into out.
+func cliCall(name string, input any, out any) error {
+	in, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Ok    bool            `json:"ok"`
+		Data  json.RawMessage `json:"data"`
+		Error string          `json:"error"`
+	}
+	if err = json.Unmarshal(callByName(name, in), &resp); err != nil {
+		return fmt.Errorf("%s: undecodable response: %w", name, err)
+	}
+	if !resp.Ok {
+		return fmt.Errorf("%s: %s", name, resp.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Data, out)
+}
+
+func cliCallCommand(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("usage: call <Function> [json|-]")
+	}
+	input := []byte("{}")
+	if len(args) == 2 && args[1] == "-" {
+		var err error
+		if input, err = io.ReadAll(os.Stdin); err != nil {
+			return err
+		}
+	} else if len(args) == 2 {
+		input = []byte(args[1])
+	}
+	out := callByName(args[0], input)
+	_, err := os.Stdout.Write(append(out, '\n'))
+	return err
+}
+
+func cliServe(r io.Reader, w io.Writer) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxRestBody)
+	enc := json.NewEncoder(w)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var req struct {
+			ID       json.RawMessage `json:"id"`
+			Function string          `json:"function"`
+			Input    json.RawMessage `json:"input"`
+		}
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			if err = enc.Encode(map[string]any{"response": jsonResp{Ok: false, Error: fmt.Sprintf("invalid json: %v", err)}}); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(req.Input) == 0 || string(req.Input) == "null" {
+			req.Input = json.RawMessage("{}")
+		}
+		reply := map[string]any{"id": req.ID}
+		if out := callByName(req.Function, req.Input); json.Valid(out) {
+			reply["response"] = json.RawMessage(out)
+		} else {
+			// compressed by WmSetCompression; []byte is sent as base64
+			reply["response_b64"] = out
+		}
+		if err := enc.Encode(reply); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+type cliSession struct {
+	flags   *flag.FlagSet
+	db      *string
+	dialect *string
+	address *string
+}
+
+func newCLISession(name string) *cliSession {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	return &cliSession{
+		flags:   fs,
+		db:      fs.String("db", "session.db", "SQLite file of the session"),
+		dialect: fs.String("dialect", "sqlite3", "database dialect (sqlite3 or postgres)"),
+		address: fs.String("address", "", "database address; overrides -db"),
+	}
+}
+
+// open returns a client handle for the first device of the database.
+func (s *cliSession) open() (uint64, error) {
+	address := *s.address
+	if address == "" {
+		address = "file:" + *s.db + "?_foreign_keys=on"
+	}
+	var cont, dev, cli struct {
+		Handle uint64 `json:"handle"`
+	}
+	if err := cliCall("WmOpenContainer", map[string]any{"dialect": *s.dialect, "address": address}, &cont); err != nil {
+		return 0, err
+	}
+	if err := cliCall("WmContainerGetFirstDevice", map[string]any{"handle": cont.Handle}, &dev); err != nil {
+		return 0, err
+	}
+	if err := cliCall("WmNewClient", map[string]any{"device": dev.Handle}, &cli); err != nil {
+		return 0, err
+	}
+	return cli.Handle, nil
+}
+
+// connect connects a paired client and waits until it's usable.
+func (s *cliSession) connect(client uint64) error {
+	var has struct {
+		Has bool `json:"has"`
+	}
+	if err := cliCall("WmClientHasStoreID", map[string]any{"client": client}, &has); err != nil {
+		return err
+	}
+	if !has.Has {
+		return errors.New("the session isn't paired, run login first")
+	}
+	if err := cliCall("WmClientConnect", map[string]any{"client": client}, nil); err != nil {
+		return err
+	}
+	var ready struct {
+		Ok bool `json:"ok"`
+	}
+	if err := cliCall("WmClientWaitForConnection", map[string]any{"client": client, "timeoutMs": 30000}, &ready); err != nil {
+		return err
+	}
+	if !ready.Ok {
+		return errors.New("timed out waiting for the connection")
+	}
+	return nil
+}
+
+func printJSON(v any) {
+	b, _ := json.Marshal(v)
+	fmt.Println(string(b))
+}
+
+func cliLogin(args []string) error {
+	s := newCLISession("login")
+	phone := s.flags.String("phone", "", "link with a pairing code for this number instead of a QR code")
+	if err := s.flags.Parse(args); err != nil {
+		return err
+	}
+	client, err := s.open()
+	if err != nil {
+		return err
+	}
+	var has struct {
+		Has bool `json:"has"`
+	}
+	if err = cliCall("WmClientHasStoreID", map[string]any{"client": client}, &has); err != nil {
+		return err
+	}
+	if has.Has {
+		return errors.New("the session is already paired")
+	}
+	var qr struct {
+		Handle uint64 `json:"handle"`
+	}
+	if err = cliCall("WmClientGetQRChannel", map[string]any{"client": client}, &qr); err != nil {
+		return err
+	}
+	if err = cliCall("WmClientConnect", map[string]any{"client": client}, nil); err != nil {
+		return err
+	}
+	paired := false
+	for {
+		var ev map[string]any
+		if err = cliCall("WmQRNext", map[string]any{"handle": qr.Handle, "timeoutMs": 120000}, &ev); err != nil {
+			return err
+		}
+		switch ev["event"] {
+		case "code":
+			if *phone == "" {
+				printJSON(ev)
+			} else if !paired {
+				// PairPhone needs the QR flow to have started
+				var code string
+				input := map[string]any{"client": client, "method": "PairPhone", "args": []any{*phone, true, 1, "Chrome (Linux)"}}
+				if err = cliCall("WmClientCall", input, &code); err != nil {
+					return err
+				}
+				paired = true
+				printJSON(map[string]any{"event": "pairing_code", "code": code})
+			}
+		case "success":
+			printJSON(ev)
+			var ready struct {
+				Ok bool `json:"ok"`
+			}
+			return cliCall("WmClientWaitForConnection", map[string]any{"client": client, "timeoutMs": 30000}, &ready)
+		default:
+			printJSON(ev)
+			return fmt.Errorf("login ended with %v", ev["event"])
+		}
+	}
+}
+
+func cliSend(args []string) error {
+	s := newCLISession("send")
+	to := s.flags.String("to", "", "recipient JID")
+	text := s.flags.String("text", "", "message text")
+	if err := s.flags.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" || *text == "" {
+		return errors.New("-to and -text are required")
+	}
+	client, err := s.open()
+	if err != nil {
+		return err
+	}
+	if err = s.connect(client); err != nil {
+		return err
+	}
+	defer cliCall("WmClientDisconnect", map[string]any{"client": client}, nil)
+	var resp json.RawMessage
+	input := map[string]any{"client": client, "method": "SendMessage", "args": []any{*to, map[string]any{"conversation": *text}}}
+	if err = cliCall("WmClientCall", input, &resp); err != nil {
+		return err
+	}
+	fmt.Println(string(resp))
+	return nil
+}
+
+func cliListen(args []string) error {
+	s := newCLISession("listen")
+	include := s.flags.String("include", "", "comma-separated event types to print")
+	if err := s.flags.Parse(args); err != nil {
+		return err
+	}
+	client, err := s.open()
+	if err != nil {
+		return err
+	}
+	sub := map[string]any{"client": client}
+	if *include != "" {
+		sub["include"] = strings.Split(*include, ",")
+	}
+	var stream struct {
+		Handle uint64 `json:"handle"`
+	}
+	if err = cliCall("WmClientStartEvents", sub, &stream); err != nil {
+		return err
+	}
+	if err = s.connect(client); err != nil {
+		return err
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		_ = cliCall("WmClientDisconnect", map[string]any{"client": client}, nil)
+		_ = cliCall("WmRelease", map[string]any{"handle": stream.Handle}, nil)
+	}()
+	for {
+		var ev json.RawMessage
+		if err = cliCall("WmEventNext", map[string]any{"handle": stream.Handle, "timeoutMs": 0}, &ev); err != nil {
+			return err
+		}
+		if strings.HasPrefix(string(ev), `{"type":"closed"`) {
+			return nil
+		}
+		fmt.Println(string(ev))
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// clientConfig holds bridge-side behaviour configured per client. It is keyed by
+// the *wa.Client so event handlers, which only see the client, can reach it.
+type clientConfig struct {
+	mu sync.RWMutex
+	// held by the offline-only raw Signal exports; connects wait for it (see connectClient)
+	offlineMu sync.Mutex
+
+	label           string
+	connState       string // last connection_state
+	callPolicy      callPolicy
+	archiveMessages bool
+	journal         *eventJournal
+	webhook         *webhookSink
+	autoDownload    *autoDownloader
+	dedupe          *messageDeduper
+	reconnect       *reconnector
+	sendOpts        *sendDefaults
+	preKeyWatermark int
+	mediaSlots      *mediaSlots
+	recovery        *messageRecovery
+	phoneRerequest  *bool // whatsmeow's own re-request setting while auto recovery replaces it
+	retries         *retryStats
+	health          *clientHealth
+	idle            *idleWatcher
+	warmup          *warmupState
+	locale          *clientLocale
+	identity        *identityGuard
+	deadline        time.Duration // default operation deadline
+}
+
+var (
+	clientConfigsMu sync.Mutex
+	clientConfigs   = map[*wa.Client]*clientConfig{}
+)
+
+func configFor(cli *wa.Client) *clientConfig {
+	clientConfigsMu.Lock()
+	defer clientConfigsMu.Unlock()
+	cfg := clientConfigs[cli]
+	if cfg == nil {
+		cfg = &clientConfig{}
+		clientConfigs[cli] = cfg
+	}
+	return cfg
+}
+
+func dropClientConfig(cli *wa.Client) {
+	clientConfigsMu.Lock()
+	delete(clientConfigs, cli)
+	clientConfigsMu.Unlock()
+}
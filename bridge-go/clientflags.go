@@ -0,0 +1,70 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// clientFlagFields maps the boolean whatsmeow client options settable from Node
+// to their fields. Unknown names are rejected so typos don't pass silently.
+//
+// synchronous_ack: the server ack of a message is only sent after every event
+// handler returned. The bridge handler writes the event journal and webhook
+// queue before returning, so with it on, an acked message is always persisted.
+// enable_decrypted_event_buffer: decrypted messages are buffered in the store
+// until handled, so a crash between decrypting and handling doesn't lose them.
+// auto_trust_identity: on by default in whatsmeow. When off, a contact whose
+// identity key changed isn't re-trusted silently: an identity_change event is
+// emitted and their messages fail to decrypt until the identity is trusted.
+// emit_app_state_events_on_full_sync: off by default, the contact, mute,
+// archive, pin... events of the initial full app state sync are skipped (the
+// state still lands in the store); on, every entry is emitted as an event.
+// error_on_subscribe_presence_without_token: subscribing to the presence of a
+// contact whose privacy token we don't have (usually someone who never messaged
+// us) is attempted anyway by default, and the server may silently ignore it.
+// On, it fails with a "no privacy token" error instead.
+func clientFlagFields(cli *wa.Client) map[string]*bool {
+	return map[string]*bool{
+		"synchronous_ack":                           &cli.SynchronousAck,
+		"enable_decrypted_event_buffer":             &cli.EnableDecryptedEventBuffer,
+		"auto_trust_identity":                       &cli.AutoTrustIdentity,
+		"emit_app_state_events_on_full_sync":        &cli.EmitAppStateEventsOnFullSync,
+		"error_on_subscribe_presence_without_token": &cli.ErrorOnSubscribePresenceWithoutToken,
+	}
+}
+
+//export WmClientSetFlags
+func WmClientSetFlags(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64          `json:"client"`
+		Flags  map[string]bool `json:"flags"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	fields := clientFlagFields(cli)
+	for name := range payload.Flags {
+		if _, ok := fields[name]; !ok {
+			return fail(fmt.Errorf("unknown client flag %q (known: %v)", name, slices.Sorted(maps.Keys(fields))))
+		}
+	}
+	for name, value := range payload.Flags {
+		*fields[name] = value
+	}
+	out := make(map[string]bool, len(fields))
+	for name, field := range fields {
+		out[name] = *field
+	}
+	return success(out)
+}
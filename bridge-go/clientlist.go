@@ -0,0 +1,87 @@
+package main
+
+import "C"
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// A service running many accounts keeps its own table of client handles, which
+// can drift from the bridge after a partial failure (a crash between
+// WmNewClient and saving the handle, a release that never got acknowledged).
+// Clients can carry a label given to WmNewClient, typically the service's own
+// account ID, and WmListClients lists every client with its label, JID, login
+// and connection state so the two tables can be reconciled.
+
+func (cfg *clientConfig) clientLabel() string {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.label
+}
+
+// connectionState returns the last connection_state of cli, corrected for
+// disconnects that don't emit one (Disconnect and logouts).
+func connectionState(cli *wa.Client) string {
+	cfg := configFor(cli)
+	cfg.mu.RLock()
+	state := cfg.connState
+	cfg.mu.RUnlock()
+	if cli.IsConnected() {
+		return "connected"
+	}
+	if state == "" || state == "connected" {
+		return "disconnected"
+	}
+	return state
+}
+
+//export WmListClients
+func WmListClients(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		// only clients with this label
+		Label string `json:"label"`
+	}
+	if s := C.GoString(input); s != "" {
+		if err := json.Unmarshal([]byte(s), &payload); err != nil {
+			return fail(fmt.Errorf("invalid json: %w", err))
+		}
+	}
+	type clientInfo struct {
+		Handle          uint64 `json:"handle"`
+		Label           string `json:"label"`
+		JID             string `json:"jid,omitempty"`
+		LoggedIn        bool   `json:"logged_in"`
+		Connected       bool   `json:"connected"`
+		ConnectionState string `json:"connection_state"`
+	}
+	clientsMu.RLock()
+	handles := make(map[handle]*wa.Client, len(clients))
+	for h, cli := range clients {
+		handles[h] = cli
+	}
+	clientsMu.RUnlock()
+	list := []clientInfo{}
+	for h, cli := range handles {
+		info := clientInfo{
+			Handle:          uint64(h),
+			Label:           configFor(cli).clientLabel(),
+			LoggedIn:        cli.IsLoggedIn(),
+			Connected:       cli.IsConnected(),
+			ConnectionState: connectionState(cli),
+		}
+		if payload.Label != "" && info.Label != payload.Label {
+			continue
+		}
+		if jid := cli.Store.GetJID(); !jid.IsEmpty() {
+			info.JID = jid.String()
+		}
+		list = append(list, info)
+	}
+	slices.SortFunc(list, func(a, b clientInfo) int { return cmp.Compare(a.Handle, b.Handle) })
+	return success(map[string]any{"clients": list})
+}
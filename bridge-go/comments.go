@@ -0,0 +1,212 @@
+package main
+
+import "C"
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Comments are messages pointing at a parent post: plain commentMessages on
+// channels, encCommentMessages (encrypted with the parent's message secret,
+// which whatsmeow decrypts with DecryptComment) in community announcement
+// groups. Incoming ones get a "comment" object on their message event with the
+// parent's ID and, for channel posts the bridge has seen, its server ID;
+// posts are mapped in wmnode_newsletter_posts as their message events arrive.
+// WmClientSendComment sends one the same way.
+
+// recordNewsletterPost remembers the server ID of a channel post.
+func recordNewsletterPost(cli *wa.Client, evt *events.Message) {
+	if evt.Info.Chat.Server != types.NewsletterServer || evt.Info.ServerID == 0 {
+		return
+	}
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return
+	}
+	_, err = db.db.ExecContext(context.Background(), `
+		INSERT INTO wmnode_newsletter_posts (our_jid, chat, message_id, server_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (our_jid, chat, message_id) DO UPDATE SET server_id=excluded.server_id
+	`, cli.Store.GetJID().ToNonAD().String(), evt.Info.Chat.String(), string(evt.Info.ID), int64(evt.Info.ServerID))
+	if err != nil {
+		cli.Log.Warnf("Failed to record server ID of channel post %s: %v", evt.Info.ID, err)
+	}
+}
+
+// newsletterPostServerID returns the server ID of a channel post, or 0 when unknown.
+func newsletterPostServerID(ctx context.Context, cli *wa.Client, chat types.JID, id types.MessageID) (types.MessageServerID, error) {
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return 0, err
+	}
+	var serverID int64
+	err = db.db.QueryRowContext(ctx, `SELECT server_id FROM wmnode_newsletter_posts WHERE our_jid=$1 AND chat=$2 AND message_id=$3`,
+		cli.Store.GetJID().ToNonAD().String(), chat.String(), string(id)).Scan(&serverID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return types.MessageServerID(serverID), err
+}
+
+// newsletterPostID is the reverse of newsletterPostServerID.
+func newsletterPostID(ctx context.Context, cli *wa.Client, chat types.JID, serverID types.MessageServerID) (types.MessageID, error) {
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return "", err
+	}
+	var id string
+	err = db.db.QueryRowContext(ctx, `SELECT message_id FROM wmnode_newsletter_posts WHERE our_jid=$1 AND chat=$2 AND server_id=$3`,
+		cli.Store.GetJID().ToNonAD().String(), chat.String(), int64(serverID)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return types.MessageID(id), err
+}
+
+// linkComment returns the fields to attach to the message event of a comment,
+// or nil if evt isn't one.
+func linkComment(cli *wa.Client, evt *events.Message) map[string]any {
+	var key *waCommon.MessageKey
+	var body *waE2E.Message
+	comment := map[string]any{}
+	switch {
+	case evt.Message.GetCommentMessage() != nil:
+		key = evt.Message.GetCommentMessage().GetTargetMessageKey()
+		body = evt.Message.GetCommentMessage().GetMessage()
+		comment["encrypted"] = false
+	case evt.Message.GetEncCommentMessage() != nil:
+		key = evt.Message.GetEncCommentMessage().GetTargetMessageKey()
+		comment["encrypted"] = true
+		var err error
+		if body, err = cli.DecryptComment(context.Background(), evt); err != nil {
+			cli.Log.Warnf("Failed to decrypt comment %s: %v", evt.Info.ID, err)
+			comment["error"] = err.Error()
+		}
+	default:
+		return nil
+	}
+	parentChat := evt.Info.Chat
+	if key.GetRemoteJID() != "" {
+		if jid, err := types.ParseJID(key.GetRemoteJID()); err == nil {
+			parentChat = jid
+		}
+	}
+	parentID := types.MessageID(key.GetID())
+	comment["parent_id"] = string(parentID)
+	comment["parent_chat"] = parentChat.String()
+	if key.GetParticipant() != "" {
+		comment["parent_sender"] = key.GetParticipant()
+	}
+	if body != nil {
+		comment["message"] = protoJSON(body)
+	}
+	if parentChat.Server == types.NewsletterServer {
+		serverID, err := newsletterPostServerID(context.Background(), cli, parentChat, parentID)
+		if err != nil && !errors.Is(err, errNoBridgeDB) {
+			cli.Log.Warnf("Failed to look up channel post %s: %v", parentID, err)
+		} else if serverID != 0 {
+			comment["parent_server_id"] = int(serverID)
+		}
+	}
+	return map[string]any{"comment": comment}
+}
+
+//export WmClientSendComment
+func WmClientSendComment(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		Chat   string `json:"chat"`
+		// the parent post, by message ID or (channels) by server ID
+		ParentID       string `json:"parent_id"`
+		ParentServerID int64  `json:"parent_server_id"`
+		ParentSender   string `json:"parent_sender"`
+		ParentFromMe   bool   `json:"parent_from_me"`
+		// the comment, as text or a protojson message
+		Text           string          `json:"text"`
+		Message        json.RawMessage `json:"message"`
+		IdempotencyKey string          `json:"idempotency_key"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	chat, err := types.ParseJID(payload.Chat)
+	if err != nil {
+		return fail(err)
+	}
+	body := &waE2E.Message{}
+	switch {
+	case len(payload.Message) > 0:
+		if err = protojson.Unmarshal(payload.Message, body); err != nil {
+			return fail(fmt.Errorf("invalid message: %w", err))
+		}
+	case payload.Text != "":
+		body.Conversation = proto.String(payload.Text)
+	default:
+		return fail(errors.New("text or message is required"))
+	}
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	parentID := types.MessageID(payload.ParentID)
+	if parentID == "" && payload.ParentServerID != 0 {
+		if parentID, err = newsletterPostID(ctx, cli, chat, types.MessageServerID(payload.ParentServerID)); err != nil {
+			return fail(err)
+		} else if parentID == "" {
+			return fail(errors.New("unknown parent_server_id, pass parent_id instead"))
+		}
+	}
+	if parentID == "" {
+		return fail(errors.New("parent_id is required"))
+	}
+	var msg *waE2E.Message
+	if chat.Server == types.NewsletterServer {
+		// channel posts are plaintext, so are their comments
+		msg = &waE2E.Message{CommentMessage: &waE2E.CommentMessage{
+			Message:          body,
+			TargetMessageKey: &waCommon.MessageKey{RemoteJID: proto.String(chat.String()), FromMe: proto.Bool(payload.ParentFromMe), ID: proto.String(string(parentID))},
+		}}
+	} else {
+		parent := &types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, IsFromMe: payload.ParentFromMe, IsGroup: chat.Server == types.GroupServer},
+			ID:            parentID,
+		}
+		if payload.ParentFromMe {
+			parent.Sender = cli.Store.GetJID().ToNonAD()
+		} else if parent.Sender, err = types.ParseJID(payload.ParentSender); err != nil || payload.ParentSender == "" {
+			return fail(errors.New("parent_sender is required for comments outside channels"))
+		}
+		if msg, err = cli.EncryptComment(ctx, parent, body); err != nil {
+			return fail(err)
+		}
+	}
+	if err := throttleSend(ctx, cli, chat); err != nil {
+		return fail(err)
+	}
+	resp, err := cli.SendMessage(ctx, chat, msg, sendExtra(cli, nil, payload.IdempotencyKey)...)
+	if err != nil {
+		return fail(err)
+	}
+	enc, err := encodeReturn(reflect.ValueOf(resp))
+	if err != nil {
+		return fail(err)
+	}
+	return success(enc)
+}
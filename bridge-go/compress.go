@@ -0,0 +1,89 @@
+package main
+
+import "C"
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Large responses (history syncs, big group infos) can be compressed once the
+// caller opted in with WmSetCompression. Through the C string exports a
+// compressed response is {"ok": true, "encoding": "gzip"|"zstd", "payload":
+// base64}, holding the compressed form of the normal response. WmCallBinary
+// returns the compressed bytes directly; they're told apart from JSON by the
+// gzip/zstd magic bytes. Errors are never compressed.
+
+type compressionConfig struct {
+	Algorithm string `json:"algorithm"` // "gzip", "zstd" or "none"
+	Threshold int    `json:"threshold_bytes"`
+}
+
+var compression atomic.Pointer[compressionConfig]
+
+var zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+
+// compressResponse returns the compressed form of an encoded response, or
+// nil if compression is off or the response is below the threshold.
+func compressResponse(b []byte) ([]byte, string) {
+	cfg := compression.Load()
+	if cfg == nil || len(b) < cfg.Threshold {
+		return nil, ""
+	}
+	switch cfg.Algorithm {
+	case "gzip":
+		var buf bytes.Buffer
+		zw, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+		_, _ = zw.Write(b)
+		_ = zw.Close()
+		return buf.Bytes(), "gzip"
+	case "zstd":
+		return zstdEncoder.EncodeAll(b, make([]byte, 0, len(b)/4)), "zstd"
+	}
+	return nil, ""
+}
+
+// compressedEnvelope wraps a large response for the C string exports.
+func compressedEnvelope(b []byte) []byte {
+	packed, encoding := compressResponse(b)
+	if packed == nil {
+		return b
+	}
+	env, _ := json.Marshal(map[string]any{
+		"ok":       true,
+		"encoding": encoding,
+		"payload":  base64.StdEncoding.EncodeToString(packed),
+	})
+	return env
+}
+
+//export WmSetCompression
+func WmSetCompression(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var cfg compressionConfig
+	if err := json.Unmarshal([]byte(C.GoString(input)), &cfg); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	switch cfg.Algorithm {
+	case "", "none":
+		compression.Store(nil)
+		return success(map[string]any{"algorithm": "none"})
+	case "gzip", "zstd":
+	default:
+		return fail(fmt.Errorf("unknown compression algorithm %q", cfg.Algorithm))
+	}
+	if cfg.Threshold < 0 {
+		return fail(errors.New("threshold_bytes must not be negative"))
+	}
+	if cfg.Threshold == 0 {
+		cfg.Threshold = 64 * 1024
+	}
+	compression.Store(&cfg)
+	return success(cfg)
+}
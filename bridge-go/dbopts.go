@@ -0,0 +1,131 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// Driver, pool and SQLite settings accepted by WmOpenContainer. SQLite pragmas
+// are set through go-sqlite3 DSN parameters rather than PRAGMA statements, so
+// every connection of the pool gets them, not just the first one.
+
+type poolOptions struct {
+	MaxOpenConns      int   `json:"max_open_conns"`
+	MaxIdleConns      int   `json:"max_idle_conns"`
+	ConnMaxLifetimeMs int64 `json:"conn_max_lifetime_ms"`
+	ConnMaxIdleTimeMs int64 `json:"conn_max_idle_time_ms"`
+}
+
+func (p *poolOptions) apply(db *sql.DB) {
+	if p == nil {
+		return
+	}
+	if p.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(p.MaxOpenConns)
+	}
+	if p.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	if p.ConnMaxLifetimeMs > 0 {
+		db.SetConnMaxLifetime(time.Duration(p.ConnMaxLifetimeMs) * time.Millisecond)
+	}
+	if p.ConnMaxIdleTimeMs > 0 {
+		db.SetConnMaxIdleTime(time.Duration(p.ConnMaxIdleTimeMs) * time.Millisecond)
+	}
+}
+
+type sqliteOptions struct {
+	JournalMode   string `json:"journal_mode"`
+	BusyTimeoutMs int    `json:"busy_timeout_ms"`
+	ForeignKeys   *bool  `json:"foreign_keys"`
+	Synchronous   string `json:"synchronous"`
+}
+
+// sqliteDSN adds the pragmas in opts to address, replacing any the address already sets.
+func sqliteDSN(address string, opts *sqliteOptions) (string, error) {
+	if opts == nil {
+		return address, nil
+	}
+	base, rawQuery, _ := strings.Cut(address, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", fmt.Errorf("invalid sqlite address parameters: %w", err)
+	}
+	if opts.JournalMode != "" {
+		mode := strings.ToUpper(opts.JournalMode)
+		if !slices.Contains([]string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}, mode) {
+			return "", fmt.Errorf("unknown journal_mode: %s", opts.JournalMode)
+		}
+		query.Set("_journal_mode", mode)
+	}
+	if opts.BusyTimeoutMs > 0 {
+		query.Set("_busy_timeout", strconv.Itoa(opts.BusyTimeoutMs))
+	}
+	if opts.ForeignKeys != nil {
+		query.Set("_foreign_keys", strconv.FormatBool(*opts.ForeignKeys))
+	}
+	if opts.Synchronous != "" {
+		sync := strings.ToUpper(opts.Synchronous)
+		if !slices.Contains([]string{"OFF", "NORMAL", "FULL", "EXTRA"}, sync) {
+			return "", fmt.Errorf("unknown synchronous mode: %s", opts.Synchronous)
+		}
+		query.Set("_synchronous", sync)
+	}
+	if len(query) == 0 {
+		return base, nil
+	}
+	return base + "?" + query.Encode(), nil
+}
+
+// sqlDriverFor picks the database/sql driver for a dialect. The dialect tells
+// sqlstore which SQL flavour to speak, the driver is how the bridge connects:
+// postgres can go through lib/pq ("postgres", the default) or pgx ("pgx").
+func sqlDriverFor(dialect, driver string) (string, error) {
+	if driver == "" {
+		return dialect, nil
+	}
+	if !slices.Contains(sql.Drivers(), driver) {
+		return "", fmt.Errorf("sql driver %q is not available (have %v)", driver, sql.Drivers())
+	}
+	postgresDriver := driver == "postgres" || driver == "pgx"
+	if postgresDriver != (dialect == "postgres") {
+		return "", fmt.Errorf("sql driver %q can't be used with the %s dialect", driver, dialect)
+	}
+	return driver, nil
+}
+
+// withDriverOptions appends driver specific connection parameters to address:
+// as URL query parameters for URL-style addresses and sqlite, or as
+// space-separated key=value pairs for keyword/value postgres connection strings.
+func withDriverOptions(dialect, address string, opts map[string]string) (string, error) {
+	if len(opts) == 0 {
+		return address, nil
+	}
+	keys := slices.Sorted(maps.Keys(opts))
+	if dialect == "postgres" && !strings.Contains(address, "://") {
+		var sb strings.Builder
+		sb.WriteString(address)
+		for _, k := range keys {
+			v := strings.ReplaceAll(strings.ReplaceAll(opts[k], `\`, `\\`), `'`, `\'`)
+			fmt.Fprintf(&sb, " %s='%s'", k, v)
+		}
+		return strings.TrimSpace(sb.String()), nil
+	}
+	base, rawQuery, _ := strings.Cut(address, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", fmt.Errorf("invalid address parameters: %w", err)
+	}
+	for _, k := range keys {
+		query.Set(k, opts[k])
+	}
+	return base + "?" + query.Encode(), nil
+}
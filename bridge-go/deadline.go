@@ -0,0 +1,69 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// Most whatsmeow calls wait for a server response with no deadline of their
+// own, so a wedged connection can keep a Node promise pending forever.
+// WmClientSetDefaultDeadline gives a client a deadline applied to the context
+// of every WmClientCall (whatever op_id says, a cancel still works earlier), of
+// uploads and downloads, and of the bridge's own send and query helpers. The
+// few whatsmeow methods that take no context aren't covered. Calls whose
+// context already has a deadline keep it.
+
+func (cfg *clientConfig) defaultDeadline() time.Duration {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.deadline
+}
+
+// withClientDeadline bounds ctx by the default deadline of cli, if any.
+func withClientDeadline(ctx context.Context, cli *wa.Client) (context.Context, context.CancelFunc) {
+	d := configFor(cli).defaultDeadline()
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// clientContext is the context of a bridge helper acting on cli.
+func clientContext(cli *wa.Client) (context.Context, context.CancelFunc) {
+	return withClientDeadline(context.Background(), cli)
+}
+
+//export WmClientSetDefaultDeadline
+func WmClientSetDefaultDeadline(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	// 0 removes the deadline
+	var payload struct {
+		Client    uint64 `json:"client"`
+		TimeoutMs int64  `json:"timeout_ms"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if payload.TimeoutMs < 0 {
+		return fail(errors.New("timeout_ms must not be negative"))
+	}
+	cfg := configFor(cli)
+	cfg.mu.Lock()
+	cfg.deadline = time.Duration(payload.TimeoutMs) * time.Millisecond
+	cfg.mu.Unlock()
+	return success(map[string]any{"timeout_ms": payload.TimeoutMs})
+}
@@ -0,0 +1,70 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// Some whatsmeow callbacks expect an answer synchronously. Node can't be called
+// from Go, so the question is emitted as an event carrying a decision_id and the
+// callback waits until WmResolveDecision answers it, or falls back to a default
+// after a timeout so a missing consumer can't stall the client.
+
+var (
+	decisionsMu    sync.Mutex
+	decisions      = map[uint64]chan bool{}
+	nextDecisionID atomic.Uint64
+)
+
+func awaitDecision(cli *wa.Client, ev map[string]any, timeout time.Duration, fallback bool) bool {
+	id := nextDecisionID.Add(1)
+	ch := make(chan bool, 1)
+	decisionsMu.Lock()
+	decisions[id] = ch
+	decisionsMu.Unlock()
+	defer func() {
+		decisionsMu.Lock()
+		delete(decisions, id)
+		decisionsMu.Unlock()
+	}()
+	ev["decision_id"] = id
+	emitBridgeEvent(cli, ev)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case allow := <-ch:
+		return allow
+	case <-timer.C:
+		return fallback
+	}
+}
+
+//export WmResolveDecision
+func WmResolveDecision(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		DecisionID uint64 `json:"decision_id"`
+		Allow      bool   `json:"allow"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	decisionsMu.Lock()
+	ch := decisions[payload.DecisionID]
+	decisionsMu.Unlock()
+	if ch == nil {
+		return fail(errors.New("decision not pending (already answered or timed out)"))
+	}
+	select {
+	case ch <- payload.Allow:
+	default:
+	}
+	return success(map[string]any{})
+}
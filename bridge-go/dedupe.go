@@ -0,0 +1,107 @@
+package main
+
+import "C"
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// messageDeduper remembers the last few thousand (chat, sender, id) triples so
+// messages redelivered by retries or offline sync can be dropped or flagged.
+type messageDeduper struct {
+	mu       sync.Mutex
+	limit    int
+	annotate bool
+	order    *list.List // of *dedupeEntry, most recent first
+	seen     map[dedupeKey]*list.Element
+}
+
+type dedupeKey struct {
+	chat   types.JID
+	sender types.JID
+	id     types.MessageID
+}
+
+type dedupeEntry struct {
+	key   dedupeKey
+	count int
+}
+
+// check records a delivery and returns how many times the message was seen before.
+func (d *messageDeduper) check(key dedupeKey) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if el, ok := d.seen[key]; ok {
+		entry := el.Value.(*dedupeEntry)
+		entry.count++
+		d.order.MoveToFront(el)
+		return entry.count - 1
+	}
+	d.seen[key] = d.order.PushFront(&dedupeEntry{key: key, count: 1})
+	for d.order.Len() > d.limit {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.seen, oldest.Value.(*dedupeEntry).key)
+	}
+	return 0
+}
+
+// checkDuplicate returns how often evt was delivered before, and whether it should be dropped.
+func checkDuplicate(cli *wa.Client, evt *events.Message) (int, bool) {
+	cfg := configFor(cli)
+	cfg.mu.RLock()
+	d := cfg.dedupe
+	cfg.mu.RUnlock()
+	if d == nil {
+		return 0, false
+	}
+	seen := d.check(dedupeKey{chat: evt.Info.Chat.ToNonAD(), sender: evt.Info.Sender.ToNonAD(), id: evt.Info.ID})
+	return seen, seen > 0 && !d.annotate
+}
+
+//export WmClientSetDedupe
+func WmClientSetDedupe(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client  uint64 `json:"client"`
+		Enabled bool   `json:"enabled"`
+		Window  int    `json:"window"`
+		// Mode is "drop" (default) to suppress repeats or "annotate" to deliver them with was_duplicate set.
+		Mode string `json:"mode"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	var d *messageDeduper
+	if payload.Enabled {
+		if payload.Mode == "" {
+			payload.Mode = "drop"
+		}
+		if payload.Mode != "drop" && payload.Mode != "annotate" {
+			return fail(fmt.Errorf("unknown dedupe mode %q", payload.Mode))
+		}
+		if payload.Window <= 0 {
+			payload.Window = 10000
+		}
+		d = &messageDeduper{limit: payload.Window, annotate: payload.Mode == "annotate", order: list.New(), seen: map[dedupeKey]*list.Element{}}
+	}
+	cfg := configFor(cli)
+	cfg.mu.Lock()
+	cfg.dedupe = d
+	cfg.mu.Unlock()
+	if d == nil {
+		return success(map[string]any{"enabled": false})
+	}
+	return success(map[string]any{"enabled": true, "window": payload.Window, "mode": payload.Mode})
+}
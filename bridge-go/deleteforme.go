@@ -0,0 +1,128 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/proto/waSyncAction"
+	"go.mau.fi/whatsmeow/types"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Deleting a message for me (unlike revoking it for everyone) only removes our
+// copy, synced to the phone and our other devices through the regular_high
+// app state collection. whatsmeow parses these mutations into DeleteForMe events
+// but has no builder for them, so WmClientDeleteMessageForMe sends the patch
+// itself. Deleted messages also leave the bridge's message archive, whichever
+// device deleted them.
+
+// forgetArchivedMessage removes a message deleted for us from the archive.
+func forgetArchivedMessage(cli *wa.Client, chat types.JID, id string) {
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return
+	}
+	_, err = db.db.ExecContext(context.Background(), `DELETE FROM wmnode_messages WHERE our_jid=$1 AND chat=$2 AND message_id=$3`,
+		cli.Store.GetJID().ToNonAD().String(), chat.String(), id)
+	if err != nil {
+		cli.Log.Warnf("Failed to delete message %s from archive: %v", id, err)
+	}
+}
+
+// buildDeleteForMe builds the app state patch deleting one message for us. The
+// index is the message key: chat, ID, from me, and the sender in groups.
+func buildDeleteForMe(chat, sender types.JID, id types.MessageID, fromMe bool, messageTS time.Time, deleteMedia bool) appstate.PatchInfo {
+	fromMeFlag, participant := "0", "0"
+	if fromMe {
+		fromMeFlag = "1"
+	} else if chat.Server == types.GroupServer || chat.Server == types.BroadcastServer {
+		participant = sender.ToNonAD().String()
+	}
+	return appstate.PatchInfo{
+		Type: appstate.WAPatchRegularHigh,
+		Mutations: []appstate.MutationInfo{{
+			Index:   []string{appstate.IndexDeleteMessageForMe, chat.String(), string(id), fromMeFlag, participant},
+			Version: 3,
+			Value: &waSyncAction.SyncActionValue{
+				DeleteMessageForMeAction: &waSyncAction.DeleteMessageForMeAction{
+					DeleteMedia:      proto.Bool(deleteMedia),
+					MessageTimestamp: proto.Int64(messageTS.Unix()),
+				},
+			},
+		}},
+	}
+}
+
+//export WmClientDeleteMessageForMe
+func WmClientDeleteMessageForMe(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		Chat   string `json:"chat"`
+		// required for messages of others in groups
+		Sender string `json:"sender"`
+		ID     string `json:"id"`
+		FromMe bool   `json:"from_me"`
+		// unix seconds of the message; looked up in the archive when missing
+		Timestamp   int64 `json:"timestamp"`
+		DeleteMedia bool  `json:"delete_media"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	chat, err := types.ParseJID(payload.Chat)
+	if err != nil {
+		return fail(err)
+	}
+	if payload.ID == "" {
+		return fail(errors.New("id is required"))
+	}
+	var sender types.JID
+	if payload.Sender != "" {
+		if sender, err = types.ParseJID(payload.Sender); err != nil {
+			return fail(err)
+		}
+	}
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	messageTS := time.Unix(payload.Timestamp, 0)
+	if payload.Timestamp == 0 || (sender.IsEmpty() && !payload.FromMe) {
+		archived, err := getArchivedMessage(ctx, cli, chat, types.MessageID(payload.ID))
+		if err != nil && !errors.Is(err, errNoBridgeDB) {
+			return fail(err)
+		}
+		if archived == nil && payload.Timestamp == 0 {
+			return fail(errors.New("message not in the archive, timestamp is required"))
+		}
+		if archived != nil {
+			if payload.Timestamp == 0 {
+				messageTS = archived.Timestamp
+			}
+			if sender.IsEmpty() && !payload.FromMe {
+				sender, payload.FromMe = archived.Sender, archived.FromMe
+			}
+		}
+	}
+	isGroup := chat.Server == types.GroupServer || chat.Server == types.BroadcastServer
+	if isGroup && !payload.FromMe && sender.IsEmpty() {
+		return fail(errors.New("sender is required for messages of others in groups"))
+	}
+	patch := buildDeleteForMe(chat, sender, types.MessageID(payload.ID), payload.FromMe, messageTS, payload.DeleteMedia)
+	if err = cli.SendAppState(ctx, patch); err != nil {
+		return fail(err)
+	}
+	forgetArchivedMessage(cli, chat, payload.ID)
+	return success(map[string]any{"chat": chat.String(), "id": payload.ID})
+}
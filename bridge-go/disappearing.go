@@ -0,0 +1,174 @@
+package main
+
+import "C"
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// whatsmeow keeps no disappearing-message state for private chats, so the
+// bridge tracks it in wmnode_chat_ephemeral from what passes by: ephemeral
+// setting messages, the expiration of incoming disappearing messages, group
+// info changes, history sync conversations and SetDisappearingTimer calls made
+// through WmClientCall. WmClientGetDisappearingTimer reads it back; for groups
+// it asks the server unless a recorded value is good enough.
+
+// recordDisappearingTimer stores the timer of a chat unless a newer setting is known.
+func recordDisappearingTimer(cli *wa.Client, chat types.JID, timer uint32, settingTS time.Time, source string) {
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil || chat.IsEmpty() {
+		return
+	}
+	_, err = db.db.ExecContext(context.Background(), `
+		INSERT INTO wmnode_chat_ephemeral (our_jid, chat, timer, setting_ts, source)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (our_jid, chat) DO UPDATE SET timer=excluded.timer, setting_ts=excluded.setting_ts, source=excluded.source
+		WHERE excluded.setting_ts >= wmnode_chat_ephemeral.setting_ts
+	`, cli.Store.GetJID().ToNonAD().String(), chat.ToNonAD().String(), int64(timer), settingTS.Unix(), source)
+	if err != nil {
+		cli.Log.Warnf("Failed to record disappearing timer of %s: %v", chat, err)
+	}
+}
+
+// contextInfoOf returns the contextInfo of the content of msg, if it has one.
+func contextInfoOf(msg *waE2E.Message) *waE2E.ContextInfo {
+	var found *waE2E.ContextInfo
+	msg.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return true
+		}
+		inner := v.Message()
+		field := inner.Descriptor().Fields().ByName("contextInfo")
+		if field == nil || !inner.Has(field) {
+			return true
+		}
+		found, _ = inner.Get(field).Message().Interface().(*waE2E.ContextInfo)
+		return found == nil
+	})
+	return found
+}
+
+func trackDisappearingTimer(cli *wa.Client, raw any) {
+	switch evt := raw.(type) {
+	case *events.Message:
+		if pm := evt.Message.GetProtocolMessage(); pm.GetType() == waE2E.ProtocolMessage_EPHEMERAL_SETTING {
+			recordDisappearingTimer(cli, evt.Info.Chat, pm.GetEphemeralExpiration(), evt.Info.Timestamp, "setting_message")
+		} else if evt.IsEphemeral && evt.Info.Chat.Server != types.GroupServer {
+			// the setting time isn't known, so any real setting wins over this
+			if ctx := contextInfoOf(evt.Message); ctx.GetExpiration() > 0 {
+				recordDisappearingTimer(cli, evt.Info.Chat, ctx.GetExpiration(), time.Unix(ctx.GetEphemeralSettingTimestamp(), 0), "message")
+			}
+		}
+	case *events.GroupInfo:
+		if evt.Ephemeral != nil {
+			timer := evt.Ephemeral.DisappearingTimer
+			if !evt.Ephemeral.IsEphemeral {
+				timer = 0
+			}
+			recordDisappearingTimer(cli, evt.JID, timer, evt.Timestamp, "group_info")
+		}
+	case *events.HistorySync:
+		for _, conv := range evt.Data.GetConversations() {
+			chat, err := types.ParseJID(conv.GetID())
+			if err != nil || conv.EphemeralExpiration == nil {
+				continue
+			}
+			recordDisappearingTimer(cli, chat, conv.GetEphemeralExpiration(), time.Unix(conv.GetEphemeralSettingTimestamp(), 0), "history_sync")
+		}
+	}
+}
+
+// recordSetDisappearingTimer records a successful SetDisappearingTimer call
+// made through WmClientCall, whose setting message never comes back to us.
+func recordSetDisappearingTimer(cli *wa.Client, args []reflect.Value) {
+	var chat types.JID
+	var timer time.Duration
+	settingTS := time.Now()
+	for _, arg := range args {
+		switch v := arg.Interface().(type) {
+		case types.JID:
+			chat = v
+		case time.Duration:
+			timer = v
+		case time.Time:
+			if !v.IsZero() {
+				settingTS = v
+			}
+		}
+	}
+	recordDisappearingTimer(cli, chat, uint32(timer.Seconds()), settingTS, "set")
+}
+
+//export WmClientGetDisappearingTimer
+func WmClientGetDisappearingTimer(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		Chat   string `json:"chat"`
+		// groups: use the recorded value if there is one instead of asking the server
+		Cached bool `json:"cached"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	chat, err := types.ParseJID(payload.Chat)
+	if err != nil {
+		return fail(err)
+	}
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	out := map[string]any{"chat": chat.ToNonAD().String(), "known": false, "timer_seconds": 0, "enabled": false}
+	db, dbErr := bridgeDBForDevice(cli.Store)
+	if dbErr == nil {
+		var timer, settingTS int64
+		var source string
+		err = db.db.QueryRowContext(ctx, `SELECT timer, setting_ts, source FROM wmnode_chat_ephemeral WHERE our_jid=$1 AND chat=$2`,
+			cli.Store.GetJID().ToNonAD().String(), chat.ToNonAD().String()).Scan(&timer, &settingTS, &source)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fail(err)
+		} else if err == nil {
+			out["known"] = true
+			out["timer_seconds"] = timer
+			out["enabled"] = timer > 0
+			out["source"] = source
+			if settingTS > 0 {
+				out["setting_timestamp"] = settingTS
+			}
+		}
+	}
+	if chat.Server != types.GroupServer || (payload.Cached && out["known"] == true) {
+		return success(out)
+	}
+	info, err := cli.GetGroupInfo(ctx, chat)
+	if err != nil {
+		return fail(err)
+	}
+	timer := info.DisappearingTimer
+	if !info.IsEphemeral {
+		timer = 0
+	}
+	recordDisappearingTimer(cli, chat, timer, time.Now(), "group_info")
+	out["known"] = true
+	out["timer_seconds"] = int64(timer)
+	out["enabled"] = timer > 0
+	out["source"] = "group_info"
+	delete(out, "setting_timestamp")
+	return success(out)
+}
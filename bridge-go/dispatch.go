@@ -0,0 +1,311 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+)
+
+// WmClientCall resolves a method by name and inspects every parameter type the
+// first time a name is used; the result is kept in dispatchPlans so later calls
+// only index the method and run the prepared converters. Plans are per
+// receiver type, shared by all values of it.
+//
+// WmDeviceCall and WmContainerCall use the same conventions for store.Device
+// (or one of its stores, picked with "store") and sqlstore.Container. Devices
+// cross the boundary as device handles in both directions.
+
+type paramPlan struct {
+	typ      reflect.Type
+	context  bool // injected by the bridge
+	variadic bool // typ is the slice type
+	convert  argConverter
+}
+
+type dispatchPlan struct {
+	index    int
+	params   []paramPlan
+	variadic bool
+}
+
+type dispatchKey struct {
+	recv   reflect.Type
+	method string
+}
+
+var (
+	dispatchPlansMu sync.RWMutex
+	dispatchPlans   = map[dispatchKey]*dispatchPlan{}
+)
+
+var (
+	typeOfClient    = reflect.TypeOf((*wa.Client)(nil))
+	typeOfDevice    = reflect.TypeOf((*store.Device)(nil))
+	typeOfContainer = reflect.TypeOf((*sqlstore.Container)(nil))
+)
+
+func dispatchPlanFor(recv reflect.Type, method string) (*dispatchPlan, error) {
+	key := dispatchKey{recv, method}
+	dispatchPlansMu.RLock()
+	plan, ok := dispatchPlans[key]
+	dispatchPlansMu.RUnlock()
+	if ok {
+		return plan, nil
+	}
+	m, found := recv.MethodByName(method)
+	if !found {
+		return nil, fmt.Errorf("method not found: %s", method)
+	}
+	mt := m.Type
+	plan = &dispatchPlan{index: m.Index, variadic: mt.IsVariadic()}
+	// In(0) is the receiver, except for interface methods
+	first := 1
+	if recv.Kind() == reflect.Interface {
+		first = 0
+	}
+	for i := first; i < mt.NumIn(); i++ {
+		pt := mt.In(i)
+		p := paramPlan{typ: pt}
+		if pt.Kind() == reflect.Interface && pt.Implements(typeOfContext) {
+			p.context = true
+		} else {
+			p.variadic = mt.IsVariadic() && i == mt.NumIn()-1
+			p.convert = converterFor(pt)
+		}
+		plan.params = append(plan.params, p)
+	}
+	dispatchPlansMu.Lock()
+	dispatchPlans[key] = plan
+	dispatchPlansMu.Unlock()
+	return plan, nil
+}
+
+// buildArgs converts JSON args (an array, or a single value for a single
+// parameter) into call arguments.
+func (plan *dispatchPlan) buildArgs(ctx context.Context, method string, rawJSON json.RawMessage) ([]reflect.Value, error) {
+	// Parse args as array of raw messages
+	var rawArgs []json.RawMessage
+	if len(rawJSON) > 0 && string(rawJSON) != "null" && string(rawJSON) != "{}" {
+		if rawJSON[0] == '[' { // fast check
+			if err := json.Unmarshal(rawJSON, &rawArgs); err != nil {
+				return nil, fmt.Errorf("args must be array: %w", err)
+			}
+		} else {
+			// allow single arg object for single non-context parameter
+			rawArgs = []json.RawMessage{rawJSON}
+		}
+	}
+
+	args := make([]reflect.Value, 0, len(plan.params))
+	ai := 0
+	for i, p := range plan.params {
+		// Auto-inject context.Context
+		if p.context {
+			args = append(args, reflect.ValueOf(ctx))
+			continue
+		}
+		// Handle variadic last parameter: allow missing -> empty slice
+		if p.variadic {
+			if ai >= len(rawArgs) {
+				args = append(args, reflect.MakeSlice(p.typ, 0, 0))
+				continue
+			}
+			raw := rawArgs[ai]
+			// Wrap single object into array for variadic parameter
+			if raw[0] != '[' {
+				raw, _ = json.Marshal([]json.RawMessage{raw})
+			}
+			sliceVal, err := p.convert(raw)
+			if err != nil {
+				return nil, fmt.Errorf("arg %d: %w", i, err)
+			}
+			args = append(args, sliceVal)
+			ai++
+			continue
+		}
+		if ai >= len(rawArgs) {
+			return nil, fmt.Errorf("missing argument %d for %s", i, method)
+		}
+		v, err := p.convert(rawArgs[ai])
+		if err != nil {
+			return nil, fmt.Errorf("arg %d: %w", i, err)
+		}
+		args = append(args, v)
+		ai++
+	}
+	return args, nil
+}
+
+// splitError strips a trailing error return, returning it if set.
+func splitError(out []reflect.Value) ([]reflect.Value, error) {
+	if len(out) > 0 {
+		if errv, ok := out[len(out)-1].Interface().(error); ok {
+			if errv != nil {
+				return nil, errv
+			}
+			out = out[:len(out)-1]
+		}
+	}
+	return out, nil
+}
+
+// encodeResults encodes the remaining returns: nothing as {}, one value as
+// itself and several as an array.
+func encodeResults(out []reflect.Value) (any, error) {
+	if len(out) == 0 {
+		return map[string]any{}, nil
+	}
+	if len(out) == 1 {
+		return encodeReturn(out[0])
+	}
+	// multiple returns
+	arr := make([]any, 0, len(out))
+	for _, v := range out {
+		enc, err := encodeReturn(v)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, enc)
+	}
+	return arr, nil
+}
+
+// callMethod runs a method on recv, which must be of type recvType (an
+// interface type restricts the callable methods to that interface).
+func callMethod(recv reflect.Value, recvType reflect.Type, method string, rawArgs json.RawMessage, opID uint64) (any, error) {
+	plan, err := dispatchPlanFor(recvType, method)
+	if err != nil {
+		return nil, err
+	}
+	ctx, done, err := beginOp(opID)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	args, err := plan.buildArgs(ctx, method, rawArgs)
+	if err != nil {
+		return nil, err
+	}
+	meth := recv.Method(plan.index)
+	var out []reflect.Value
+	if plan.variadic {
+		out = meth.CallSlice(args)
+	} else {
+		out = meth.Call(args)
+	}
+	if out, err = splitError(out); err != nil {
+		return nil, err
+	}
+	for i, v := range out {
+		out[i] = deviceHandlesOf(v)
+	}
+	return encodeResults(out)
+}
+
+func registerDevice(dev *store.Device) handle {
+	devicesMu.Lock()
+	defer devicesMu.Unlock()
+	for h, d := range devices {
+		if d == dev {
+			return h
+		}
+	}
+	h := newHandle()
+	devices[h] = dev
+	return h
+}
+
+// deviceHandlesOf replaces returned devices with {"handle": n}.
+func deviceHandlesOf(v reflect.Value) reflect.Value {
+	switch {
+	case v.Type() == typeOfDevice:
+		if v.IsNil() {
+			return v
+		}
+		return reflect.ValueOf(map[string]any{"handle": uint64(registerDevice(v.Interface().(*store.Device)))})
+	case v.Kind() == reflect.Slice && v.Type().Elem() == typeOfDevice:
+		handles := make([]map[string]any, v.Len())
+		for i := range handles {
+			handles[i] = map[string]any{"handle": uint64(registerDevice(v.Index(i).Interface().(*store.Device)))}
+		}
+		return reflect.ValueOf(handles)
+	}
+	return v
+}
+
+// deviceStores maps WmDeviceCall's store names to store.Device fields.
+var deviceStores = map[string]string{
+	"identities":     "Identities",
+	"sessions":       "Sessions",
+	"pre_keys":       "PreKeys",
+	"sender_keys":    "SenderKeys",
+	"app_state_keys": "AppStateKeys",
+	"app_state":      "AppState",
+	"contacts":       "Contacts",
+	"chat_settings":  "ChatSettings",
+	"msg_secrets":    "MsgSecrets",
+	"privacy_tokens": "PrivacyTokens",
+	"lids":           "LIDs",
+}
+
+//export WmDeviceCall
+func WmDeviceCall(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Device uint64          `json:"device"`
+		Store  string          `json:"store"`
+		Method string          `json:"method"`
+		Args   json.RawMessage `json:"args"`
+		OpID   uint64          `json:"op_id"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	devicesMu.RLock()
+	dev := devices[handle(payload.Device)]
+	devicesMu.RUnlock()
+	if dev == nil {
+		return fail(errors.New("device handle not found"))
+	}
+	if payload.Store == "" {
+		return respond(callMethod(reflect.ValueOf(dev), typeOfDevice, payload.Method, payload.Args, payload.OpID))
+	}
+	field, ok := deviceStores[payload.Store]
+	if !ok {
+		return fail(fmt.Errorf("unknown store %q", payload.Store))
+	}
+	sv := reflect.ValueOf(dev).Elem().FieldByName(field)
+	if !sv.IsValid() || sv.IsNil() {
+		return fail(fmt.Errorf("store %q is not available", payload.Store))
+	}
+	return respond(callMethod(sv, sv.Type(), payload.Method, payload.Args, payload.OpID))
+}
+
+//export WmContainerCall
+func WmContainerCall(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Handle uint64          `json:"handle"`
+		Method string          `json:"method"`
+		Args   json.RawMessage `json:"args"`
+		OpID   uint64          `json:"op_id"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	containersMu.RLock()
+	cont := containers[handle(payload.Handle)]
+	containersMu.RUnlock()
+	if cont == nil {
+		return fail(errors.New("container handle not found"))
+	}
+	return respond(callMethod(reflect.ValueOf(cont), typeOfContainer, payload.Method, payload.Args, payload.OpID))
+}
@@ -0,0 +1,157 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Edits arrive as protocol messages pointing at the original message ID. When
+// the original is in the archive, its row is replaced with the new content and
+// the previous version is kept in wmnode_message_edits, so the full history can
+// be listed with WmClientGetEditHistory.
+
+func editOf(msg *waE2E.Message) *waE2E.ProtocolMessage {
+	pm := msg.GetProtocolMessage()
+	if pm == nil || pm.GetType() != waE2E.ProtocolMessage_MESSAGE_EDIT {
+		return nil
+	}
+	return pm
+}
+
+// linkMessageEdit emits a message_edit event for evt and returns the fields
+// to attach to the message event itself, or nil if evt isn't an edit.
+func linkMessageEdit(cli *wa.Client, evt *events.Message) map[string]any {
+	pm := editOf(evt.Message)
+	if pm == nil {
+		return nil
+	}
+	ctx := context.Background()
+	origID := types.MessageID(pm.GetKey().GetID())
+	ev := map[string]any{
+		"type":             "message_edit",
+		"chat":             evt.Info.Chat.String(),
+		"original_id":      string(origID),
+		"edit_id":          string(evt.Info.ID),
+		"sender":           evt.Info.Sender.ToNonAD().String(),
+		"timestamp":        eventTime(evt.Info.Timestamp),
+		"new_message":      marshalProtoToMap(pm.GetEditedMessage()),
+		"previous_message": nil,
+	}
+	orig, err := getArchivedMessage(ctx, cli, evt.Info.Chat, origID)
+	if err != nil && !errors.Is(err, errNoBridgeDB) {
+		cli.Log.Warnf("Failed to look up edited message %s: %v", origID, err)
+	}
+	if orig != nil {
+		ev["previous_message"] = marshalProtoToMap(orig.Message)
+		ev["original_timestamp"] = eventTime(orig.Timestamp)
+		if err = recordMessageEdit(ctx, cli, orig, evt, pm.GetEditedMessage()); err != nil {
+			cli.Log.Warnf("Failed to record edit %s of %s: %v", evt.Info.ID, origID, err)
+		}
+	}
+	emitBridgeEvent(cli, ev)
+	return map[string]any{"edit_of": string(origID)}
+}
+
+func recordMessageEdit(ctx context.Context, cli *wa.Client, orig *archivedMessage, evt *events.Message, edited *waE2E.Message) error {
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return err
+	}
+	ourJID := cli.Store.GetJID().ToNonAD().String()
+	prev, err := proto.Marshal(orig.Message)
+	if err != nil {
+		return err
+	}
+	_, err = db.db.ExecContext(ctx, `
+		INSERT INTO wmnode_message_edits (our_jid, chat, message_id, edit_id, timestamp, previous_message)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (our_jid, chat, message_id, edit_id) DO NOTHING
+	`, ourJID, orig.Chat.String(), string(orig.ID), string(evt.Info.ID), evt.Info.Timestamp.UnixMilli(),
+		base64.StdEncoding.EncodeToString(prev))
+	if err != nil {
+		return err
+	}
+	updated := *orig
+	updated.Message = edited
+	return storeArchivedMessage(ctx, db, ourJID, &updated)
+}
+
+//export WmClientGetEditHistory
+func WmClientGetEditHistory(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		Chat   string `json:"chat"`
+		ID     string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	chat, err := types.ParseJID(payload.Chat)
+	if err != nil {
+		return fail(err)
+	}
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return fail(err)
+	}
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	current, err := getArchivedMessage(ctx, cli, chat, types.MessageID(payload.ID))
+	if err != nil {
+		return fail(err)
+	}
+	if current == nil {
+		return success(map[string]any{"found": false})
+	}
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT edit_id, timestamp, previous_message FROM wmnode_message_edits WHERE our_jid=$1 AND chat=$2 AND message_id=$3 ORDER BY timestamp`,
+		cli.Store.GetJID().ToNonAD().String(), chat.String(), payload.ID)
+	if err != nil {
+		return fail(err)
+	}
+	defer rows.Close()
+	// each version is the content that was replaced by edit_id at edited_at
+	versions := []map[string]any{}
+	for rows.Next() {
+		var editID, data string
+		var ts int64
+		if err := rows.Scan(&editID, &ts, &data); err != nil {
+			return fail(err)
+		}
+		raw, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return fail(err)
+		}
+		var msg waE2E.Message
+		if err := proto.Unmarshal(raw, &msg); err != nil {
+			return fail(err)
+		}
+		versions = append(versions, map[string]any{
+			"message":   marshalProtoToMap(&msg),
+			"edit_id":   editID,
+			"edited_at": time.UnixMilli(ts).Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return fail(err)
+	}
+	return success(map[string]any{"found": true, "current": serializeArchivedMessage(current), "versions": versions})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// eventFilter restricts which event types a stream receives. An empty include
+// list means everything that isn't explicitly excluded.
+type eventFilter struct {
+	include map[string]bool
+	exclude map[string]bool
+}
+
+func newEventFilter(include, exclude []string) *eventFilter {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil
+	}
+	f := &eventFilter{include: map[string]bool{}, exclude: map[string]bool{}}
+	for _, t := range include {
+		f.include[t] = true
+	}
+	for _, t := range exclude {
+		f.exclude[t] = true
+	}
+	return f
+}
+
+func (f *eventFilter) allows(eventType string) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.include) > 0 && !f.include[eventType] {
+		return false
+	}
+	return !f.exclude[eventType]
+}
+
+// chatFilter scopes a stream to (or away from) specific chats. It only applies
+// to chat-bound events: messages, receipts, presence and the bridge's own events
+// that carry a chat. Everything else passes.
+type chatFilter struct {
+	include map[types.JID]bool
+	exclude map[types.JID]bool
+}
+
+func newChatFilter(include, exclude []string) (*chatFilter, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	f := &chatFilter{include: map[types.JID]bool{}, exclude: map[types.JID]bool{}}
+	for _, s := range include {
+		jid, err := types.ParseJID(s)
+		if err != nil {
+			return nil, err
+		}
+		f.include[jid.ToNonAD()] = true
+	}
+	for _, s := range exclude {
+		jid, err := types.ParseJID(s)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude[jid.ToNonAD()] = true
+	}
+	return f, nil
+}
+
+func (f *chatFilter) allows(raw interface{}) bool {
+	if f == nil {
+		return true
+	}
+	chat, ok := eventChat(raw)
+	return !ok || f.allowsChat(chat)
+}
+
+// allowsBridgeEvent checks an event built by the bridge, chat-bound when it
+// carries a "chat" field.
+func (f *chatFilter) allowsBridgeEvent(ev map[string]any) bool {
+	if f == nil {
+		return true
+	}
+	switch chat := ev["chat"].(type) {
+	case types.JID:
+		return f.allowsChat(chat)
+	case string:
+		jid, err := types.ParseJID(chat)
+		return err != nil || f.allowsChat(jid)
+	default:
+		return true
+	}
+}
+
+func (f *chatFilter) allowsChat(chat types.JID) bool {
+	chat = chat.ToNonAD()
+	if len(f.include) > 0 && !f.include[chat] {
+		return false
+	}
+	return !f.exclude[chat]
+}
+
+// eventChat returns the chat a whatsmeow event belongs to. For presence that's
+// the user whose presence changed, which is also their 1:1 chat.
+func eventChat(raw interface{}) (types.JID, bool) {
+	switch evt := raw.(type) {
+	case *events.Message:
+		return evt.Info.Chat, true
+	case *events.UndecryptableMessage:
+		return evt.Info.Chat, true
+	case *events.Receipt:
+		return evt.Chat, true
+	case *events.ChatPresence:
+		return evt.Chat, true
+	case *events.Presence:
+		return evt.From, true
+	default:
+		return types.JID{}, false
+	}
+}
+
+// eventTypeNames remembers the serialized "type" of each Go event type, so
+// filtered streams can skip serializing events they'd discard anyway.
+var eventTypeNames sync.Map // reflect.Type -> string
+
+func knownEventType(raw interface{}) (string, bool) {
+	name, ok := eventTypeNames.Load(reflect.TypeOf(raw))
+	if !ok {
+		return "", false
+	}
+	return name.(string), true
+}
+
+func rememberEventType(raw interface{}, payload map[string]any) string {
+	name, _ := payload["type"].(string)
+	eventTypeNames.LoadOrStore(reflect.TypeOf(raw), name)
+	return name
+}
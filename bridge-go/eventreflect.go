@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/types"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Events without an explicit case in serializeEvent are walked by reflection, so
+// event types added in newer whatsmeow versions reach Node with their data
+// instead of just a type name. Field names are converted to snake_case.
+
+const maxReflectDepth = 10
+
+var (
+	typeOfTime  = reflect.TypeOf(time.Time{})
+	typeOfNode  = reflect.TypeOf(waBinary.Node{})
+	typeOfError = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+func serializeUnknownEvent(raw interface{}) map[string]any {
+	out := map[string]any{}
+	if fields, ok := reflectToJSON(reflect.ValueOf(raw), 0).(map[string]any); ok {
+		out = fields
+	}
+	out["type"] = fmt.Sprintf("unknown:%T", raw)
+	return out
+}
+
+func reflectToJSON(v reflect.Value, depth int) any {
+	if !v.IsValid() || depth > maxReflectDepth {
+		return nil
+	}
+	t := v.Type()
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+	}
+	if t.Implements(typeOfError) {
+		return v.Interface().(error).Error()
+	}
+	if t.Implements(typeOfProtoMsg) {
+		return marshalProtoToMap(v.Interface().(proto.Message))
+	}
+	switch t {
+	case typeOfTime:
+		return eventTime(v.Interface().(time.Time))
+	case typeOfDuration:
+		return v.Interface().(time.Duration).Milliseconds()
+	case typeOfJID:
+		return v.Interface().(types.JID).String()
+	case typeOfNode:
+		node := v.Interface().(waBinary.Node)
+		return nodeToJSON(&node)
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return reflectToJSON(v.Elem(), depth+1)
+	case reflect.Struct:
+		out := map[string]any{}
+		reflectStructFields(v, depth, out)
+		return out
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if v.Kind() == reflect.Array {
+				b := make([]byte, v.Len())
+				reflect.Copy(reflect.ValueOf(b), v)
+				return base64.StdEncoding.EncodeToString(b)
+			}
+			return base64.StdEncoding.EncodeToString(v.Bytes())
+		}
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = reflectToJSON(v.Index(i), depth+1)
+		}
+		return out
+	case reflect.Map:
+		out := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[fmt.Sprint(iter.Key().Interface())] = reflectToJSON(iter.Value(), depth+1)
+		}
+		return out
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	default:
+		// channels, funcs and unsafe pointers have no JSON form
+		return nil
+	}
+}
+
+// reflectStructFields copies the exported fields of v into out. Embedded
+// structs (like MessageInfo in MessageSource) are flattened, matching how the
+// explicit serializers lay them out.
+func reflectStructFields(v reflect.Value, depth int, out map[string]any) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Anonymous {
+			inner := fv
+			if inner.Kind() == reflect.Pointer {
+				if inner.IsNil() {
+					continue
+				}
+				inner = inner.Elem()
+			}
+			if inner.Kind() == reflect.Struct && inner.Type() != typeOfTime && inner.Type() != typeOfJID {
+				reflectStructFields(inner, depth+1, out)
+				continue
+			}
+		}
+		out[snakeCase(f.Name)] = reflectToJSON(fv, depth+1)
+	}
+}
+
+// snakeCase turns Go field names like "MessageID" or "LastSuccess" into "message_id" and "last_success".
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var sb strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				sb.WriteByte('_')
+			}
+		}
+		sb.WriteRune(unicode.ToLower(r))
+	}
+	return sb.String()
+}
@@ -0,0 +1,264 @@
+package main
+
+import "C"
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// An event socket serves event streams over a Unix socket, so consumers don't
+// need to poll through cgo and several processes can share one bridge. Every
+// frame in both directions is a 4-byte big-endian length followed by the body.
+//
+// A connection starts with a JSON hello frame naming the client (handle or JID)
+// and the usual stream options. The bridge answers {"ok":true,"handle":...} and
+// then writes {"client":..., "event":{...}} frames, encoded as JSON or as a
+// serialized google.protobuf.Struct depending on the socket format.
+type eventSocket struct {
+	ln     net.Listener
+	path   string
+	format string
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type eventSocketHello struct {
+	Client       json.RawMessage `json:"client"`
+	Include      []string        `json:"include"`
+	Exclude      []string        `json:"exclude"`
+	Chats        []string        `json:"chats"`
+	ExcludeChats []string        `json:"exclude_chats"`
+	serializeOptions
+}
+
+const maxHelloFrame = 64 << 10
+
+var (
+	eventSocketsMu sync.RWMutex
+	eventSockets   = map[handle]*eventSocket{}
+)
+
+func (s *eventSocket) close() {
+	s.cancel()
+	_ = s.ln.Close()
+	_ = os.Remove(s.path)
+}
+
+func (s *eventSocket) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func readFrame(r io.Reader, limit uint32) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size > limit {
+		return nil, fmt.Errorf("frame too large (%d bytes)", size)
+	}
+	buf := make([]byte, size)
+	_, err := io.ReadFull(r, buf)
+	return buf, err
+}
+
+func writeFrame(w io.Writer, body []byte) error {
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(body)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+func (s *eventSocket) encode(frame map[string]any) ([]byte, error) {
+	data, err := json.Marshal(frame)
+	if err != nil || s.format != "proto" {
+		return data, err
+	}
+	// structpb only takes plain JSON values, so go through the JSON form first
+	var plain map[string]any
+	if err = json.Unmarshal(data, &plain); err != nil {
+		return nil, err
+	}
+	st, err := structpb.NewStruct(plain)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(st)
+}
+
+func findClient(ref json.RawMessage) *wa.Client {
+	clientsMu.RLock()
+	defer clientsMu.RUnlock()
+	var h uint64
+	if err := json.Unmarshal(ref, &h); err == nil {
+		return clients[handle(h)]
+	}
+	var jid string
+	if err := json.Unmarshal(ref, &jid); err != nil || jid == "" {
+		return nil
+	}
+	for _, cli := range clients {
+		if cli.Store.GetJID().ToNonAD().String() == jid {
+			return cli
+		}
+	}
+	return nil
+}
+
+func (s *eventSocket) handleConn(conn net.Conn) {
+	defer conn.Close()
+	reply := func(frame map[string]any) error {
+		data, err := json.Marshal(frame)
+		if err != nil {
+			return err
+		}
+		return writeFrame(conn, data)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	raw, err := readFrame(conn, maxHelloFrame)
+	if err != nil {
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	var hello eventSocketHello
+	if err = json.Unmarshal(raw, &hello); err != nil {
+		_ = reply(map[string]any{"ok": false, "error": fmt.Sprintf("invalid json: %v", err)})
+		return
+	}
+	cli := findClient(hello.Client)
+	if cli == nil {
+		_ = reply(map[string]any{"ok": false, "error": "client not found"})
+		return
+	}
+	chats, err := newChatFilter(hello.Chats, hello.ExcludeChats)
+	if err != nil {
+		_ = reply(map[string]any{"ok": false, "error": err.Error()})
+		return
+	}
+	if err = hello.serializeOptions.normalize(); err != nil {
+		_ = reply(map[string]any{"ok": false, "error": err.Error()})
+		return
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	es := &eventStream{ch: make(chan any, 1024), ctx: ctx, cancel: cancel, client: cli, filter: newEventFilter(hello.Include, hello.Exclude), chats: chats, opts: hello.serializeOptions}
+	h := newHandle()
+	eventsMu.Lock()
+	eventsMap[h] = es
+	eventsMu.Unlock()
+	defer func() {
+		eventsMu.Lock()
+		delete(eventsMap, h)
+		eventsMu.Unlock()
+	}()
+	if err = reply(map[string]any{"ok": true, "handle": uint64(h)}); err != nil {
+		return
+	}
+	// the peer never sends anything after the hello, so a read returning means it hung up
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		cancel()
+	}()
+	clientHandle := uint64(handleOfClient(cli))
+	w := bufio.NewWriter(conn)
+	send := func(ev any) error {
+		data, err := s.encode(map[string]any{"client": clientHandle, "event": ev})
+		if err != nil {
+			cli.Log.Warnf("Failed to encode event for socket: %v", err)
+			return nil
+		}
+		if err = writeFrame(w, data); err != nil {
+			return err
+		}
+		if len(es.ch) == 0 {
+			return w.Flush()
+		}
+		return nil
+	}
+	for {
+		if n := es.pendingDrops.Swap(0); n > 0 && es.filter.allows("events_dropped") {
+			if send(map[string]any{"type": "events_dropped", "count": n, "total_dropped": es.dropped.Load(), "schema_version": eventSchemaVersion}) != nil {
+				return
+			}
+		}
+		select {
+		case ev := <-es.ch:
+			es.popped()
+			if send(ev) != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func handleOfClient(cli *wa.Client) handle {
+	clientsMu.RLock()
+	defer clientsMu.RUnlock()
+	for h, c := range clients {
+		if c == cli {
+			return h
+		}
+	}
+	return 0
+}
+
+//export WmEventSocketListen
+func WmEventSocketListen(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Path   string `json:"path"`
+		Format string `json:"format"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	if payload.Path == "" {
+		return fail(errors.New("path is required"))
+	}
+	if payload.Format == "" {
+		payload.Format = "json"
+	}
+	if payload.Format != "json" && payload.Format != "proto" {
+		return fail(fmt.Errorf("unsupported frame format %q", payload.Format))
+	}
+	// a socket file left behind by a crashed process would make Listen fail
+	if fi, err := os.Stat(payload.Path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(payload.Path)
+	}
+	ln, err := net.Listen("unix", payload.Path)
+	if err != nil {
+		return fail(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sock := &eventSocket{ln: ln, path: payload.Path, format: payload.Format, ctx: ctx, cancel: cancel}
+	h := newHandle()
+	eventSocketsMu.Lock()
+	eventSockets[h] = sock
+	eventSocketsMu.Unlock()
+	go sock.serve()
+	return success(map[string]any{"handle": uint64(h), "path": payload.Path, "format": payload.Format})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Receipts and presence updates make up most of the traffic of an account in
+// large groups. Instead of building a map for serializeEvent and marshaling it
+// later, they're written straight to JSON in a pooled buffer; the result has
+// the same fields as the map form and goes through the stream as a
+// json.RawMessage. Events that also go to the journal or webhook, which need
+// the map, keep using serializeEvent.
+
+var fastEventBufs = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// fastEventType returns the type of raw if it has a direct encoder, or "".
+func fastEventType(raw interface{}) string {
+	switch raw.(type) {
+	case *events.Receipt:
+		return "receipt"
+	case *events.Presence:
+		return "presence"
+	case *events.ChatPresence:
+		return "chat_presence"
+	}
+	return ""
+}
+
+// encodeFastEvent encodes an event fastEventType accepts.
+func encodeFastEvent(raw interface{}, opts serializeOptions) json.RawMessage {
+	buf := fastEventBufs.Get().(*bytes.Buffer)
+	defer fastEventBufs.Put(buf)
+	buf.Reset()
+	w := fastEventWriter{buf: buf, format: opts.TimestampFormat}
+	buf.WriteByte('{')
+	w.str("type", fastEventType(raw))
+	switch evt := raw.(type) {
+	case *events.Receipt:
+		w.key("info")
+		w.value(evt.MessageSource)
+		w.key("message_ids")
+		if evt.MessageIDs == nil {
+			buf.WriteString("null")
+		} else {
+			buf.WriteByte('[')
+			for i, id := range evt.MessageIDs {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				buf.Write(appendJSONString(buf.AvailableBuffer(), string(id)))
+			}
+			buf.WriteByte(']')
+		}
+		w.time("timestamp", evt.Timestamp)
+		w.str("receipt_type", string(evt.Type))
+		w.str("message_sender", evt.MessageSender.String())
+	case *events.Presence:
+		w.str("from", evt.From.String())
+		w.boolean("unavailable", evt.Unavailable)
+		w.time("last_seen", evt.LastSeen)
+	case *events.ChatPresence:
+		w.str("chat", evt.MessageSource.Chat.String())
+		w.str("sender", evt.MessageSource.Sender.String())
+		w.boolean("is_from_me", evt.MessageSource.IsFromMe)
+		w.str("state", string(evt.State))
+		w.str("media", string(evt.Media))
+	}
+	w.key("schema_version")
+	buf.Write(strconv.AppendInt(buf.AvailableBuffer(), eventSchemaVersion, 10))
+	buf.WriteByte('}')
+	return bytes.Clone(buf.Bytes())
+}
+
+type fastEventWriter struct {
+	buf    *bytes.Buffer
+	format string
+	enc    *json.Encoder
+}
+
+func (w *fastEventWriter) key(k string) {
+	if w.buf.Len() > 1 {
+		w.buf.WriteByte(',')
+	}
+	w.buf.Write(appendJSONString(w.buf.AvailableBuffer(), k))
+	w.buf.WriteByte(':')
+}
+
+func (w *fastEventWriter) str(k, v string) {
+	w.key(k)
+	w.buf.Write(appendJSONString(w.buf.AvailableBuffer(), v))
+}
+
+func (w *fastEventWriter) boolean(k string, v bool) {
+	w.key(k)
+	w.buf.Write(strconv.AppendBool(w.buf.AvailableBuffer(), v))
+}
+
+// value encodes v with encoding/json, straight into the buffer.
+func (w *fastEventWriter) value(v any) {
+	if w.enc == nil {
+		w.enc = json.NewEncoder(w.buf)
+	}
+	if err := w.enc.Encode(v); err != nil {
+		w.buf.WriteString("null")
+		return
+	}
+	w.buf.Truncate(w.buf.Len() - 1) // Encode adds a newline
+}
+
+// time writes t the way formatEventTimes would.
+func (w *fastEventWriter) time(k string, t time.Time) {
+	if w.format != timestampFormatUnixMs {
+		w.key(k)
+		b := append(w.buf.AvailableBuffer(), '"')
+		if !t.IsZero() {
+			b = t.AppendFormat(b, time.RFC3339)
+		}
+		w.buf.Write(append(b, '"'))
+		if w.format == timestampFormatRFC3339 {
+			return
+		}
+		k += "_ms"
+	}
+	w.key(k)
+	w.buf.Write(strconv.AppendInt(w.buf.AvailableBuffer(), eventTime(t).unixMilli(), 10))
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends s as a JSON string, escaped like encoding/json does.
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				b = append(b, '\\', c)
+			case c == '\b':
+				b = append(b, '\\', 'b')
+			case c == '\f':
+				b = append(b, '\\', 'f')
+			case c == '\n':
+				b = append(b, '\\', 'n')
+			case c == '\r':
+				b = append(b, '\\', 'r')
+			case c == '\t':
+				b = append(b, '\\', 't')
+			case c < 0x20 || c == '<' || c == '>' || c == '&':
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			default:
+				b = append(b, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b = append(b, `\ufffd`...)
+		case r == '\u2028' || r == '\u2029':
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+		default:
+			b = append(b, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(b, '"')
+}
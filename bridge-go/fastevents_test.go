@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestAppendJSONString(t *testing.T) {
+	tests := []string{
+		"",
+		"plain ascii",
+		`quote " and backslash \`,
+		"control \x00\x01\x1f and \b\f\n\r\t",
+		"html <script>&amp;</script>",
+		"unicode é ü 日本 🙂",
+		"line separators \u2028 \u2029",
+		"invalid utf-8 \xff\xfe and truncated \xe6\x97",
+		"\x7f delete",
+	}
+	for _, s := range tests {
+		want, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := appendJSONString(nil, s)
+		if utf8.ValidString(s) {
+			if string(got) != string(want) {
+				t.Errorf("appendJSONString(%q) = %s, want %s", s, got, want)
+			}
+			continue
+		}
+		// Go versions differ in how they write the replacement character
+		var gotStr, wantStr string
+		if err = json.Unmarshal(got, &gotStr); err != nil {
+			t.Fatalf("appendJSONString(%q) = %s: %v", s, got, err)
+		}
+		_ = json.Unmarshal(want, &wantStr)
+		if gotStr != wantStr {
+			t.Errorf("appendJSONString(%q) decodes to %q, want %q", s, gotStr, wantStr)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import "C"
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// WmConnectAll and WmDisconnectAll act on every client (or those with a label)
+// for maintenance windows, doing what WmClientConnect and WmClientDisconnect do
+// for each with at most `concurrency` at a time, and report one result per
+// client instead of failing on the first error. Clients that were never paired
+// are skipped by WmConnectAll unless include_unpaired is set, since connecting
+// them starts a QR pairing nobody is watching.
+
+type fleetPayload struct {
+	Label       string `json:"label"`
+	Concurrency int    `json:"concurrency"`
+}
+
+type fleetResult struct {
+	Handle uint64 `json:"handle"`
+	Label  string `json:"label"`
+	JID    string `json:"jid,omitempty"`
+	// connected, already_connected, skipped_unpaired, disconnected,
+	// already_disconnected or failed
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// forEachClient runs fn for the clients matching the payload and collects the results by handle.
+func forEachClient(p fleetPayload, fn func(cli *wa.Client, res *fleetResult)) []fleetResult {
+	if p.Concurrency <= 0 {
+		p.Concurrency = 8
+	}
+	clientsMu.RLock()
+	handles := make(map[handle]*wa.Client, len(clients))
+	for h, cli := range clients {
+		handles[h] = cli
+	}
+	clientsMu.RUnlock()
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = []fleetResult{}
+		sem     = make(chan struct{}, p.Concurrency)
+	)
+	for h, cli := range handles {
+		label := configFor(cli).clientLabel()
+		if p.Label != "" && label != p.Label {
+			continue
+		}
+		res := fleetResult{Handle: uint64(h), Label: label}
+		if jid := cli.Store.GetJID(); !jid.IsEmpty() {
+			res.JID = jid.String()
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(cli, &res)
+			mu.Lock()
+			results = append(results, res)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	slices.SortFunc(results, func(a, b fleetResult) int { return cmp.Compare(a.Handle, b.Handle) })
+	return results
+}
+
+func fleetSummary(results []fleetResult) map[string]any {
+	failed := 0
+	for _, res := range results {
+		if res.Status == "failed" {
+			failed++
+		}
+	}
+	return map[string]any{"results": results, "total": len(results), "failed": failed}
+}
+
+//export WmConnectAll
+func WmConnectAll(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	if err := checkShutdown(); err != nil {
+		return fail(err)
+	}
+	var payload struct {
+		fleetPayload
+		IncludeUnpaired bool `json:"include_unpaired"`
+		// also wait up to this long for each client to log in
+		WaitMs int64 `json:"wait_ms"`
+	}
+	if s := C.GoString(input); s != "" {
+		if err := json.Unmarshal([]byte(s), &payload); err != nil {
+			return fail(fmt.Errorf("invalid json: %w", err))
+		}
+	}
+	results := forEachClient(payload.fleetPayload, func(cli *wa.Client, res *fleetResult) {
+		switch {
+		case res.JID == "" && !payload.IncludeUnpaired:
+			res.Status = "skipped_unpaired"
+			return
+		case cli.IsConnected():
+			res.Status = "already_connected"
+			return
+		}
+		resetIdle(cli)
+		emitConnectionState(cli, "connecting", nil)
+		if err := connectClient(cli); err != nil && !errors.Is(err, wa.ErrAlreadyConnected) {
+			res.Status, res.Error = "failed", err.Error()
+			return
+		}
+		if payload.WaitMs > 0 && !cli.WaitForConnection(time.Duration(payload.WaitMs)*time.Millisecond) {
+			res.Status, res.Error = "failed", "timed out waiting for login"
+			return
+		}
+		res.Status = "connected"
+	})
+	return success(fleetSummary(results))
+}
+
+//export WmDisconnectAll
+func WmDisconnectAll(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload fleetPayload
+	if s := C.GoString(input); s != "" {
+		if err := json.Unmarshal([]byte(s), &payload); err != nil {
+			return fail(fmt.Errorf("invalid json: %w", err))
+		}
+	}
+	results := forEachClient(payload, func(cli *wa.Client, res *fleetResult) {
+		// a pending reconnect would bring it back right away
+		stopReconnect(cli)
+		resetIdle(cli)
+		if !cli.IsConnected() {
+			res.Status = "already_disconnected"
+			return
+		}
+		cli.Disconnect()
+		res.Status = "disconnected"
+	})
+	return success(fleetSummary(results))
+}
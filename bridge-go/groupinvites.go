@@ -0,0 +1,177 @@
+package main
+
+import "C"
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Invite messages ("v4" invites) let a group or community admin invite
+// someone whose privacy settings don't allow adding them directly: adding them
+// fails with 403 and an add request code, which is sent to them in a
+// groupInviteMessage and redeemed with JoinGroupWithInvite. WmClientSendGroupInvite
+// runs the whole flow (adding directly when allowed), incoming invites get a
+// "group_invite" object on their message event, and WmClientAcceptGroupInvite
+// accepts one with the fields of that object.
+
+// linkGroupInvite returns the fields to attach to the message event of a
+// group invite, or nil for other messages.
+func linkGroupInvite(evt *events.Message) map[string]any {
+	invite := evt.Message.GetGroupInviteMessage()
+	if invite == nil {
+		return nil
+	}
+	out := map[string]any{
+		"group":      invite.GetGroupJID(),
+		"group_name": invite.GetGroupName(),
+		"group_type": strings.ToLower(invite.GetGroupType().String()),
+		"inviter":    evt.Info.Sender.ToNonAD().String(),
+		"code":       invite.GetInviteCode(),
+		"expiration": invite.GetInviteExpiration(),
+		"expired":    invite.GetInviteExpiration() > 0 && time.Now().Unix() > invite.GetInviteExpiration(),
+	}
+	if invite.GetCaption() != "" {
+		out["caption"] = invite.GetCaption()
+	}
+	return map[string]any{"group_invite": out}
+}
+
+//export WmClientSendGroupInvite
+func WmClientSendGroupInvite(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		Group  string `json:"group"`
+		To     string `json:"to"`
+		// an add request code from an earlier attempt; by default the user is
+		// added, and only invited if their privacy settings refuse it
+		Code       string `json:"code"`
+		Expiration int64  `json:"expiration"`
+		Caption    string `json:"caption"`
+		// JPEG preview of the group picture
+		ThumbnailB64   string `json:"thumbnail_b64"`
+		IdempotencyKey string `json:"idempotency_key"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	group, err := types.ParseJID(payload.Group)
+	if err != nil {
+		return fail(err)
+	}
+	to, err := types.ParseJID(payload.To)
+	if err != nil {
+		return fail(err)
+	}
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	code, expiration := payload.Code, payload.Expiration
+	if code == "" {
+		added, err := cli.UpdateGroupParticipants(ctx, group, []types.JID{to}, wa.ParticipantChangeAdd)
+		if err != nil {
+			return fail(err)
+		}
+		if len(added) != 1 {
+			return fail(errors.New("unexpected response to adding the participant"))
+		}
+		switch p := added[0]; {
+		case p.Error == 0:
+			return success(map[string]any{"added": true, "invited": false})
+		case p.Error == 403 && p.AddRequest != nil:
+			code, expiration = p.AddRequest.Code, p.AddRequest.Expiration.Unix()
+		default:
+			return fail(fmt.Errorf("adding the participant failed with error %d", p.Error))
+		}
+	}
+	info, err := cli.GetGroupInfo(ctx, group)
+	if err != nil {
+		return fail(err)
+	}
+	invite := &waE2E.GroupInviteMessage{
+		GroupJID:         proto.String(group.String()),
+		InviteCode:       proto.String(code),
+		InviteExpiration: proto.Int64(expiration),
+		GroupName:        proto.String(info.Name),
+		GroupType:        waE2E.GroupInviteMessage_DEFAULT.Enum(),
+	}
+	if info.IsParent {
+		invite.GroupType = waE2E.GroupInviteMessage_PARENT.Enum()
+	}
+	if payload.Caption != "" {
+		invite.Caption = proto.String(payload.Caption)
+	}
+	if payload.ThumbnailB64 != "" {
+		if invite.JPEGThumbnail, err = base64.StdEncoding.DecodeString(payload.ThumbnailB64); err != nil {
+			return fail(fmt.Errorf("invalid thumbnail_b64: %w", err))
+		}
+	}
+	if err := throttleSend(ctx, cli, to); err != nil {
+		return fail(err)
+	}
+	resp, err := cli.SendMessage(ctx, to.ToNonAD(), &waE2E.Message{GroupInviteMessage: invite}, sendExtra(cli, nil, payload.IdempotencyKey)...)
+	if err != nil {
+		return fail(err)
+	}
+	enc, err := encodeReturn(reflect.ValueOf(resp))
+	if err != nil {
+		return fail(err)
+	}
+	return success(map[string]any{"added": false, "invited": true, "code": code, "expiration": expiration, "message": enc})
+}
+
+//export WmClientAcceptGroupInvite
+func WmClientAcceptGroupInvite(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client     uint64 `json:"client"`
+		Group      string `json:"group"`
+		Inviter    string `json:"inviter"`
+		Code       string `json:"code"`
+		Expiration int64  `json:"expiration"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	group, err := types.ParseJID(payload.Group)
+	if err != nil {
+		return fail(err)
+	}
+	inviter, err := types.ParseJID(payload.Inviter)
+	if err != nil {
+		return fail(err)
+	}
+	if payload.Code == "" {
+		return fail(errors.New("code is required"))
+	}
+	if payload.Expiration > 0 && time.Now().Unix() > payload.Expiration {
+		return fail(errors.New("the invite has expired"))
+	}
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	if err = cli.JoinGroupWithInvite(ctx, group, inviter, payload.Code, payload.Expiration); err != nil {
+		return fail(err)
+	}
+	return success(map[string]any{"group": group.String()})
+}
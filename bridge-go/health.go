@@ -0,0 +1,191 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// A session can stay "logged in" and even "connected" while the socket is dead
+// (a zombie). WmClientHealth gathers what tells them apart: when the server
+// last proved the connection alive (connecting, a restored keepalive or a
+// health ping), keepalive failures, when the last event arrived, work still
+// pending for the client and, with ping set, a live round trip. whatsmeow
+// doesn't report its successful keepalives, hence the health ping.
+
+type clientHealth struct {
+	lastEvent      atomic.Int64 // unix ms
+	lastAlive      atomic.Int64 // unix ms
+	keepaliveFails atomic.Int32 // since the last success
+	lastTimeout    atomic.Int64 // unix ms
+}
+
+func (cfg *clientConfig) clientHealth() *clientHealth {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	if cfg.health == nil {
+		cfg.health = &clientHealth{}
+	}
+	return cfg.health
+}
+
+func trackHealth(cli *wa.Client, raw any) {
+	h := configFor(cli).clientHealth()
+	now := time.Now().UnixMilli()
+	h.lastEvent.Store(now)
+	switch evt := raw.(type) {
+	case *events.Connected, *events.KeepAliveRestored:
+		h.lastAlive.Store(now)
+		h.keepaliveFails.Store(0)
+	case *events.KeepAliveTimeout:
+		h.keepaliveFails.Store(int32(evt.ErrorCount))
+		h.lastTimeout.Store(now)
+		if last := evt.LastSuccess.UnixMilli(); !evt.LastSuccess.IsZero() && last > h.lastAlive.Load() {
+			h.lastAlive.Store(last)
+		}
+	}
+}
+
+// pingServer sends an XMPP ping and returns the round trip time.
+func pingServer(cli *wa.Client, timeout time.Duration) (time.Duration, error) {
+	if !cli.IsConnected() {
+		return 0, wa.ErrNotConnected
+	}
+	start := time.Now()
+	resp, err := sendNodeAndWait(cli, waBinary.Node{
+		Tag: "iq",
+		Attrs: waBinary.Attrs{
+			"id":    cli.DangerousInternals().GenerateRequestID(),
+			"to":    types.ServerJID,
+			"type":  "get",
+			"xmlns": "w:p",
+		},
+		Content: []waBinary.Node{{Tag: "ping"}},
+	}, timeout, 0)
+	if err != nil {
+		return 0, err
+	}
+	if err = iqError(resp); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+func unixMsOrNil(ms int64) any {
+	if ms == 0 {
+		return nil
+	}
+	return ms
+}
+
+//export WmClientHealth
+func WmClientHealth(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client    uint64 `json:"client"`
+		Ping      bool   `json:"ping"`
+		TimeoutMs int64  `json:"timeout_ms"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	cfg := configFor(cli)
+	h := cfg.clientHealth()
+	out := map[string]any{
+		"connected": cli.IsConnected(),
+		"logged_in": cli.IsLoggedIn(),
+	}
+
+	if payload.Ping {
+		timeout := 10 * time.Second
+		if payload.TimeoutMs > 0 {
+			timeout = time.Duration(payload.TimeoutMs) * time.Millisecond
+		}
+		ping := map[string]any{"ok": false}
+		if rtt, err := pingServer(cli, timeout); err != nil {
+			ping["error"] = err.Error()
+		} else {
+			ping["ok"] = true
+			ping["rtt_ms"] = rtt.Milliseconds()
+			h.lastAlive.Store(time.Now().UnixMilli())
+		}
+		out["ping"] = ping
+	}
+	out["last_alive_ms"] = unixMsOrNil(h.lastAlive.Load())
+	out["last_event_ms"] = unixMsOrNil(h.lastEvent.Load())
+	keepalive := rttStats(handle(payload.Client))
+	keepalive["failing"] = h.keepaliveFails.Load() > 0
+	keepalive["error_count"] = h.keepaliveFails.Load()
+	keepalive["last_timeout_ms"] = unixMsOrNil(h.lastTimeout.Load())
+	out["keepalive"] = keepalive
+
+	pending := map[string]any{"recoveries": 0, "reconnect_attempt": 0}
+	if r := cfg.messageRecovery(); r != nil {
+		r.mu.Lock()
+		pending["recoveries"] = len(r.pending)
+		r.mu.Unlock()
+	}
+	if r := cfg.reconnector(); r != nil {
+		r.mu.Lock()
+		if r.active {
+			pending["reconnect_attempt"] = r.attempt
+		}
+		r.mu.Unlock()
+	}
+	tasks.mu.Lock()
+	if q := tasks.queues[cli]; q != nil {
+		pending["tasks"] = len(q.tasks) + q.running
+	} else {
+		pending["tasks"] = 0
+	}
+	tasks.mu.Unlock()
+	out["pending"] = pending
+
+	backlog := 0
+	var oldest time.Time
+	eventsMu.RLock()
+	for _, es := range eventsMap {
+		if es.client != cli {
+			continue
+		}
+		es.mu.Lock()
+		backlog += len(es.ch)
+		if len(es.queuedAt) > 0 && (oldest.IsZero() || es.queuedAt[0].Before(oldest)) {
+			oldest = es.queuedAt[0]
+		}
+		es.mu.Unlock()
+	}
+	eventsMu.RUnlock()
+	out["event_backlog"] = backlog
+	if !oldest.IsZero() {
+		out["oldest_queued"] = oldest.Format(time.RFC3339Nano)
+	}
+
+	// a logged in session is healthy if it's connected and nothing says the
+	// socket is dead; a failed ping or failing keepalives make it unresponsive
+	switch {
+	case !cli.IsLoggedIn():
+		out["status"] = "logged_out"
+	case !cli.IsConnected() && idleParked(cli):
+		out["status"] = "idle"
+	case !cli.IsConnected():
+		out["status"] = "disconnected"
+	case payload.Ping && out["ping"].(map[string]any)["ok"] == false, h.keepaliveFails.Load() > 0:
+		out["status"] = "unresponsive"
+	default:
+		out["status"] = "ok"
+	}
+	return success(out)
+}
@@ -0,0 +1,402 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/types"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// mediaJob is a background download of every media attachment referenced by a
+// history sync blob, or kept in the local message archive (archive.go).
+// Progress is reported through ch and polled with WmMediaJobNext.
+type mediaJob struct {
+	ch     chan map[string]any
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	client *wa.Client
+}
+
+type mediaJobItem struct {
+	chat      types.JID
+	id        types.MessageID
+	kind      string
+	mimetype  string
+	timestamp time.Time
+	msg       wa.DownloadableMessage
+}
+
+type mediaJobOptions struct {
+	Dir         string   `json:"dir"`
+	Concurrency int      `json:"concurrency"`
+	Retries     *int     `json:"retries"`
+	BackoffMs   int      `json:"backoffMs"`
+	Types       []string `json:"types"`
+	Overwrite   bool     `json:"overwrite"`
+}
+
+// downloadableFromMessage returns the downloadable part of an (already unwrapped) message.
+func downloadableFromMessage(msg *waE2E.Message) (wa.DownloadableMessage, string, string) {
+	switch {
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage(), "image", msg.GetImageMessage().GetMimetype()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage(), "video", msg.GetVideoMessage().GetMimetype()
+	case msg.GetAudioMessage() != nil:
+		return msg.GetAudioMessage(), "audio", msg.GetAudioMessage().GetMimetype()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage(), "document", msg.GetDocumentMessage().GetMimetype()
+	case msg.GetStickerMessage() != nil:
+		return msg.GetStickerMessage(), "sticker", msg.GetStickerMessage().GetMimetype()
+	default:
+		return nil, "", ""
+	}
+}
+
+func parseHistorySyncInput(obj json.RawMessage, b64 string) (*waHistorySync.HistorySync, error) {
+	hs := &waHistorySync.HistorySync{}
+	switch {
+	case b64 != "":
+		data, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64: %w", err)
+		}
+		if err := proto.Unmarshal(data, hs); err != nil {
+			return nil, fmt.Errorf("invalid history sync: %w", err)
+		}
+	case len(obj) > 0 && string(obj) != "null":
+		if err := protojson.Unmarshal(obj, hs); err != nil {
+			return nil, fmt.Errorf("invalid history sync: %w", err)
+		}
+	default:
+		return nil, errors.New("history_sync or history_sync_b64 is required")
+	}
+	return hs, nil
+}
+
+func collectHistoryMedia(cli *wa.Client, hs *waHistorySync.HistorySync, kinds []string) []mediaJobItem {
+	allowed := map[string]bool{}
+	for _, k := range kinds {
+		allowed[k] = true
+	}
+	var items []mediaJobItem
+	for _, conv := range hs.GetConversations() {
+		chat, err := types.ParseJID(conv.GetID())
+		if err != nil {
+			continue
+		}
+		for _, hsm := range conv.GetMessages() {
+			if hsm.GetMessage() == nil {
+				continue
+			}
+			evt, err := cli.ParseWebMessage(chat, hsm.GetMessage())
+			if err != nil || evt.Message == nil {
+				continue
+			}
+			dl, kind, mimetype := downloadableFromMessage(evt.Message)
+			if dl == nil || (len(allowed) > 0 && !allowed[kind]) {
+				continue
+			}
+			items = append(items, mediaJobItem{chat: chat, id: evt.Info.ID, kind: kind, mimetype: mimetype, timestamp: evt.Info.Timestamp, msg: dl})
+		}
+	}
+	return items
+}
+
+var unsafeFileChars = strings.NewReplacer("/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_")
+
+func mediaFilePath(dir string, item mediaJobItem) string {
+	ext := ".bin"
+	if item.mimetype != "" {
+		if exts, _ := mime.ExtensionsByType(strings.SplitN(item.mimetype, ";", 2)[0]); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return filepath.Join(dir, unsafeFileChars.Replace(item.chat.String()), unsafeFileChars.Replace(string(item.id))+ext)
+}
+
+func isPermanentDownloadError(err error) bool {
+	return errors.Is(err, wa.ErrMediaDownloadFailedWith404) ||
+		errors.Is(err, wa.ErrMediaDownloadFailedWith410) ||
+		errors.Is(err, wa.ErrNoURLPresent)
+}
+
+// collectArchiveMedia lists the media messages of the message archive, limited
+// to chats when given.
+func collectArchiveMedia(ctx context.Context, cli *wa.Client, chats []types.JID, kinds []string) ([]mediaJobItem, error) {
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return nil, err
+	}
+	if len(kinds) == 0 {
+		kinds = []string{"image", "video", "audio", "document", "sticker"}
+	}
+	allowedChats := map[types.JID]bool{}
+	for _, chat := range chats {
+		allowedChats[chat] = true
+	}
+	var items []mediaJobItem
+	for _, msgType := range kinds {
+		rows, err := db.db.QueryContext(ctx, `SELECT `+archivedMessageColumns+` FROM wmnode_messages WHERE our_jid=$1 AND message_type=$2 ORDER BY chat, timestamp`,
+			cli.Store.GetJID().ToNonAD().String(), msgType)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			msg, err := scanArchivedMessage(rows)
+			if err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+			if len(allowedChats) > 0 && !allowedChats[msg.Chat] {
+				continue
+			}
+			if dl, kind, mimetype := downloadableFromMessage(msg.Message); dl != nil {
+				items = append(items, mediaJobItem{chat: msg.Chat, id: msg.ID, kind: kind, mimetype: mimetype, timestamp: msg.Timestamp, msg: dl})
+			}
+		}
+		err = rows.Err()
+		_ = rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func downloadWithRetry(ctx context.Context, cli *wa.Client, msg wa.DownloadableMessage, retries int, backoff time.Duration) ([]byte, error) {
+	lastErr := fmt.Errorf("invalid retry count %d", retries)
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff << (attempt - 1)):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		release, err := acquireMedia(ctx, cli)
+		if err != nil {
+			return nil, err
+		}
+		data, err := cli.Download(ctx, msg)
+		release()
+		if err == nil {
+			return data, nil
+		}
+		lastErr = err
+		if isPermanentDownloadError(err) || ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+func (job *mediaJob) emit(ev map[string]any) {
+	select {
+	case job.ch <- ev:
+	case <-job.ctx.Done():
+	}
+}
+
+func (job *mediaJob) run(cli *wa.Client, items []mediaJobItem, opts mediaJobOptions) {
+	defer close(job.done)
+	total := len(items)
+	job.emit(map[string]any{"type": "job_started", "total": total})
+
+	var mu sync.Mutex
+	var downloaded, skipped, failed int
+	progress := func(ev map[string]any) {
+		mu.Lock()
+		ev["downloaded"], ev["skipped"], ev["failed"], ev["total"] = downloaded, skipped, failed, total
+		mu.Unlock()
+		job.emit(ev)
+	}
+
+	queue := make(chan mediaJobItem)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range queue {
+				path := mediaFilePath(opts.Dir, item)
+				base := map[string]any{"chat": item.chat.String(), "id": string(item.id), "media_type": item.kind, "path": path, "timestamp": item.timestamp.Format(time.RFC3339)}
+				if !opts.Overwrite {
+					if _, err := os.Stat(path); err == nil {
+						mu.Lock()
+						skipped++
+						mu.Unlock()
+						base["type"] = "media_skipped"
+						progress(base)
+						continue
+					}
+				}
+				data, err := downloadWithRetry(job.ctx, cli, item.msg, *opts.Retries, time.Duration(opts.BackoffMs)*time.Millisecond)
+				if err == nil {
+					if err = os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+						err = os.WriteFile(path, data, 0o644)
+					}
+				}
+				if job.ctx.Err() != nil {
+					return
+				}
+				mu.Lock()
+				if err != nil {
+					failed++
+					base["type"] = "media_failed"
+					base["error"] = err.Error()
+				} else {
+					downloaded++
+					base["type"] = "media_downloaded"
+					base["size"] = len(data)
+				}
+				mu.Unlock()
+				progress(base)
+			}
+		}()
+	}
+feed:
+	for _, item := range items {
+		select {
+		case queue <- item:
+		case <-job.ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	if job.ctx.Err() != nil {
+		return
+	}
+	progress(map[string]any{"type": "job_completed"})
+}
+
+//export WmHistoryMediaJobStart
+func WmHistoryMediaJobStart(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client         uint64          `json:"client"`
+		HistorySync    json.RawMessage `json:"history_sync"`
+		HistorySyncB64 string          `json:"history_sync_b64"`
+		// "archive" walks the message archive instead of a history sync
+		Source string   `json:"source"`
+		Chats  []string `json:"chats"`
+		mediaJobOptions
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if payload.Dir == "" {
+		return fail(errors.New("dir is required"))
+	}
+	opts := payload.mediaJobOptions
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	if opts.Retries == nil {
+		retries := 3
+		opts.Retries = &retries
+	} else if *opts.Retries < 0 {
+		return fail(errors.New("retries can't be negative"))
+	}
+	if opts.BackoffMs <= 0 {
+		opts.BackoffMs = 1000
+	}
+	var items []mediaJobItem
+	switch payload.Source {
+	case "", "history_sync":
+		if len(payload.Chats) > 0 {
+			return fail(errors.New("chats is only supported with the archive source"))
+		}
+		hs, err := parseHistorySyncInput(payload.HistorySync, payload.HistorySyncB64)
+		if err != nil {
+			return fail(err)
+		}
+		items = collectHistoryMedia(cli, hs, opts.Types)
+	case "archive":
+		chats := make([]types.JID, 0, len(payload.Chats))
+		for _, raw := range payload.Chats {
+			chat, err := types.ParseJID(raw)
+			if err != nil {
+				return fail(err)
+			}
+			chats = append(chats, chat.ToNonAD())
+		}
+		var err error
+		if items, err = collectArchiveMedia(context.Background(), cli, chats, opts.Types); err != nil {
+			return fail(err)
+		}
+	default:
+		return fail(fmt.Errorf("unknown media job source: %s", payload.Source))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &mediaJob{ch: make(chan map[string]any, 128), ctx: ctx, cancel: cancel, done: make(chan struct{}), client: cli}
+	go job.run(cli, items, opts)
+	h := newHandle()
+	mediaJobsMu.Lock()
+	mediaJobs[h] = job
+	mediaJobsMu.Unlock()
+	return success(map[string]any{"handle": uint64(h), "total": len(items)})
+}
+
+//export WmMediaJobNext
+func WmMediaJobNext(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Handle    uint64 `json:"handle"`
+		TimeoutMs int    `json:"timeoutMs"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	mediaJobsMu.RLock()
+	job := mediaJobs[handle(payload.Handle)]
+	mediaJobsMu.RUnlock()
+	if job == nil {
+		return fail(errors.New("media job handle not found"))
+	}
+	var timeout <-chan time.Time
+	if payload.TimeoutMs > 0 {
+		timeout = time.After(time.Duration(payload.TimeoutMs) * time.Millisecond)
+	} else {
+		timeout = make(<-chan time.Time)
+	}
+	select {
+	case ev := <-job.ch:
+		return success(ev)
+	case <-job.done:
+		// drain anything emitted right before the job finished
+		select {
+		case ev := <-job.ch:
+			return success(ev)
+		default:
+			return success(map[string]any{"type": "closed"})
+		}
+	case <-timeout:
+		return success(map[string]any{"type": "timeout"})
+	case <-job.ctx.Done():
+		return success(map[string]any{"type": "closed"})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// recordHistorySyncChunk persists that a history sync chunk reached the bridge so
+// that consumers restarting mid-sync can tell what they still have to ingest.
+func recordHistorySyncChunk(cli *wa.Client, evt *events.HistorySync) {
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil || evt.Data == nil {
+		return
+	}
+	ourJID := cli.Store.GetJID().ToNonAD().String()
+	var messages int
+	for _, conv := range evt.Data.GetConversations() {
+		messages += len(conv.GetMessages())
+	}
+	_, err = db.db.ExecContext(context.Background(), `
+		INSERT INTO wmnode_history_sync (our_jid, sync_type, chunk_order, progress, conversations, messages, delivered_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (our_jid, sync_type, chunk_order) DO UPDATE
+			SET progress=excluded.progress, conversations=excluded.conversations, messages=excluded.messages, delivered_at=excluded.delivered_at
+	`, ourJID, evt.Data.GetSyncType().String(), int64(evt.Data.GetChunkOrder()), int64(evt.Data.GetProgress()),
+		len(evt.Data.GetConversations()), messages, time.Now().UnixMilli())
+	if err != nil {
+		cli.Log.Warnf("Failed to record history sync chunk: %v", err)
+	}
+}
+
+type historySyncChunk struct {
+	SyncType      string `json:"sync_type"`
+	ChunkOrder    int64  `json:"chunk_order"`
+	Progress      int64  `json:"progress"`
+	Conversations int64  `json:"conversations"`
+	Messages      int64  `json:"messages"`
+	DeliveredAt   string `json:"delivered_at"`
+	ProcessedAt   string `json:"processed_at,omitempty"`
+}
+
+//export WmHistorySyncMarkProcessed
+func WmHistorySyncMarkProcessed(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client     uint64 `json:"client"`
+		SyncType   string `json:"sync_type"`
+		ChunkOrder int64  `json:"chunk_order"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return fail(err)
+	}
+	res, err := db.db.ExecContext(context.Background(),
+		`UPDATE wmnode_history_sync SET processed_at=$1 WHERE our_jid=$2 AND sync_type=$3 AND chunk_order=$4`,
+		time.Now().UnixMilli(), cli.Store.GetJID().ToNonAD().String(), payload.SyncType, payload.ChunkOrder)
+	if err != nil {
+		return fail(err)
+	}
+	n, _ := res.RowsAffected()
+	return success(map[string]any{"updated": n > 0})
+}
+
+//export WmHistorySyncStatus
+func WmHistorySyncStatus(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return fail(err)
+	}
+	rows, err := db.db.QueryContext(context.Background(), `
+		SELECT sync_type, chunk_order, progress, conversations, messages, delivered_at, processed_at
+		FROM wmnode_history_sync WHERE our_jid=$1
+	`, cli.Store.GetJID().ToNonAD().String())
+	if err != nil {
+		return fail(err)
+	}
+	defer rows.Close()
+	var chunks []historySyncChunk
+	for rows.Next() {
+		var c historySyncChunk
+		var deliveredAt, processedAt int64
+		if err := rows.Scan(&c.SyncType, &c.ChunkOrder, &c.Progress, &c.Conversations, &c.Messages, &deliveredAt, &processedAt); err != nil {
+			return fail(err)
+		}
+		c.DeliveredAt = time.UnixMilli(deliveredAt).Format(time.RFC3339)
+		if processedAt > 0 {
+			c.ProcessedAt = time.UnixMilli(processedAt).Format(time.RFC3339)
+		}
+		chunks = append(chunks, c)
+	}
+	if err := rows.Err(); err != nil {
+		return fail(err)
+	}
+	sort.Slice(chunks, func(i, j int) bool {
+		if chunks[i].SyncType != chunks[j].SyncType {
+			return chunks[i].SyncType < chunks[j].SyncType
+		}
+		return chunks[i].ChunkOrder < chunks[j].ChunkOrder
+	})
+
+	// Summarize per sync type; the cursor is the last chunk of the contiguous processed prefix.
+	summaries := []map[string]any{}
+	for i := 0; i < len(chunks); {
+		j := i
+		var processed int
+		var progress int64
+		cursor := int64(-1)
+		contiguous := true
+		pending := []int64{}
+		for ; j < len(chunks) && chunks[j].SyncType == chunks[i].SyncType; j++ {
+			c := chunks[j]
+			if c.Progress > progress {
+				progress = c.Progress
+			}
+			if c.ProcessedAt != "" {
+				processed++
+				if contiguous {
+					cursor = c.ChunkOrder
+				}
+			} else {
+				contiguous = false
+				pending = append(pending, c.ChunkOrder)
+			}
+		}
+		summaries = append(summaries, map[string]any{
+			"sync_type": chunks[i].SyncType,
+			"delivered": j - i,
+			"processed": processed,
+			"pending":   pending,
+			"cursor":    cursor,
+			"progress":  progress,
+		})
+		i = j
+	}
+	if chunks == nil {
+		chunks = []historySyncChunk{}
+	}
+	return success(map[string]any{"sync_types": summaries, "chunks": chunks})
+}
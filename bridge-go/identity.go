@@ -0,0 +1,256 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// A contact's identity key changes when they reinstall or switch phones, and
+// also when someone else takes over their number. whatsmeow reports it as
+// identity_change and carries on. Deployments that must verify the new key
+// first set the client's identity policy to "quarantine": the contact is then
+// quarantined, an identity_quarantined event is emitted, and every send to
+// their direct chat fails (checked by the send gate, ratelimit.go) until Node
+// calls WmTrustIdentity. Group sends aren't blocked. Quarantined contacts are
+// stored in wmnode_identity_quarantine and stay blocked across restarts, and
+// after switching back to "auto", until trusted.
+
+const (
+	identityPolicyAuto       = "auto"
+	identityPolicyQuarantine = "quarantine"
+)
+
+var errIdentityQuarantined = errors.New("contact identity changed and is quarantined until trusted")
+
+type identityGuard struct {
+	mu         sync.Mutex
+	quarantine bool
+	loaded     bool
+	blocked    map[string]time.Time // user JID -> since
+}
+
+func (cfg *clientConfig) identityGuard() *identityGuard {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	if cfg.identity == nil {
+		cfg.identity = &identityGuard{blocked: map[string]time.Time{}}
+	}
+	return cfg.identity
+}
+
+// loadLocked reads the quarantined contacts of cli once.
+func (g *identityGuard) loadLocked(ctx context.Context, cli *wa.Client) error {
+	if g.loaded {
+		return nil
+	}
+	jid := cli.Store.GetJID()
+	if jid.IsEmpty() {
+		return nil
+	}
+	db, err := bridgeDBForDevice(cli.Store)
+	if errors.Is(err, errNoBridgeDB) {
+		g.loaded = true
+		return nil
+	} else if err != nil {
+		return err
+	}
+	rows, err := db.db.QueryContext(ctx, `SELECT jid, since FROM wmnode_identity_quarantine WHERE our_jid=$1`, jid.ToNonAD().String())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user string
+		var since int64
+		if err = rows.Scan(&user, &since); err != nil {
+			return err
+		}
+		g.blocked[user] = time.UnixMilli(since)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	g.loaded = true
+	return nil
+}
+
+// identityUser returns the user JID a quarantine is keyed by: the phone number
+// JID when a LID maps to one, so both forms of a chat hit the same entry.
+func identityUser(ctx context.Context, cli *wa.Client, jid types.JID) types.JID {
+	if jid.Server == types.HiddenUserServer {
+		if pn, err := cli.Store.LIDs.GetPNForLID(ctx, jid); err == nil && !pn.IsEmpty() {
+			jid = pn
+		}
+	}
+	return jid.ToNonAD()
+}
+
+// quarantineIdentity is called for identity_change events.
+func quarantineIdentity(cli *wa.Client, evt *events.IdentityChange) {
+	g := configFor(cli).identityGuard()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.quarantine {
+		return
+	}
+	ctx := context.Background()
+	if err := g.loadLocked(ctx, cli); err != nil {
+		cli.Log.Warnf("Failed to load quarantined identities: %v", err)
+	}
+	user := identityUser(ctx, cli, evt.JID)
+	if user.User == cli.Store.GetJID().User {
+		return
+	}
+	if _, ok := g.blocked[user.String()]; ok {
+		return
+	}
+	since := time.Now()
+	g.blocked[user.String()] = since
+	if db, err := bridgeDBForDevice(cli.Store); err == nil {
+		_, err = db.db.ExecContext(ctx, `
+			INSERT INTO wmnode_identity_quarantine (our_jid, jid, since) VALUES ($1, $2, $3)
+			ON CONFLICT (our_jid, jid) DO NOTHING
+		`, cli.Store.GetJID().ToNonAD().String(), user.String(), since.UnixMilli())
+		if err != nil {
+			cli.Log.Warnf("Failed to store quarantined identity of %s: %v", user, err)
+		}
+	}
+	emitBridgeEvent(cli, map[string]any{
+		"type":     "identity_quarantined",
+		"jid":      user.String(),
+		"changed":  evt.JID.String(),
+		"implicit": evt.Implicit,
+		"since":    since.UnixMilli(),
+	})
+}
+
+// checkIdentityQuarantine fails sends to the direct chat of a quarantined contact.
+func checkIdentityQuarantine(ctx context.Context, cli *wa.Client, chat types.JID) error {
+	if chat.Server != types.DefaultUserServer && chat.Server != types.HiddenUserServer {
+		return nil
+	}
+	g := configFor(cli).identityGuard()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.loadLocked(ctx, cli); err != nil {
+		cli.Log.Warnf("Failed to load quarantined identities: %v", err)
+	}
+	if len(g.blocked) == 0 {
+		return nil
+	}
+	user := identityUser(ctx, cli, chat)
+	if _, ok := g.blocked[user.String()]; ok {
+		return fmt.Errorf("%w: %s", errIdentityQuarantined, user)
+	}
+	return nil
+}
+
+func (g *identityGuard) statusLocked() map[string]any {
+	mode := identityPolicyAuto
+	if g.quarantine {
+		mode = identityPolicyQuarantine
+	}
+	quarantined := make([]map[string]any, 0, len(g.blocked))
+	for user, since := range g.blocked {
+		quarantined = append(quarantined, map[string]any{"jid": user, "since": since.UnixMilli()})
+	}
+	sort.Slice(quarantined, func(i, j int) bool { return quarantined[i]["jid"].(string) < quarantined[j]["jid"].(string) })
+	return map[string]any{"mode": mode, "quarantined": quarantined}
+}
+
+//export WmClientSetIdentityPolicy
+func WmClientSetIdentityPolicy(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	// mode is "auto" (default) or "quarantine"; omit it to read the policy
+	var payload struct {
+		Client uint64 `json:"client"`
+		Mode   string `json:"mode"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	g := configFor(cli).identityGuard()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch payload.Mode {
+	case "":
+	case identityPolicyAuto:
+		g.quarantine = false
+	case identityPolicyQuarantine:
+		g.quarantine = true
+	default:
+		return fail(fmt.Errorf("unknown identity policy mode: %s", payload.Mode))
+	}
+	if err := g.loadLocked(context.Background(), cli); err != nil {
+		return fail(err)
+	}
+	return success(g.statusLocked())
+}
+
+//export WmTrustIdentity
+func WmTrustIdentity(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		JID    string `json:"jid"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	jid, err := types.ParseJID(payload.JID)
+	if err != nil {
+		return fail(err)
+	}
+	ctx := context.Background()
+	user := identityUser(ctx, cli, jid)
+	g := configFor(cli).identityGuard()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err = g.loadLocked(ctx, cli); err != nil {
+		return fail(err)
+	}
+	_, wasQuarantined := g.blocked[user.String()]
+	if db, err := bridgeDBForDevice(cli.Store); err == nil {
+		_, err = db.db.ExecContext(ctx, `DELETE FROM wmnode_identity_quarantine WHERE our_jid=$1 AND jid=$2`,
+			cli.Store.GetJID().ToNonAD().String(), user.String())
+		if err != nil {
+			return fail(err)
+		}
+	}
+	delete(g.blocked, user.String())
+	// without auto trust whatsmeow kept the old key, forget it so the new one is accepted
+	if !cli.AutoTrustIdentity {
+		forms := []types.JID{user}
+		if lid, err := cli.Store.LIDs.GetLIDForPN(ctx, user); err == nil && !lid.IsEmpty() {
+			forms = append(forms, lid)
+		} else if jid.Server == types.HiddenUserServer {
+			forms = append(forms, jid)
+		}
+		for _, form := range forms {
+			if err = cli.Store.Identities.DeleteAllIdentities(ctx, form.SignalAddressUser()); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	return success(map[string]any{"jid": user.String(), "was_quarantined": wasQuarantined})
+}
@@ -0,0 +1,204 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// A fleet of mostly dormant accounts keeps a socket and keepalives per client.
+// With WmClientSetIdlePolicy a client that sees no activity from Node for
+// idle_ms is disconnected (it stays registered and keeps its handle) and
+// reported as connection_state "idle". The next client export made for it that
+// needs the connection (see beginClientCall) reconnects first, waiting up to
+// wake_timeout_ms for the session to log in again. Those exports are the
+// activity; events, background work of the bridge and exports that only read
+// or change local state don't count, and an explicit WmClientDisconnect isn't
+// undone by the next call.
+
+type idlePolicy struct {
+	IdleMs        int64 `json:"idle_ms"`
+	WakeTimeoutMs int64 `json:"wake_timeout_ms"`
+}
+
+type idleWatcher struct {
+	policy idlePolicy
+
+	mu     sync.Mutex
+	last   time.Time   // of the last activity
+	timer  *time.Timer // fires when the client may have gone idle
+	parked bool        // disconnected by the policy
+	waking *idleWake   // reconnect of the parked client in progress
+}
+
+type idleWake struct {
+	done chan struct{}
+	err  error // set before done is closed
+}
+
+func (cfg *clientConfig) idleWatcher() *idleWatcher {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.idle
+}
+
+func stopIdleWatch(cli *wa.Client) {
+	if w := configFor(cli).idleWatcher(); w != nil {
+		w.mu.Lock()
+		if w.timer != nil {
+			w.timer.Stop()
+			w.timer = nil
+		}
+		w.parked = false
+		w.mu.Unlock()
+	}
+}
+
+// touch records activity and pushes the idle check back.
+func (w *idleWatcher) touch(cli *wa.Client) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last = time.Now()
+	w.scheduleLocked(cli, time.Duration(w.policy.IdleMs)*time.Millisecond)
+}
+
+func (w *idleWatcher) scheduleLocked(cli *wa.Client, after time.Duration) {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(after, func() {
+		submitTask(cli, func() { w.check(cli) })
+	})
+}
+
+// check parks the client if it has been idle long enough.
+func (w *idleWatcher) check(cli *wa.Client) {
+	w.mu.Lock()
+	idle := time.Duration(w.policy.IdleMs) * time.Millisecond
+	if left := idle - time.Since(w.last); left > 0 {
+		w.scheduleLocked(cli, left)
+		w.mu.Unlock()
+		return
+	}
+	w.timer = nil
+	if w.parked || !cli.IsConnected() {
+		w.mu.Unlock()
+		return
+	}
+	w.parked = true
+	w.mu.Unlock()
+	// an outage being handled would reconnect it right away
+	stopReconnect(cli)
+	cli.Disconnect()
+	emitConnectionState(cli, "idle", map[string]any{"idle_ms": time.Since(w.last).Milliseconds()})
+}
+
+// wake reconnects a parked client. Concurrent calls wait for the same
+// reconnect, without holding w.mu so activity can still be recorded meanwhile.
+func (w *idleWatcher) wake(cli *wa.Client) error {
+	w.mu.Lock()
+	if !w.parked {
+		w.mu.Unlock()
+		return nil
+	}
+	if wk := w.waking; wk != nil {
+		w.mu.Unlock()
+		<-wk.done
+		return wk.err
+	}
+	wk := &idleWake{done: make(chan struct{})}
+	w.waking = wk
+	w.mu.Unlock()
+	defer close(wk.done)
+
+	emitConnectionState(cli, "connecting", nil)
+	err := connectClient(cli)
+	connected := err == nil || errors.Is(err, wa.ErrAlreadyConnected)
+	if !connected {
+		wk.err = fmt.Errorf("failed to reconnect idle client: %w", err)
+	} else if !cli.WaitForConnection(time.Duration(w.policy.WakeTimeoutMs) * time.Millisecond) {
+		wk.err = errors.New("timed out waiting for the idle client to reconnect")
+	}
+	w.mu.Lock()
+	w.waking = nil
+	// a login that timed out may still complete, the client isn't parked either way
+	if connected {
+		w.parked = false
+	}
+	w.mu.Unlock()
+	return wk.err
+}
+
+// wakeIdleClient is called before Node-initiated work on cli: it counts as
+// activity and reconnects the client if the idle policy disconnected it.
+func wakeIdleClient(cli *wa.Client) error {
+	w := configFor(cli).idleWatcher()
+	if w == nil {
+		return nil
+	}
+	w.touch(cli)
+	return w.wake(cli)
+}
+
+// resetIdle records an explicit connect or disconnect, which ends any parking.
+func resetIdle(cli *wa.Client) {
+	if w := configFor(cli).idleWatcher(); w != nil {
+		w.touch(cli)
+		w.mu.Lock()
+		w.parked = false
+		w.mu.Unlock()
+	}
+}
+
+func idleParked(cli *wa.Client) bool {
+	w := configFor(cli).idleWatcher()
+	if w == nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.parked
+}
+
+//export WmClientSetIdlePolicy
+func WmClientSetIdlePolicy(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client  uint64 `json:"client"`
+		Enabled bool   `json:"enabled"`
+		idlePolicy
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	policy := payload.idlePolicy
+	if payload.Enabled && policy.IdleMs <= 0 {
+		return fail(errors.New("idle_ms is required"))
+	}
+	if policy.WakeTimeoutMs <= 0 {
+		policy.WakeTimeoutMs = 30_000
+	}
+	stopIdleWatch(cli)
+	cfg := configFor(cli)
+	cfg.mu.Lock()
+	cfg.idle = nil
+	if payload.Enabled {
+		cfg.idle = &idleWatcher{policy: policy}
+	}
+	cfg.mu.Unlock()
+	if !payload.Enabled {
+		return success(map[string]any{"enabled": false})
+	}
+	cfg.idleWatcher().touch(cli)
+	return success(map[string]any{"enabled": true, "policy": policy})
+}
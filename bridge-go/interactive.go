@@ -0,0 +1,253 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	wa "go.mau.fi/whatsmeow"
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Native flow messages are interactive messages whose buttons (quick_reply,
+// cta_url, single_select, ...) carry their parameters as JSON strings, and
+// whose answers are interactiveResponseMessages with the parameters of the
+// tapped button. WmClientSendInteractive builds them from plain objects, and
+// message events get "native_flow" / "native_flow_response" objects with the
+// JSON already parsed. Phones only render them with the biz node official
+// clients add, so it's sent along.
+
+type nativeFlowButton struct {
+	Name   string          `json:"name"`
+	Params json.RawMessage `json:"params"`
+}
+
+// paramsJSON returns the JSON text of params, which may be an object or a
+// string that already holds JSON.
+func paramsJSON(params json.RawMessage) (string, error) {
+	if len(params) == 0 || string(params) == "null" {
+		return "{}", nil
+	}
+	var s string
+	if json.Unmarshal(params, &s) == nil {
+		if !json.Valid([]byte(s)) {
+			return "", errors.New("params string is not JSON")
+		}
+		return s, nil
+	}
+	return string(params), nil
+}
+
+// parsedParams is the inverse of paramsJSON, keeping invalid JSON as a string.
+func parsedParams(s string) any {
+	if s != "" && json.Valid([]byte(s)) {
+		return json.RawMessage(s)
+	}
+	return s
+}
+
+// linkNativeFlow returns the fields to attach to the message event of a native
+// flow message or response, or nil for other messages.
+func linkNativeFlow(evt *events.Message) map[string]any {
+	if flow := evt.Message.GetInteractiveMessage().GetNativeFlowMessage(); flow != nil {
+		buttons := make([]map[string]any, len(flow.GetButtons()))
+		for i, btn := range flow.GetButtons() {
+			buttons[i] = map[string]any{"name": btn.GetName(), "params": parsedParams(btn.GetButtonParamsJSON())}
+		}
+		return map[string]any{"native_flow": map[string]any{
+			"buttons":         buttons,
+			"message_params":  parsedParams(flow.GetMessageParamsJSON()),
+			"message_version": flow.GetMessageVersion(),
+		}}
+	}
+	resp := evt.Message.GetInteractiveResponseMessage()
+	if flow := resp.GetNativeFlowResponseMessage(); flow != nil {
+		out := map[string]any{
+			"name":    flow.GetName(),
+			"params":  parsedParams(flow.GetParamsJSON()),
+			"version": flow.GetVersion(),
+			"body":    resp.GetBody().GetText(),
+		}
+		if ctx := resp.GetContextInfo(); ctx.GetStanzaID() != "" {
+			out["quoted_id"] = ctx.GetStanzaID()
+		}
+		return map[string]any{"native_flow_response": out}
+	}
+	return nil
+}
+
+func sendInteractive(cli *wa.Client, to string, msg *waE2E.Message, biz waBinary.Node, idempotencyKey string) *C.char {
+	jid, err := types.ParseJID(to)
+	if err != nil {
+		return fail(err)
+	}
+	nodes := []waBinary.Node{biz}
+	extra := wa.SendRequestExtra{AdditionalNodes: &nodes}
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	if err := throttleSend(ctx, cli, jid); err != nil {
+		return fail(err)
+	}
+	resp, err := cli.SendMessage(ctx, jid, msg, sendExtra(cli, []wa.SendRequestExtra{extra}, idempotencyKey)...)
+	if err != nil {
+		return fail(err)
+	}
+	enc, err := encodeReturn(reflect.ValueOf(resp))
+	if err != nil {
+		return fail(err)
+	}
+	return success(enc)
+}
+
+//export WmClientSendInteractive
+func WmClientSendInteractive(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		To     string `json:"to"`
+		// InteractiveMessage.Header in protojson form ({title, subtitle, imageMessage, ...})
+		Header        json.RawMessage    `json:"header"`
+		Body          string             `json:"body"`
+		Footer        string             `json:"footer"`
+		Buttons       []nativeFlowButton `json:"buttons"`
+		MessageParams json.RawMessage    `json:"message_params"`
+		// a whole InteractiveMessage in protojson form instead of the fields above
+		Interactive    json.RawMessage `json:"interactive"`
+		IdempotencyKey string          `json:"idempotency_key"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	interactive := &waE2E.InteractiveMessage{}
+	if len(payload.Interactive) > 0 {
+		if err := protojson.Unmarshal(payload.Interactive, interactive); err != nil {
+			return fail(fmt.Errorf("invalid interactive: %w", err))
+		}
+	} else {
+		if len(payload.Buttons) == 0 {
+			return fail(errors.New("buttons or interactive is required"))
+		}
+		flow := &waE2E.InteractiveMessage_NativeFlowMessage{MessageVersion: proto.Int32(1)}
+		for i, btn := range payload.Buttons {
+			params, err := paramsJSON(btn.Params)
+			if err != nil || btn.Name == "" {
+				return fail(fmt.Errorf("button %d needs a name and JSON params", i))
+			}
+			flow.Buttons = append(flow.Buttons, &waE2E.InteractiveMessage_NativeFlowMessage_NativeFlowButton{
+				Name:             proto.String(btn.Name),
+				ButtonParamsJSON: proto.String(params),
+			})
+		}
+		if len(payload.MessageParams) > 0 {
+			params, err := paramsJSON(payload.MessageParams)
+			if err != nil {
+				return fail(fmt.Errorf("message_params: %w", err))
+			}
+			flow.MessageParamsJSON = proto.String(params)
+		}
+		interactive.InteractiveMessage = &waE2E.InteractiveMessage_NativeFlowMessage_{NativeFlowMessage: flow}
+		interactive.Body = &waE2E.InteractiveMessage_Body{Text: proto.String(payload.Body)}
+		if payload.Footer != "" {
+			interactive.Footer = &waE2E.InteractiveMessage_Footer{Text: proto.String(payload.Footer)}
+		}
+		if len(payload.Header) > 0 {
+			interactive.Header = &waE2E.InteractiveMessage_Header{}
+			if err := protojson.Unmarshal(payload.Header, interactive.Header); err != nil {
+				return fail(fmt.Errorf("invalid header: %w", err))
+			}
+		}
+	}
+	// like the official clients, wrap it so older clients show a fallback
+	msg := &waE2E.Message{ViewOnceMessage: &waE2E.FutureProofMessage{Message: &waE2E.Message{
+		MessageContextInfo: &waE2E.MessageContextInfo{
+			DeviceListMetadata:        &waE2E.DeviceListMetadata{},
+			DeviceListMetadataVersion: proto.Int32(2),
+		},
+		InteractiveMessage: interactive,
+	}}}
+	biz := waBinary.Node{Tag: "biz", Content: []waBinary.Node{{
+		Tag:   "interactive",
+		Attrs: waBinary.Attrs{"type": "native_flow", "v": "1"},
+		Content: []waBinary.Node{{
+			Tag:   "native_flow",
+			Attrs: waBinary.Attrs{"v": "9", "name": "mixed"},
+		}},
+	}}}
+	return sendInteractive(cli, payload.To, msg, biz, payload.IdempotencyKey)
+}
+
+//export WmClientSendInteractiveResponse
+func WmClientSendInteractiveResponse(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client  uint64          `json:"client"`
+		To      string          `json:"to"`
+		Name    string          `json:"name"`
+		Params  json.RawMessage `json:"params"`
+		Version int32           `json:"version"`
+		Body    string          `json:"body"`
+		// the interactive message being answered
+		QuotedID       string `json:"quoted_id"`
+		QuotedSender   string `json:"quoted_sender"`
+		IdempotencyKey string `json:"idempotency_key"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if payload.Name == "" {
+		return fail(errors.New("name is required"))
+	}
+	params, err := paramsJSON(payload.Params)
+	if err != nil {
+		return fail(err)
+	}
+	if payload.Version == 0 {
+		payload.Version = 3
+	}
+	resp := &waE2E.InteractiveResponseMessage{
+		Body: &waE2E.InteractiveResponseMessage_Body{
+			Text:   proto.String(payload.Body),
+			Format: waE2E.InteractiveResponseMessage_Body_DEFAULT.Enum(),
+		},
+		InteractiveResponseMessage: &waE2E.InteractiveResponseMessage_NativeFlowResponseMessage_{
+			NativeFlowResponseMessage: &waE2E.InteractiveResponseMessage_NativeFlowResponseMessage{
+				Name:       proto.String(payload.Name),
+				ParamsJSON: proto.String(params),
+				Version:    proto.Int32(payload.Version),
+			},
+		},
+	}
+	if payload.QuotedID != "" {
+		resp.ContextInfo = &waE2E.ContextInfo{StanzaID: proto.String(payload.QuotedID)}
+		if payload.QuotedSender != "" {
+			resp.ContextInfo.Participant = proto.String(payload.QuotedSender)
+		}
+	}
+	biz := waBinary.Node{Tag: "biz", Content: []waBinary.Node{{
+		Tag:   "interactive",
+		Attrs: waBinary.Attrs{"type": "native_flow", "v": "1"},
+		Content: []waBinary.Node{{
+			Tag:   "native_flow",
+			Attrs: waBinary.Attrs{"v": "9", "name": payload.Name},
+		}},
+	}}}
+	return sendInteractive(cli, payload.To, &waE2E.Message{InteractiveResponseMessage: resp}, biz, payload.IdempotencyKey)
+}
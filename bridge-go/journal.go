@@ -0,0 +1,194 @@
+package main
+
+import "C"
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// eventJournal appends every serialized event of a client to the container DB
+// with a per-account monotonic sequence number, so a restarted Node process can
+// replay what it hadn't consumed yet.
+type eventJournal struct {
+	mu     sync.Mutex
+	db     *bridgeDB
+	ourJID string
+	seq    int64
+}
+
+func (cfg *clientConfig) eventJournal() *eventJournal {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.journal
+}
+
+// append stores ev and sets its "seq" field. Failures are logged and leave ev unnumbered.
+func (j *eventJournal) append(cli *wa.Client, ev map[string]any) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	ctx := context.Background()
+	ourJID := cli.Store.GetJID().ToNonAD().String()
+	if ourJID != j.ourJID {
+		// the device was paired since the journal was enabled, continue that account's sequence
+		seq, err := maxJournalSeq(ctx, j.db, ourJID)
+		if err != nil {
+			cli.Log.Warnf("Failed to load event journal sequence: %v", err)
+			return
+		}
+		j.ourJID, j.seq = ourJID, seq
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		cli.Log.Warnf("Failed to marshal event for journal: %v", err)
+		return
+	}
+	eventType, _ := ev["type"].(string)
+	_, err = j.db.db.ExecContext(ctx,
+		`INSERT INTO wmnode_event_journal (our_jid, seq, event_type, created_at, payload) VALUES ($1, $2, $3, $4, $5)`,
+		ourJID, j.seq+1, eventType, time.Now().UnixMilli(), string(data))
+	if err != nil {
+		cli.Log.Warnf("Failed to write %s event to journal: %v", eventType, err)
+		return
+	}
+	j.seq++
+	ev["seq"] = j.seq
+}
+
+func maxJournalSeq(ctx context.Context, db *bridgeDB, ourJID string) (int64, error) {
+	var seq sql.NullInt64
+	err := db.db.QueryRowContext(ctx, `SELECT MAX(seq) FROM wmnode_event_journal WHERE our_jid=$1`, ourJID).Scan(&seq)
+	return seq.Int64, err
+}
+
+//export WmClientSetEventJournal
+func WmClientSetEventJournal(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client  uint64 `json:"client"`
+		Enabled bool   `json:"enabled"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	cfg := configFor(cli)
+	if !payload.Enabled {
+		cfg.mu.Lock()
+		cfg.journal = nil
+		cfg.mu.Unlock()
+		return success(map[string]any{"enabled": false})
+	}
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return fail(err)
+	}
+	ourJID := cli.Store.GetJID().ToNonAD().String()
+	seq, err := maxJournalSeq(context.Background(), db, ourJID)
+	if err != nil {
+		return fail(err)
+	}
+	cfg.mu.Lock()
+	if cfg.journal == nil {
+		cfg.journal = &eventJournal{db: db, ourJID: ourJID, seq: seq}
+	}
+	cfg.mu.Unlock()
+	return success(map[string]any{"enabled": true, "last_seq": seq})
+}
+
+//export WmEventReplay
+func WmEventReplay(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client  uint64 `json:"client"`
+		FromSeq int64  `json:"fromSeq"`
+		Limit   int    `json:"limit"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return fail(err)
+	}
+	if payload.Limit <= 0 {
+		payload.Limit = 500
+	}
+	ctx := context.Background()
+	ourJID := cli.Store.GetJID().ToNonAD().String()
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT seq, payload FROM wmnode_event_journal WHERE our_jid=$1 AND seq>=$2 ORDER BY seq LIMIT $3`,
+		ourJID, payload.FromSeq, payload.Limit)
+	if err != nil {
+		return fail(err)
+	}
+	defer rows.Close()
+	evts := []json.RawMessage{}
+	nextSeq := payload.FromSeq
+	for rows.Next() {
+		var seq int64
+		var data string
+		if err := rows.Scan(&seq, &data); err != nil {
+			return fail(err)
+		}
+		evts = append(evts, json.RawMessage(data))
+		nextSeq = seq + 1
+	}
+	if err := rows.Err(); err != nil {
+		return fail(err)
+	}
+	lastSeq, err := maxJournalSeq(ctx, db, ourJID)
+	if err != nil {
+		return fail(err)
+	}
+	return success(map[string]any{"events": evts, "next_seq": nextSeq, "last_seq": lastSeq})
+}
+
+//export WmEventJournalTrim
+func WmEventJournalTrim(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client    uint64 `json:"client"`
+		BeforeSeq int64  `json:"beforeSeq"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return fail(err)
+	}
+	ctx := context.Background()
+	ourJID := cli.Store.GetJID().ToNonAD().String()
+	lastSeq, err := maxJournalSeq(ctx, db, ourJID)
+	if err != nil {
+		return fail(err)
+	}
+	// always keep the newest entry, otherwise the sequence would restart after a reload
+	res, err := db.db.ExecContext(ctx, `DELETE FROM wmnode_event_journal WHERE our_jid=$1 AND seq<$2`,
+		ourJID, min(payload.BeforeSeq, lastSeq))
+	if err != nil {
+		return fail(err)
+	}
+	n, _ := res.RowsAffected()
+	return success(map[string]any{"deleted": n})
+}
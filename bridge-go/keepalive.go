@@ -0,0 +1,194 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// whatsmeow pings the server every 20-30s and reports KeepAliveTimeout when a
+// ping goes unanswered for 10s, which behind a flaky NAT means constant churn.
+// WmSetKeepalive changes those timings. They are process-wide variables of
+// whatsmeow that every connected client's keepalive loop reads without a lock,
+// so they can only be changed while no client is connected: set them before
+// connecting the first one.
+//
+// whatsmeow doesn't report answered pings, so their round trip is measured
+// from the nodes on the Client/Send and Client/Recv debug loggers: a w:p ping
+// going out and the result with the same id coming back. WmClientHealth shows
+// the last and average round trip (health pings included).
+
+type pingRTT struct {
+	mu      sync.Mutex
+	pending map[string]time.Time // ping id -> sent
+	last    time.Duration
+	avg     time.Duration // exponential moving average
+	samples int
+}
+
+// pingRTTs is keyed by client handle, which is all a logger knows.
+var pingRTTs sync.Map // handle -> *pingRTT
+
+func pingRTTFor(client handle) *pingRTT {
+	v, _ := pingRTTs.LoadOrStore(client, &pingRTT{pending: map[string]time.Time{}})
+	return v.(*pingRTT)
+}
+
+// xmlAttr returns the value of attr in the opening tag of an XML node string.
+func xmlAttr(node, attr string) string {
+	end := strings.IndexByte(node, '>')
+	if end < 0 {
+		return ""
+	}
+	i := strings.Index(node[:end], " "+attr+`="`)
+	if i < 0 {
+		return ""
+	}
+	rest := node[i+len(attr)+3 : end]
+	if j := strings.IndexByte(rest, '"'); j >= 0 {
+		return rest[:j]
+	}
+	return ""
+}
+
+// trackPingLine is called for the debug lines of client loggers.
+func trackPingLine(client handle, module, msg string, args []interface{}) {
+	if msg != "%s" || len(args) != 1 {
+		return
+	}
+	node, ok := args[0].(string)
+	if !ok || !strings.HasPrefix(node, "<iq ") {
+		return
+	}
+	switch {
+	case strings.HasSuffix(module, "/Send"):
+		if !strings.Contains(node, `xmlns="w:p"`) || !strings.Contains(node, "<ping") {
+			return
+		}
+		id := xmlAttr(node, "id")
+		if id == "" {
+			return
+		}
+		p := pingRTTFor(client)
+		now := time.Now()
+		p.mu.Lock()
+		for k, sent := range p.pending {
+			if now.Sub(sent) > time.Minute {
+				delete(p.pending, k)
+			}
+		}
+		p.pending[id] = now
+		p.mu.Unlock()
+	case strings.HasSuffix(module, "/Recv"):
+		v, ok := pingRTTs.Load(client)
+		if !ok {
+			return
+		}
+		p := v.(*pingRTT)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if len(p.pending) == 0 {
+			return
+		}
+		id := xmlAttr(node, "id")
+		sent, ok := p.pending[id]
+		if !ok {
+			return
+		}
+		delete(p.pending, id)
+		p.last = time.Since(sent)
+		if p.samples == 0 {
+			p.avg = p.last
+		} else {
+			p.avg += (p.last - p.avg) / 8
+		}
+		p.samples++
+	}
+}
+
+func dropPingRTT(client handle) {
+	pingRTTs.Delete(client)
+}
+
+// rttStats returns the round trip fields of WmClientHealth's keepalive object.
+func rttStats(client handle) map[string]any {
+	out := map[string]any{"rtt_ms": nil, "avg_rtt_ms": nil, "rtt_samples": 0}
+	v, ok := pingRTTs.Load(client)
+	if !ok {
+		return out
+	}
+	p := v.(*pingRTT)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.samples > 0 {
+		out["rtt_ms"] = p.last.Milliseconds()
+		out["avg_rtt_ms"] = p.avg.Milliseconds()
+		out["rtt_samples"] = p.samples
+	}
+	return out
+}
+
+func keepaliveSettings() map[string]any {
+	return map[string]any{
+		"interval_min_ms":      wa.KeepAliveIntervalMin.Milliseconds(),
+		"interval_max_ms":      wa.KeepAliveIntervalMax.Milliseconds(),
+		"response_deadline_ms": wa.KeepAliveResponseDeadline.Milliseconds(),
+		"max_fail_time_ms":     wa.KeepAliveMaxFailTime.Milliseconds(),
+	}
+}
+
+//export WmSetKeepalive
+func WmSetKeepalive(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	// unset fields keep their current value; pass {} to read them
+	var payload struct {
+		IntervalMinMs      int64 `json:"interval_min_ms"`
+		IntervalMaxMs      int64 `json:"interval_max_ms"`
+		ResponseDeadlineMs int64 `json:"response_deadline_ms"`
+		MaxFailTimeMs      int64 `json:"max_fail_time_ms"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	ms := func(v int64, cur time.Duration) time.Duration {
+		if v > 0 {
+			return time.Duration(v) * time.Millisecond
+		}
+		return cur
+	}
+	if payload.IntervalMinMs <= 0 && payload.IntervalMaxMs <= 0 && payload.ResponseDeadlineMs <= 0 && payload.MaxFailTimeMs <= 0 {
+		return success(keepaliveSettings())
+	}
+	minInterval := ms(payload.IntervalMinMs, wa.KeepAliveIntervalMin)
+	maxInterval := ms(payload.IntervalMaxMs, wa.KeepAliveIntervalMax)
+	// the keepalive loop picks a random interval in [min, max), which panics on an empty range
+	if maxInterval-minInterval < time.Millisecond {
+		return fail(fmt.Errorf("interval_max_ms (%d) must be at least 1ms above interval_min_ms (%d)", maxInterval.Milliseconds(), minInterval.Milliseconds()))
+	}
+	end, err := beginCall()
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	clientsMu.RLock()
+	connected := 0
+	for _, cli := range clients {
+		if cli.IsConnected() {
+			connected++
+		}
+	}
+	clientsMu.RUnlock()
+	if connected > 0 {
+		return fail(fmt.Errorf("keepalive settings can't change while clients are connected (%d connected)", connected))
+	}
+	wa.KeepAliveIntervalMin = minInterval
+	wa.KeepAliveIntervalMax = maxInterval
+	wa.KeepAliveResponseDeadline = ms(payload.ResponseDeadlineMs, wa.KeepAliveResponseDeadline)
+	wa.KeepAliveMaxFailTime = ms(payload.MaxFailTimeMs, wa.KeepAliveMaxFailTime)
+	return success(keepaliveSettings())
+}
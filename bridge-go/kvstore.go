@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/util/keys"
+)
+
+// kvStore implements the whatsmeow key stores on a storeBackend. Keys mirror the
+// sqlstore columns: signal addresses are "user:device", so everything of a phone
+// number can be found with the prefix "user:". Namespaces:
+//
+//	identity           address -> 32 byte identity key
+//	session            address -> serialized session
+//	prekey             key ID -> uploaded flag byte + 32 byte private key
+//	sender_key         user|group -> serialized sender key
+//	app_state_sync_key hex(key ID) -> JSON AppStateSyncKey
+//	app_state_version  name -> JSON {version, hash}
+//	app_state_mac      name|hex(index MAC) -> JSON {version, value_mac}
+//	meta               next_prekey_id -> decimal counter
+type kvStore struct {
+	backend *storeBackend
+	scope   string
+	// serializes pre-key ID allocation, which is a read-modify-write of the counter
+	preKeyMu sync.Mutex
+}
+
+const (
+	kvIdentity        = "identity"
+	kvSession         = "session"
+	kvPreKey          = "prekey"
+	kvSenderKey       = "sender_key"
+	kvAppStateSyncKey = "app_state_sync_key"
+	kvAppStateVersion = "app_state_version"
+	kvAppStateMAC     = "app_state_mac"
+	kvMeta            = "meta"
+)
+
+var (
+	_ store.IdentityStore        = (*kvStore)(nil)
+	_ store.SessionStore         = (*kvStore)(nil)
+	_ store.PreKeyStore          = (*kvStore)(nil)
+	_ store.SenderKeyStore       = (*kvStore)(nil)
+	_ store.AppStateSyncKeyStore = (*kvStore)(nil)
+	_ store.AppStateStore        = (*kvStore)(nil)
+)
+
+func (s *kvStore) get(ctx context.Context, ns, key string) ([]byte, error) {
+	reply, err := s.backend.do(ctx, &storeRequest{Op: "get", Scope: s.scope, Namespace: ns, Key: key})
+	return reply.Value, err
+}
+
+func (s *kvStore) put(ctx context.Context, ns, key string, value []byte) error {
+	_, err := s.backend.do(ctx, &storeRequest{Op: "put", Scope: s.scope, Namespace: ns, Key: key, Value: value})
+	return err
+}
+
+func (s *kvStore) delete(ctx context.Context, ns, key string) error {
+	_, err := s.backend.do(ctx, &storeRequest{Op: "delete", Scope: s.scope, Namespace: ns, Key: key})
+	return err
+}
+
+func (s *kvStore) deletePrefix(ctx context.Context, ns, prefix string) error {
+	_, err := s.backend.do(ctx, &storeRequest{Op: "delete_prefix", Scope: s.scope, Namespace: ns, Prefix: prefix})
+	return err
+}
+
+func (s *kvStore) scan(ctx context.Context, ns, prefix string) ([]storeEntry, error) {
+	reply, err := s.backend.do(ctx, &storeRequest{Op: "scan", Scope: s.scope, Namespace: ns, Prefix: prefix})
+	return reply.Entries, err
+}
+
+// --- identities ---
+
+func (s *kvStore) PutIdentity(ctx context.Context, address string, key [32]byte) error {
+	return s.put(ctx, kvIdentity, address, key[:])
+}
+
+func (s *kvStore) DeleteAllIdentities(ctx context.Context, phone string) error {
+	return s.deletePrefix(ctx, kvIdentity, phone+":")
+}
+
+func (s *kvStore) DeleteIdentity(ctx context.Context, address string) error {
+	return s.delete(ctx, kvIdentity, address)
+}
+
+func (s *kvStore) IsTrustedIdentity(ctx context.Context, address string, key [32]byte) (bool, error) {
+	existing, err := s.get(ctx, kvIdentity, address)
+	if err != nil {
+		return false, err
+	}
+	// trust on first use, like sqlstore
+	return existing == nil || bytes.Equal(existing, key[:]), nil
+}
+
+// --- sessions ---
+
+func (s *kvStore) GetSession(ctx context.Context, address string) ([]byte, error) {
+	return s.get(ctx, kvSession, address)
+}
+
+func (s *kvStore) HasSession(ctx context.Context, address string) (bool, error) {
+	session, err := s.get(ctx, kvSession, address)
+	return session != nil, err
+}
+
+func (s *kvStore) GetManySessions(ctx context.Context, addresses []string) (map[string][]byte, error) {
+	out := make(map[string][]byte, len(addresses))
+	for _, address := range addresses {
+		session, err := s.get(ctx, kvSession, address)
+		if err != nil {
+			return nil, err
+		}
+		out[address] = session
+	}
+	return out, nil
+}
+
+func (s *kvStore) PutSession(ctx context.Context, address string, session []byte) error {
+	return s.put(ctx, kvSession, address, session)
+}
+
+func (s *kvStore) PutManySessions(ctx context.Context, sessions map[string][]byte) error {
+	for address, session := range sessions {
+		if err := s.put(ctx, kvSession, address, session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *kvStore) DeleteAllSessions(ctx context.Context, phone string) error {
+	return s.deletePrefix(ctx, kvSession, phone+":")
+}
+
+func (s *kvStore) DeleteSession(ctx context.Context, address string) error {
+	return s.delete(ctx, kvSession, address)
+}
+
+// MigratePNToLID copies sessions, identities and sender keys of a phone number
+// to its LID, keeping any the LID already has, and removes the phone number ones.
+func (s *kvStore) MigratePNToLID(ctx context.Context, pn, lid types.JID) error {
+	pnPrefix, lidPrefix := pn.SignalAddressUser()+":", lid.SignalAddressUser()+":"
+	for _, ns := range []string{kvSession, kvIdentity, kvSenderKey} {
+		entries, err := s.scan(ctx, ns, pnPrefix)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		existing, err := s.scan(ctx, ns, lidPrefix)
+		if err != nil {
+			return err
+		}
+		have := make(map[string]bool, len(existing))
+		for _, e := range existing {
+			have[e.Key] = true
+		}
+		for _, e := range entries {
+			newKey := lidPrefix + strings.TrimPrefix(e.Key, pnPrefix)
+			if have[newKey] {
+				continue
+			}
+			if err = s.put(ctx, ns, newKey, e.Value); err != nil {
+				return err
+			}
+		}
+		if err = s.deletePrefix(ctx, ns, pnPrefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- pre-keys ---
+
+func encodePreKey(key *keys.PreKey, uploaded bool) []byte {
+	out := make([]byte, 0, 33)
+	if uploaded {
+		out = append(out, 1)
+	} else {
+		out = append(out, 0)
+	}
+	return append(out, key.Priv[:]...)
+}
+
+func decodePreKey(id uint32, value []byte) (*keys.PreKey, bool, error) {
+	if len(value) != 33 {
+		return nil, false, fmt.Errorf("invalid stored pre-key %d (%d bytes)", id, len(value))
+	}
+	kp := keys.NewKeyPairFromPrivateKey([32]byte(value[1:]))
+	return &keys.PreKey{KeyPair: *kp, KeyID: id}, value[0] == 1, nil
+}
+
+type storedPreKey struct {
+	key      *keys.PreKey
+	uploaded bool
+}
+
+func (s *kvStore) allPreKeys(ctx context.Context) ([]storedPreKey, error) {
+	entries, err := s.scan(ctx, kvPreKey, "")
+	if err != nil {
+		return nil, err
+	}
+	out := make([]storedPreKey, 0, len(entries))
+	for _, e := range entries {
+		id, err := strconv.ParseUint(e.Key, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored pre-key ID %q", e.Key)
+		}
+		key, uploaded, err := decodePreKey(uint32(id), e.Value)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, storedPreKey{key, uploaded})
+	}
+	slices.SortFunc(out, func(a, b storedPreKey) int { return cmp.Compare(a.key.KeyID, b.key.KeyID) })
+	return out, nil
+}
+
+func (s *kvStore) genPreKeys(ctx context.Context, count int) ([]*keys.PreKey, error) {
+	raw, err := s.get(ctx, kvMeta, "next_prekey_id")
+	if err != nil {
+		return nil, err
+	}
+	nextID := uint64(1)
+	if raw != nil {
+		if nextID, err = strconv.ParseUint(string(raw), 10, 32); err != nil {
+			return nil, fmt.Errorf("invalid stored next_prekey_id %q", raw)
+		}
+	}
+	out := make([]*keys.PreKey, count)
+	for i := range out {
+		out[i] = keys.NewPreKey(uint32(nextID))
+		nextID++
+	}
+	// bump the counter first so a failure halfway can't hand out an ID twice
+	if err = s.put(ctx, kvMeta, "next_prekey_id", []byte(strconv.FormatUint(nextID, 10))); err != nil {
+		return nil, err
+	}
+	for _, key := range out {
+		if err = s.put(ctx, kvPreKey, strconv.FormatUint(uint64(key.KeyID), 10), encodePreKey(key, false)); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (s *kvStore) GetOrGenPreKeys(ctx context.Context, count uint32) ([]*keys.PreKey, error) {
+	s.preKeyMu.Lock()
+	defer s.preKeyMu.Unlock()
+	all, err := s.allPreKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*keys.PreKey, 0, count)
+	for _, pk := range all {
+		if !pk.uploaded && len(out) < int(count) {
+			out = append(out, pk.key)
+		}
+	}
+	if missing := int(count) - len(out); missing > 0 {
+		generated, err := s.genPreKeys(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, generated...)
+	}
+	return out, nil
+}
+
+func (s *kvStore) GenOnePreKey(ctx context.Context) (*keys.PreKey, error) {
+	s.preKeyMu.Lock()
+	defer s.preKeyMu.Unlock()
+	generated, err := s.genPreKeys(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	// a single pre-key is handed out directly, not uploaded in a batch
+	key := generated[0]
+	return key, s.put(ctx, kvPreKey, strconv.FormatUint(uint64(key.KeyID), 10), encodePreKey(key, true))
+}
+
+func (s *kvStore) GetPreKey(ctx context.Context, id uint32) (*keys.PreKey, error) {
+	raw, err := s.get(ctx, kvPreKey, strconv.FormatUint(uint64(id), 10))
+	if err != nil || raw == nil {
+		return nil, err
+	}
+	key, _, err := decodePreKey(id, raw)
+	return key, err
+}
+
+func (s *kvStore) RemovePreKey(ctx context.Context, id uint32) error {
+	return s.delete(ctx, kvPreKey, strconv.FormatUint(uint64(id), 10))
+}
+
+func (s *kvStore) MarkPreKeysAsUploaded(ctx context.Context, upToID uint32) error {
+	s.preKeyMu.Lock()
+	defer s.preKeyMu.Unlock()
+	all, err := s.allPreKeys(ctx)
+	if err != nil {
+		return err
+	}
+	for _, pk := range all {
+		if pk.uploaded || pk.key.KeyID > upToID {
+			continue
+		}
+		if err = s.put(ctx, kvPreKey, strconv.FormatUint(uint64(pk.key.KeyID), 10), encodePreKey(pk.key, true)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *kvStore) UploadedPreKeyCount(ctx context.Context) (int, error) {
+	all, err := s.allPreKeys(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, pk := range all {
+		if pk.uploaded {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// --- sender keys ---
+
+func (s *kvStore) PutSenderKey(ctx context.Context, group, user string, session []byte) error {
+	return s.put(ctx, kvSenderKey, user+"|"+group, session)
+}
+
+func (s *kvStore) GetSenderKey(ctx context.Context, group, user string) ([]byte, error) {
+	return s.get(ctx, kvSenderKey, user+"|"+group)
+}
+
+// --- app state ---
+
+func (s *kvStore) PutAppStateSyncKey(ctx context.Context, id []byte, key store.AppStateSyncKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return s.put(ctx, kvAppStateSyncKey, hex.EncodeToString(id), data)
+}
+
+func (s *kvStore) GetAppStateSyncKey(ctx context.Context, id []byte) (*store.AppStateSyncKey, error) {
+	raw, err := s.get(ctx, kvAppStateSyncKey, hex.EncodeToString(id))
+	if err != nil || raw == nil {
+		return nil, err
+	}
+	var key store.AppStateSyncKey
+	if err = json.Unmarshal(raw, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *kvStore) GetLatestAppStateSyncKeyID(ctx context.Context) ([]byte, error) {
+	entries, err := s.scan(ctx, kvAppStateSyncKey, "")
+	if err != nil {
+		return nil, err
+	}
+	var latestID []byte
+	var latestTS int64
+	for _, e := range entries {
+		var key store.AppStateSyncKey
+		if err = json.Unmarshal(e.Value, &key); err != nil {
+			return nil, err
+		}
+		if latestID == nil || key.Timestamp > latestTS {
+			if latestID, err = hex.DecodeString(e.Key); err != nil {
+				return nil, err
+			}
+			latestTS = key.Timestamp
+		}
+	}
+	return latestID, nil
+}
+
+func (s *kvStore) GetAllAppStateSyncKeyIDs(ctx context.Context) ([][]byte, error) {
+	entries, err := s.scan(ctx, kvAppStateSyncKey, "")
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]byte, 0, len(entries))
+	for _, e := range entries {
+		id, err := hex.DecodeString(e.Key)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
+
+type appStateVersionRow struct {
+	Version uint64 `json:"version"`
+	Hash    []byte `json:"hash"`
+}
+
+type appStateMACRow struct {
+	Version  uint64 `json:"version"`
+	ValueMAC []byte `json:"value_mac"`
+}
+
+func (s *kvStore) PutAppStateVersion(ctx context.Context, name string, version uint64, hash [128]byte) error {
+	data, err := json.Marshal(appStateVersionRow{Version: version, Hash: hash[:]})
+	if err != nil {
+		return err
+	}
+	return s.put(ctx, kvAppStateVersion, name, data)
+}
+
+func (s *kvStore) GetAppStateVersion(ctx context.Context, name string) (version uint64, hash [128]byte, err error) {
+	raw, err := s.get(ctx, kvAppStateVersion, name)
+	if err != nil || raw == nil {
+		return 0, hash, err
+	}
+	var stored appStateVersionRow
+	if err = json.Unmarshal(raw, &stored); err != nil {
+		return 0, hash, err
+	}
+	if len(stored.Hash) != len(hash) {
+		return 0, hash, fmt.Errorf("invalid stored app state hash for %s", name)
+	}
+	copy(hash[:], stored.Hash)
+	return stored.Version, hash, nil
+}
+
+func (s *kvStore) DeleteAppStateVersion(ctx context.Context, name string) error {
+	if err := s.delete(ctx, kvAppStateVersion, name); err != nil {
+		return err
+	}
+	return s.deletePrefix(ctx, kvAppStateMAC, name+"|")
+}
+
+func (s *kvStore) PutAppStateMutationMACs(ctx context.Context, name string, version uint64, mutations []store.AppStateMutationMAC) error {
+	for _, m := range mutations {
+		data, err := json.Marshal(appStateMACRow{Version: version, ValueMAC: m.ValueMAC})
+		if err != nil {
+			return err
+		}
+		if err = s.put(ctx, kvAppStateMAC, name+"|"+hex.EncodeToString(m.IndexMAC), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *kvStore) DeleteAppStateMutationMACs(ctx context.Context, name string, indexMACs [][]byte) error {
+	for _, indexMAC := range indexMACs {
+		if err := s.delete(ctx, kvAppStateMAC, name+"|"+hex.EncodeToString(indexMAC)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *kvStore) GetAppStateMutationMAC(ctx context.Context, name string, indexMAC []byte) ([]byte, error) {
+	raw, err := s.get(ctx, kvAppStateMAC, name+"|"+hex.EncodeToString(indexMAC))
+	if err != nil || raw == nil {
+		return nil, err
+	}
+	var stored appStateMACRow
+	if err = json.Unmarshal(raw, &stored); err != nil {
+		return nil, err
+	}
+	return stored.ValueMAC, nil
+}
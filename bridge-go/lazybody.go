@@ -0,0 +1,90 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Streams opened with lazy_body get message events without the protojson
+// encoded message: the info, the flags, the plain text when there is one and a
+// body_seq. WmEventGetBody(body_seq) encodes the full message on demand, so
+// streams that drop most messages never pay for marshaling them. Only the last
+// lazyBodyCap messages are kept.
+
+const lazyBodyCap = 4096
+
+var (
+	lazyBodiesMu sync.Mutex
+	lazyBodies   = map[uint64]*events.Message{}
+	lazyBodySeq  uint64
+)
+
+func stashBody(evt *events.Message) uint64 {
+	lazyBodiesMu.Lock()
+	defer lazyBodiesMu.Unlock()
+	lazyBodySeq++
+	lazyBodies[lazyBodySeq] = evt
+	delete(lazyBodies, lazyBodySeq-lazyBodyCap)
+	return lazyBodySeq
+}
+
+// addMessageBody sets the message protos of evt on out, as protojson maps or
+// as base64 wire bytes.
+func addMessageBody(out map[string]any, evt *events.Message, rawProto bool) {
+	if rawProto {
+		if evt.Message != nil {
+			out["message_b64"] = marshalProtoToB64(evt.Message)
+		}
+		if evt.RawMessage != nil {
+			out["raw_message_b64"] = marshalProtoToB64(evt.RawMessage)
+		}
+		if evt.SourceWebMsg != nil {
+			out["source_web_msg_b64"] = marshalProtoToB64(evt.SourceWebMsg)
+		}
+		return
+	}
+	if evt.Message != nil {
+		out["message"] = protoJSON(evt.Message)
+	}
+	if evt.RawMessage != nil {
+		out["raw_message"] = protoJSON(evt.RawMessage)
+	}
+	if evt.SourceWebMsg != nil {
+		out["source_web_msg"] = protoJSON(evt.SourceWebMsg)
+	}
+}
+
+// addLazyBody replaces the body with body_seq and a text preview.
+func addLazyBody(out map[string]any, evt *events.Message) {
+	out["body_seq"] = stashBody(evt)
+	if text := evt.Message.GetConversation(); text != "" {
+		out["text"] = text
+	} else if text := evt.Message.GetExtendedTextMessage().GetText(); text != "" {
+		out["text"] = text
+	}
+}
+
+//export WmEventGetBody
+func WmEventGetBody(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Seq      uint64 `json:"seq"`
+		RawProto bool   `json:"raw_proto"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	lazyBodiesMu.Lock()
+	evt := lazyBodies[payload.Seq]
+	lazyBodiesMu.Unlock()
+	if evt == nil {
+		return fail(fmt.Errorf("message body %d not found or expired", payload.Seq))
+	}
+	out := map[string]any{}
+	addMessageBody(out, evt, payload.RawProto)
+	return success(out)
+}
@@ -0,0 +1,259 @@
+package main
+
+import "C"
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store"
+)
+
+// Handles live until WmRelease, so a Node process that crashes or forgets to
+// release leaks connected clients and streams. A handle can be given a lease:
+// unless it is renewed within ttl_ms (WmLeaseRenew, typically from a keepalive
+// timer) the reaper releases it as if WmRelease had been called. Handles
+// without a lease are never reaped. WmListHandles shows everything the bridge
+// currently holds, for auditing.
+
+type lease struct {
+	ttl     time.Duration
+	expires time.Time
+}
+
+var (
+	leasesMu    sync.Mutex
+	leases      = map[handle]*lease{}
+	reaperStart sync.Once
+)
+
+func dropLease(h handle) {
+	leasesMu.Lock()
+	delete(leases, h)
+	leasesMu.Unlock()
+}
+
+func runLeaseReaper() {
+	logCfgMu.RLock()
+	level := logCfg.Client
+	logCfgMu.RUnlock()
+	log := newRoutedLogger("Leases", level, 0, 0)
+	for range time.Tick(time.Second) {
+		now := time.Now()
+		var expired []handle
+		leasesMu.Lock()
+		for h, l := range leases {
+			if now.After(l.expires) {
+				expired = append(expired, h)
+			}
+		}
+		leasesMu.Unlock()
+		for _, h := range expired {
+			log.Warnf("Lease of handle %d expired, releasing it", h)
+			if err := releaseHandle(h); err != nil {
+				log.Debugf("Handle %d was already gone: %v", h, err)
+			}
+		}
+	}
+}
+
+//export WmLeaseSet
+func WmLeaseSet(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Handle uint64 `json:"handle"`
+		TTLMs  int64  `json:"ttl_ms"` // 0 removes the lease
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	h := handle(payload.Handle)
+	if payload.TTLMs < 0 {
+		return fail(errors.New("ttl_ms must not be negative"))
+	}
+	if payload.TTLMs == 0 {
+		dropLease(h)
+		return success(map[string]any{})
+	}
+	if handleKind(h) == "" {
+		return fail(errors.New("handle not found"))
+	}
+	ttl := time.Duration(payload.TTLMs) * time.Millisecond
+	expires := time.Now().Add(ttl)
+	leasesMu.Lock()
+	leases[h] = &lease{ttl: ttl, expires: expires}
+	leasesMu.Unlock()
+	reaperStart.Do(func() { go runLeaseReaper() })
+	return success(map[string]any{"expires_at": expires.UnixMilli()})
+}
+
+//export WmLeaseRenew
+func WmLeaseRenew(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Handles []uint64 `json:"handles"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	now := time.Now()
+	renewed := 0
+	var missing []uint64
+	leasesMu.Lock()
+	for _, h := range payload.Handles {
+		if l := leases[handle(h)]; l != nil {
+			l.expires = now.Add(l.ttl)
+			renewed++
+		} else {
+			missing = append(missing, h)
+		}
+	}
+	leasesMu.Unlock()
+	// missing handles were reaped or never leased; the caller should stop using them
+	return success(map[string]any{"renewed": renewed, "missing": missing})
+}
+
+func inRegistry[T any](mu *sync.RWMutex, m map[handle]T, h handle) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := m[h]
+	return ok
+}
+
+// handleKind says which registry h is in, or "" if none.
+func handleKind(h handle) string {
+	switch {
+	case inRegistry(&containersMu, containers, h):
+		return "container"
+	case inRegistry(&devicesMu, devices, h):
+		return "device"
+	case inRegistry(&clientsMu, clients, h):
+		return "client"
+	case inRegistry(&eventsMu, eventsMap, h):
+		return "event_stream"
+	case inRegistry(&qrsMu, qrs, h):
+		return "qr_channel"
+	case inRegistry(&mediaJobsMu, mediaJobs, h):
+		return "media_job"
+	case inRegistry(&eventSocketsMu, eventSockets, h):
+		return "event_socket"
+	case inRegistry(&logStreamsMu, logStreams, h):
+		return "log_stream"
+	case inRegistry(&storeBackendsMu, storeBackends, h):
+		return "store_backend"
+	case inRegistry(&restServersMu, restServers, h):
+		return "rest_server"
+	}
+	opsMu.Lock()
+	defer opsMu.Unlock()
+	if _, ok := ops[uint64(h)]; ok {
+		return "operation"
+	}
+	return ""
+}
+
+//export WmListHandles
+func WmListHandles(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	type handleInfo struct {
+		Handle    uint64 `json:"handle"`
+		Kind      string `json:"kind"`
+		Container uint64 `json:"container,omitempty"` // owning container of devices and clients
+		Client    uint64 `json:"client,omitempty"`    // client a stream reads from
+		JID       string `json:"jid,omitempty"`
+		Label     string `json:"label,omitempty"` // of clients
+		ExpiresAt int64  `json:"lease_expires_at,omitempty"`
+	}
+	list := []handleInfo{}
+
+	containersMu.RLock()
+	containerOf := map[any]uint64{}
+	for h, c := range containers {
+		containerOf[c] = uint64(h)
+		list = append(list, handleInfo{Handle: uint64(h), Kind: "container"})
+	}
+	containersMu.RUnlock()
+	devicesMu.RLock()
+	for h, dev := range devices {
+		info := handleInfo{Handle: uint64(h), Kind: "device", Container: containerOf[dev.Container]}
+		if dev.ID != nil {
+			info.JID = dev.ID.String()
+		}
+		list = append(list, info)
+	}
+	devicesMu.RUnlock()
+	clientsMu.RLock()
+	clientHandles := map[*wa.Client]uint64{}
+	for h, cli := range clients {
+		clientHandles[cli] = uint64(h)
+		info := handleInfo{Handle: uint64(h), Kind: "client", Container: containerOfStore(containerOf, cli.Store)}
+		if jid := cli.Store.GetJID(); !jid.IsEmpty() {
+			info.JID = jid.String()
+		}
+		info.Label = configFor(cli).clientLabel()
+		list = append(list, info)
+	}
+	clientsMu.RUnlock()
+	eventsMu.RLock()
+	for h, es := range eventsMap {
+		list = append(list, handleInfo{Handle: uint64(h), Kind: "event_stream", Client: clientHandles[es.client]})
+	}
+	eventsMu.RUnlock()
+	qrsMu.RLock()
+	for h, st := range qrs {
+		list = append(list, handleInfo{Handle: uint64(h), Kind: "qr_channel", Client: clientHandles[st.client]})
+	}
+	qrsMu.RUnlock()
+	mediaJobsMu.RLock()
+	for h, job := range mediaJobs {
+		list = append(list, handleInfo{Handle: uint64(h), Kind: "media_job", Client: clientHandles[job.client]})
+	}
+	mediaJobsMu.RUnlock()
+	eventSocketsMu.RLock()
+	for h := range eventSockets {
+		list = append(list, handleInfo{Handle: uint64(h), Kind: "event_socket"})
+	}
+	eventSocketsMu.RUnlock()
+	logStreamsMu.RLock()
+	for h, ls := range logStreams {
+		list = append(list, handleInfo{Handle: uint64(h), Kind: "log_stream", Client: uint64(ls.client)})
+	}
+	logStreamsMu.RUnlock()
+	storeBackendsMu.RLock()
+	for h := range storeBackends {
+		list = append(list, handleInfo{Handle: uint64(h), Kind: "store_backend"})
+	}
+	storeBackendsMu.RUnlock()
+	restServersMu.RLock()
+	for h := range restServers {
+		list = append(list, handleInfo{Handle: uint64(h), Kind: "rest_server"})
+	}
+	restServersMu.RUnlock()
+	opsMu.Lock()
+	for id := range ops {
+		list = append(list, handleInfo{Handle: id, Kind: "operation"})
+	}
+	opsMu.Unlock()
+
+	leasesMu.Lock()
+	for i := range list {
+		if l := leases[handle(list[i].Handle)]; l != nil {
+			list[i].ExpiresAt = l.expires.UnixMilli()
+		}
+	}
+	leasesMu.Unlock()
+	slices.SortFunc(list, func(a, b handleInfo) int { return cmp.Compare(a.Handle, b.Handle) })
+	return success(map[string]any{"handles": list})
+}
+
+func containerOfStore(containerOf map[any]uint64, dev *store.Device) uint64 {
+	if dev == nil {
+		return 0
+	}
+	return containerOf[dev.Container]
+}
@@ -0,0 +1,157 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waWa6"
+	"go.mau.fi/whatsmeow/store"
+)
+
+// Server-generated text (system messages, templates, business notices) comes in
+// the language of the locale the client reports when logging in, which
+// whatsmeow takes from the process-wide store.BaseClientPayload (en/US unless
+// changed). WmClientSetLocale overrides it per client through the client's
+// GetClientPayload hook, from the next connection. The login payload has no
+// timezone; a timezone given here is validated and kept with the locale so the
+// application can read one per-session setting back (WmClientGetLocale).
+
+type clientLocale struct {
+	Language string `json:"language"` // ISO 639-1, e.g. "pt"
+	Country  string `json:"country"`  // ISO 3166-1 alpha-2, e.g. "BR"
+	Timezone string `json:"timezone"` // IANA name, e.g. "America/Sao_Paulo"
+}
+
+func (l *clientLocale) normalize() error {
+	l.Language = strings.ToLower(strings.TrimSpace(l.Language))
+	l.Country = strings.ToUpper(strings.TrimSpace(l.Country))
+	if l.Language != "" && !isAlpha2(l.Language) {
+		return fmt.Errorf("invalid language %q, expected an ISO 639-1 code", l.Language)
+	}
+	if l.Country != "" && !isAlpha2(l.Country) {
+		return fmt.Errorf("invalid country %q, expected an ISO 3166-1 alpha-2 code", l.Country)
+	}
+	if l.Timezone != "" {
+		if _, err := time.LoadLocation(l.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone: %w", err)
+		}
+	}
+	return nil
+}
+
+func isAlpha2(s string) bool {
+	if len(s) != 2 {
+		return false
+	}
+	for _, c := range s {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func (cfg *clientConfig) clientLocale() *clientLocale {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.locale
+}
+
+// localeInfo returns the locale cli reports, the process default for unset fields.
+func localeInfo(cli *wa.Client) map[string]any {
+	ua := store.BaseClientPayload.GetUserAgent()
+	out := map[string]any{
+		"language":   ua.GetLocaleLanguageIso6391(),
+		"country":    ua.GetLocaleCountryIso31661Alpha2(),
+		"timezone":   nil,
+		"overridden": false,
+	}
+	if l := configFor(cli).clientLocale(); l != nil {
+		out["overridden"] = true
+		if l.Language != "" {
+			out["language"] = l.Language
+		}
+		if l.Country != "" {
+			out["country"] = l.Country
+		}
+		if l.Timezone != "" {
+			out["timezone"] = l.Timezone
+		}
+	}
+	return out
+}
+
+// localizedClientPayload is the GetClientPayload hook of clients with a locale.
+func localizedClientPayload(cli *wa.Client) func() *waWa6.ClientPayload {
+	return func() *waWa6.ClientPayload {
+		payload := cli.Store.GetClientPayload()
+		l := configFor(cli).clientLocale()
+		if l == nil || payload.UserAgent == nil {
+			return payload
+		}
+		if l.Language != "" {
+			payload.UserAgent.LocaleLanguageIso6391 = &l.Language
+		}
+		if l.Country != "" {
+			payload.UserAgent.LocaleCountryIso31661Alpha2 = &l.Country
+		}
+		return payload
+	}
+}
+
+//export WmClientSetLocale
+func WmClientSetLocale(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	// all fields empty go back to the process default
+	var payload struct {
+		Client uint64 `json:"client"`
+		clientLocale
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	locale := payload.clientLocale
+	if err := locale.normalize(); err != nil {
+		return fail(err)
+	}
+	cfg := configFor(cli)
+	cfg.mu.Lock()
+	if locale == (clientLocale{}) {
+		cfg.locale = nil
+		cli.GetClientPayload = nil
+	} else {
+		cfg.locale = &locale
+		cli.GetClientPayload = localizedClientPayload(cli)
+	}
+	cfg.mu.Unlock()
+	out := localeInfo(cli)
+	// the login payload is only sent when connecting
+	out["applies_on_reconnect"] = cli.IsConnected()
+	return success(out)
+}
+
+//export WmClientGetLocale
+func WmClientGetLocale(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	return success(localeInfo(cli))
+}
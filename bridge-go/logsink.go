@@ -0,0 +1,143 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// A client can have its own structured log sink instead of the shared stdout
+// logger: WmClientSetLogSink writes the client's log records as JSON lines
+// (the log stream records: {type, time, level, client, module, message}) to a
+// file and/or stdout, at a level of its own. The level also applies to log streams reading the client, so
+// a sink without a file or stdout, plus a log stream, forwards the client's
+// records to a callback on the Node side (Client.onLog).
+
+type logSink struct {
+	cli      *wa.Client
+	minLevel int
+	file     *os.File
+	stdout   bool
+	path     string
+
+	mu sync.Mutex // serializes writes
+}
+
+var (
+	logSinksMu sync.RWMutex
+	logSinks   = map[handle]*logSink{}
+	// logSinkCount lets loggers skip the lookup when no client has a sink
+	logSinkCount atomic.Int32
+)
+
+func logSinkFor(client handle) *logSink {
+	if client == 0 || logSinkCount.Load() == 0 {
+		return nil
+	}
+	logSinksMu.RLock()
+	defer logSinksMu.RUnlock()
+	return logSinks[client]
+}
+
+func (s *logSink) write(rec map[string]any) {
+	if s.file == nil && !s.stdout {
+		return
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		_, _ = s.file.Write(line)
+	}
+	if s.stdout {
+		_, _ = os.Stdout.Write(line)
+	}
+}
+
+func (s *logSink) close() {
+	if s.file != nil {
+		_ = s.file.Close()
+	}
+}
+
+func removeLogSink(h handle) {
+	logSinksMu.Lock()
+	defer logSinksMu.Unlock()
+	if s := logSinks[h]; s != nil {
+		s.close()
+		delete(logSinks, h)
+		logSinkCount.Add(-1)
+	}
+}
+
+func stopLogSinks(cli *wa.Client) {
+	logSinksMu.Lock()
+	defer logSinksMu.Unlock()
+	for h, s := range logSinks {
+		if s.cli == cli {
+			s.close()
+			delete(logSinks, h)
+			logSinkCount.Add(-1)
+		}
+	}
+}
+
+//export WmClientSetLogSink
+func WmClientSetLogSink(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client  uint64 `json:"client"`
+		Enabled bool   `json:"enabled"`
+		Level   string `json:"level"`
+		File    string `json:"file"`
+		Stdout  bool   `json:"stdout"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	h := handle(payload.Client)
+	if !payload.Enabled {
+		removeLogSink(h)
+		return success(map[string]any{"enabled": false})
+	}
+	sink := &logSink{cli: cli, stdout: payload.Stdout, path: payload.File}
+	switch {
+	case payload.Level == "":
+		sink.minLevel = logLevels["INFO"]
+	case strings.EqualFold(payload.Level, "none"):
+		sink.minLevel = len(logLevels)
+	default:
+		var ok bool
+		if sink.minLevel, ok = logLevelIndex(payload.Level); !ok {
+			return fail(fmt.Errorf("unknown log level %q", payload.Level))
+		}
+	}
+	if sink.path != "" {
+		f, err := os.OpenFile(sink.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fail(err)
+		}
+		sink.file = f
+	}
+	removeLogSink(h)
+	logSinksMu.Lock()
+	logSinks[h] = sink
+	logSinkCount.Add(1)
+	logSinksMu.Unlock()
+	return success(map[string]any{"enabled": true, "file": sink.path, "stdout": sink.stdout})
+}
@@ -0,0 +1,215 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// Log records of the client and database loggers can be consumed as a stream
+// (WmLogStreamStart + WmLogNext) tagged with the client or container handle
+// they belong to. Printing to stdout can be turned off with WmSetLogOptions,
+// or replaced per client by a JSON sink (logsink.go).
+
+var logLevels = map[string]int{"DEBUG": 0, "INFO": 1, "WARN": 2, "ERROR": 3}
+
+func logLevelIndex(level string) (int, bool) {
+	idx, ok := logLevels[strings.ToUpper(level)]
+	return idx, ok
+}
+
+type logStream struct {
+	ch       chan map[string]any
+	ctx      context.Context
+	cancel   context.CancelFunc
+	minLevel int
+	client   handle // 0 means every source
+	dropped  atomic.Uint64
+}
+
+var (
+	logStreamsMu sync.RWMutex
+	logStreams   = map[handle]*logStream{}
+	// logStreamCount lets loggers skip building records when nobody listens
+	logStreamCount atomic.Int32
+)
+
+type routedLogger struct {
+	stdout    waLog.Logger
+	module    string
+	minLevel  int
+	client    handle
+	container handle
+}
+
+func newRoutedLogger(module, level string, client, container handle) waLog.Logger {
+	logCfgMu.RLock()
+	cfg := logCfg
+	logCfgMu.RUnlock()
+	minLevel, ok := logLevelIndex(level)
+	if !ok {
+		minLevel = 0
+	}
+	none := strings.EqualFold(level, "none")
+	if none {
+		// still a routedLogger so stanza taps see the Send/Recv debug lines
+		minLevel = len(logLevels)
+	}
+	stdout := waLog.Noop
+	if cfg.Stdout && !none {
+		stdout = makeLogger(module, level, cfg.Color)
+	}
+	return &routedLogger{stdout: stdout, module: module, minLevel: minLevel, client: client, container: container}
+}
+
+// route hands a record to the client's log sink and to log streams. A sink's
+// level replaces the logger's.
+func (l *routedLogger) route(level string, msg string, args []interface{}, sink *logSink) {
+	idx, minLevel := logLevels[level], l.minLevel
+	if sink != nil {
+		minLevel = sink.minLevel
+	}
+	if idx < minLevel || (sink == nil && logStreamCount.Load() == 0) {
+		return
+	}
+	rec := map[string]any{
+		"type":    "log",
+		"level":   level,
+		"module":  l.module,
+		"message": fmt.Sprintf(msg, args...),
+		"time":    time.Now().Format(time.RFC3339Nano),
+	}
+	if l.client != 0 {
+		rec["client"] = uint64(l.client)
+	}
+	if l.container != 0 {
+		rec["container"] = uint64(l.container)
+	}
+	if sink != nil {
+		sink.write(rec)
+	}
+	logStreamsMu.RLock()
+	defer logStreamsMu.RUnlock()
+	for _, ls := range logStreams {
+		if idx < ls.minLevel || (ls.client != 0 && ls.client != l.client) {
+			continue
+		}
+		select {
+		case ls.ch <- rec:
+		default:
+			ls.dropped.Add(1)
+		}
+	}
+}
+
+func (l *routedLogger) Errorf(msg string, args ...interface{}) {
+	sink := logSinkFor(l.client)
+	if sink == nil {
+		l.stdout.Errorf(msg, args...)
+	}
+	l.route("ERROR", msg, args, sink)
+}
+
+func (l *routedLogger) Warnf(msg string, args ...interface{}) {
+	sink := logSinkFor(l.client)
+	if sink == nil {
+		l.stdout.Warnf(msg, args...)
+	}
+	l.route("WARN", msg, args, sink)
+}
+
+func (l *routedLogger) Infof(msg string, args ...interface{}) {
+	sink := logSinkFor(l.client)
+	if sink == nil {
+		l.stdout.Infof(msg, args...)
+	}
+	l.route("INFO", msg, args, sink)
+}
+
+func (l *routedLogger) Debugf(msg string, args ...interface{}) {
+	sink := logSinkFor(l.client)
+	if sink == nil {
+		l.stdout.Debugf(msg, args...)
+	}
+	l.route("DEBUG", msg, args, sink)
+	if l.client != 0 {
+		trackPingLine(l.client, l.module, msg, args)
+		if stanzaTapCount.Load() > 0 {
+			tapLogLine(l.client, l.module, msg, args)
+		}
+	}
+}
+
+func (l *routedLogger) Sub(module string) waLog.Logger {
+	return &routedLogger{stdout: l.stdout.Sub(module), module: l.module + "/" + module, minLevel: l.minLevel, client: l.client, container: l.container}
+}
+
+//export WmLogStreamStart
+func WmLogStreamStart(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Level  string `json:"level"`
+		Client uint64 `json:"client"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	minLevel := 0
+	if payload.Level != "" {
+		var ok bool
+		if minLevel, ok = logLevelIndex(payload.Level); !ok {
+			return fail(fmt.Errorf("unknown log level %q", payload.Level))
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ls := &logStream{ch: make(chan map[string]any, 1024), ctx: ctx, cancel: cancel, minLevel: minLevel, client: handle(payload.Client)}
+	h := newHandle()
+	logStreamsMu.Lock()
+	logStreams[h] = ls
+	logStreamsMu.Unlock()
+	logStreamCount.Add(1)
+	return success(map[string]any{"handle": uint64(h)})
+}
+
+//export WmLogNext
+func WmLogNext(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Handle    uint64 `json:"handle"`
+		TimeoutMs int    `json:"timeoutMs"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	logStreamsMu.RLock()
+	ls := logStreams[handle(payload.Handle)]
+	logStreamsMu.RUnlock()
+	if ls == nil {
+		return fail(errors.New("log stream handle not found"))
+	}
+	if n := ls.dropped.Swap(0); n > 0 {
+		return success(map[string]any{"type": "logs_dropped", "count": n})
+	}
+	var timeout <-chan time.Time
+	if payload.TimeoutMs > 0 {
+		timeout = time.After(time.Duration(payload.TimeoutMs) * time.Millisecond)
+	} else {
+		timeout = make(<-chan time.Time)
+	}
+	select {
+	case rec := <-ls.ch:
+		return success(rec)
+	case <-timeout:
+		return success(map[string]any{"type": "timeout"})
+	case <-ls.ctx.Done():
+		return success(map[string]any{"type": "closed"})
+	}
+}
@@ -7,10 +7,12 @@ package main
 import "C"
 import (
 	"context"
+	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"reflect"
 	"strings"
 	"sync"
@@ -41,6 +43,8 @@ type logOptions struct {
 	Database string `json:"database"`
 	Client   string `json:"client"`
 	Color    bool   `json:"color"`
+	// Stdout can be turned off when records are consumed through WmLogStreamStart
+	Stdout bool `json:"stdout"`
 }
 
 func init() {
@@ -49,7 +53,7 @@ func init() {
 }
 
 var (
-	logCfg   = logOptions{Database: "DEBUG", Client: "DEBUG", Color: true}
+	logCfg   = logOptions{Database: "DEBUG", Client: "DEBUG", Color: true, Stdout: true}
 	logCfgMu sync.RWMutex
 )
 
@@ -60,26 +64,28 @@ func makeLogger(module, level string, color bool) waLog.Logger {
 	return waLog.Stdout(module, strings.ToUpper(level), color)
 }
 
-func newDBLogger() waLog.Logger {
+func newDBLogger(container handle) waLog.Logger {
 	logCfgMu.RLock()
-	cfg := logCfg
+	level := logCfg.Database
 	logCfgMu.RUnlock()
-	return makeLogger("Database", cfg.Database, cfg.Color)
+	return newRoutedLogger("Database", level, 0, container)
 }
 
-func newClientLogger() waLog.Logger {
+func newClientLogger(client handle) waLog.Logger {
 	logCfgMu.RLock()
-	cfg := logCfg
+	level := logCfg.Client
 	logCfgMu.RUnlock()
-	return makeLogger("Client", cfg.Client, cfg.Color)
+	return newRoutedLogger("Client", level, client, 0)
 }
 
 //export WmSetLogOptions
-func WmSetLogOptions(input *C.char) *C.char {
+func WmSetLogOptions(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var req struct {
 		Database string `json:"database"`
 		Client   string `json:"client"`
 		Color    *bool  `json:"color"`
+		Stdout   *bool  `json:"stdout"`
 	}
 	if err := json.Unmarshal([]byte(C.GoString(input)), &req); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
@@ -94,6 +100,9 @@ func WmSetLogOptions(input *C.char) *C.char {
 	if req.Color != nil {
 		logCfg.Color = *req.Color
 	}
+	if req.Stdout != nil {
+		logCfg.Stdout = *req.Stdout
+	}
 	logCfgMu.Unlock()
 	return success(map[string]any{})
 }
@@ -101,60 +110,63 @@ func WmSetLogOptions(input *C.char) *C.char {
 func newHandle() handle { return handle(nextHandle.Add(1)) }
 
 //export WmClientIsLoggedIn
-func WmClientIsLoggedIn(input *C.char) *C.char {
+func WmClientIsLoggedIn(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var payload struct {
 		Client uint64 `json:"client"`
 	}
 	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
 	}
-	clientsMu.RLock()
-	cli := clients[handle(payload.Client)]
-	clientsMu.RUnlock()
-	if cli == nil {
-		return fail(errors.New("client handle not found"))
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
 	}
+	defer end()
 	return success(map[string]any{"isLoggedIn": cli.IsLoggedIn()})
 }
 
 //export WmClientHasStoreID
-func WmClientHasStoreID(input *C.char) *C.char {
+func WmClientHasStoreID(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
     var payload struct {
         Client uint64 `json:"client"`
     }
     if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
         return fail(fmt.Errorf("invalid json: %w", err))
     }
-    clientsMu.RLock()
-    cli := clients[handle(payload.Client)]
-    clientsMu.RUnlock()
-    if cli == nil {
-        return fail(errors.New("client handle not found"))
+    cli, end, err := beginClientCall(payload.Client, false)
+    if err != nil {
+        return fail(err)
     }
+    defer end()
     has := !cli.Store.GetJID().IsEmpty()
     return success(map[string]any{"has": has})
 }
 
 //export WmClientDisconnect
-func WmClientDisconnect(input *C.char) *C.char {
+func WmClientDisconnect(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var payload struct {
 		Client uint64 `json:"client"`
 	}
 	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
 	}
-	clientsMu.RLock()
-	cli := clients[handle(payload.Client)]
-	clientsMu.RUnlock()
-	if cli == nil {
-		return fail(errors.New("client handle not found"))
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
 	}
+	defer end()
+	stopReconnect(cli)
+	resetIdle(cli)
 	cli.Disconnect()
 	return success(map[string]any{})
 }
 
 //export WmClientWaitForConnection
-func WmClientWaitForConnection(input *C.char) *C.char {
+func WmClientWaitForConnection(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var payload struct {
 		Client    uint64 `json:"client"`
 		TimeoutMs int    `json:"timeoutMs"`
@@ -162,12 +174,11 @@ func WmClientWaitForConnection(input *C.char) *C.char {
 	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
 	}
-	clientsMu.RLock()
-	cli := clients[handle(payload.Client)]
-	clientsMu.RUnlock()
-	if cli == nil {
-		return fail(errors.New("client handle not found"))
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
 	}
+	defer end()
 	ok := cli.WaitForConnection(time.Duration(payload.TimeoutMs) * time.Millisecond)
 	return success(map[string]any{"ok": ok})
 }
@@ -185,7 +196,46 @@ func marshalProtoToMap(m proto.Message) map[string]any {
 	return out
 }
 
-func serializeEvent(raw interface{}) map[string]any {
+// protoJSON is the protojson form of m, embedded as is when the event is
+// marshaled instead of being decoded into a map first.
+func protoJSON(m proto.Message) json.RawMessage {
+	if m == nil {
+		return nil
+	}
+	b, err := protojson.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// serializeOptions are per-stream knobs for how events are encoded.
+type serializeOptions struct {
+	// RawProto ships message protos as base64 wire bytes instead of protojson maps.
+	RawProto bool `json:"raw_proto"`
+	// TimestampFormat is "both" (default), "rfc3339" or "unix_ms", see formatEventTimes.
+	TimestampFormat string `json:"timestamp_format"`
+	// LazyBody leaves message protos out of message events, see WmEventGetBody.
+	LazyBody bool `json:"lazy_body"`
+}
+
+func marshalProtoToB64(m proto.Message) string {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// serializeEvent converts a whatsmeow event into the JSON shape described by WmEventSchema.
+func serializeEvent(raw interface{}, opts serializeOptions) map[string]any {
+	ev := serializeEventFields(raw, opts)
+	formatEventTimes(ev, opts.TimestampFormat)
+	ev["schema_version"] = eventSchemaVersion
+	return ev
+}
+
+func serializeEventFields(raw interface{}, opts serializeOptions) map[string]any {
 	switch evt := raw.(type) {
 	// Connection lifecycle
 	case *events.Connected:
@@ -214,13 +264,13 @@ func serializeEvent(raw interface{}) map[string]any {
 	case *events.CATRefreshError:
 		return map[string]any{"type": "cat_refresh_error", "error": evt.Error.Error()}
 	case *events.ConnectFailure:
-		return map[string]any{"type": "connect_failure", "reason": evt.Reason.NumberString(), "message": evt.Message}
+		return map[string]any{"type": "connect_failure", "reason": evt.Reason.NumberString(), "message": evt.Message, "raw": nodeToJSON(evt.Raw)}
 	case *events.StreamError:
-		return map[string]any{"type": "stream_error", "code": evt.Code}
+		return map[string]any{"type": "stream_error", "code": evt.Code, "raw": nodeToJSON(evt.Raw)}
 	case *events.TemporaryBan:
 		return map[string]any{"type": "temporary_ban", "code": int(evt.Code), "expire_ms": int64(evt.Expire / time.Millisecond)}
 	case *events.KeepAliveTimeout:
-		return map[string]any{"type": "keepalive_timeout", "error_count": evt.ErrorCount, "last_success": evt.LastSuccess.Format(time.RFC3339)}
+		return map[string]any{"type": "keepalive_timeout", "error_count": evt.ErrorCount, "last_success": eventTime(evt.LastSuccess)}
 	case *events.KeepAliveRestored:
 		return map[string]any{"type": "keepalive_restored"}
 
@@ -230,12 +280,12 @@ func serializeEvent(raw interface{}) map[string]any {
 			"type":           "receipt",
 			"info":           evt.MessageSource,
 			"message_ids":    evt.MessageIDs,
-			"timestamp":      evt.Timestamp.Format(time.RFC3339),
+			"timestamp":      eventTime(evt.Timestamp),
 			"receipt_type":   string(evt.Type),
 			"message_sender": evt.MessageSender.String(),
 		}
 	case *events.Presence:
-		return map[string]any{"type": "presence", "from": evt.From.String(), "unavailable": evt.Unavailable, "last_seen": evt.LastSeen.Format(time.RFC3339)}
+		return map[string]any{"type": "presence", "from": evt.From.String(), "unavailable": evt.Unavailable, "last_seen": eventTime(evt.LastSeen)}
 	case *events.ChatPresence:
 		return map[string]any{"type": "chat_presence", "chat": evt.MessageSource.Chat.String(), "sender": evt.MessageSource.Sender.String(), "is_from_me": evt.MessageSource.IsFromMe, "state": string(evt.State), "media": string(evt.Media)}
 
@@ -244,6 +294,7 @@ func serializeEvent(raw interface{}) map[string]any {
 		out := map[string]any{
 			"type":                     "message",
 			"info":                     evt.Info,
+			"timestamp":                eventTime(evt.Info.Timestamp),
 			"is_ephemeral":             evt.IsEphemeral,
 			"is_view_once":             evt.IsViewOnce,
 			"is_view_once_v2":          evt.IsViewOnceV2,
@@ -254,22 +305,18 @@ func serializeEvent(raw interface{}) map[string]any {
 			"is_bot_invoke":            evt.IsBotInvoke,
 			"retry_count":              evt.RetryCount,
 		}
-		if evt.Message != nil {
-			out["message"] = marshalProtoToMap(evt.Message)
-		}
-		if evt.RawMessage != nil {
-			out["raw_message"] = marshalProtoToMap(evt.RawMessage)
-		}
-		if evt.SourceWebMsg != nil {
-			out["source_web_msg"] = marshalProtoToMap(evt.SourceWebMsg)
+		if opts.LazyBody {
+			addLazyBody(out, evt)
+		} else {
+			addMessageBody(out, evt, opts.RawProto)
 		}
 		if evt.UnavailableRequestID != "" {
 			out["unavailable_request_id"] = string(evt.UnavailableRequestID)
 		}
 		if evt.NewsletterMeta != nil {
 			out["newsletter_meta"] = map[string]any{
-				"edit_ts":     evt.NewsletterMeta.EditTS.Format(time.RFC3339),
-				"original_ts": evt.NewsletterMeta.OriginalTS.Format(time.RFC3339),
+				"edit_ts":     eventTime(evt.NewsletterMeta.EditTS),
+				"original_ts": eventTime(evt.NewsletterMeta.OriginalTS),
 			}
 		}
 		return out
@@ -277,6 +324,7 @@ func serializeEvent(raw interface{}) map[string]any {
 		return map[string]any{
 			"type":              "undecryptable_message",
 			"info":              evt.Info,
+			"timestamp":         eventTime(evt.Info.Timestamp),
 			"is_unavailable":    evt.IsUnavailable,
 			"unavailable_type":  string(evt.UnavailableType),
 			"decrypt_fail_mode": string(evt.DecryptFailMode),
@@ -285,6 +333,7 @@ func serializeEvent(raw interface{}) map[string]any {
 		out := map[string]any{
 			"type":        "fb_message",
 			"info":        evt.Info,
+			"timestamp":   eventTime(evt.Info.Timestamp),
 			"retry_count": evt.RetryCount,
 		}
 		if evt.Transport != nil {
@@ -301,7 +350,13 @@ func serializeEvent(raw interface{}) map[string]any {
 
 	// History sync
 	case *events.HistorySync:
-		return map[string]any{"type": "history_sync", "data": marshalProtoToMap(evt.Data)}
+		return map[string]any{
+			"type":        "history_sync",
+			"sync_type":   evt.Data.GetSyncType().String(),
+			"chunk_order": evt.Data.GetChunkOrder(),
+			"progress":    evt.Data.GetProgress(),
+			"data":        marshalProtoToMap(evt.Data),
+		}
 
 	// Group & user
 	case *events.JoinedGroup:
@@ -322,7 +377,7 @@ func serializeEvent(raw interface{}) map[string]any {
 			"notify":                      evt.Notify,
 			"sender":                      strPtr(evt.Sender),
 			"sender_pn":                   strPtr(evt.SenderPN),
-			"timestamp":                   evt.Timestamp.Format(time.RFC3339),
+			"timestamp":                   eventTime(evt.Timestamp),
 			"name":                        evt.Name,
 			"topic":                       evt.Topic,
 			"locked":                      evt.Locked,
@@ -343,11 +398,11 @@ func serializeEvent(raw interface{}) map[string]any {
 			"unknown_changes":             evt.UnknownChanges,
 		}
 	case *events.Picture:
-		return map[string]any{"type": "picture", "jid": evt.JID.String(), "author": evt.Author.String(), "timestamp": evt.Timestamp.Format(time.RFC3339), "remove": evt.Remove, "picture_id": evt.PictureID}
+		return map[string]any{"type": "picture", "jid": evt.JID.String(), "author": evt.Author.String(), "timestamp": eventTime(evt.Timestamp), "remove": evt.Remove, "picture_id": evt.PictureID}
 	case *events.UserAbout:
-		return map[string]any{"type": "user_about", "jid": evt.JID.String(), "status": evt.Status, "timestamp": evt.Timestamp.Format(time.RFC3339)}
+		return map[string]any{"type": "user_about", "jid": evt.JID.String(), "status": evt.Status, "timestamp": eventTime(evt.Timestamp)}
 	case *events.IdentityChange:
-		return map[string]any{"type": "identity_change", "jid": evt.JID.String(), "timestamp": evt.Timestamp.Format(time.RFC3339), "implicit": evt.Implicit}
+		return map[string]any{"type": "identity_change", "jid": evt.JID.String(), "timestamp": eventTime(evt.Timestamp), "implicit": evt.Implicit}
 	case *events.PrivacySettings:
 		return map[string]any{"type": "privacy_settings", "new_settings": evt.NewSettings, "group_add_changed": evt.GroupAddChanged, "last_seen_changed": evt.LastSeenChanged, "status_changed": evt.StatusChanged, "profile_changed": evt.ProfileChanged, "read_receipts_changed": evt.ReadReceiptsChanged, "online_changed": evt.OnlineChanged, "call_add_changed": evt.CallAddChanged}
 	case *events.OfflineSyncPreview:
@@ -355,7 +410,7 @@ func serializeEvent(raw interface{}) map[string]any {
 	case *events.OfflineSyncCompleted:
 		return map[string]any{"type": "offline_sync_completed", "count": evt.Count}
 	case *events.MediaRetry:
-		out := map[string]any{"type": "media_retry", "ciphertext_b64": base64.StdEncoding.EncodeToString(evt.Ciphertext), "iv_b64": base64.StdEncoding.EncodeToString(evt.IV), "timestamp": evt.Timestamp.Format(time.RFC3339), "message_id": string(evt.MessageID), "chat_id": evt.ChatID.String(), "sender_id": evt.SenderID.String(), "from_me": evt.FromMe}
+		out := map[string]any{"type": "media_retry", "ciphertext_b64": base64.StdEncoding.EncodeToString(evt.Ciphertext), "iv_b64": base64.StdEncoding.EncodeToString(evt.IV), "timestamp": eventTime(evt.Timestamp), "message_id": string(evt.MessageID), "chat_id": evt.ChatID.String(), "sender_id": evt.SenderID.String(), "from_me": evt.FromMe}
 		if evt.Error != nil {
 			out["error"] = map[string]any{"code": evt.Error.Code}
 		}
@@ -383,7 +438,7 @@ func serializeEvent(raw interface{}) map[string]any {
 				"MessageServerID": int(m.MessageServerID),
 				"MessageID":       string(m.MessageID),
 				"Type":            m.Type,
-				"Timestamp":       m.Timestamp.Format(time.RFC3339),
+				"Timestamp":       eventTime(m.Timestamp),
 				"ViewsCount":      m.ViewsCount,
 				"ReactionCounts":  m.ReactionCounts,
 			}
@@ -392,43 +447,43 @@ func serializeEvent(raw interface{}) map[string]any {
 			}
 			msgs[i] = mm
 		}
-		return map[string]any{"type": "newsletter_live_update", "jid": evt.JID.String(), "time": evt.Time.Format(time.RFC3339), "messages": msgs}
+		return map[string]any{"type": "newsletter_live_update", "jid": evt.JID.String(), "time": eventTime(evt.Time), "messages": msgs}
 
 	// AppState (sync actions)
 	case *events.Contact:
-		return map[string]any{"type": "appstate_contact", "jid": evt.JID.String(), "timestamp": evt.Timestamp.Format(time.RFC3339), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
+		return map[string]any{"type": "appstate_contact", "jid": evt.JID.String(), "timestamp": eventTime(evt.Timestamp), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
 	case *events.PushName:
 		return map[string]any{"type": "appstate_push_name", "jid": evt.JID.String(), "message": evt.Message, "old_push_name": evt.OldPushName, "new_push_name": evt.NewPushName}
 	case *events.BusinessName:
 		return map[string]any{"type": "appstate_business_name", "jid": evt.JID.String(), "message": evt.Message, "old_business_name": evt.OldBusinessName, "new_business_name": evt.NewBusinessName}
 	case *events.Pin:
-		return map[string]any{"type": "appstate_pin", "jid": evt.JID.String(), "timestamp": evt.Timestamp.Format(time.RFC3339), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
+		return map[string]any{"type": "appstate_pin", "jid": evt.JID.String(), "timestamp": eventTime(evt.Timestamp), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
 	case *events.Star:
-		return map[string]any{"type": "appstate_star", "chat_jid": evt.ChatJID.String(), "sender_jid": evt.SenderJID.String(), "is_from_me": evt.IsFromMe, "message_id": evt.MessageID, "timestamp": evt.Timestamp.Format(time.RFC3339), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
+		return map[string]any{"type": "appstate_star", "chat_jid": evt.ChatJID.String(), "sender_jid": evt.SenderJID.String(), "is_from_me": evt.IsFromMe, "message_id": evt.MessageID, "timestamp": eventTime(evt.Timestamp), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
 	case *events.DeleteForMe:
-		return map[string]any{"type": "appstate_delete_for_me", "chat_jid": evt.ChatJID.String(), "sender_jid": evt.SenderJID.String(), "is_from_me": evt.IsFromMe, "message_id": evt.MessageID, "timestamp": evt.Timestamp.Format(time.RFC3339), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
+		return map[string]any{"type": "appstate_delete_for_me", "chat_jid": evt.ChatJID.String(), "sender_jid": evt.SenderJID.String(), "is_from_me": evt.IsFromMe, "message_id": evt.MessageID, "timestamp": eventTime(evt.Timestamp), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
 	case *events.Mute:
-		return map[string]any{"type": "appstate_mute", "jid": evt.JID.String(), "timestamp": evt.Timestamp.Format(time.RFC3339), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
+		return map[string]any{"type": "appstate_mute", "jid": evt.JID.String(), "timestamp": eventTime(evt.Timestamp), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
 	case *events.Archive:
-		return map[string]any{"type": "appstate_archive", "jid": evt.JID.String(), "timestamp": evt.Timestamp.Format(time.RFC3339), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
+		return map[string]any{"type": "appstate_archive", "jid": evt.JID.String(), "timestamp": eventTime(evt.Timestamp), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
 	case *events.MarkChatAsRead:
-		return map[string]any{"type": "appstate_mark_chat_as_read", "jid": evt.JID.String(), "timestamp": evt.Timestamp.Format(time.RFC3339), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
+		return map[string]any{"type": "appstate_mark_chat_as_read", "jid": evt.JID.String(), "timestamp": eventTime(evt.Timestamp), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
 	case *events.ClearChat:
-		return map[string]any{"type": "appstate_clear_chat", "jid": evt.JID.String(), "timestamp": evt.Timestamp.Format(time.RFC3339), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
+		return map[string]any{"type": "appstate_clear_chat", "jid": evt.JID.String(), "timestamp": eventTime(evt.Timestamp), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
 	case *events.DeleteChat:
-		return map[string]any{"type": "appstate_delete_chat", "jid": evt.JID.String(), "timestamp": evt.Timestamp.Format(time.RFC3339), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
+		return map[string]any{"type": "appstate_delete_chat", "jid": evt.JID.String(), "timestamp": eventTime(evt.Timestamp), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
 	case *events.PushNameSetting:
-		return map[string]any{"type": "appstate_push_name_setting", "timestamp": evt.Timestamp.Format(time.RFC3339), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
+		return map[string]any{"type": "appstate_push_name_setting", "timestamp": eventTime(evt.Timestamp), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
 	case *events.UnarchiveChatsSetting:
-		return map[string]any{"type": "appstate_unarchive_chats_setting", "timestamp": evt.Timestamp.Format(time.RFC3339), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
+		return map[string]any{"type": "appstate_unarchive_chats_setting", "timestamp": eventTime(evt.Timestamp), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
 	case *events.UserStatusMute:
-		return map[string]any{"type": "appstate_user_status_mute", "jid": evt.JID.String(), "timestamp": evt.Timestamp.Format(time.RFC3339), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
+		return map[string]any{"type": "appstate_user_status_mute", "jid": evt.JID.String(), "timestamp": eventTime(evt.Timestamp), "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
 	case *events.LabelEdit:
-		return map[string]any{"type": "appstate_label_edit", "timestamp": evt.Timestamp.Format(time.RFC3339), "label_id": evt.LabelID, "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
+		return map[string]any{"type": "appstate_label_edit", "timestamp": eventTime(evt.Timestamp), "label_id": evt.LabelID, "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
 	case *events.LabelAssociationChat:
-		return map[string]any{"type": "appstate_label_association_chat", "jid": evt.JID.String(), "timestamp": evt.Timestamp.Format(time.RFC3339), "label_id": evt.LabelID, "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
+		return map[string]any{"type": "appstate_label_association_chat", "jid": evt.JID.String(), "timestamp": eventTime(evt.Timestamp), "label_id": evt.LabelID, "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
 	case *events.LabelAssociationMessage:
-		return map[string]any{"type": "appstate_label_association_message", "jid": evt.JID.String(), "timestamp": evt.Timestamp.Format(time.RFC3339), "label_id": evt.LabelID, "message_id": evt.MessageID, "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
+		return map[string]any{"type": "appstate_label_association_message", "jid": evt.JID.String(), "timestamp": eventTime(evt.Timestamp), "label_id": evt.LabelID, "message_id": evt.MessageID, "action": marshalProtoToMap(evt.Action), "from_full_sync": evt.FromFullSync}
 	case *events.AppState:
 		out := map[string]any{"type": "appstate", "index": evt.Index}
 		if evt.SyncActionValue != nil {
@@ -440,26 +495,26 @@ func serializeEvent(raw interface{}) map[string]any {
 
 	// Calls
 	case *events.CallOffer:
-		return map[string]any{"type": "call_offer", "basic": evt.BasicCallMeta, "remote": evt.CallRemoteMeta, "data": evt.Data}
+		return map[string]any{"type": "call_offer", "basic": evt.BasicCallMeta, "remote": evt.CallRemoteMeta, "data": nodeToJSON(evt.Data)}
 	case *events.CallAccept:
-		return map[string]any{"type": "call_accept", "basic": evt.BasicCallMeta, "remote": evt.CallRemoteMeta, "data": evt.Data}
+		return map[string]any{"type": "call_accept", "basic": evt.BasicCallMeta, "remote": evt.CallRemoteMeta, "data": nodeToJSON(evt.Data)}
 	case *events.CallPreAccept:
-		return map[string]any{"type": "call_pre_accept", "basic": evt.BasicCallMeta, "remote": evt.CallRemoteMeta, "data": evt.Data}
+		return map[string]any{"type": "call_pre_accept", "basic": evt.BasicCallMeta, "remote": evt.CallRemoteMeta, "data": nodeToJSON(evt.Data)}
 	case *events.CallTransport:
-		return map[string]any{"type": "call_transport", "basic": evt.BasicCallMeta, "remote": evt.CallRemoteMeta, "data": evt.Data}
+		return map[string]any{"type": "call_transport", "basic": evt.BasicCallMeta, "remote": evt.CallRemoteMeta, "data": nodeToJSON(evt.Data)}
 	case *events.CallOfferNotice:
-		return map[string]any{"type": "call_offer_notice", "basic": evt.BasicCallMeta, "media": evt.Media, "notice_type": evt.Type, "data": evt.Data}
+		return map[string]any{"type": "call_offer_notice", "basic": evt.BasicCallMeta, "media": evt.Media, "notice_type": evt.Type, "data": nodeToJSON(evt.Data)}
 	case *events.CallRelayLatency:
-		return map[string]any{"type": "call_relay_latency", "basic": evt.BasicCallMeta, "data": evt.Data}
+		return map[string]any{"type": "call_relay_latency", "basic": evt.BasicCallMeta, "data": nodeToJSON(evt.Data)}
 	case *events.CallTerminate:
-		return map[string]any{"type": "call_terminate", "basic": evt.BasicCallMeta, "reason": evt.Reason, "data": evt.Data}
+		return map[string]any{"type": "call_terminate", "basic": evt.BasicCallMeta, "reason": evt.Reason, "data": nodeToJSON(evt.Data)}
 	case *events.CallReject:
-		return map[string]any{"type": "call_reject", "basic": evt.BasicCallMeta, "data": evt.Data}
+		return map[string]any{"type": "call_reject", "basic": evt.BasicCallMeta, "data": nodeToJSON(evt.Data)}
 	case *events.UnknownCallEvent:
-		return map[string]any{"type": "call_unknown", "node": evt.Node}
+		return map[string]any{"type": "call_unknown", "node": nodeToJSON(evt.Node)}
 
 	default:
-		return map[string]any{"type": fmt.Sprintf("unknown:%T", raw)}
+		return serializeUnknownEvent(raw)
 	}
 }
 
@@ -471,31 +526,33 @@ func strPtr(j *types.JID) string {
 }
 
 //export WmClientStartEvents
-func WmClientStartEvents(input *C.char) *C.char {
+func WmClientStartEvents(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var payload struct {
-		Client uint64 `json:"client"`
+		Client       uint64   `json:"client"`
+		Include      []string `json:"include"`
+		Exclude      []string `json:"exclude"`
+		Chats        []string `json:"chats"`
+		ExcludeChats []string `json:"exclude_chats"`
+		serializeOptions
 	}
 	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
 	}
-	clientsMu.RLock()
-	cli := clients[handle(payload.Client)]
-	clientsMu.RUnlock()
-	if cli == nil {
-		return fail(errors.New("client handle not found"))
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	chats, err := newChatFilter(payload.Chats, payload.ExcludeChats)
+	if err != nil {
+		return fail(err)
+	}
+	if err = payload.serializeOptions.normalize(); err != nil {
+		return fail(err)
 	}
 	ctx, cancel := context.WithCancel(context.Background())
-	stream := &eventStream{ch: make(chan map[string]any, 128), ctx: ctx, cancel: cancel, client: cli}
-	stream.handlerID = cli.AddEventHandler(func(raw interface{}) {
-		if raw == nil {
-			return
-		}
-		payload := serializeEvent(raw)
-		select {
-		case stream.ch <- payload:
-		default: /* drop if full */
-		}
-	})
+	stream := &eventStream{ch: make(chan any, 128), ctx: ctx, cancel: cancel, client: cli, filter: newEventFilter(payload.Include, payload.Exclude), chats: chats, opts: payload.serializeOptions}
 	h := newHandle()
 	eventsMu.Lock()
 	eventsMap[h] = stream
@@ -503,8 +560,102 @@ func WmClientStartEvents(input *C.char) *C.char {
 	return success(map[string]any{"handle": uint64(h)})
 }
 
+// persistEvent hands an event to the client's journal and webhook, if enabled.
+func persistEvent(cli *wa.Client, cfg *clientConfig, ev map[string]any) {
+	if j := cfg.eventJournal(); j != nil {
+		j.append(cli, ev)
+	}
+	if w := cfg.webhookSink(); w != nil {
+		w.enqueue(ev)
+	}
+}
+
+// deliverEvent persists a whatsmeow event (when enabled) and fans it out to every
+// stream open for cli. Streams sharing the same options share one serialization.
+// extra holds bridge-computed fields merged into the serialized event.
+func deliverEvent(cli *wa.Client, raw interface{}, extra map[string]any) {
+	cache := map[serializeOptions]map[string]any{}
+	if cfg := configFor(cli); cfg.eventJournal() != nil || cfg.webhookSink() != nil {
+		base := serializeEvent(raw, serializeOptions{})
+		rememberEventType(raw, base)
+		maps.Copy(base, extra)
+		persistEvent(cli, cfg, base)
+		cache[serializeOptions{}] = base
+	}
+	// journaled events and those with extra fields need the map form
+	var fastType string
+	if len(cache) == 0 && extra == nil {
+		fastType = fastEventType(raw)
+	}
+	encoded := map[serializeOptions]json.RawMessage{}
+	eventsMu.RLock()
+	defer eventsMu.RUnlock()
+	for _, es := range eventsMap {
+		if es.client != cli || !es.chats.allows(raw) {
+			continue
+		}
+		if name, ok := knownEventType(raw); ok && !es.filter.allows(name) {
+			continue
+		}
+		if fastType != "" {
+			if !es.filter.allows(fastType) {
+				continue
+			}
+			ev, ok := encoded[es.opts]
+			if !ok {
+				ev = encodeFastEvent(raw, es.opts)
+				encoded[es.opts] = ev
+			}
+			es.push(ev)
+			continue
+		}
+		payload, ok := cache[es.opts]
+		if !ok {
+			payload = serializeEvent(raw, es.opts)
+			rememberEventType(raw, payload)
+			maps.Copy(payload, extra)
+			if seq, ok := cache[serializeOptions{}]["seq"]; ok {
+				payload["seq"] = seq
+			}
+			cache[es.opts] = payload
+		}
+		if !es.filter.allows(payload["type"].(string)) {
+			continue
+		}
+		es.push(payload)
+	}
+}
+
+// emitBridgeEvent queues a bridge-generated event on every stream open for cli.
+func emitBridgeEvent(cli *wa.Client, ev map[string]any) {
+	ev["schema_version"] = eventSchemaVersion
+	formatted := map[string]map[string]any{}
+	base := cloneEventMap(ev)
+	formatEventTimes(base, "")
+	persistEvent(cli, configFor(cli), base)
+	formatted[""] = base
+	eventsMu.RLock()
+	defer eventsMu.RUnlock()
+	for _, es := range eventsMap {
+		if es.client != cli || !es.filter.allows(ev["type"].(string)) || !es.chats.allowsBridgeEvent(ev) {
+			continue
+		}
+		payload, ok := formatted[es.opts.TimestampFormat]
+		if !ok {
+			payload = cloneEventMap(ev)
+			formatEventTimes(payload, es.opts.TimestampFormat)
+			if seq, ok := base["seq"]; ok {
+				payload["seq"] = seq
+			}
+			formatted[es.opts.TimestampFormat] = payload
+		}
+		es.push(payload)
+	}
+}
+
 //export WmEventNext
-func WmEventNext(input *C.char) *C.char {
+func WmEventNext(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var payload struct {
 		Handle    uint64 `json:"handle"`
 		TimeoutMs int    `json:"timeoutMs"`
@@ -518,6 +669,9 @@ func WmEventNext(input *C.char) *C.char {
 	if es == nil {
 		return fail(errors.New("event handle not found"))
 	}
+	if n := es.pendingDrops.Swap(0); n > 0 && es.filter.allows("events_dropped") {
+		return success(map[string]any{"type": "events_dropped", "count": n, "total_dropped": es.dropped.Load(), "schema_version": eventSchemaVersion})
+	}
 	var timeout <-chan time.Time
 	if payload.TimeoutMs > 0 {
 		timeout = time.After(time.Duration(payload.TimeoutMs) * time.Millisecond)
@@ -526,6 +680,7 @@ func WmEventNext(input *C.char) *C.char {
 	}
 	select {
 	case ev := <-es.ch:
+		es.popped()
 		return success(ev)
 	case <-timeout:
 		return success(map[string]any{"type": "timeout"})
@@ -534,6 +689,24 @@ func WmEventNext(input *C.char) *C.char {
 	}
 }
 
+//export WmEventStats
+func WmEventStats(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Handle uint64 `json:"handle"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	eventsMu.RLock()
+	es := eventsMap[handle(payload.Handle)]
+	eventsMu.RUnlock()
+	if es == nil {
+		return fail(errors.New("event handle not found"))
+	}
+	return success(es.stats())
+}
+
 // registries
 var (
 	containersMu sync.RWMutex
@@ -550,30 +723,87 @@ var (
 
 	eventsMu  sync.RWMutex
 	eventsMap = map[handle]*eventStream{}
+
+	mediaJobsMu sync.RWMutex
+	mediaJobs   = map[handle]*mediaJob{}
 )
 
 type qrState struct {
 	ch     <-chan wa.QRChannelItem
 	cancel context.CancelFunc
+	client *wa.Client
 }
 
 type eventStream struct {
-	ch        chan map[string]any
-	ctx       context.Context
-	cancel    context.CancelFunc
-	client    *wa.Client
-	handlerID uint32
+	// ch holds event maps, or json.RawMessage for events encoded by encodeFastEvent
+	ch     chan any
+	ctx    context.Context
+	cancel context.CancelFunc
+	client *wa.Client
+	filter *eventFilter
+	chats  *chatFilter
+	opts   serializeOptions
+
+	// queuedAt mirrors the enqueue time of every event currently in ch
+	mu           sync.Mutex
+	queuedAt     []time.Time
+	delivered    atomic.Uint64
+	dropped      atomic.Uint64
+	pendingDrops atomic.Uint64
+}
+
+// push queues ev without blocking, counting it as dropped when the buffer is full.
+func (es *eventStream) push(ev any) bool {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	select {
+	case es.ch <- ev:
+		es.queuedAt = append(es.queuedAt, time.Now())
+		return true
+	default:
+		es.dropped.Add(1)
+		es.pendingDrops.Add(1)
+		return false
+	}
+}
+
+func (es *eventStream) popped() {
+	es.mu.Lock()
+	if len(es.queuedAt) > 0 {
+		es.queuedAt = es.queuedAt[1:]
+	}
+	es.mu.Unlock()
+	es.delivered.Add(1)
+}
+
+func (es *eventStream) stats() map[string]any {
+	es.mu.Lock()
+	depth := len(es.ch)
+	var oldest string
+	if len(es.queuedAt) > 0 {
+		oldest = es.queuedAt[0].Format(time.RFC3339Nano)
+	}
+	es.mu.Unlock()
+	return map[string]any{
+		"delivered":     es.delivered.Load(),
+		"dropped":       es.dropped.Load(),
+		"queue_depth":   depth,
+		"queue_cap":     cap(es.ch),
+		"oldest_queued": oldest,
+	}
 }
 
 type jsonResp struct {
 	Ok    bool        `json:"ok"`
 	Data  interface{} `json:"data,omitempty"`
 	Error string      `json:"error,omitempty"`
+	// set when the call panicked
+	Stack string `json:"stack,omitempty"`
 }
 
 func success(data interface{}) *C.char {
 	b, _ := json.Marshal(jsonResp{Ok: true, Data: data})
-	return C.CString(string(b))
+	return C.CString(string(compressedEnvelope(b)))
 }
 
 func fail(err error) *C.char {
@@ -582,6 +812,13 @@ func fail(err error) *C.char {
 	return C.CString(string(b))
 }
 
+func respond(data any, err error) *C.char {
+	if err != nil {
+		return fail(err)
+	}
+	return success(data)
+}
+
 //export WmFreeCString
 func WmFreeCString(ptr *C.char) {
 	if ptr != nil {
@@ -590,8 +827,19 @@ func WmFreeCString(ptr *C.char) {
 }
 
 type openContainerReq struct {
-	Dialect string `json:"dialect"`
-	Address string `json:"address"`
+	Dialect       string            `json:"dialect"`
+	Address       string            `json:"address"`
+	Driver        string            `json:"driver"`
+	DriverOptions map[string]string `json:"driver_options"`
+	Pool          *poolOptions      `json:"pool"`
+	SQLite        *sqliteOptions    `json:"sqlite"`
+	Encryption    *struct {
+		Passphrase string `json:"passphrase"`
+	} `json:"encryption"`
+	// Upgrade false fails on an outdated schema instead of migrating it
+	Upgrade *bool `json:"upgrade"`
+	// Schema keeps a postgres tenant's tables in their own schema
+	Schema string `json:"schema"`
 }
 
 type withHandle struct {
@@ -599,7 +847,11 @@ type withHandle struct {
 }
 
 //export WmOpenContainer
-func WmOpenContainer(input *C.char) *C.char {
+func WmOpenContainer(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	if err := checkShutdown(); err != nil {
+		return fail(err)
+	}
 	var req openContainerReq
 	if err := json.Unmarshal([]byte(C.GoString(input)), &req); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
@@ -608,12 +860,62 @@ func WmOpenContainer(input *C.char) *C.char {
 		return fail(errors.New("dialect and address are required"))
 	}
 	ctx := context.Background()
-	dbLog := newDBLogger()
-	cont, err := sqlstore.New(ctx, req.Dialect, req.Address, dbLog)
+	h := newHandle()
+	dbLog := newDBLogger(h)
+	driver, err := sqlDriverFor(req.Dialect, req.Driver)
 	if err != nil {
 		return fail(err)
 	}
-	h := newHandle()
+	address := req.Address
+	if req.SQLite != nil {
+		if req.Dialect != "sqlite3" {
+			return fail(errors.New("sqlite options require the sqlite3 dialect"))
+		}
+		if address, err = sqliteDSN(address, req.SQLite); err != nil {
+			return fail(err)
+		}
+	}
+	driverOptions, err := tenantSchemaOptions(req.Dialect, req.Schema, req.DriverOptions)
+	if err != nil {
+		return fail(err)
+	}
+	if address, err = withDriverOptions(req.Dialect, address, driverOptions); err != nil {
+		return fail(err)
+	}
+	var db *sql.DB
+	if req.Encryption != nil {
+		if req.Dialect != "sqlite3" || driver != "sqlite3" {
+			return fail(errors.New("encryption is only supported for sqlite3 (SQLCipher)"))
+		}
+		if db, err = openEncryptedSQLite(address, req.Encryption.Passphrase); err != nil {
+			return fail(err)
+		}
+	} else if db, err = sql.Open(driver, address); err != nil {
+		return fail(fmt.Errorf("failed to open database: %w", err))
+	}
+	req.Pool.apply(db)
+	if req.Schema != "" {
+		if err = createTenantSchema(ctx, db, req.Schema); err != nil {
+			_ = db.Close()
+			return fail(err)
+		}
+	}
+	cont := sqlstore.NewWithDB(db, req.Dialect, dbLog)
+	if req.Upgrade != nil && !*req.Upgrade {
+		if err := checkSchemaVersion(ctx, db); err != nil {
+			_ = db.Close()
+			return fail(err)
+		}
+	} else if err := cont.Upgrade(ctx); err != nil {
+		_ = db.Close()
+		return fail(fmt.Errorf("failed to upgrade database: %w", err))
+	}
+	bdb := &bridgeDB{db: db, dialect: req.Dialect}
+	if err := bdb.upgrade(ctx); err != nil {
+		_ = db.Close()
+		return fail(err)
+	}
+	registerBridgeDB(cont, bdb)
 	containersMu.Lock()
 	containers[h] = cont
 	containersMu.Unlock()
@@ -621,7 +923,8 @@ func WmOpenContainer(input *C.char) *C.char {
 }
 
 //export WmContainerGetFirstDevice
-func WmContainerGetFirstDevice(input *C.char) *C.char {
+func WmContainerGetFirstDevice(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var req withHandle
 	if err := json.Unmarshal([]byte(C.GoString(input)), &req); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
@@ -645,7 +948,8 @@ func WmContainerGetFirstDevice(input *C.char) *C.char {
 }
 
 //export WmContainerGetAllDevices
-func WmContainerGetAllDevices(input *C.char) *C.char {
+func WmContainerGetAllDevices(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var req withHandle
 	if err := json.Unmarshal([]byte(C.GoString(input)), &req); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
@@ -673,7 +977,8 @@ func WmContainerGetAllDevices(input *C.char) *C.char {
 }
 
 //export WmContainerGetDevice
-func WmContainerGetDevice(input *C.char) *C.char {
+func WmContainerGetDevice(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var req struct {
 		Handle uint64 `json:"handle"`
 		JID    string `json:"jid"`
@@ -706,10 +1011,46 @@ func WmContainerGetDevice(input *C.char) *C.char {
 	return success(map[string]any{"handle": uint64(h), "found": true})
 }
 
+//export WmDeviceGetInfo
+func WmDeviceGetInfo(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var req withHandle
+	if err := json.Unmarshal([]byte(C.GoString(input)), &req); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	devicesMu.RLock()
+	dev := devices[handle(req.Handle)]
+	devicesMu.RUnlock()
+	if dev == nil {
+		return fail(errors.New("device handle not found"))
+	}
+	info := map[string]any{
+		"registration_id": dev.RegistrationID,
+		"platform":        dev.Platform,
+		"push_name":       dev.PushName,
+		"business_name":   dev.BusinessName,
+		"initialized":     dev.Initialized,
+		"paired":          dev.ID != nil,
+	}
+	if dev.ID != nil {
+		info["jid"] = dev.ID.String()
+	}
+	if !dev.LID.IsEmpty() {
+		info["lid"] = dev.LID.String()
+	}
+	return success(info)
+}
+
 //export WmNewClient
-func WmNewClient(input *C.char) *C.char {
+func WmNewClient(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	if err := checkShutdown(); err != nil {
+		return fail(err)
+	}
 	var payload struct {
 		Device uint64 `json:"device"`
+		// free-form tag reported back by WmListClients and WmListHandles
+		Label string `json:"label"`
 	}
 	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
@@ -720,56 +1061,138 @@ func WmNewClient(input *C.char) *C.char {
 	if dev == nil {
 		return fail(errors.New("device handle not found"))
 	}
-	clientLog := newClientLogger()
-	cli := wa.NewClient(dev, clientLog)
 	h := newHandle()
+	clientLog := newClientLogger(h)
+	guardPushNames(dev)
+	cli := wa.NewClient(dev, clientLog)
+	cli.AddEventHandler(func(raw interface{}) { handleBridgeEvent(cli, raw) })
+	configFor(cli).label = payload.Label
 	clientsMu.Lock()
 	clients[h] = cli
 	clientsMu.Unlock()
 	return success(map[string]any{"handle": uint64(h)})
 }
 
+// handleBridgeEvent is the only whatsmeow event handler of a client: it runs the
+// bridge's own bookkeeping and then hands the event to the journal and streams.
+func handleBridgeEvent(cli *wa.Client, raw interface{}) {
+	if raw == nil {
+		return
+	}
+	var extra map[string]any
+	trackHealth(cli, raw)
+	switch evt := raw.(type) {
+	case *events.HistorySync:
+		recordHistorySyncChunk(cli, evt)
+		trackDisappearingTimer(cli, evt)
+	case *events.GroupInfo:
+		trackDisappearingTimer(cli, evt)
+	case *events.DeleteForMe:
+		forgetArchivedMessage(cli, evt.ChatJID, evt.MessageID)
+	case *events.IdentityChange:
+		quarantineIdentity(cli, evt)
+	case *events.Connected:
+		if attempts := resetReconnect(cli); attempts > 0 {
+			emitConnectionState(cli, "connected", map[string]any{"attempts": attempts})
+		} else {
+			emitConnectionState(cli, "connected", nil)
+		}
+		renewNewsletterLiveUpdates(cli)
+		submitTask(cli, func() { checkPreKeys(cli, -1) })
+	case *events.Disconnected:
+		emitConnectionState(cli, "disconnected", nil)
+		autoReconnect(cli)
+	case *events.CallOffer:
+		submitTask(cli, func() { autoRejectCall(cli, evt.BasicCallMeta) })
+	case *events.UndecryptableMessage:
+		recordRetryEvent(cli, evt)
+		recoverUnavailable(cli, evt)
+	case *events.Receipt:
+		recordRetryEvent(cli, evt)
+	case *events.Message:
+		seen, drop := checkDuplicate(cli, evt)
+		if drop {
+			return
+		}
+		if seen > 0 {
+			// the side effects already ran for the first copy
+			extra = map[string]any{"was_duplicate": seen}
+			break
+		}
+		archiveMessage(cli, evt)
+		linkRecoveredMessage(cli, evt)
+		trackDisappearingTimer(cli, evt)
+		storeMessageSecret(cli, evt)
+		decryptPollVote(cli, evt)
+		trackReaction(cli, evt)
+		recordNewsletterPost(cli, evt)
+		extra = scheduleAutoDownload(cli, evt)
+		mergeExtra(&extra, linkMessageEdit(cli, evt))
+		mergeExtra(&extra, linkComment(cli, evt))
+		mergeExtra(&extra, linkOrder(cli, evt))
+		mergeExtra(&extra, linkNativeFlow(evt))
+		mergeExtra(&extra, linkEncReaction(cli, evt))
+		mergeExtra(&extra, linkGroupInvite(evt))
+	}
+	deliverEvent(cli, raw, extra)
+}
+
+// mergeExtra adds fields to *extra, allocating it on first use.
+func mergeExtra(extra *map[string]any, fields map[string]any) {
+	if len(fields) == 0 {
+		return
+	}
+	if *extra == nil {
+		*extra = make(map[string]any, len(fields))
+	}
+	maps.Copy(*extra, fields)
+}
+
 //export WmClientConnect
-func WmClientConnect(input *C.char) *C.char {
+func WmClientConnect(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var payload struct {
 		Client uint64 `json:"client"`
 	}
 	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
 	}
-	clientsMu.RLock()
-	cli := clients[handle(payload.Client)]
-	clientsMu.RUnlock()
-	if cli == nil {
-		return fail(errors.New("client handle not found"))
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	resetIdle(cli)
+	if !cli.IsConnected() {
+		emitConnectionState(cli, "connecting", nil)
 	}
-	if err := cli.Connect(); err != nil {
+	if err := connectClient(cli); err != nil {
 		return fail(err)
 	}
 	return success(map[string]any{})
 }
 
 //export WmClientGetQRChannel
-func WmClientGetQRChannel(input *C.char) *C.char {
+func WmClientGetQRChannel(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var payload struct {
 		Client uint64 `json:"client"`
 	}
 	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
 	}
-	clientsMu.RLock()
-	cli := clients[handle(payload.Client)]
-	clientsMu.RUnlock()
-	if cli == nil {
-		return fail(errors.New("client handle not found"))
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
 	}
+	defer end()
 	ctx, cancel := context.WithCancel(context.Background())
 	ch, err := cli.GetQRChannel(ctx)
 	if err != nil {
 		cancel()
 		return fail(err)
 	}
-	state := &qrState{ch: ch, cancel: cancel}
+	state := &qrState{ch: ch, cancel: cancel, client: cli}
 	h := newHandle()
 	qrsMu.Lock()
 	qrs[h] = state
@@ -778,7 +1201,8 @@ func WmClientGetQRChannel(input *C.char) *C.char {
 }
 
 //export WmQRNext
-func WmQRNext(input *C.char) *C.char {
+func WmQRNext(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var payload struct {
 		Handle    uint64 `json:"handle"`
 		TimeoutMs int    `json:"timeoutMs"`
@@ -828,7 +1252,8 @@ func WmQRNext(input *C.char) *C.char {
 }
 
 //export WmClientSendPresence
-func WmClientSendPresence(input *C.char) *C.char {
+func WmClientSendPresence(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var payload struct {
 		Client uint64 `json:"client"`
 		State  string `json:"state"`
@@ -836,12 +1261,11 @@ func WmClientSendPresence(input *C.char) *C.char {
 	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
 	}
-	clientsMu.RLock()
-	cli := clients[handle(payload.Client)]
-	clientsMu.RUnlock()
-	if cli == nil {
-		return fail(errors.New("client handle not found"))
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
 	}
+	defer end()
 	if err := cli.SendPresence(types.Presence(payload.State)); err != nil {
 		return fail(err)
 	}
@@ -849,7 +1273,8 @@ func WmClientSendPresence(input *C.char) *C.char {
 }
 
 //export WmClientSubscribePresence
-func WmClientSubscribePresence(input *C.char) *C.char {
+func WmClientSubscribePresence(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var payload struct {
 		Client uint64 `json:"client"`
 		JID    string `json:"jid"`
@@ -857,24 +1282,31 @@ func WmClientSubscribePresence(input *C.char) *C.char {
 	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
 	}
-	clientsMu.RLock()
-	cli := clients[handle(payload.Client)]
-	clientsMu.RUnlock()
-	if cli == nil {
-		return fail(errors.New("client handle not found"))
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
 	}
+	defer end()
 	jid, err := types.ParseJID(payload.JID)
 	if err != nil {
 		return fail(err)
 	}
+	// without a privacy token from the contact the server may ignore the
+	// subscription; the error_on_subscribe_presence_without_token flag fails it
+	out := map[string]any{"has_token": false}
+	if token, err := cli.Store.PrivacyTokens.GetPrivacyToken(context.Background(), jid.ToNonAD()); err == nil && token != nil {
+		out["has_token"] = true
+		out["token_timestamp"] = token.Timestamp.UnixMilli()
+	}
 	if err := cli.SubscribePresence(jid); err != nil {
 		return fail(err)
 	}
-	return success(map[string]any{})
+	return success(out)
 }
 
 //export WmClientSendChatPresence
-func WmClientSendChatPresence(input *C.char) *C.char {
+func WmClientSendChatPresence(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var payload struct {
 		Client uint64 `json:"client"`
 		JID    string `json:"jid"`
@@ -884,12 +1316,11 @@ func WmClientSendChatPresence(input *C.char) *C.char {
 	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
 	}
-	clientsMu.RLock()
-	cli := clients[handle(payload.Client)]
-	clientsMu.RUnlock()
-	if cli == nil {
-		return fail(errors.New("client handle not found"))
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
 	}
+	defer end()
 	jid, err := types.ParseJID(payload.JID)
 	if err != nil {
 		return fail(err)
@@ -925,21 +1356,22 @@ func mapMediaType(name string) (wa.MediaType, error) {
 }
 
 //export WmClientUpload
-func WmClientUpload(input *C.char) *C.char {
+func WmClientUpload(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var payload struct {
 		Client  uint64 `json:"client"`
 		DataB64 string `json:"data"`
 		Type    string `json:"type"`
+		OpID    uint64 `json:"op_id"`
 	}
 	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
 	}
-	clientsMu.RLock()
-	cli := clients[handle(payload.Client)]
-	clientsMu.RUnlock()
-	if cli == nil {
-		return fail(errors.New("client handle not found"))
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
 	}
+	defer end()
 	data, err := base64.StdEncoding.DecodeString(payload.DataB64)
 	if err != nil {
 		return fail(fmt.Errorf("invalid base64: %w", err))
@@ -948,7 +1380,19 @@ func WmClientUpload(input *C.char) *C.char {
 	if err != nil {
 		return fail(err)
 	}
-	resp, err := cli.Upload(context.Background(), data, mt)
+	ctx, done, err := beginOp(payload.OpID)
+	if err != nil {
+		return fail(err)
+	}
+	defer done()
+	ctx, cancel := withClientDeadline(ctx, cli)
+	defer cancel()
+	release, err := acquireMedia(ctx, cli)
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+	resp, err := cli.Upload(ctx, data, mt)
 	if err != nil {
 		return fail(err)
 	}
@@ -966,7 +1410,8 @@ func WmClientUpload(input *C.char) *C.char {
 }
 
 //export WmClientDownloadByPath
-func WmClientDownloadByPath(input *C.char) *C.char {
+func WmClientDownloadByPath(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var payload struct {
 		Client     uint64 `json:"client"`
 		DirectPath string `json:"direct_path"`
@@ -976,16 +1421,16 @@ func WmClientDownloadByPath(input *C.char) *C.char {
 		FileLength int    `json:"file_length"`
 		Type       string `json:"type"`
 		MMSType    string `json:"mms_type"`
+		OpID       uint64 `json:"op_id"`
 	}
 	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
 	}
-	clientsMu.RLock()
-	cli := clients[handle(payload.Client)]
-	clientsMu.RUnlock()
-	if cli == nil {
-		return fail(errors.New("client handle not found"))
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
 	}
+	defer end()
 	encSHA, err := base64.StdEncoding.DecodeString(payload.EncSHA256)
 	if err != nil {
 		return fail(err)
@@ -1002,7 +1447,19 @@ func WmClientDownloadByPath(input *C.char) *C.char {
 	if err != nil {
 		return fail(err)
 	}
-	data, err := cli.DownloadMediaWithPath(context.Background(), payload.DirectPath, encSHA, sha, mediaKey, payload.FileLength, mt, payload.MMSType)
+	ctx, done, err := beginOp(payload.OpID)
+	if err != nil {
+		return fail(err)
+	}
+	defer done()
+	ctx, cancel := withClientDeadline(ctx, cli)
+	defer cancel()
+	release, err := acquireMedia(ctx, cli)
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+	data, err := cli.DownloadMediaWithPath(ctx, payload.DirectPath, encSHA, sha, mediaKey, payload.FileLength, mt, payload.MMSType)
 	if err != nil {
 		return fail(err)
 	}
@@ -1010,7 +1467,8 @@ func WmClientDownloadByPath(input *C.char) *C.char {
 }
 
 //export WmClientGetGroupInviteLink
-func WmClientGetGroupInviteLink(input *C.char) *C.char {
+func WmClientGetGroupInviteLink(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var payload struct {
 		Client uint64 `json:"client"`
 		JID    string `json:"jid"`
@@ -1019,12 +1477,11 @@ func WmClientGetGroupInviteLink(input *C.char) *C.char {
 	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
 	}
-	clientsMu.RLock()
-	cli := clients[handle(payload.Client)]
-	clientsMu.RUnlock()
-	if cli == nil {
-		return fail(errors.New("client handle not found"))
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
 	}
+	defer end()
 	jid, err := types.ParseJID(payload.JID)
 	if err != nil {
 		return fail(err)
@@ -1037,127 +1494,87 @@ func WmClientGetGroupInviteLink(input *C.char) *C.char {
 }
 
 //export WmClientCall
-func WmClientCall(input *C.char) *C.char {
-	// Dispatcher genérico por reflexão
+func WmClientCall(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	return respond(clientCall([]byte(C.GoString(input))))
+}
+
+// clientCall is the generic reflection dispatcher behind WmClientCall.
+func clientCall(input []byte) (any, error) {
 	var payload struct {
 		Client uint64          `json:"client"`
 		Method string          `json:"method"`
 		Args   json.RawMessage `json:"args"`
+		OpID   uint64          `json:"op_id"`
+		// sends only: derive the message ID from this key (see idempotentMessageID)
+		IdempotencyKey string `json:"idempotency_key"`
 	}
-	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
-		return fail(fmt.Errorf("invalid json: %w", err))
+	if err := json.Unmarshal(input, &payload); err != nil {
+		return nil, fmt.Errorf("invalid json: %w", err)
 	}
-	clientsMu.RLock()
-	cli := clients[handle(payload.Client)]
-	clientsMu.RUnlock()
-	if cli == nil {
-		return fail(errors.New("client handle not found"))
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return nil, err
 	}
+	defer end()
+	return invokeClientMethod(cli, payload.Method, payload.Args, payload.OpID, payload.IdempotencyKey)
+}
 
-	rv := reflect.ValueOf(cli)
-	meth := rv.MethodByName(payload.Method)
-	if !meth.IsValid() {
-		return fail(fmt.Errorf("method not found: %s", payload.Method))
+// invokeClientMethod calls a whatsmeow.Client method with JSON args. Callers
+// admit the call with beginClientCall first.
+func invokeClientMethod(cli *wa.Client, method string, rawArgs json.RawMessage, opID uint64, idempotencyKey string) (any, error) {
+	plan, err := dispatchPlanFor(typeOfClient, method)
+	if err != nil {
+		return nil, err
 	}
-	mt := meth.Type()
-
-	// Parse args as array of raw messages
-	var rawArgs []json.RawMessage
-	if len(payload.Args) > 0 && string(payload.Args) != "null" && string(payload.Args) != "{}" {
-		if payload.Args[0] == '[' { // fast check
-			if err := json.Unmarshal(payload.Args, &rawArgs); err != nil {
-				return fail(fmt.Errorf("args must be array: %w", err))
-			}
-		} else {
-			// allow single arg object for single non-context parameter
-			rawArgs = []json.RawMessage{payload.Args}
-		}
+	ctx, done, err := beginOp(opID)
+	if err != nil {
+		return nil, err
 	}
-
-	// Build call parameters
-	args := make([]reflect.Value, 0, mt.NumIn())
-	ai := 0
-	for i := 0; i < mt.NumIn(); i++ {
-		pt := mt.In(i)
-		// Auto-inject context.Context
-		if pt.Kind() == reflect.Interface && pt.Implements(reflect.TypeOf((*context.Context)(nil)).Elem()) {
-			args = append(args, reflect.ValueOf(context.Background()))
-			continue
-		}
-		// Handle variadic last parameter: allow missing -> empty slice
-		if mt.IsVariadic() && i == mt.NumIn()-1 {
-			if ai >= len(rawArgs) {
-				args = append(args, reflect.MakeSlice(pt, 0, 0))
-				continue
-			}
-			// If provided as array in JSON, use it directly
-			if rawArgs[ai][0] == '[' {
-				sliceVal, err := convertArg(rawArgs[ai], pt)
-				if err != nil {
-					return fail(fmt.Errorf("arg %d: %w", i, err))
-				}
-				args = append(args, sliceVal)
-				ai++
-				continue
-			} else {
-				// Wrap single object into array for variadic parameter
-				wrapped, _ := json.Marshal([]json.RawMessage{rawArgs[ai]})
-				sliceVal, err := convertArg(json.RawMessage(wrapped), pt)
-				if err != nil {
-					return fail(fmt.Errorf("arg %d: %w", i, err))
-				}
-				args = append(args, sliceVal)
-				ai++
-				continue
-			}
-		}
-		if ai >= len(rawArgs) {
-			return fail(fmt.Errorf("missing argument %d for %s", i, payload.Method))
-		}
-		v, err := convertArg(rawArgs[ai], pt)
+	defer done()
+	ctx, cancel := withClientDeadline(ctx, cli)
+	defer cancel()
+	if isMediaMethod(method) {
+		release, err := acquireMedia(ctx, cli)
 		if err != nil {
-			return fail(fmt.Errorf("arg %d: %w", i, err))
+			return nil, err
 		}
-		args = append(args, v)
-		ai++
+		defer release()
+	}
+	meth := reflect.ValueOf(cli).Method(plan.index)
+	args, err := plan.buildArgs(ctx, method, rawArgs)
+	if err != nil {
+		return nil, err
 	}
 
 	// Call (use CallSlice for variadic methods)
 	var out []reflect.Value
-	if mt.IsVariadic() {
+	var secretChat types.JID
+	var secret []byte
+	if err := throttleClientCall(ctx, cli, method, args); err != nil {
+		return nil, err
+	}
+	if method == "SendMessage" {
+		secretChat, secret = ensureSentMessageSecret(args)
+	}
+	if plan.variadic {
+		applySendDefaults(cli, args, idempotencyKey)
 		out = meth.CallSlice(args)
 	} else {
 		out = meth.Call(args)
 	}
-	// Handle error as last return
-	if len(out) > 0 {
-		if errv, ok := out[len(out)-1].Interface().(error); ok {
-			if errv != nil {
-				return fail(errv)
-			}
-			out = out[:len(out)-1]
-		}
+	out, err = splitError(out)
+	if err != nil {
+		return nil, err
 	}
-	if len(out) == 0 {
-		return success(map[string]any{})
+	if method == "SendMessage" && len(out) == 1 {
+		archiveSentPoll(cli, args, out[0])
+		storeSentMessageSecret(cli, secretChat, secret, out[0])
 	}
-	if len(out) == 1 {
-		enc, err := encodeReturn(out[0])
-		if err != nil {
-			return fail(err)
-		}
-		return success(enc)
-	}
-	// multiple returns
-	arr := make([]any, 0, len(out))
-	for _, v := range out {
-		enc, err := encodeReturn(v)
-		if err != nil {
-			return fail(err)
-		}
-		arr = append(arr, enc)
+	if method == "SetDisappearingTimer" {
+		recordSetDisappearingTimer(cli, args)
 	}
-	return success(arr)
+	return encodeResults(out)
 }
 
 var (
@@ -1167,61 +1584,86 @@ var (
 	typeOfJID      = reflect.TypeOf(types.JID{})
 )
 
+type argConverter func(raw json.RawMessage) (reflect.Value, error)
+
 func convertArg(raw json.RawMessage, t reflect.Type) (reflect.Value, error) {
+	return converterFor(t)(raw)
+}
+
+// converterFor inspects a parameter type once and returns its conversion, so
+// dispatch plans don't redo the type checks on every call.
+func converterFor(t reflect.Type) argConverter {
 	// context handled by caller
-	if t == typeOfDuration {
-		var ms int64
-		if err := json.Unmarshal(raw, &ms); err != nil {
-			return reflect.Value{}, err
+	switch {
+	case t == typeOfDuration:
+		return func(raw json.RawMessage) (reflect.Value, error) {
+			var ms int64
+			if err := json.Unmarshal(raw, &ms); err != nil {
+				return reflect.Value{}, err
+			}
+			d := time.Duration(ms) * time.Millisecond
+			return reflect.ValueOf(d), nil
 		}
-		d := time.Duration(ms) * time.Millisecond
-		return reflect.ValueOf(d), nil
-	}
-	if t == typeOfJID {
-		var s string
-		if err := json.Unmarshal(raw, &s); err != nil {
-			return reflect.Value{}, err
+	case t == typeOfJID:
+		return func(raw json.RawMessage) (reflect.Value, error) {
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return reflect.Value{}, err
+			}
+			jid, err := types.ParseJID(s)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			return reflect.ValueOf(jid), nil
 		}
-		jid, err := types.ParseJID(s)
-		if err != nil {
-			return reflect.Value{}, err
+	// devices are passed as device handles
+	case t == typeOfDevice:
+		return func(raw json.RawMessage) (reflect.Value, error) {
+			var h uint64
+			if err := json.Unmarshal(raw, &h); err != nil {
+				return reflect.Value{}, fmt.Errorf("expected a device handle: %w", err)
+			}
+			devicesMu.RLock()
+			dev := devices[handle(h)]
+			devicesMu.RUnlock()
+			if dev == nil {
+				return reflect.Value{}, errors.New("device handle not found")
+			}
+			return reflect.ValueOf(dev), nil
 		}
-		return reflect.ValueOf(jid), nil
-	}
 	// proto message pointer
-	if t.Kind() == reflect.Pointer && t.Implements(typeOfProtoMsg) {
-		pv := reflect.New(t.Elem())
-		// use protojson to unmarshal
-		if len(raw) == 0 || string(raw) == "null" {
+	case t.Kind() == reflect.Pointer && t.Implements(typeOfProtoMsg):
+		elem := t.Elem()
+		return func(raw json.RawMessage) (reflect.Value, error) {
+			pv := reflect.New(elem)
+			// use protojson to unmarshal
+			if len(raw) == 0 || string(raw) == "null" {
+				return pv, nil
+			}
+			if err := protojson.Unmarshal(raw, pv.Interface().(proto.Message)); err != nil {
+				return reflect.Value{}, err
+			}
 			return pv, nil
 		}
-		if err := protojson.Unmarshal(raw, pv.Interface().(proto.Message)); err != nil {
-			return reflect.Value{}, err
-		}
-		return pv, nil
-	}
 	// regular pointer to struct: json.Unmarshal into it
-	if t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Struct {
-		pv := reflect.New(t.Elem())
-		if err := json.Unmarshal(raw, pv.Interface()); err != nil {
-			return reflect.Value{}, err
+	case t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Struct:
+		elem := t.Elem()
+		return func(raw json.RawMessage) (reflect.Value, error) {
+			pv := reflect.New(elem)
+			if err := json.Unmarshal(raw, pv.Interface()); err != nil {
+				return reflect.Value{}, err
+			}
+			return pv, nil
 		}
-		return pv, nil
 	}
-	// struct by value
-	if t.Kind() == reflect.Struct {
+	// structs by value, basic kinds and slices
+	return func(raw json.RawMessage) (reflect.Value, error) {
 		pv := reflect.New(t)
 		if err := json.Unmarshal(raw, pv.Interface()); err != nil {
 			return reflect.Value{}, err
 		}
 		return pv.Elem(), nil
 	}
-	// basic kinds and slices
-	pv := reflect.New(t)
-	if err := json.Unmarshal(raw, pv.Interface()); err != nil {
-		return reflect.Value{}, err
-	}
-	return pv.Elem(), nil
 }
 
 func encodeReturn(v reflect.Value) (any, error) {
@@ -1332,25 +1774,44 @@ func encodeReturn(v reflect.Value) (any, error) {
 		}
 		return out, nil
 	}
+	// map[types.JID]T -> object keyed by JID string, values encoded like returns
+	if v.Kind() == reflect.Map && v.Type().Key() == typeOfJID {
+		out := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			enc, err := encodeReturn(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			out[iter.Key().Interface().(types.JID).String()] = enc
+		}
+		return out, nil
+	}
 	return v.Interface(), nil
 }
 
 //export WmRelease
-func WmRelease(input *C.char) *C.char {
+func WmRelease(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
 	var req withHandle
 	if err := json.Unmarshal([]byte(C.GoString(input)), &req); err != nil {
 		return fail(fmt.Errorf("invalid json: %w", err))
 	}
-	h := handle(req.Handle)
+	if err := releaseHandle(handle(req.Handle)); err != nil {
+		return fail(err)
+	}
+	return success(map[string]any{})
+}
+
+// releaseHandle frees whatever h refers to, along with its lease.
+func releaseHandle(h handle) error {
+	dropLease(h)
 	eventsMu.Lock()
 	if es, ok := eventsMap[h]; ok {
-		if es.client != nil && es.handlerID != 0 {
-			go es.client.RemoveEventHandler(es.handlerID)
-		}
 		es.cancel()
 		delete(eventsMap, h)
 		eventsMu.Unlock()
-		return success(map[string]any{})
+		return nil
 	}
 	eventsMu.Unlock()
 	qrsMu.Lock()
@@ -1358,33 +1819,83 @@ func WmRelease(input *C.char) *C.char {
 		st.cancel()
 		delete(qrs, h)
 		qrsMu.Unlock()
-		return success(map[string]any{})
+		return nil
 	}
 	qrsMu.Unlock()
+	mediaJobsMu.Lock()
+	if job, ok := mediaJobs[h]; ok {
+		job.cancel()
+		delete(mediaJobs, h)
+		mediaJobsMu.Unlock()
+		return nil
+	}
+	mediaJobsMu.Unlock()
+	eventSocketsMu.Lock()
+	if sock, ok := eventSockets[h]; ok {
+		sock.close()
+		delete(eventSockets, h)
+		eventSocketsMu.Unlock()
+		return nil
+	}
+	eventSocketsMu.Unlock()
+	logStreamsMu.Lock()
+	if ls, ok := logStreams[h]; ok {
+		ls.cancel()
+		delete(logStreams, h)
+		logStreamCount.Add(-1)
+		logStreamsMu.Unlock()
+		return nil
+	}
+	logStreamsMu.Unlock()
+	storeBackendsMu.Lock()
+	if b, ok := storeBackends[h]; ok {
+		b.close()
+		delete(storeBackends, h)
+		storeBackendsMu.Unlock()
+		return nil
+	}
+	storeBackendsMu.Unlock()
+	restServersMu.Lock()
+	if srv, ok := restServers[h]; ok {
+		delete(restServers, h)
+		restServersMu.Unlock()
+		srv.close()
+		return nil
+	}
+	restServersMu.Unlock()
+	opsMu.Lock()
+	if op, ok := ops[uint64(h)]; ok {
+		op.cancel()
+		delete(ops, uint64(h))
+		opsMu.Unlock()
+		return nil
+	}
+	opsMu.Unlock()
 	clientsMu.Lock()
 	if cl, ok := clients[h]; ok {
-		cl.Disconnect()
+		teardownClient(cl)
+		dropPingRTT(h)
 		delete(clients, h)
 		clientsMu.Unlock()
-		return success(map[string]any{})
+		return nil
 	}
 	clientsMu.Unlock()
 	devicesMu.Lock()
 	if _, ok := devices[h]; ok {
 		delete(devices, h)
 		devicesMu.Unlock()
-		return success(map[string]any{})
+		return nil
 	}
 	devicesMu.Unlock()
 	containersMu.Lock()
 	if c, ok := containers[h]; ok {
+		releaseContainerDependents(c)
+		unregisterBridgeDB(c)
 		_ = c.Close()
 		delete(containers, h)
 		containersMu.Unlock()
-		return success(map[string]any{})
+		return nil
 	}
 	containersMu.Unlock()
-	return fail(errors.New("handle not found"))
+	return errors.New("handle not found")
 }
-
-func main() {}
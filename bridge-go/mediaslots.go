@@ -0,0 +1,139 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// Media uploads and downloads take a slot from their client's limiter and
+// one from the global limiter before they start, so a burst of media sends
+// queues up inside the bridge instead of opening dozens of TLS connections to
+// the media servers. Both limits are unlimited until set with
+// WmSetMediaConcurrency and can be changed while transfers are running.
+
+type mediaSlots struct {
+	mu      sync.Mutex
+	limit   int // 0 is unlimited
+	active  int
+	waiting int
+	// wake is closed and replaced whenever a slot frees up or the limit changes
+	wake chan struct{}
+}
+
+func newMediaSlots() *mediaSlots {
+	return &mediaSlots{wake: make(chan struct{})}
+}
+
+var globalMediaSlots = newMediaSlots()
+
+func (s *mediaSlots) broadcast() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+func (s *mediaSlots) acquire(ctx context.Context) error {
+	s.mu.Lock()
+	s.waiting++
+	defer func() {
+		s.waiting--
+		s.mu.Unlock()
+	}()
+	for s.limit > 0 && s.active >= s.limit {
+		wake := s.wake
+		s.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			s.mu.Lock()
+			return ctx.Err()
+		}
+		s.mu.Lock()
+	}
+	s.active++
+	return nil
+}
+
+func (s *mediaSlots) release() {
+	s.mu.Lock()
+	s.active--
+	s.broadcast()
+	s.mu.Unlock()
+}
+
+func (s *mediaSlots) setLimit(limit int) {
+	s.mu.Lock()
+	s.limit = limit
+	s.broadcast()
+	s.mu.Unlock()
+}
+
+func (s *mediaSlots) stats() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return map[string]any{"limit": s.limit, "active": s.active, "waiting": s.waiting}
+}
+
+func (cfg *clientConfig) mediaLimiter() *mediaSlots {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	if cfg.mediaSlots == nil {
+		cfg.mediaSlots = newMediaSlots()
+	}
+	return cfg.mediaSlots
+}
+
+// acquireMedia waits for a per-client and a global media slot.
+func acquireMedia(ctx context.Context, cli *wa.Client) (func(), error) {
+	own := configFor(cli).mediaLimiter()
+	if err := own.acquire(ctx); err != nil {
+		return nil, err
+	}
+	if err := globalMediaSlots.acquire(ctx); err != nil {
+		own.release()
+		return nil, err
+	}
+	return func() {
+		globalMediaSlots.release()
+		own.release()
+	}, nil
+}
+
+// isMediaMethod reports whether a WmClientCall method transfers media.
+func isMediaMethod(method string) bool {
+	return strings.HasPrefix(method, "Upload") || strings.HasPrefix(method, "Download")
+}
+
+//export WmSetMediaConcurrency
+func WmSetMediaConcurrency(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"` // 0 sets the global limit
+		Max    *int   `json:"max_concurrent"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	slots := globalMediaSlots
+	if payload.Client != 0 {
+		cli, end, err := beginClientCall(payload.Client, false)
+		if err != nil {
+			return fail(err)
+		}
+		defer end()
+		slots = configFor(cli).mediaLimiter()
+	}
+	if payload.Max != nil {
+		if *payload.Max < 0 {
+			return fail(errors.New("max_concurrent must not be negative"))
+		}
+		slots.setLimit(*payload.Max)
+	}
+	return success(slots.stats())
+}
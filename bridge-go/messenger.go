@@ -0,0 +1,153 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	wa "go.mau.fi/whatsmeow"
+	armadillo "go.mau.fi/whatsmeow/proto"
+	"go.mau.fi/whatsmeow/proto/waArmadilloApplication"
+	"go.mau.fi/whatsmeow/proto/waConsumerApplication"
+	"go.mau.fi/whatsmeow/proto/waMsgApplication"
+	"go.mau.fi/whatsmeow/types"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/google/uuid"
+)
+
+// Messenger and Instagram E2EE chats use the same protocol with a different
+// endpoint and message envelope. Logging in to Meta is out of scope: the device
+// must already carry the Facebook UUID and credentials from that login. Once a
+// client is in FB mode, messages arrive as fb_message events and are sent with
+// WmClientSendFBMessage, since SendFBMessage takes an interface argument that
+// WmClientCall can't build from JSON.
+
+//export WmClientSetMessengerConfig
+func WmClientSetMessengerConfig(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client       uint64 `json:"client"`
+		Enabled      bool   `json:"enabled"`
+		UserAgent    string `json:"user_agent"`
+		BaseURL      string `json:"base_url"`
+		WebsocketURL string `json:"websocket_url"`
+		FacebookUUID string `json:"facebook_uuid"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if cli.IsConnected() {
+		return fail(errors.New("messenger mode must be configured before connecting"))
+	}
+	if !payload.Enabled {
+		cli.MessengerConfig = nil
+		return success(map[string]any{"enabled": false})
+	}
+	if payload.UserAgent == "" || payload.BaseURL == "" {
+		return fail(errors.New("user_agent and base_url are required"))
+	}
+	if payload.FacebookUUID != "" {
+		id, err := uuid.Parse(payload.FacebookUUID)
+		if err != nil {
+			return fail(fmt.Errorf("invalid facebook_uuid: %w", err))
+		}
+		cli.Store.FacebookUUID = id
+		// unpaired devices are saved with it once pairing completes
+		if cli.Store.ID != nil {
+			ctx, cancel := clientContext(cli)
+			err = cli.Store.Save(ctx)
+			cancel()
+			if err != nil {
+				return fail(fmt.Errorf("failed to save facebook_uuid: %w", err))
+			}
+		}
+	}
+	if cli.Store.FacebookUUID == uuid.Nil {
+		return fail(errors.New("device has no facebook_uuid"))
+	}
+	cli.MessengerConfig = &wa.MessengerConfig{
+		UserAgent:    payload.UserAgent,
+		BaseURL:      payload.BaseURL,
+		WebsocketURL: payload.WebsocketURL,
+	}
+	return success(map[string]any{"enabled": true, "facebook_uuid": cli.Store.FacebookUUID.String()})
+}
+
+//export WmClientSendFBMessage
+func WmClientSendFBMessage(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		To     string `json:"to"`
+		// exactly one of the two application payloads, in protojson form
+		ConsumerApplication json.RawMessage     `json:"consumer_application"`
+		Armadillo           json.RawMessage     `json:"armadillo"`
+		Metadata            json.RawMessage     `json:"metadata"`
+		Extra               wa.SendRequestExtra `json:"extra"`
+		IdempotencyKey      string              `json:"idempotency_key"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if cli.MessengerConfig == nil {
+		return fail(errors.New("client is not in messenger mode"))
+	}
+	to, err := types.ParseJID(payload.To)
+	if err != nil {
+		return fail(err)
+	}
+	var message armadillo.MessageApplicationSub
+	switch {
+	case len(payload.ConsumerApplication) > 0 && len(payload.Armadillo) > 0:
+		return fail(errors.New("only one of consumer_application and armadillo can be set"))
+	case len(payload.ConsumerApplication) > 0:
+		msg := &waConsumerApplication.ConsumerApplication{}
+		if err = protojson.Unmarshal(payload.ConsumerApplication, msg); err != nil {
+			return fail(fmt.Errorf("invalid consumer_application: %w", err))
+		}
+		message = msg
+	case len(payload.Armadillo) > 0:
+		msg := &waArmadilloApplication.Armadillo{}
+		if err = protojson.Unmarshal(payload.Armadillo, msg); err != nil {
+			return fail(fmt.Errorf("invalid armadillo: %w", err))
+		}
+		message = msg
+	default:
+		return fail(errors.New("consumer_application or armadillo is required"))
+	}
+	var metadata *waMsgApplication.MessageApplication_Metadata
+	if len(payload.Metadata) > 0 {
+		metadata = &waMsgApplication.MessageApplication_Metadata{}
+		if err = protojson.Unmarshal(payload.Metadata, metadata); err != nil {
+			return fail(fmt.Errorf("invalid metadata: %w", err))
+		}
+	}
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	if err := throttleSend(ctx, cli, to); err != nil {
+		return fail(err)
+	}
+	resp, err := cli.SendFBMessage(ctx, to, message, metadata, sendExtra(cli, []wa.SendRequestExtra{payload.Extra}, payload.IdempotencyKey)...)
+	if err != nil {
+		return fail(err)
+	}
+	enc, err := encodeReturn(reflect.ValueOf(resp))
+	if err != nil {
+		return fail(err)
+	}
+	return success(enc)
+}
@@ -0,0 +1,114 @@
+package main
+
+import "C"
+import (
+	"reflect"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// WmClientListMethods describes every whatsmeow.Client method WmClientCall can
+// reach, with parameter and return types named the way they cross the JSON
+// boundary (see convertArg and encodeReturn). context.Context parameters are
+// injected by the bridge and left out; a trailing error return is reported as
+// errors: true and thrown on the Node side. Methods taking channels or
+// callbacks are listed with callable: false.
+
+type methodParam struct {
+	Type     string `json:"type"`
+	Variadic bool   `json:"variadic,omitempty"`
+}
+
+type methodInfo struct {
+	Name     string        `json:"name"`
+	Params   []methodParam `json:"params"`
+	Returns  []string      `json:"returns"`
+	Errors   bool          `json:"errors"`
+	Callable bool          `json:"callable"`
+}
+
+var typeOfTime = reflect.TypeOf(time.Time{})
+
+func jsonTypeName(t reflect.Type) string {
+	switch {
+	case t == typeOfDuration:
+		return "duration_ms"
+	case t == typeOfJID || (t.Kind() == reflect.Pointer && t.Elem() == typeOfJID):
+		return "jid"
+	case t == typeOfTime:
+		return "time"
+	case t.Kind() == reflect.Pointer && t.Implements(typeOfProtoMsg):
+		msg := reflect.New(t.Elem()).Interface().(proto.Message)
+		return "proto:" + string(msg.ProtoReflect().Descriptor().FullName())
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return "bytes"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return jsonTypeName(t.Elem()) + "[]"
+	case reflect.Map:
+		return "map<" + jsonTypeName(t.Key()) + ", " + jsonTypeName(t.Elem()) + ">"
+	case reflect.Pointer:
+		return jsonTypeName(t.Elem())
+	case reflect.Struct:
+		return "object:" + t.String()
+	case reflect.Interface:
+		return "any"
+	default:
+		return "unsupported"
+	}
+}
+
+func describeClientMethods() []methodInfo {
+	ct := reflect.TypeOf((*wa.Client)(nil))
+	methods := make([]methodInfo, 0, ct.NumMethod())
+	for i := range ct.NumMethod() {
+		m := ct.Method(i)
+		mt := m.Type
+		info := methodInfo{Name: m.Name, Params: []methodParam{}, Returns: []string{}, Callable: true}
+		// In(0) is the receiver
+		for j := 1; j < mt.NumIn(); j++ {
+			pt := mt.In(j)
+			if pt.Kind() == reflect.Interface && pt.Implements(typeOfContext) {
+				continue
+			}
+			param := methodParam{}
+			if mt.IsVariadic() && j == mt.NumIn()-1 {
+				param.Variadic = true
+				pt = pt.Elem()
+			}
+			param.Type = jsonTypeName(pt)
+			if param.Type == "unsupported" {
+				info.Callable = false
+			}
+			info.Params = append(info.Params, param)
+		}
+		for j := range mt.NumOut() {
+			rt := mt.Out(j)
+			if j == mt.NumOut()-1 && rt == reflect.TypeOf((*error)(nil)).Elem() {
+				info.Errors = true
+				continue
+			}
+			info.Returns = append(info.Returns, jsonTypeName(rt))
+		}
+		methods = append(methods, info)
+	}
+	return methods
+}
+
+//export WmClientListMethods
+func WmClientListMethods(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	return success(map[string]any{"methods": describeClientMethods()})
+}
@@ -0,0 +1,417 @@
+package main
+
+import "C"
+import (
+	"bytes"
+	"context"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Message secrets are what reactions, poll votes and edits of a message are
+// encrypted with. whatsmeow stores them as messages arrive; apps that keep their
+// own message history can read them out and put them back (or derive them from
+// a stored message) so those updates still decrypt after the store was reset.
+//
+// whatsmeow only looks at the top level of incoming messages, so the bridge
+// also stores secrets found inside wrappers (bot invocations and the like),
+// and adds one to messages sent to groups and bots through WmClientCall when
+// it's missing, storing it once the send succeeds: reactions in community
+// announcement groups and bot replies are encrypted with the secret of the
+// message they refer to, and fail without it. Encrypted reactions are
+// decrypted into message events and reaction tallies, and sent with
+// WmClientSendReaction. WmClientDeriveMessageKey exposes the per-use-case keys
+// for apps doing the crypto themselves.
+
+type messageSecretItem struct {
+	Chat   string `json:"chat"`
+	Sender string `json:"sender"`
+	ID     string `json:"id"`
+	Secret []byte `json:"secret"`
+	// alternatively, the original message in protojson form
+	Message json.RawMessage `json:"message"`
+}
+
+// getMessageSecret returns the stored secret of a message, or nil.
+func getMessageSecret(ctx context.Context, cli *wa.Client, chat, sender types.JID, id types.MessageID) ([]byte, error) {
+	// GetMessageSecret gained extra return values across whatsmeow versions
+	// (the real sender JID), so only the first and last ones are relied on.
+	out := reflect.ValueOf(cli.Store.MsgSecrets).MethodByName("GetMessageSecret").Call([]reflect.Value{
+		reflect.ValueOf(ctx), reflect.ValueOf(chat), reflect.ValueOf(sender), reflect.ValueOf(id),
+	})
+	if errv, _ := out[len(out)-1].Interface().(error); errv != nil {
+		return nil, errv
+	}
+	secret, _ := out[0].Interface().([]byte)
+	return secret, nil
+}
+
+// messageSecretOf returns the secret of msg, looking inside the wrappers
+// whatsmeow doesn't unwrap.
+func messageSecretOf(msg *waE2E.Message) []byte {
+	for msg != nil {
+		if secret := msg.GetMessageContextInfo().GetMessageSecret(); len(secret) > 0 {
+			return secret
+		}
+		switch {
+		case msg.GetBotInvokeMessage() != nil:
+			msg = msg.GetBotInvokeMessage().GetMessage()
+		case msg.GetViewOnceMessage() != nil:
+			msg = msg.GetViewOnceMessage().GetMessage()
+		case msg.GetViewOnceMessageV2() != nil:
+			msg = msg.GetViewOnceMessageV2().GetMessage()
+		case msg.GetEphemeralMessage() != nil:
+			msg = msg.GetEphemeralMessage().GetMessage()
+		case msg.GetDocumentWithCaptionMessage() != nil:
+			msg = msg.GetDocumentWithCaptionMessage().GetMessage()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// storeMessageSecret stores the secret of an incoming message when whatsmeow
+// didn't, i.e. when it isn't at the top level of the raw message.
+func storeMessageSecret(cli *wa.Client, evt *events.Message) {
+	secret := messageSecretOf(evt.Message)
+	if secret == nil || bytes.Equal(secret, evt.RawMessage.GetMessageContextInfo().GetMessageSecret()) {
+		return
+	}
+	err := cli.Store.MsgSecrets.PutMessageSecret(context.Background(), evt.Info.Chat, evt.Info.Sender.ToNonAD(), evt.Info.ID, secret)
+	if err != nil {
+		cli.Log.Warnf("Failed to store message secret of %s: %v", evt.Info.ID, err)
+	}
+}
+
+// needsMessageSecret reports whether updates to msg sent to chat will be
+// encrypted with its secret: anything in groups and bot chats except updates.
+func needsMessageSecret(chat types.JID, msg *waE2E.Message) bool {
+	if chat.Server != types.GroupServer && !chat.IsBot() {
+		return false
+	}
+	return msg.GetReactionMessage() == nil && msg.GetEncReactionMessage() == nil &&
+		msg.GetProtocolMessage() == nil && msg.GetPollUpdateMessage() == nil &&
+		msg.GetKeepInChatMessage() == nil && msg.GetPinInChatMessage() == nil
+}
+
+// ensureSentMessageSecret adds a secret to the message of a reflected
+// SendMessage call if it needs one, and returns the secret to store after
+// the send.
+func ensureSentMessageSecret(args []reflect.Value) (types.JID, []byte) {
+	var to types.JID
+	var msg *waE2E.Message
+	for _, arg := range args {
+		switch v := arg.Interface().(type) {
+		case types.JID:
+			to = v
+		case *waE2E.Message:
+			msg = v
+		}
+	}
+	if msg == nil || !needsMessageSecret(to, msg) {
+		return to, nil
+	}
+	if secret := messageSecretOf(msg); secret != nil {
+		return to, secret
+	}
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	if msg.MessageContextInfo == nil {
+		msg.MessageContextInfo = &waE2E.MessageContextInfo{}
+	}
+	msg.MessageContextInfo.MessageSecret = secret
+	return to, secret
+}
+
+func storeSentMessageSecret(cli *wa.Client, to types.JID, secret []byte, ret reflect.Value) {
+	resp, ok := ret.Interface().(wa.SendResponse)
+	if !ok || secret == nil {
+		return
+	}
+	err := cli.Store.MsgSecrets.PutMessageSecret(context.Background(), to.ToNonAD(), cli.Store.GetJID().ToNonAD(), resp.ID, secret)
+	if err != nil {
+		cli.Log.Warnf("Failed to store message secret of sent message %s: %v", resp.ID, err)
+	}
+}
+
+// decryptedReaction returns the reaction in evt, decrypting encrypted ones.
+func decryptedReaction(cli *wa.Client, evt *events.Message) (*waE2E.ReactionMessage, error) {
+	if reaction := evt.Message.GetReactionMessage(); reaction != nil {
+		return reaction, nil
+	}
+	enc := evt.Message.GetEncReactionMessage()
+	if enc == nil {
+		return nil, nil
+	}
+	reaction, err := cli.DecryptReaction(context.Background(), evt)
+	if err == nil && reaction.Key == nil {
+		reaction.Key = enc.GetTargetMessageKey()
+	}
+	return reaction, err
+}
+
+// linkEncReaction returns the fields to attach to the message event of an
+// encrypted reaction, or nil for other messages.
+func linkEncReaction(cli *wa.Client, evt *events.Message) map[string]any {
+	enc := evt.Message.GetEncReactionMessage()
+	if enc == nil {
+		return nil
+	}
+	out := map[string]any{"target_id": enc.GetTargetMessageKey().GetID()}
+	reaction, err := decryptedReaction(cli, evt)
+	if err != nil {
+		cli.Log.Warnf("Failed to decrypt reaction %s: %v", evt.Info.ID, err)
+		out["error"] = err.Error()
+	} else {
+		out["text"] = reaction.GetText()
+	}
+	return map[string]any{"enc_reaction": out}
+}
+
+// message secret use cases, as mixed into the derived keys
+var messageSecretUseCases = map[string]string{
+	"poll_vote":      "Poll Vote",
+	"reaction":       "Enc Reaction",
+	"comment":        "Enc Comment",
+	"report_token":   "Report Token",
+	"event_response": "Event Response",
+	"event_edit":     "Event Edit",
+	"bot_message":    "Bot Message",
+}
+
+//export WmClientDeriveMessageKey
+func WmClientDeriveMessageKey(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client  uint64 `json:"client"`
+		UseCase string `json:"use_case"`
+		// the original message; its secret is looked up unless given
+		Chat   string `json:"chat"`
+		Sender string `json:"sender"`
+		ID     string `json:"id"`
+		Secret []byte `json:"secret"`
+		// who sends the update, ourselves if empty
+		ModificationSender string `json:"modification_sender"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	useCase, ok := messageSecretUseCases[payload.UseCase]
+	if !ok {
+		return fail(fmt.Errorf("unknown use_case %q", payload.UseCase))
+	}
+	ctx := context.Background()
+	secret := payload.Secret
+	if len(secret) == 0 {
+		chat, err := types.ParseJID(payload.Chat)
+		if err != nil {
+			return fail(err)
+		}
+		sender, err := types.ParseJID(payload.Sender)
+		if err != nil {
+			return fail(err)
+		}
+		if secret, err = getMessageSecret(ctx, cli, chat, sender, types.MessageID(payload.ID)); err != nil {
+			return fail(err)
+		} else if secret == nil {
+			return fail(errors.New("no secret stored for the message"))
+		}
+	}
+	if payload.UseCase == "bot_message" {
+		key, err := hkdf.Key(sha256.New, secret, nil, useCase, 32)
+		if err != nil {
+			return fail(err)
+		}
+		return success(map[string]any{"key": key})
+	}
+	origSender, err := types.ParseJID(payload.Sender)
+	if err != nil || payload.ID == "" {
+		return fail(errors.New("id and sender of the original message are required"))
+	}
+	modSender := cli.Store.GetJID()
+	if payload.ModificationSender != "" {
+		if modSender, err = types.ParseJID(payload.ModificationSender); err != nil {
+			return fail(err)
+		}
+	}
+	origSenderStr := origSender.ToNonAD().String()
+	modSenderStr := modSender.ToNonAD().String()
+	key, err := hkdf.Key(sha256.New, secret, nil, payload.ID+origSenderStr+modSenderStr+useCase, 32)
+	if err != nil {
+		return fail(err)
+	}
+	return success(map[string]any{
+		"key":             key,
+		"additional_data": []byte(payload.ID + "\x00" + modSenderStr),
+	})
+}
+
+//export WmClientSendReaction
+func WmClientSendReaction(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		Chat   string `json:"chat"`
+		// the message reacted to
+		Sender string `json:"sender"`
+		ID     string `json:"id"`
+		FromMe bool   `json:"from_me"`
+		// empty to remove our reaction
+		Emoji string `json:"emoji"`
+		// encrypt with the message secret; by default only in community
+		// announcement groups, which require it
+		Encrypted      *bool  `json:"encrypted"`
+		IdempotencyKey string `json:"idempotency_key"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	chat, err := types.ParseJID(payload.Chat)
+	if err != nil {
+		return fail(err)
+	}
+	target := &types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: chat, IsFromMe: payload.FromMe, IsGroup: chat.Server == types.GroupServer},
+		ID:            types.MessageID(payload.ID),
+	}
+	if payload.FromMe {
+		target.Sender = cli.Store.GetJID().ToNonAD()
+	} else if target.Sender, err = types.ParseJID(payload.Sender); err != nil || payload.Sender == "" {
+		return fail(errors.New("sender is required for messages not from us"))
+	}
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	encrypted := false
+	if payload.Encrypted != nil {
+		encrypted = *payload.Encrypted
+	} else if chat.Server == types.GroupServer {
+		info, err := cli.GetGroupInfo(ctx, chat)
+		if err != nil {
+			return fail(fmt.Errorf("failed to check if the group is an announcement group: %w", err))
+		}
+		encrypted = info.IsDefaultSubGroup && info.IsAnnounce
+	}
+	msg := cli.BuildReaction(chat, target.Sender, target.ID, payload.Emoji)
+	if encrypted {
+		enc, err := cli.EncryptReaction(ctx, target, msg.GetReactionMessage())
+		if err != nil {
+			return fail(err)
+		}
+		msg = &waE2E.Message{EncReactionMessage: enc}
+	}
+	if err := throttleSend(ctx, cli, chat); err != nil {
+		return fail(err)
+	}
+	resp, err := cli.SendMessage(ctx, chat, msg, sendExtra(cli, nil, payload.IdempotencyKey)...)
+	if err != nil {
+		return fail(err)
+	}
+	enc, err := encodeReturn(reflect.ValueOf(resp))
+	if err != nil {
+		return fail(err)
+	}
+	return success(enc)
+}
+
+//export WmClientGetMessageSecret
+func WmClientGetMessageSecret(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		Chat   string `json:"chat"`
+		Sender string `json:"sender"`
+		ID     string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	chat, err := types.ParseJID(payload.Chat)
+	if err != nil {
+		return fail(err)
+	}
+	sender, err := types.ParseJID(payload.Sender)
+	if err != nil {
+		return fail(err)
+	}
+	secret, err := getMessageSecret(context.Background(), cli, chat, sender, types.MessageID(payload.ID))
+	if err != nil {
+		return fail(err)
+	}
+	if secret == nil {
+		return success(map[string]any{"found": false})
+	}
+	return success(map[string]any{"found": true, "secret": secret})
+}
+
+//export WmClientPutMessageSecrets
+func WmClientPutMessageSecrets(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client  uint64              `json:"client"`
+		Secrets []messageSecretItem `json:"secrets"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	ctx := context.Background()
+	stored := 0
+	for i, item := range payload.Secrets {
+		chat, err := types.ParseJID(item.Chat)
+		if err != nil {
+			return fail(fmt.Errorf("secret %d: %w", i, err))
+		}
+		sender, err := types.ParseJID(item.Sender)
+		if err != nil {
+			return fail(fmt.Errorf("secret %d: %w", i, err))
+		}
+		secret := item.Secret
+		if len(secret) == 0 && len(item.Message) > 0 {
+			var msg waE2E.Message
+			if err = protojson.Unmarshal(item.Message, &msg); err != nil {
+				return fail(fmt.Errorf("secret %d: invalid message: %w", i, err))
+			}
+			secret = msg.GetMessageContextInfo().GetMessageSecret()
+		}
+		if len(secret) == 0 {
+			return fail(fmt.Errorf("secret %d: no secret given and none in the message", i))
+		}
+		if err = cli.Store.MsgSecrets.PutMessageSecret(ctx, chat, sender, types.MessageID(item.ID), secret); err != nil {
+			return fail(fmt.Errorf("secret %d: %w", i, err))
+		}
+		stored++
+	}
+	return success(map[string]any{"stored": stored})
+}
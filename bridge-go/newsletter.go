@@ -0,0 +1,358 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+const newsletterLinkPrefix = "https://whatsapp.com/channel/"
+
+func serializePictureInfo(pic *types.ProfilePictureInfo) map[string]any {
+	if pic == nil || (pic.URL == "" && pic.ID == "" && pic.DirectPath == "") {
+		return nil
+	}
+	return map[string]any{"url": pic.URL, "id": pic.ID, "type": pic.Type, "direct_path": pic.DirectPath}
+}
+
+// serializeNewsletterMetadata flattens types.NewsletterMetadata into a stable shape
+// instead of exposing whatsmeow's GraphQL-derived JSON tags directly.
+func serializeNewsletterMetadata(meta *types.NewsletterMetadata) map[string]any {
+	if meta == nil {
+		return nil
+	}
+	tm := meta.ThreadMeta
+	out := map[string]any{
+		"jid":              meta.ID.String(),
+		"state":            string(meta.State.Type),
+		"name":             tm.Name.Text,
+		"description":      tm.Description.Text,
+		"invite_code":      tm.InviteCode,
+		"invite_link":      "",
+		"creation_time":    tm.CreationTime.Time.Format(time.RFC3339),
+		"subscriber_count": tm.SubscriberCount,
+		"verification":     string(tm.VerificationState),
+		"picture":          serializePictureInfo(tm.Picture),
+		"preview":          serializePictureInfo(&tm.Preview),
+		"reaction_codes":   string(tm.Settings.ReactionCodes.Value),
+		"viewer":           nil,
+	}
+	if tm.InviteCode != "" {
+		out["invite_link"] = newsletterLinkPrefix + tm.InviteCode
+	}
+	if meta.ViewerMeta != nil {
+		out["viewer"] = map[string]any{"role": string(meta.ViewerMeta.Role), "mute": string(meta.ViewerMeta.Mute)}
+	}
+	return out
+}
+
+// parseNewsletterInviteKey extracts the invite key from a channel link such as
+// https://whatsapp.com/channel/<key>. A bare key is returned unchanged.
+func parseNewsletterInviteKey(link string) (string, error) {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return "", errors.New("invite link is required")
+	}
+	if !strings.Contains(link, "/") {
+		return link, nil
+	}
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("invalid invite link: %w", err)
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if host != "whatsapp.com" || len(parts) < 2 || parts[0] != "channel" || parts[1] == "" {
+		return "", fmt.Errorf("not a channel invite link: %s", link)
+	}
+	return parts[1], nil
+}
+
+//export WmClientCreateNewsletter
+func WmClientCreateNewsletter(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client      uint64 `json:"client"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		PictureB64  string `json:"picture"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if payload.Name == "" {
+		return fail(errors.New("name is required"))
+	}
+	params := wa.CreateNewsletterParams{Name: payload.Name, Description: payload.Description}
+	if payload.PictureB64 != "" {
+		pic, err := base64.StdEncoding.DecodeString(payload.PictureB64)
+		if err != nil {
+			return fail(fmt.Errorf("invalid base64: %w", err))
+		}
+		params.Picture = pic
+	}
+	meta, err := cli.CreateNewsletter(params)
+	if err != nil {
+		return fail(err)
+	}
+	return success(serializeNewsletterMetadata(meta))
+}
+
+//export WmClientGetNewsletterInfo
+func WmClientGetNewsletterInfo(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		JID    string `json:"jid"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	jid, err := types.ParseJID(payload.JID)
+	if err != nil {
+		return fail(err)
+	}
+	meta, err := cli.GetNewsletterInfo(jid)
+	if err != nil {
+		return fail(err)
+	}
+	return success(serializeNewsletterMetadata(meta))
+}
+
+//export WmClientGetNewsletterInfoWithInvite
+func WmClientGetNewsletterInfoWithInvite(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		Key    string `json:"key"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	key, err := parseNewsletterInviteKey(payload.Key)
+	if err != nil {
+		return fail(err)
+	}
+	meta, err := cli.GetNewsletterInfoWithInvite(key)
+	if err != nil {
+		return fail(err)
+	}
+	return success(serializeNewsletterMetadata(meta))
+}
+
+//export WmClientResolveNewsletterLink
+func WmClientResolveNewsletterLink(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		Link   string `json:"link"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	key, err := parseNewsletterInviteKey(payload.Link)
+	if err != nil {
+		return fail(err)
+	}
+	// Only queries the metadata, the newsletter is not followed.
+	meta, err := cli.GetNewsletterInfoWithInvite(key)
+	if err != nil {
+		return fail(err)
+	}
+	return success(map[string]any{"key": key, "jid": meta.ID.String(), "newsletter": serializeNewsletterMetadata(meta)})
+}
+
+// newsletterLiveSub keeps a live-updates lease for one newsletter alive by
+// re-subscribing shortly before the server-provided duration runs out.
+type newsletterLiveSub struct {
+	cancel    context.CancelFunc
+	kick      chan struct{}
+	expiresAt atomic.Int64
+}
+
+var (
+	newsletterSubsMu sync.Mutex
+	newsletterSubs   = map[*wa.Client]map[types.JID]*newsletterLiveSub{}
+)
+
+const newsletterLiveRetryDelay = 30 * time.Second
+
+func (sub *newsletterLiveSub) run(ctx context.Context, cli *wa.Client, jid types.JID) {
+	for {
+		callCtx, cancel := withClientDeadline(ctx, cli)
+		dur, err := cli.NewsletterSubscribeLiveUpdates(callCtx, jid)
+		cancel()
+		wait := newsletterLiveRetryDelay
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if !errors.Is(err, wa.ErrNotConnected) {
+				emitBridgeEvent(cli, map[string]any{"type": "newsletter_live_updates_error", "jid": jid.String(), "error": err.Error()})
+			}
+		} else {
+			sub.expiresAt.Store(time.Now().Add(dur).UnixMilli())
+			// renew at 80% of the lease so a slow round trip doesn't leave a gap
+			wait = max(dur*4/5, 5*time.Second)
+		}
+		select {
+		case <-time.After(wait):
+		case <-sub.kick:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// renewNewsletterLiveUpdates re-subscribes every active lease of cli immediately,
+// used after reconnects since the server drops live-update subscriptions with the socket.
+func renewNewsletterLiveUpdates(cli *wa.Client) {
+	newsletterSubsMu.Lock()
+	subs := make([]*newsletterLiveSub, 0, len(newsletterSubs[cli]))
+	for _, sub := range newsletterSubs[cli] {
+		subs = append(subs, sub)
+	}
+	newsletterSubsMu.Unlock()
+	for _, sub := range subs {
+		select {
+		case sub.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func stopNewsletterLiveUpdates(cli *wa.Client) {
+	newsletterSubsMu.Lock()
+	defer newsletterSubsMu.Unlock()
+	for _, sub := range newsletterSubs[cli] {
+		sub.cancel()
+	}
+	delete(newsletterSubs, cli)
+}
+
+//export WmClientNewsletterLiveUpdates
+func WmClientNewsletterLiveUpdates(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client  uint64 `json:"client"`
+		JID     string `json:"jid"`
+		Enabled bool   `json:"enabled"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	jid, err := types.ParseJID(payload.JID)
+	if err != nil {
+		return fail(err)
+	}
+	newsletterSubsMu.Lock()
+	existing := newsletterSubs[cli][jid]
+	if !payload.Enabled {
+		if existing != nil {
+			existing.cancel()
+			delete(newsletterSubs[cli], jid)
+		}
+		newsletterSubsMu.Unlock()
+		return success(map[string]any{"subscribed": false})
+	}
+	newsletterSubsMu.Unlock()
+	if existing != nil {
+		return success(map[string]any{"subscribed": true, "expires_at": existing.expiresAt.Load()})
+	}
+	// Subscribe synchronously once so errors (e.g. unknown newsletter) reach the caller.
+	// The lock isn't held across the round trip, so a concurrent call may win the race.
+	subCtx, subCancel := clientContext(cli)
+	dur, err := cli.NewsletterSubscribeLiveUpdates(subCtx, jid)
+	subCancel()
+	if err != nil {
+		return fail(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := &newsletterLiveSub{cancel: cancel, kick: make(chan struct{}, 1)}
+	sub.expiresAt.Store(time.Now().Add(dur).UnixMilli())
+	newsletterSubsMu.Lock()
+	subs := newsletterSubs[cli]
+	if existing = subs[jid]; existing != nil {
+		newsletterSubsMu.Unlock()
+		cancel()
+		return success(map[string]any{"subscribed": true, "expires_at": existing.expiresAt.Load()})
+	}
+	if subs == nil {
+		subs = map[types.JID]*newsletterLiveSub{}
+		newsletterSubs[cli] = subs
+	}
+	subs[jid] = sub
+	newsletterSubsMu.Unlock()
+	go func() {
+		select {
+		case <-time.After(max(dur*4/5, 5*time.Second)):
+		case <-sub.kick:
+		case <-ctx.Done():
+			return
+		}
+		sub.run(ctx, cli, jid)
+	}()
+	return success(map[string]any{"subscribed": true, "expires_at": sub.expiresAt.Load()})
+}
+
+//export WmClientNewsletterLiveSubscriptions
+func WmClientNewsletterLiveSubscriptions(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	newsletterSubsMu.Lock()
+	out := make([]map[string]any, 0, len(newsletterSubs[cli]))
+	for jid, sub := range newsletterSubs[cli] {
+		out = append(out, map[string]any{"jid": jid.String(), "expires_at": sub.expiresAt.Load()})
+	}
+	newsletterSubsMu.Unlock()
+	return success(map[string]any{"subscriptions": out})
+}
@@ -0,0 +1,84 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Calls block the thread that made them, so an operation ID has to exist before
+// the call starts: WmOpNew allocates one, the caller passes it as op_id to
+// WmClientCall (or WmDeviceCall, WmContainerCall, WmClientUpload,
+// WmClientDownloadByPath), and WmCancel from another thread cancels the context
+// the call runs with. An ID is used up by the call that runs with it; cancelling
+// before the call starts makes it fail immediately. IDs that end up unused can
+// be dropped with WmRelease.
+
+type operation struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	inUse  bool
+}
+
+var (
+	opsMu sync.Mutex
+	ops   = map[uint64]*operation{}
+)
+
+// beginOp returns the context for a call with the given op_id, 0 meaning none,
+// and a func to call once the call is over.
+func beginOp(id uint64) (context.Context, func(), error) {
+	if id == 0 {
+		return context.Background(), func() {}, nil
+	}
+	opsMu.Lock()
+	defer opsMu.Unlock()
+	op := ops[id]
+	if op == nil {
+		return nil, nil, fmt.Errorf("operation %d not found", id)
+	}
+	if op.inUse {
+		return nil, nil, fmt.Errorf("operation %d is already running", id)
+	}
+	op.inUse = true
+	return op.ctx, func() {
+		opsMu.Lock()
+		delete(ops, id)
+		opsMu.Unlock()
+		op.cancel()
+	}, nil
+}
+
+//export WmOpNew
+func WmOpNew(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	ctx, cancel := context.WithCancel(context.Background())
+	id := uint64(newHandle())
+	opsMu.Lock()
+	ops[id] = &operation{ctx: ctx, cancel: cancel}
+	opsMu.Unlock()
+	return success(map[string]any{"op_id": id})
+}
+
+//export WmCancel
+func WmCancel(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		OpID uint64 `json:"op_id"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	opsMu.Lock()
+	op := ops[payload.OpID]
+	running := op != nil && op.inUse
+	opsMu.Unlock()
+	if op == nil {
+		return fail(errors.New("operation not found"))
+	}
+	op.cancel()
+	return success(map[string]any{"running": running})
+}
@@ -0,0 +1,303 @@
+package main
+
+import "C"
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// An order message only carries the totals; the cart itself is fetched with
+// the fb:thrift_iq order query using the order's token. Message events of
+// orders get an "order" object, and the cart follows as an "order_details"
+// event once the query (run on the task pool) returns. Sellers answer with
+// WmClientSendInvoice, or WmClientSendPaymentRequest where WhatsApp payments
+// are available.
+
+func serializeOrderMessage(order *waE2E.OrderMessage) map[string]any {
+	out := map[string]any{
+		"order_id":          order.GetOrderID(),
+		"title":             order.GetOrderTitle(),
+		"item_count":        order.GetItemCount(),
+		"status":            strings.ToLower(order.GetStatus().String()),
+		"seller":            order.GetSellerJID(),
+		"message":           order.GetMessage(),
+		"token":             order.GetToken(),
+		"total_amount_1000": order.GetTotalAmount1000(),
+		"currency":          order.GetTotalCurrencyCode(),
+	}
+	if order.GetCatalogType() != "" {
+		out["catalog_type"] = order.GetCatalogType()
+	}
+	return out
+}
+
+// linkOrder returns the fields to attach to the message event of an order and
+// starts fetching its cart, or returns nil if evt isn't an order.
+func linkOrder(cli *wa.Client, evt *events.Message) map[string]any {
+	order := evt.Message.GetOrderMessage()
+	if order == nil {
+		return nil
+	}
+	if order.GetOrderID() != "" && order.GetToken() != "" {
+		submitTask(cli, func() {
+			ev := map[string]any{
+				"type":       "order_details",
+				"chat":       evt.Info.Chat.String(),
+				"message_id": string(evt.Info.ID),
+				"order_id":   order.GetOrderID(),
+			}
+			details, err := fetchOrderDetails(cli, order.GetOrderID(), order.GetToken(), 30*time.Second, 0)
+			if err != nil {
+				cli.Log.Warnf("Failed to fetch details of order %s: %v", order.GetOrderID(), err)
+				ev["error"] = err.Error()
+			} else {
+				ev["products"] = details["products"]
+				ev["total_amount_1000"] = details["total_amount_1000"]
+				ev["currency"] = details["currency"]
+			}
+			emitBridgeEvent(cli, ev)
+		})
+	}
+	return map[string]any{"order": serializeOrderMessage(order)}
+}
+
+func fetchOrderDetails(cli *wa.Client, orderID, token string, timeout time.Duration, opID uint64) (map[string]any, error) {
+	if !cli.IsConnected() {
+		return nil, wa.ErrNotConnected
+	}
+	text := func(tag string, v string) waBinary.Node {
+		return waBinary.Node{Tag: tag, Content: []byte(v)}
+	}
+	node := waBinary.Node{
+		Tag: "iq",
+		Attrs: waBinary.Attrs{
+			"id":      cli.DangerousInternals().GenerateRequestID(),
+			"to":      types.ServerJID,
+			"type":    "get",
+			"xmlns":   "fb:thrift_iq",
+			"smax_id": "5",
+		},
+		Content: []waBinary.Node{{
+			Tag:   "order",
+			Attrs: waBinary.Attrs{"op": "get", "id": orderID},
+			Content: []waBinary.Node{
+				{Tag: "image_dimensions", Content: []waBinary.Node{text("width", "100"), text("height", "100")}},
+				text("token", token),
+			},
+		}},
+	}
+	resp, err := sendNodeAndWait(cli, node, timeout, opID)
+	if err != nil {
+		return nil, err
+	}
+	if err = iqError(resp); err != nil {
+		return nil, err
+	}
+	orderNode, ok := resp.GetOptionalChildByTag("order")
+	if !ok {
+		return nil, errors.New("response has no order")
+	}
+	products := []map[string]any{}
+	for _, p := range orderNode.GetChildrenByTag("product") {
+		product := map[string]any{
+			"id":       childText(p, "id"),
+			"name":     childText(p, "name"),
+			"currency": childText(p, "currency"),
+		}
+		if img, ok := p.GetOptionalChildByTag("image"); ok {
+			product["image_url"] = childText(img, "url")
+		}
+		if price, err := strconv.ParseInt(childText(p, "price"), 10, 64); err == nil {
+			product["price_amount_1000"] = price
+		}
+		if quantity, err := strconv.Atoi(childText(p, "quantity")); err == nil {
+			product["quantity"] = quantity
+		}
+		products = append(products, product)
+	}
+	out := map[string]any{"order_id": orderID, "products": products}
+	if price, ok := orderNode.GetOptionalChildByTag("price"); ok {
+		if total, err := strconv.ParseInt(childText(price, "total"), 10, 64); err == nil {
+			out["total_amount_1000"] = total
+		}
+		out["currency"] = childText(price, "currency")
+	}
+	return out, nil
+}
+
+//export WmClientGetOrderDetails
+func WmClientGetOrderDetails(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client    uint64 `json:"client"`
+		OrderID   string `json:"order_id"`
+		Token     string `json:"token"`
+		TimeoutMs int64  `json:"timeout_ms"`
+		OpID      uint64 `json:"op_id"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	if payload.OrderID == "" || payload.Token == "" {
+		return fail(errors.New("order_id and token are required"))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	details, err := fetchOrderDetails(cli, payload.OrderID, payload.Token, rawTimeout(payload.TimeoutMs), payload.OpID)
+	if err != nil {
+		return fail(err)
+	}
+	return success(details)
+}
+
+func sendOrderReply(cli *wa.Client, to string, msg *waE2E.Message, idempotencyKey string) *C.char {
+	jid, err := types.ParseJID(to)
+	if err != nil {
+		return fail(err)
+	}
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	if err := throttleSend(ctx, cli, jid); err != nil {
+		return fail(err)
+	}
+	resp, err := cli.SendMessage(ctx, jid, msg, sendExtra(cli, nil, idempotencyKey)...)
+	if err != nil {
+		return fail(err)
+	}
+	enc, err := encodeReturn(reflect.ValueOf(resp))
+	if err != nil {
+		return fail(err)
+	}
+	return success(enc)
+}
+
+//export WmClientSendInvoice
+func WmClientSendInvoice(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		To     string `json:"to"`
+		Note   string `json:"note"`
+		// token of the order the invoice is for
+		Token      string `json:"token"`
+		Attachment *struct {
+			Type     string `json:"type"` // image or pdf
+			Mimetype string `json:"mimetype"`
+			// fields of a WmClientUpload result
+			DirectPath    string `json:"direct_path"`
+			MediaKey      []byte `json:"media_key"`
+			FileSHA256    []byte `json:"file_sha256"`
+			FileEncSHA256 []byte `json:"file_enc_sha256"`
+			ThumbnailB64  string `json:"thumbnail_b64"`
+		} `json:"attachment"`
+		IdempotencyKey string `json:"idempotency_key"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if payload.Token == "" {
+		return fail(errors.New("token is required"))
+	}
+	invoice := &waE2E.InvoiceMessage{Note: proto.String(payload.Note), Token: proto.String(payload.Token)}
+	if a := payload.Attachment; a != nil {
+		switch a.Type {
+		case "image":
+			invoice.AttachmentType = waE2E.InvoiceMessage_IMAGE.Enum()
+		case "pdf":
+			invoice.AttachmentType = waE2E.InvoiceMessage_PDF.Enum()
+		default:
+			return fail(errors.New(`attachment.type must be "image" or "pdf"`))
+		}
+		if a.DirectPath == "" || len(a.MediaKey) == 0 {
+			return fail(errors.New("attachment needs the direct_path and media_key of an upload"))
+		}
+		invoice.AttachmentMimetype = proto.String(a.Mimetype)
+		invoice.AttachmentDirectPath = proto.String(a.DirectPath)
+		invoice.AttachmentMediaKey = a.MediaKey
+		invoice.AttachmentMediaKeyTimestamp = proto.Int64(time.Now().Unix())
+		invoice.AttachmentFileSHA256 = a.FileSHA256
+		invoice.AttachmentFileEncSHA256 = a.FileEncSHA256
+		if a.ThumbnailB64 != "" {
+			thumb, err := base64.StdEncoding.DecodeString(a.ThumbnailB64)
+			if err != nil {
+				return fail(fmt.Errorf("invalid thumbnail_b64: %w", err))
+			}
+			invoice.AttachmentJPEGThumbnail = thumb
+		}
+	}
+	return sendOrderReply(cli, payload.To, &waE2E.Message{InvoiceMessage: invoice}, payload.IdempotencyKey)
+}
+
+//export WmClientSendPaymentRequest
+func WmClientSendPaymentRequest(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client     uint64 `json:"client"`
+		To         string `json:"to"`
+		Currency   string `json:"currency"` // ISO 4217
+		Amount1000 uint64 `json:"amount_1000"`
+		// who is asked to pay, the recipient if empty
+		RequestFrom string `json:"request_from"`
+		Note        string `json:"note"`
+		// unix seconds
+		Expiry         int64  `json:"expiry"`
+		IdempotencyKey string `json:"idempotency_key"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if payload.Currency == "" || payload.Amount1000 == 0 {
+		return fail(errors.New("currency and amount_1000 are required"))
+	}
+	if payload.RequestFrom == "" {
+		payload.RequestFrom = payload.To
+	}
+	from, err := types.ParseJID(payload.RequestFrom)
+	if err != nil {
+		return fail(err)
+	}
+	req := &waE2E.RequestPaymentMessage{
+		CurrencyCodeIso4217: proto.String(payload.Currency),
+		Amount1000:          proto.Uint64(payload.Amount1000),
+		RequestFrom:         proto.String(from.ToNonAD().String()),
+		Amount: &waE2E.Money{
+			Value:        proto.Int64(int64(payload.Amount1000)),
+			Offset:       proto.Uint32(1000),
+			CurrencyCode: proto.String(payload.Currency),
+		},
+	}
+	if payload.Note != "" {
+		req.NoteMessage = &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{Text: proto.String(payload.Note)}}
+	}
+	if payload.Expiry > 0 {
+		req.ExpiryTimestamp = proto.Int64(payload.Expiry)
+	}
+	return sendOrderReply(cli, payload.To, &waE2E.Message{RequestPaymentMessage: req}, payload.IdempotencyKey)
+}
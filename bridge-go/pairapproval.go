@@ -0,0 +1,98 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Anyone who can see a QR code can link their phone to it, which is a problem
+// for QR endpoints shared with customers. With a pair approval policy, whatsmeow's
+// PrePairCallback reports every pairing about to complete as a pair_request
+// event with the phone's JID, platform and business name, and waits for Node to
+// answer its decision_id (decisions.go). A rejected pairing is cancelled before
+// the device is stored and the client disconnects. allowed_users rejects
+// other phone numbers without asking; without a policy every pairing goes through.
+
+type pairApproval struct {
+	TimeoutMs int64 `json:"timeout_ms"`
+	// answer when Node doesn't in time; rejecting is the safe default
+	AllowOnTimeout bool     `json:"allow_on_timeout"`
+	AllowedUsers   []string `json:"allowed_users"` // phone numbers, empty allows any
+	// only ask about allowed users instead of letting them through
+	Ask bool `json:"ask"`
+}
+
+func (p pairApproval) callback(cli *wa.Client) func(types.JID, string, string) bool {
+	return func(jid types.JID, platform, businessName string) bool {
+		ev := map[string]any{
+			"type":          "pair_request",
+			"jid":           jid.ToNonAD().String(),
+			"platform":      platform,
+			"business_name": businessName,
+		}
+		if len(p.AllowedUsers) > 0 {
+			if !slices.Contains(p.AllowedUsers, jid.User) {
+				ev["allowed"] = false
+				ev["reason"] = "user_not_allowed"
+				emitBridgeEvent(cli, ev)
+				return false
+			}
+			if !p.Ask {
+				ev["allowed"] = true
+				emitBridgeEvent(cli, ev)
+				return true
+			}
+		}
+		return awaitDecision(cli, ev, time.Duration(p.TimeoutMs)*time.Millisecond, p.AllowOnTimeout)
+	}
+}
+
+//export WmClientSetPairApproval
+func WmClientSetPairApproval(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client  uint64 `json:"client"`
+		Enabled bool   `json:"enabled"`
+		pairApproval
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if !payload.Enabled {
+		cli.PrePairCallback = nil
+		return success(map[string]any{"enabled": false})
+	}
+	if payload.TimeoutMs <= 0 {
+		payload.TimeoutMs = 30_000
+	}
+	policy := payload.pairApproval
+	policy.AllowedUsers = make([]string, 0, len(payload.AllowedUsers))
+	for _, raw := range payload.AllowedUsers {
+		// accept JIDs and formatted numbers too
+		user, _, _ := strings.Cut(raw, "@")
+		user = strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, user)
+		if user == "" {
+			return fail(fmt.Errorf("invalid allowed user %q", raw))
+		}
+		policy.AllowedUsers = append(policy.AllowedUsers, user)
+	}
+	cli.PrePairCallback = policy.callback(cli)
+	return success(map[string]any{"enabled": true, "policy": policy})
+}
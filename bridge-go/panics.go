@@ -0,0 +1,31 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+)
+
+// A panic that escapes an export would take the whole Node process down, so
+// every export defers recoverExport and turns it into {ok: false, error, stack}.
+// The bridge's state is not rolled back; a panic while holding a registry lock
+// still leaves that lock held.
+
+func panicResp(r any) jsonResp {
+	return jsonResp{Ok: false, Error: fmt.Sprintf("panic: %v", r), Stack: string(debug.Stack())}
+}
+
+func recoverExport(ret **C.char) {
+	if r := recover(); r != nil {
+		b, _ := json.Marshal(panicResp(r))
+		*ret = C.CString(string(b))
+	}
+}
+
+// recoverBinary is recoverExport for the []byte responses of WmCallBinary.
+func recoverBinary(ret *[]byte) {
+	if r := recover(); r != nil {
+		*ret, _ = json.Marshal(panicResp(r))
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import "C"
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Poll votes arrive encrypted and only reference options by the SHA-256 of
+// their name. Polls are always archived (received ones in archiveMessage, ones
+// sent through WmClientCall here), so incoming votes can be decrypted and
+// mapped back to option names as a "poll_vote" event. The latest vote of every
+// voter is kept in the container DB for WmGetPollResults; a vote update
+// replaces the voter's previous selection.
+
+func pollCreationOf(msg *waE2E.Message) *waE2E.PollCreationMessage {
+	switch {
+	case msg.GetPollCreationMessage() != nil:
+		return msg.GetPollCreationMessage()
+	case msg.GetPollCreationMessageV2() != nil:
+		return msg.GetPollCreationMessageV2()
+	case msg.GetPollCreationMessageV3() != nil:
+		return msg.GetPollCreationMessageV3()
+	default:
+		return nil
+	}
+}
+
+// archiveSentPoll stores a poll we sent via WmClientCall("SendMessage"), which
+// never comes back to us as a message event.
+func archiveSentPoll(cli *wa.Client, args []reflect.Value, ret reflect.Value) {
+	var to types.JID
+	var msg *waE2E.Message
+	for _, arg := range args {
+		switch v := arg.Interface().(type) {
+		case types.JID:
+			to = v
+		case *waE2E.Message:
+			msg = v
+		}
+	}
+	resp, ok := ret.Interface().(wa.SendResponse)
+	if !ok || to.IsEmpty() || pollCreationOf(msg) == nil {
+		return
+	}
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return
+	}
+	ownJID := cli.Store.GetJID().ToNonAD()
+	if err = storeArchivedMessage(context.Background(), db, ownJID.String(), &archivedMessage{
+		Chat:      to.ToNonAD(),
+		Sender:    ownJID,
+		ID:        resp.ID,
+		Timestamp: resp.Timestamp,
+		FromMe:    true,
+		Message:   msg,
+	}); err != nil {
+		cli.Log.Warnf("Failed to archive sent poll %s: %v", resp.ID, err)
+	}
+}
+
+func decryptPollVote(cli *wa.Client, evt *events.Message) {
+	update := evt.Message.GetPollUpdateMessage()
+	if update == nil {
+		return
+	}
+	ctx := context.Background()
+	pollID := types.MessageID(update.GetPollCreationMessageKey().GetID())
+	orig, err := getArchivedMessage(ctx, cli, evt.Info.Chat, pollID)
+	if err != nil {
+		cli.Log.Warnf("Failed to look up poll %s for vote %s: %v", pollID, evt.Info.ID, err)
+		return
+	}
+	var poll *waE2E.PollCreationMessage
+	if orig != nil {
+		poll = pollCreationOf(orig.Message)
+	}
+	if poll == nil {
+		// not a poll we know about, the raw message event is all we can offer
+		return
+	}
+	vote, err := cli.DecryptPollVote(ctx, evt)
+	if err != nil {
+		cli.Log.Warnf("Failed to decrypt vote %s on poll %s: %v", evt.Info.ID, pollID, err)
+		return
+	}
+	selected, unknown := matchPollOptions(poll, vote.GetSelectedOptions())
+	if err = recordPollVote(ctx, cli, evt, pollID, selected, unknown); err != nil {
+		cli.Log.Warnf("Failed to record vote %s on poll %s: %v", evt.Info.ID, pollID, err)
+	}
+	ev := map[string]any{
+		"type":             "poll_vote",
+		"chat":             evt.Info.Chat.String(),
+		"poll_id":          string(pollID),
+		"poll_name":        poll.GetName(),
+		"voter":            evt.Info.Sender.ToNonAD().String(),
+		"vote_id":          string(evt.Info.ID),
+		"timestamp":        eventTime(evt.Info.Timestamp),
+		"selected_options": selected,
+	}
+	if len(unknown) > 0 {
+		ev["unknown_option_hashes"] = unknown
+	}
+	emitBridgeEvent(cli, ev)
+}
+
+// matchPollOptions maps option hashes back to the names of the poll's options;
+// hashes that match none are returned base64-encoded.
+func matchPollOptions(poll *waE2E.PollCreationMessage, hashes [][]byte) (selected, unknown []string) {
+	byHash := make(map[[32]byte]string, len(poll.GetOptions()))
+	for _, opt := range poll.GetOptions() {
+		byHash[sha256.Sum256([]byte(opt.GetOptionName()))] = opt.GetOptionName()
+	}
+	selected = []string{}
+	for _, hash := range hashes {
+		if len(hash) == sha256.Size {
+			if name, ok := byHash[[32]byte(hash)]; ok {
+				selected = append(selected, name)
+				continue
+			}
+		}
+		unknown = append(unknown, base64.StdEncoding.EncodeToString(hash))
+	}
+	return selected, unknown
+}
+
+// recordPollVote stores a voter's latest selection; older updates that arrive
+// late don't overwrite newer ones.
+func recordPollVote(ctx context.Context, cli *wa.Client, evt *events.Message, pollID types.MessageID, selected, unknown []string) error {
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return err
+	}
+	if unknown == nil {
+		unknown = []string{}
+	}
+	options, _ := json.Marshal(selected)
+	unknownJSON, _ := json.Marshal(unknown)
+	_, err = db.db.ExecContext(ctx, `
+		INSERT INTO wmnode_poll_votes (our_jid, chat, poll_id, voter, options, unknown, timestamp)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (our_jid, chat, poll_id, voter) DO UPDATE SET options=excluded.options, unknown=excluded.unknown, timestamp=excluded.timestamp
+		WHERE excluded.timestamp >= wmnode_poll_votes.timestamp
+	`, cli.Store.GetJID().ToNonAD().String(), evt.Info.Chat.String(), string(pollID), evt.Info.Sender.ToNonAD().String(),
+		string(options), string(unknownJSON), evt.Info.Timestamp.UnixMilli())
+	return err
+}
+
+// pollResults tallies the recorded votes of a poll per option, in the order of
+// the poll's options when the poll is known. A voter who selected several
+// options counts towards each of them.
+func pollResults(ctx context.Context, cli *wa.Client, chat types.JID, pollID types.MessageID) (map[string]any, error) {
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return nil, err
+	}
+	type tally struct {
+		Name   string   `json:"name"`
+		Count  int      `json:"count"`
+		Voters []string `json:"voters"`
+	}
+	out := map[string]any{"chat": chat.String(), "poll_id": string(pollID), "known_poll": false}
+	byName := map[string]*tally{}
+	options := []*tally{}
+	addOption := func(name string) *tally {
+		t := byName[name]
+		if t == nil {
+			t = &tally{Name: name, Voters: []string{}}
+			byName[name] = t
+			options = append(options, t)
+		}
+		return t
+	}
+	orig, err := getArchivedMessage(ctx, cli, chat, pollID)
+	if err != nil {
+		return nil, err
+	}
+	if orig != nil {
+		if poll := pollCreationOf(orig.Message); poll != nil {
+			out["known_poll"] = true
+			out["poll_name"] = poll.GetName()
+			out["selectable_count"] = poll.GetSelectableOptionsCount()
+			for _, opt := range poll.GetOptions() {
+				addOption(opt.GetOptionName())
+			}
+		}
+	}
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT voter, options, unknown FROM wmnode_poll_votes WHERE our_jid=$1 AND chat=$2 AND poll_id=$3 ORDER BY timestamp`,
+		cli.Store.GetJID().ToNonAD().String(), chat.String(), string(pollID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	voters := 0
+	unknownVotes := 0
+	for rows.Next() {
+		var voter, optionsJSON, unknownJSON string
+		if err := rows.Scan(&voter, &optionsJSON, &unknownJSON); err != nil {
+			return nil, err
+		}
+		var selected, unknown []string
+		_ = json.Unmarshal([]byte(optionsJSON), &selected)
+		_ = json.Unmarshal([]byte(unknownJSON), &unknown)
+		if len(selected) == 0 && len(unknown) == 0 {
+			// the vote was retracted
+			continue
+		}
+		voters++
+		unknownVotes += len(unknown)
+		for _, name := range selected {
+			t := addOption(name)
+			t.Count++
+			t.Voters = append(t.Voters, voter)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	out["options"] = options
+	out["total_voters"] = voters
+	out["unknown_votes"] = unknownVotes
+	return out, nil
+}
+
+// origPollSender is the sender whatsmeow looks the poll's secret up under.
+func origPollSender(cli *wa.Client, chat types.JID, key *waCommon.MessageKey) (types.JID, error) {
+	switch {
+	case key.GetFromMe():
+		return cli.Store.GetJID().ToNonAD(), nil
+	case key.GetParticipant() != "":
+		return types.ParseJID(key.GetParticipant())
+	case key.GetRemoteJID() != "":
+		return types.ParseJID(key.GetRemoteJID())
+	default:
+		return chat, nil
+	}
+}
+
+//export WmClientDecryptPollVote
+func WmClientDecryptPollVote(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		Chat   string `json:"chat"`
+		Sender string `json:"sender"` // the voter
+		ID     string `json:"id"`
+		FromMe bool   `json:"from_me"`
+		// unix milliseconds, used to order updates of the same voter when recorded
+		Timestamp int64 `json:"timestamp"`
+		// the message carrying the pollUpdateMessage, in protojson form
+		Message json.RawMessage `json:"message"`
+		// the original poll message or its secret, for polls the store doesn't know
+		PollMessage json.RawMessage `json:"poll_message"`
+		PollSecret  []byte          `json:"poll_secret"`
+		// add the vote to the results of WmGetPollResults
+		Record bool `json:"record"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	chat, err := types.ParseJID(payload.Chat)
+	if err != nil {
+		return fail(err)
+	}
+	sender, err := types.ParseJID(payload.Sender)
+	if err != nil {
+		return fail(err)
+	}
+	var msg waE2E.Message
+	if err = protojson.Unmarshal(payload.Message, &msg); err != nil {
+		return fail(fmt.Errorf("invalid message: %w", err))
+	}
+	update := msg.GetPollUpdateMessage()
+	if update == nil {
+		return fail(errors.New("message has no pollUpdateMessage"))
+	}
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	pollKey := update.GetPollCreationMessageKey()
+	pollID := types.MessageID(pollKey.GetID())
+	var poll *waE2E.PollCreationMessage
+	secret := payload.PollSecret
+	if len(payload.PollMessage) > 0 {
+		var pollMsg waE2E.Message
+		if err = protojson.Unmarshal(payload.PollMessage, &pollMsg); err != nil {
+			return fail(fmt.Errorf("invalid poll_message: %w", err))
+		}
+		if poll = pollCreationOf(&pollMsg); poll == nil {
+			return fail(errors.New("poll_message is not a poll"))
+		}
+		if len(secret) == 0 {
+			secret = pollMsg.GetMessageContextInfo().GetMessageSecret()
+		}
+	} else if orig, err := getArchivedMessage(ctx, cli, chat, pollID); err == nil && orig != nil {
+		poll = pollCreationOf(orig.Message)
+	}
+	if len(secret) > 0 {
+		pollSender, err := origPollSender(cli, chat, pollKey)
+		if err != nil {
+			return fail(fmt.Errorf("invalid poll key: %w", err))
+		}
+		if err = cli.Store.MsgSecrets.PutMessageSecret(ctx, chat, pollSender.ToNonAD(), pollID, secret); err != nil {
+			return fail(err)
+		}
+	}
+	evt := &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: sender, IsFromMe: payload.FromMe, IsGroup: chat.Server == types.GroupServer},
+			ID:            types.MessageID(payload.ID),
+			Timestamp:     time.UnixMilli(payload.Timestamp),
+		},
+		Message: &msg,
+	}
+	vote, err := cli.DecryptPollVote(ctx, evt)
+	if err != nil {
+		return fail(err)
+	}
+	hashes := make([]string, len(vote.GetSelectedOptions()))
+	for i, hash := range vote.GetSelectedOptions() {
+		hashes[i] = base64.StdEncoding.EncodeToString(hash)
+	}
+	out := map[string]any{"poll_id": string(pollID), "voter": sender.ToNonAD().String(), "selected_hashes": hashes}
+	if poll == nil {
+		return success(out)
+	}
+	selected, unknown := matchPollOptions(poll, vote.GetSelectedOptions())
+	out["poll_name"] = poll.GetName()
+	out["selected_options"] = selected
+	if len(unknown) > 0 {
+		out["unknown_option_hashes"] = unknown
+	}
+	if payload.Record {
+		if err = recordPollVote(ctx, cli, evt, pollID, selected, unknown); err != nil {
+			return fail(err)
+		}
+	}
+	return success(out)
+}
+
+//export WmGetPollResults
+func WmGetPollResults(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		Chat   string `json:"chat"`
+		ID     string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	chat, err := types.ParseJID(payload.Chat)
+	if err != nil {
+		return fail(err)
+	}
+	if payload.ID == "" {
+		return fail(errors.New("id is required"))
+	}
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	results, err := pollResults(ctx, cli, chat, types.MessageID(payload.ID))
+	if err != nil {
+		return fail(err)
+	}
+	return success(results)
+}
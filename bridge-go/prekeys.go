@@ -0,0 +1,132 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// whatsmeow tops up the server's one-time pre-keys when the server asks for it
+// or the count drops below MinPreKeyCount at connect time. Busy accounts that
+// want more headroom can set a watermark: the server count is checked on every
+// connect and a prekeys_low event is emitted when it falls below it. The status
+// and upload exports let operators inspect and refill on their own schedule.
+
+func (cfg *clientConfig) preKeyLowWatermark() int {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.preKeyWatermark
+}
+
+// checkPreKeys compares the server count against the watermark; count < 0
+// means it still has to be fetched.
+func checkPreKeys(cli *wa.Client, count int) {
+	watermark := configFor(cli).preKeyLowWatermark()
+	if watermark <= 0 {
+		return
+	}
+	if count < 0 {
+		var err error
+		if count, err = cli.DangerousInternals().GetServerPreKeyCount(context.Background()); err != nil {
+			cli.Log.Warnf("Failed to get server pre-key count: %v", err)
+			return
+		}
+	}
+	if count < watermark {
+		emitBridgeEvent(cli, map[string]any{"type": "prekeys_low", "server_count": count, "watermark": watermark})
+	}
+}
+
+//export WmClientPreKeyStatus
+func WmClientPreKeyStatus(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	ctx := context.Background()
+	local, err := cli.Store.PreKeys.UploadedPreKeyCount(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	server, err := cli.DangerousInternals().GetServerPreKeyCount(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	checkPreKeys(cli, server)
+	return success(map[string]any{
+		"server_count":   server,
+		"uploaded_count": local,
+		"min_count":      wa.MinPreKeyCount,
+		"wanted_count":   wa.WantedPreKeyCount,
+		"watermark":      configFor(cli).preKeyLowWatermark(),
+	})
+}
+
+//export WmClientUploadPreKeys
+func WmClientUploadPreKeys(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	ctx := context.Background()
+	before, err := cli.DangerousInternals().GetServerPreKeyCount(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	// whatsmeow generates the keys and logs (rather than returns) upload
+	// failures, so the result is judged by asking the server again
+	cli.DangerousInternals().UploadPreKeys(ctx, false)
+	after, err := cli.DangerousInternals().GetServerPreKeyCount(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	return success(map[string]any{"before": before, "server_count": after, "uploaded": after > before})
+}
+
+//export WmClientSetPreKeyWatermark
+func WmClientSetPreKeyWatermark(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client    uint64 `json:"client"`
+		Watermark int    `json:"watermark"` // 0 disables the check
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if payload.Watermark < 0 {
+		return fail(errors.New("watermark must not be negative"))
+	}
+	cfg := configFor(cli)
+	cfg.mu.Lock()
+	cfg.preKeyWatermark = payload.Watermark
+	cfg.mu.Unlock()
+	if cli.IsConnected() && payload.Watermark > 0 {
+		submitTask(cli, func() { checkPreKeys(cli, -1) })
+	}
+	return success(map[string]any{"watermark": payload.Watermark})
+}
@@ -0,0 +1,90 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// Proxies are set per client so each session can use its own egress. whatsmeow
+// accepts http(s):// and socks5:// URLs; credentials go in the URL userinfo,
+// which is filled from username/password when the URL doesn't carry its own.
+
+func proxyURL(raw, username, password string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, errors.New("proxy url has no host")
+	}
+	if username != "" && u.User == nil {
+		u.User = url.UserPassword(username, password)
+	}
+	return u, nil
+}
+
+//export WmClientSetProxy
+func WmClientSetProxy(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client   uint64 `json:"client"`
+		URL      string `json:"url"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+		// MediaURL routes media up/downloads through a different proxy than the websocket
+		MediaURL    string `json:"media_url"`
+		NoWebsocket bool   `json:"no_websocket"`
+		NoMedia     bool   `json:"no_media"`
+		OnlyLogin   bool   `json:"only_login"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if cli.IsConnected() {
+		return fail(errors.New("proxy must be set before connecting"))
+	}
+	opts := wa.SetProxyOptions{
+		NoWebsocket: payload.NoWebsocket,
+		NoMedia:     payload.NoMedia || payload.MediaURL != "",
+		OnlyLogin:   payload.OnlyLogin,
+	}
+	out := map[string]any{"url": nil, "media_url": nil}
+	if payload.URL == "" {
+		cli.SetProxy(nil, opts)
+	} else {
+		u, err := proxyURL(payload.URL, payload.Username, payload.Password)
+		if err != nil {
+			return fail(err)
+		}
+		if err = cli.SetProxyAddress(u.String(), opts); err != nil {
+			return fail(err)
+		}
+		out["url"] = u.Redacted()
+	}
+	if payload.MediaURL != "" {
+		u, err := proxyURL(payload.MediaURL, payload.Username, payload.Password)
+		if err != nil {
+			return fail(err)
+		}
+		if err = cli.SetProxyAddress(u.String(), wa.SetProxyOptions{NoWebsocket: true}); err != nil {
+			return fail(err)
+		}
+		out["media_url"] = u.Redacted()
+	}
+	return success(out)
+}
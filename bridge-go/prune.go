@@ -0,0 +1,170 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.mau.fi/whatsmeow/store/sqlstore"
+)
+
+// whatsmeow's tables reference whatsmeow_device with ON DELETE CASCADE, but
+// SQLite only honours that with foreign keys enabled and the bridge's own
+// tables have no reference at all, so stores that have seen many accounts come
+// and go collect rows nobody owns. WmContainerPrune finds them by owner JID and
+// deletes them (or only counts them with dry_run).
+
+type pruneTable struct {
+	name   string
+	column string
+	// bridge tables are keyed by the account JID without device part
+	nonAD bool
+}
+
+var pruneTables = []pruneTable{
+	{"whatsmeow_identity_keys", "our_jid", false},
+	{"whatsmeow_pre_keys", "jid", false},
+	{"whatsmeow_sessions", "our_jid", false},
+	{"whatsmeow_sender_keys", "our_jid", false},
+	{"whatsmeow_app_state_sync_keys", "jid", false},
+	{"whatsmeow_app_state_version", "jid", false},
+	{"whatsmeow_app_state_mutation_macs", "jid", false},
+	{"whatsmeow_contacts", "our_jid", false},
+	{"whatsmeow_chat_settings", "our_jid", false},
+	{"whatsmeow_message_secrets", "our_jid", false},
+	{"whatsmeow_privacy_tokens", "our_jid", false},
+	{"whatsmeow_event_buffer", "our_jid", false},
+	{"wmnode_history_sync", "our_jid", true},
+	{"wmnode_messages", "our_jid", true},
+	{"wmnode_event_journal", "our_jid", true},
+	{"wmnode_webhook_queue", "our_jid", true},
+	{"wmnode_webhook_seq", "our_jid", true},
+	{"wmnode_reactions", "our_jid", true},
+	{"wmnode_message_edits", "our_jid", true},
+	{"wmnode_poll_votes", "our_jid", true},
+	{"wmnode_newsletter_posts", "our_jid", true},
+	{"wmnode_chat_ephemeral", "our_jid", true},
+	{"wmnode_warmup", "our_jid", true},
+	{"wmnode_identity_quarantine", "our_jid", true},
+}
+
+func tableExists(ctx context.Context, b *bridgeDB, name string) (bool, error) {
+	var exists bool
+	var err error
+	if b.dialect == "postgres" {
+		err = b.db.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", name).Scan(&exists)
+	} else {
+		err = b.db.QueryRowContext(ctx, "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type='table' AND name=$1", name).Scan(&exists)
+	}
+	return exists, err
+}
+
+// liveOwners returns the device JIDs saved in the container plus any device
+// handle loaded from it, and the account JIDs of both.
+func liveOwners(ctx context.Context, cont *sqlstore.Container) (devs, accounts map[string]bool, err error) {
+	devs, accounts = map[string]bool{}, map[string]bool{}
+	stored, err := cont.GetAllDevices(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	devicesMu.RLock()
+	for _, dev := range devices {
+		if dev.Container == cont {
+			stored = append(stored, dev)
+		}
+	}
+	devicesMu.RUnlock()
+	for _, dev := range stored {
+		if dev.ID == nil {
+			continue
+		}
+		devs[dev.ID.String()] = true
+		accounts[dev.ID.ToNonAD().String()] = true
+	}
+	return devs, accounts, nil
+}
+
+func pruneOrphans(ctx context.Context, b *bridgeDB, devs, accounts map[string]bool, dryRun bool) (map[string]int64, error) {
+	counts := map[string]int64{}
+	for _, t := range pruneTables {
+		if ok, err := tableExists(ctx, b, t.name); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		live := devs
+		if t.nonAD {
+			live = accounts
+		}
+		rows, err := b.db.QueryContext(ctx, fmt.Sprintf("SELECT %s, COUNT(*) FROM %s GROUP BY %s", t.column, t.name, t.column))
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", t.name, err)
+		}
+		var orphans []string
+		for rows.Next() {
+			var owner string
+			var n int64
+			if err = rows.Scan(&owner, &n); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if !live[owner] {
+				orphans = append(orphans, owner)
+				counts[t.name] += n
+			}
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		if dryRun {
+			continue
+		}
+		for _, owner := range orphans {
+			if _, err = b.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s=$1", t.name, t.column), owner); err != nil {
+				return nil, fmt.Errorf("failed to prune %s: %w", t.name, err)
+			}
+		}
+	}
+	return counts, nil
+}
+
+//export WmContainerPrune
+func WmContainerPrune(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var req struct {
+		Handle uint64 `json:"handle"`
+		DryRun bool   `json:"dry_run"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &req); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	containersMu.RLock()
+	cont := containers[handle(req.Handle)]
+	containersMu.RUnlock()
+	if cont == nil {
+		return fail(errors.New("container handle not found"))
+	}
+	bridgeDBsMu.RLock()
+	bdb := bridgeDBs[cont]
+	bridgeDBsMu.RUnlock()
+	if bdb == nil {
+		return fail(errNoBridgeDB)
+	}
+	ctx := context.Background()
+	devs, accounts, err := liveOwners(ctx, cont)
+	if err != nil {
+		return fail(err)
+	}
+	counts, err := pruneOrphans(ctx, bdb, devs, accounts, req.DryRun)
+	if err != nil {
+		return fail(err)
+	}
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	return success(map[string]any{"tables": counts, "total": total, "dry_run": req.DryRun})
+}
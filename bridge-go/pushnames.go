@@ -0,0 +1,116 @@
+package main
+
+import "C"
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// whatsmeow saves the push name of every incoming message sender, and those of
+// history syncs, in the contact store. Deployments that keep names elsewhere,
+// or mustn't keep names of people who aren't contacts, turn that off with
+// WmClientSetPushNameStorage: the device's contact store is wrapped when the
+// client is created and drops push name writes while disabled. Names already
+// stored stay, and without writes whatsmeow doesn't notice changes either, so
+// no push_name events are emitted meanwhile. WmClientDumpContactNames returns the
+// whole name table (address book, push and business names) for syncing to a CRM.
+
+type pushNameGuard struct {
+	store.ContactStore
+	skip atomic.Bool
+}
+
+func (g *pushNameGuard) PutPushName(ctx context.Context, user types.JID, pushName string) (bool, string, error) {
+	if g.skip.Load() {
+		return false, "", nil
+	}
+	return g.ContactStore.PutPushName(ctx, user, pushName)
+}
+
+// guardPushNames wraps the contact store of dev once. It must run before a
+// client is created for the device.
+func guardPushNames(dev *store.Device) *pushNameGuard {
+	if g, ok := dev.Contacts.(*pushNameGuard); ok {
+		return g
+	}
+	g := &pushNameGuard{ContactStore: dev.Contacts}
+	dev.Contacts = g
+	return g
+}
+
+//export WmClientSetPushNameStorage
+func WmClientSetPushNameStorage(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client  uint64 `json:"client"`
+		Enabled bool   `json:"enabled"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	g, ok := cli.Store.Contacts.(*pushNameGuard)
+	if !ok {
+		return fail(errors.New("contact store of the client isn't wrapped"))
+	}
+	g.skip.Store(!payload.Enabled)
+	return success(map[string]any{"enabled": payload.Enabled})
+}
+
+//export WmClientDumpContactNames
+func WmClientDumpContactNames(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		// only entries with a push name
+		PushNamesOnly bool `json:"push_names_only"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	contacts, err := cli.Store.Contacts.GetAllContacts(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	type contactName struct {
+		JID          string `json:"jid"`
+		PushName     string `json:"push_name,omitempty"`
+		FullName     string `json:"full_name,omitempty"`
+		FirstName    string `json:"first_name,omitempty"`
+		BusinessName string `json:"business_name,omitempty"`
+	}
+	names := make([]contactName, 0, len(contacts))
+	for jid, info := range contacts {
+		if payload.PushNamesOnly && info.PushName == "" {
+			continue
+		}
+		names = append(names, contactName{
+			JID:          jid.String(),
+			PushName:     info.PushName,
+			FullName:     info.FullName,
+			FirstName:    info.FirstName,
+			BusinessName: info.BusinessName,
+		})
+	}
+	slices.SortFunc(names, func(a, b contactName) int { return cmp.Compare(a.JID, b.JID) })
+	return success(map[string]any{"contacts": names, "total": len(names)})
+}
@@ -0,0 +1,257 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Sending in bursts is one of the patterns that gets accounts banned.
+// WmSetRateLimits configures token buckets for outgoing messages: one shared by
+// every client (global), one per client and one per chat of each client. Every
+// send goes through them: SendMessage and SendFBMessage through WmClientCall,
+// the bridge's own send exports and automatic call replies (peer messages to our
+// own devices aren't limited). A send that would exceed a bucket waits for its
+// turn in "queue" mode, up to max_wait_ms, and fails with errRateLimited in
+// "reject" mode or when the wait would be longer; both are reported as
+// send_throttled events naming the limit that applied.
+
+var errRateLimited = errors.New("rate limited")
+
+type bucketLimit struct {
+	PerMinute float64 `json:"per_minute"`
+	Burst     int     `json:"burst"` // defaults to 1
+}
+
+type rateLimits struct {
+	Global    *bucketLimit `json:"global,omitempty"`
+	PerClient *bucketLimit `json:"per_client,omitempty"`
+	PerChat   *bucketLimit `json:"per_chat,omitempty"`
+	Mode      string       `json:"mode"`        // queue or reject
+	MaxWaitMs int64        `json:"max_wait_ms"` // queue mode only
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills b and takes a token from it, going negative if there was none.
+// It returns how long the caller must wait for the token to exist.
+func (b *tokenBucket) take(limit *bucketLimit, now time.Time) time.Duration {
+	rate := limit.PerMinute / 60 // tokens per second
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*rate, float64(limit.Burst))
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+// full reports whether b would be back at its burst by now, so dropping it loses nothing.
+func (b *tokenBucket) full(limit *bucketLimit, now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*limit.PerMinute/60 >= float64(limit.Burst)
+}
+
+type chatBucketKey struct {
+	cli  *wa.Client
+	chat string
+}
+
+var rateLimiter struct {
+	mu      sync.Mutex
+	limits  *rateLimits
+	global  tokenBucket
+	clients map[*wa.Client]*tokenBucket
+	chats   map[chatBucketKey]*tokenBucket
+}
+
+func bucketFor[K comparable](m map[K]*tokenBucket, key K, limit *bucketLimit, now time.Time) *tokenBucket {
+	b := m[key]
+	if b == nil {
+		b = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		m[key] = b
+	}
+	return b
+}
+
+// throttleSend is the gate of every send: it refuses chats of quarantined
+// contacts (identity.go), waits for the rate limits, then counts the send
+// against the warm-up quota of cli (warmup.go).
+func throttleSend(ctx context.Context, cli *wa.Client, chat types.JID) error {
+	if err := checkIdentityQuarantine(ctx, cli, chat); err != nil {
+		return err
+	}
+	if err := waitRateLimit(ctx, cli, chat); err != nil {
+		return err
+	}
+	return reserveWarmupSend(ctx, cli)
+}
+
+// waitRateLimit waits until cli may send to chat under the configured limits,
+// or returns errRateLimited.
+func waitRateLimit(ctx context.Context, cli *wa.Client, chat types.JID) error {
+	rl := &rateLimiter
+	rl.mu.Lock()
+	limits := rl.limits
+	if limits == nil {
+		rl.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	type taken struct {
+		b     *tokenBucket
+		limit *bucketLimit
+		scope string
+	}
+	var took []taken
+	if limits.Global != nil {
+		took = append(took, taken{&rl.global, limits.Global, "global"})
+	}
+	if limits.PerClient != nil {
+		took = append(took, taken{bucketFor(rl.clients, cli, limits.PerClient, now), limits.PerClient, "client"})
+	}
+	if limits.PerChat != nil {
+		if len(rl.chats) > 4096 {
+			for key, b := range rl.chats {
+				if b.full(limits.PerChat, now) {
+					delete(rl.chats, key)
+				}
+			}
+		}
+		key := chatBucketKey{cli: cli, chat: chat.ToNonAD().String()}
+		took = append(took, taken{bucketFor(rl.chats, key, limits.PerChat, now), limits.PerChat, "chat"})
+	}
+	var wait time.Duration
+	scope := ""
+	for _, t := range took {
+		if w := t.b.take(t.limit, now); w > wait {
+			wait, scope = w, t.scope
+		}
+	}
+	reject := wait > 0 && (limits.Mode == "reject" || wait > time.Duration(limits.MaxWaitMs)*time.Millisecond)
+	if reject {
+		for _, t := range took {
+			t.b.tokens++
+		}
+	}
+	rl.mu.Unlock()
+	if wait == 0 {
+		return nil
+	}
+	ev := map[string]any{
+		"type":    "send_throttled",
+		"chat":    chat.ToNonAD().String(),
+		"limit":   scope,
+		"wait_ms": wait.Milliseconds(),
+		"action":  "queued",
+	}
+	if reject {
+		ev["action"] = "rejected"
+		emitBridgeEvent(cli, ev)
+		return fmt.Errorf("%w by the %s limit, retry in %dms", errRateLimited, scope, wait.Milliseconds())
+	}
+	emitBridgeEvent(cli, ev)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// give the slot back to the sends queued behind us
+		rl.mu.Lock()
+		for _, t := range took {
+			t.b.tokens++
+		}
+		rl.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// throttleClientCall applies the limits to WmClientCall sends, whose target is
+// their first JID argument.
+func throttleClientCall(ctx context.Context, cli *wa.Client, method string, args []reflect.Value) error {
+	if method != "SendMessage" && method != "SendFBMessage" {
+		return nil
+	}
+	for _, arg := range args {
+		if jid, ok := arg.Interface().(types.JID); ok {
+			return throttleSend(ctx, cli, jid)
+		}
+	}
+	return nil
+}
+
+func dropRateBuckets(cli *wa.Client) {
+	rateLimiter.mu.Lock()
+	defer rateLimiter.mu.Unlock()
+	delete(rateLimiter.clients, cli)
+	for key := range rateLimiter.chats {
+		if key.cli == cli {
+			delete(rateLimiter.chats, key)
+		}
+	}
+}
+
+//export WmSetRateLimits
+func WmSetRateLimits(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Enabled bool `json:"enabled"`
+		rateLimits
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	limits := payload.rateLimits
+	if payload.Enabled {
+		if limits.Global == nil && limits.PerClient == nil && limits.PerChat == nil {
+			return fail(errors.New("at least one of global, per_client and per_chat is required"))
+		}
+		for _, l := range []*bucketLimit{limits.Global, limits.PerClient, limits.PerChat} {
+			if l == nil {
+				continue
+			}
+			if l.PerMinute <= 0 {
+				return fail(errors.New("per_minute must be positive"))
+			}
+			if l.Burst <= 0 {
+				l.Burst = 1
+			}
+		}
+		switch limits.Mode {
+		case "":
+			limits.Mode = "queue"
+		case "queue", "reject":
+		default:
+			return fail(fmt.Errorf("unknown mode %q", limits.Mode))
+		}
+		if limits.MaxWaitMs <= 0 {
+			limits.MaxWaitMs = 60_000
+		}
+	}
+	rl := &rateLimiter
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	// new limits start with full buckets
+	rl.limits = nil
+	rl.clients = map[*wa.Client]*tokenBucket{}
+	rl.chats = map[chatBucketKey]*tokenBucket{}
+	if !payload.Enabled {
+		return success(map[string]any{"enabled": false})
+	}
+	rl.limits = &limits
+	if limits.Global != nil {
+		rl.global = tokenBucket{tokens: float64(limits.Global.Burst), last: time.Now()}
+	}
+	return success(map[string]any{"enabled": true, "limits": limits})
+}
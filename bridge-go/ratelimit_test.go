@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketTake(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	limit := &bucketLimit{PerMinute: 60, Burst: 3} // a token per second
+	tests := []struct {
+		name  string
+		after time.Duration // since the previous take
+		want  time.Duration
+	}{
+		{"burst 1", 0, 0},
+		{"burst 2", 0, 0},
+		{"burst 3", 0, 0},
+		{"empty", 0, time.Second},
+		{"queued behind the previous wait", 0, 2 * time.Second},
+		{"refilled while waiting", 2 * time.Second, time.Second},
+		{"partial refill", 1500 * time.Millisecond, 500 * time.Millisecond},
+		{"long idle caps at burst", time.Hour, 0},
+		{"burst again 2", 0, 0},
+		{"burst again 3", 0, 0},
+		{"empty again", 0, time.Second},
+	}
+	b := &tokenBucket{tokens: float64(limit.Burst), last: start}
+	now := start
+	for _, tt := range tests {
+		now = now.Add(tt.after)
+		got := b.take(limit, now)
+		if diff := got - tt.want; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("%s: take() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTokenBucketFull(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	limit := &bucketLimit{PerMinute: 30, Burst: 2} // a token every 2 seconds
+	b := &tokenBucket{tokens: float64(limit.Burst), last: start}
+	if !b.full(limit, start) {
+		t.Error("new bucket isn't full")
+	}
+	b.take(limit, start)
+	b.take(limit, start)
+	tests := []struct {
+		after time.Duration
+		want  bool
+	}{
+		{0, false},
+		{2 * time.Second, false},
+		{4 * time.Second, true},
+		{time.Minute, true},
+	}
+	for _, tt := range tests {
+		if got := b.full(limit, start.Add(tt.after)); got != tt.want {
+			t.Errorf("full after %v = %v, want %v", tt.after, got, tt.want)
+		}
+	}
+}
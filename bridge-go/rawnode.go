@@ -0,0 +1,245 @@
+package main
+
+import "C"
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Escape hatch for protocol features without a typed wrapper yet: WmClientSendNode
+// sends any binary XML node and WmClientSendIQ an info query, both built from
+// the same {tag, attrs, children, content, content_b64} tree nodeToJSON
+// produces, and return the response node in that form.
+//
+// Attribute values are strings, numbers or booleans. A JID is written as
+// {"jid": "..."}; string values of the usual JID attributes (to, from,
+// participant, ...) are parsed as JIDs automatically.
+
+type jsonNode struct {
+	Tag        string         `json:"tag"`
+	Attrs      map[string]any `json:"attrs"`
+	Children   []jsonNode     `json:"children"`
+	Content    *string        `json:"content"`
+	ContentB64 *string        `json:"content_b64"`
+}
+
+var jidAttrs = map[string]bool{
+	"to": true, "from": true, "jid": true, "participant": true, "recipient": true,
+	"target": true, "call-creator": true, "sender_lid": true, "participant_pn": true,
+}
+
+func (n jsonNode) toNode() (waBinary.Node, error) {
+	if n.Tag == "" {
+		return waBinary.Node{}, errors.New("node tag is required")
+	}
+	node := waBinary.Node{Tag: n.Tag}
+	if len(n.Attrs) > 0 {
+		node.Attrs = make(waBinary.Attrs, len(n.Attrs))
+		for k, v := range n.Attrs {
+			attr, err := nodeAttrFromJSON(k, v)
+			if err != nil {
+				return node, fmt.Errorf("<%s> attribute %s: %w", n.Tag, k, err)
+			}
+			node.Attrs[k] = attr
+		}
+	}
+	switch {
+	case n.Children != nil:
+		children := make([]waBinary.Node, len(n.Children))
+		for i, child := range n.Children {
+			var err error
+			if children[i], err = child.toNode(); err != nil {
+				return node, err
+			}
+		}
+		node.Content = children
+	case n.ContentB64 != nil:
+		data, err := base64.StdEncoding.DecodeString(*n.ContentB64)
+		if err != nil {
+			return node, fmt.Errorf("<%s> content_b64: %w", n.Tag, err)
+		}
+		node.Content = data
+	case n.Content != nil:
+		node.Content = []byte(*n.Content)
+	}
+	return node, nil
+}
+
+func nodeAttrFromJSON(key string, v any) (any, error) {
+	switch tv := v.(type) {
+	case string:
+		if jidAttrs[key] {
+			if jid, err := types.ParseJID(tv); err == nil && jid.Server != "" {
+				return jid, nil
+			}
+		}
+		return tv, nil
+	case bool:
+		return tv, nil
+	case float64:
+		if tv == float64(int64(tv)) {
+			return int64(tv), nil
+		}
+		return tv, nil
+	case map[string]any:
+		s, ok := tv["jid"].(string)
+		if !ok || len(tv) != 1 {
+			return nil, errors.New(`objects must be {"jid": "..."}`)
+		}
+		return types.ParseJID(s)
+	default:
+		return nil, fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+// sendNodeAndWait sends node (which must have an id attribute) and waits for
+// the response with the same id.
+func sendNodeAndWait(cli *wa.Client, node waBinary.Node, timeout time.Duration, opID uint64) (*waBinary.Node, error) {
+	ctx, done, err := beginOp(opID)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	id, _ := node.Attrs["id"].(string)
+	internals := cli.DangerousInternals()
+	ch := internals.WaitResponse(id)
+	if err = internals.SendNode(node); err != nil {
+		internals.CancelResponse(id, ch)
+		return nil, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case resp := <-ch:
+		if resp == nil || resp.Tag == "xmlstreamend" {
+			return nil, errors.New("connection closed before the response arrived")
+		}
+		return resp, nil
+	case <-timer.C:
+		internals.CancelResponse(id, ch)
+		return nil, wa.ErrIQTimedOut
+	case <-ctx.Done():
+		internals.CancelResponse(id, ch)
+		return nil, ctx.Err()
+	}
+}
+
+func clientForRaw(client uint64) (*wa.Client, func(), error) {
+	cli, end, err := beginClientCall(client, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !cli.IsConnected() {
+		end()
+		return nil, nil, wa.ErrNotConnected
+	}
+	return cli, end, nil
+}
+
+//export WmClientSendNode
+func WmClientSendNode(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client       uint64   `json:"client"`
+		Node         jsonNode `json:"node"`
+		WaitResponse bool     `json:"wait_response"`
+		TimeoutMs    int64    `json:"timeout_ms"`
+		OpID         uint64   `json:"op_id"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := clientForRaw(payload.Client)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	node, err := payload.Node.toNode()
+	if err != nil {
+		return fail(err)
+	}
+	if !payload.WaitResponse {
+		if err = cli.DangerousInternals().SendNode(node); err != nil {
+			return fail(err)
+		}
+		return success(map[string]any{"id": node.Attrs["id"]})
+	}
+	if _, ok := node.Attrs["id"].(string); !ok {
+		if node.Attrs == nil {
+			node.Attrs = waBinary.Attrs{}
+		}
+		node.Attrs["id"] = cli.DangerousInternals().GenerateRequestID()
+	}
+	resp, err := sendNodeAndWait(cli, node, rawTimeout(payload.TimeoutMs), payload.OpID)
+	if err != nil {
+		return fail(err)
+	}
+	return success(map[string]any{"id": node.Attrs["id"], "response": nodeToJSON(resp)})
+}
+
+//export WmClientSendIQ
+func WmClientSendIQ(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client    uint64         `json:"client"`
+		Namespace string         `json:"namespace"`
+		Type      string         `json:"type"` // get or set
+		To        string         `json:"to"`   // defaults to s.whatsapp.net
+		Target    string         `json:"target"`
+		Attrs     map[string]any `json:"attrs"`
+		Content   []jsonNode     `json:"content"`
+		TimeoutMs int64          `json:"timeout_ms"`
+		OpID      uint64         `json:"op_id"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	if payload.Namespace == "" {
+		return fail(errors.New("namespace is required"))
+	}
+	if payload.Type != "get" && payload.Type != "set" {
+		return fail(errors.New(`type must be "get" or "set"`))
+	}
+	cli, end, err := clientForRaw(payload.Client)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	iq := jsonNode{Tag: "iq", Attrs: map[string]any{}, Children: payload.Content}
+	maps.Copy(iq.Attrs, payload.Attrs)
+	iq.Attrs["xmlns"] = payload.Namespace
+	iq.Attrs["type"] = payload.Type
+	iq.Attrs["to"] = types.ServerJID.String()
+	if payload.To != "" {
+		iq.Attrs["to"] = payload.To
+	}
+	if payload.Target != "" {
+		iq.Attrs["target"] = payload.Target
+	}
+	node, err := iq.toNode()
+	if err != nil {
+		return fail(err)
+	}
+	id := cli.DangerousInternals().GenerateRequestID()
+	node.Attrs["id"] = id
+	resp, err := sendNodeAndWait(cli, node, rawTimeout(payload.TimeoutMs), payload.OpID)
+	if err != nil {
+		return fail(err)
+	}
+	return success(map[string]any{"id": id, "response": nodeToJSON(resp), "is_error": resp.Attrs["type"] == "error"})
+}
+
+func rawTimeout(ms int64) time.Duration {
+	if ms <= 0 {
+		return 75 * time.Second
+	}
+	return time.Duration(ms) * time.Millisecond
+}
@@ -0,0 +1,128 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Reactions are tallied in the container DB, one row per sender and target
+// message since a sender can only have one reaction on a message at a time.
+
+func trackReaction(cli *wa.Client, evt *events.Message) {
+	reaction, err := decryptedReaction(cli, evt)
+	if reaction == nil || err != nil {
+		return
+	}
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	ourJID := cli.Store.GetJID().ToNonAD().String()
+	target := types.MessageID(reaction.GetKey().GetID())
+	sender := evt.Info.Sender.ToNonAD().String()
+	if reaction.GetText() == "" {
+		_, err = db.db.ExecContext(ctx, `DELETE FROM wmnode_reactions WHERE our_jid=$1 AND chat=$2 AND message_id=$3 AND sender=$4`,
+			ourJID, evt.Info.Chat.String(), string(target), sender)
+	} else {
+		_, err = db.db.ExecContext(ctx, `
+			INSERT INTO wmnode_reactions (our_jid, chat, message_id, sender, emoji, timestamp)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (our_jid, chat, message_id, sender) DO UPDATE SET emoji=excluded.emoji, timestamp=excluded.timestamp
+		`, ourJID, evt.Info.Chat.String(), string(target), sender, reaction.GetText(), evt.Info.Timestamp.UnixMilli())
+	}
+	if err != nil {
+		cli.Log.Warnf("Failed to record reaction %s on %s: %v", evt.Info.ID, target, err)
+		return
+	}
+	summary, err := reactionSummary(ctx, db, ourJID, evt.Info.Chat, target)
+	if err != nil {
+		cli.Log.Warnf("Failed to load reactions of %s: %v", target, err)
+		return
+	}
+	summary["type"] = "reaction_summary"
+	summary["sender"] = sender
+	summary["emoji"] = reaction.GetText()
+	emitBridgeEvent(cli, summary)
+}
+
+// reactionSummary groups the reactions of a message by emoji, most used first.
+func reactionSummary(ctx context.Context, db *bridgeDB, ourJID string, chat types.JID, id types.MessageID) (map[string]any, error) {
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT emoji, sender FROM wmnode_reactions WHERE our_jid=$1 AND chat=$2 AND message_id=$3 ORDER BY timestamp`,
+		ourJID, chat.String(), string(id))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	type tally struct {
+		Emoji   string   `json:"emoji"`
+		Count   int      `json:"count"`
+		Senders []string `json:"senders"`
+	}
+	byEmoji := map[string]*tally{}
+	reactions := []*tally{}
+	total := 0
+	for rows.Next() {
+		var emoji, sender string
+		if err := rows.Scan(&emoji, &sender); err != nil {
+			return nil, err
+		}
+		t := byEmoji[emoji]
+		if t == nil {
+			t = &tally{Emoji: emoji}
+			byEmoji[emoji] = t
+			reactions = append(reactions, t)
+		}
+		t.Count++
+		t.Senders = append(t.Senders, sender)
+		total++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(reactions, func(i, j int) bool { return reactions[i].Count > reactions[j].Count })
+	return map[string]any{"chat": chat.String(), "message_id": string(id), "total": total, "reactions": reactions}, nil
+}
+
+//export WmGetReactions
+func WmGetReactions(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		Chat   string `json:"chat"`
+		ID     string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	chat, err := types.ParseJID(payload.Chat)
+	if err != nil {
+		return fail(err)
+	}
+	if payload.ID == "" {
+		return fail(errors.New("id is required"))
+	}
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return fail(err)
+	}
+	summary, err := reactionSummary(context.Background(), db, cli.Store.GetJID().ToNonAD().String(), chat, types.MessageID(payload.ID))
+	if err != nil {
+		return fail(err)
+	}
+	return success(summary)
+}
@@ -0,0 +1,267 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// whatsmeow reconnects on its own with a fixed linear delay and no visibility.
+// Once WmClientSetAutoReconnect is called the bridge takes over: whatsmeow's loop
+// is turned off and unexpected disconnects are retried here with the configured
+// backoff, reporting each step as reconnect_attempt / reconnect_failed /
+// reconnect_gave_up events. Clients that never call it keep whatsmeow's default,
+// and disabling it hands reconnects back to whatsmeow.
+// WmClientReconnectNow skips the current wait, or reconnects if no outage is being
+// handled.
+//
+// Every client also gets connection_state events with the state it moved to:
+// connecting (WmClientConnect), connected, disconnected, idle (idle.go), and
+// for outages the bridge handles reconnect_scheduled (with delay_ms),
+// reconnecting and gave_up, so a dashboard can follow a session without
+// inferring it from the rest.
+
+func emitConnectionState(cli *wa.Client, state string, fields map[string]any) {
+	cfg := configFor(cli)
+	cfg.mu.Lock()
+	cfg.connState = state
+	cfg.mu.Unlock()
+	ev := map[string]any{"type": "connection_state", "state": state}
+	maps.Copy(ev, fields)
+	emitBridgeEvent(cli, ev)
+}
+
+type reconnectPolicy struct {
+	InitialDelayMs int64   `json:"initial_delay_ms"`
+	MaxDelayMs     int64   `json:"max_delay_ms"`
+	Multiplier     float64 `json:"multiplier"`
+	Jitter         float64 `json:"jitter"`       // fraction of the delay, 0..1
+	MaxAttempts    int     `json:"max_attempts"` // 0 means unlimited
+}
+
+// delay returns the wait before the given attempt (starting at 1).
+func (p reconnectPolicy) delay(attempt int) time.Duration {
+	d := float64(p.InitialDelayMs) * math.Pow(p.Multiplier, float64(attempt-1))
+	d = min(d, float64(p.MaxDelayMs))
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(max(d, 0)) * time.Millisecond
+}
+
+type reconnector struct {
+	policy reconnectPolicy
+
+	mu      sync.Mutex
+	attempt int         // attempts since the last successful connection
+	active  bool        // an outage is being handled
+	gen     int         // bumped when a run starts or is cancelled, to drop stale attempts
+	timer   *time.Timer // fires the next attempt, set while waiting
+}
+
+func (cfg *clientConfig) reconnector() *reconnector {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.reconnect
+}
+
+func stopReconnect(cli *wa.Client) {
+	if r := configFor(cli).reconnector(); r != nil {
+		r.cancel()
+	}
+}
+
+func (r *reconnector) cancel() {
+	r.mu.Lock()
+	r.finishLocked()
+	r.mu.Unlock()
+}
+
+func (r *reconnector) finishLocked() {
+	r.active = false
+	r.gen++
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+}
+
+// resetReconnect is called on Connected so the next outage starts from the
+// initial delay. It returns the attempts the outage took.
+func resetReconnect(cli *wa.Client) int {
+	r := configFor(cli).reconnector()
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attempts := r.attempt
+	r.attempt = 0
+	return attempts
+}
+
+// autoReconnect starts handling an outage unless one is already being handled.
+// It's called from the event handler, so even the first step runs on the
+// reconnect pool; waits are timers.
+func autoReconnect(cli *wa.Client) {
+	r := configFor(cli).reconnector()
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.active {
+		r.mu.Unlock()
+		return
+	}
+	r.active = true
+	r.gen++
+	gen := r.gen
+	r.mu.Unlock()
+	submitReconnect(cli, func() { r.next(cli, gen) })
+}
+
+// next schedules the next attempt of run gen, or ends the run.
+// Events are emitted after r.mu is released.
+func (r *reconnector) next(cli *wa.Client, gen int) {
+	r.mu.Lock()
+	if r.gen != gen {
+		r.mu.Unlock()
+		return
+	}
+	if cli.Store.ID == nil || cli.IsConnected() {
+		r.finishLocked()
+		r.mu.Unlock()
+		return
+	}
+	r.attempt++
+	attempt := r.attempt
+	if r.policy.MaxAttempts > 0 && attempt > r.policy.MaxAttempts {
+		r.finishLocked()
+		r.mu.Unlock()
+		emitBridgeEvent(cli, map[string]any{"type": "reconnect_gave_up", "attempts": attempt - 1})
+		emitConnectionState(cli, "gave_up", map[string]any{"attempts": attempt - 1})
+		return
+	}
+	delay := r.policy.delay(attempt)
+	r.timer = time.AfterFunc(delay, func() {
+		submitReconnect(cli, func() { r.try(cli, gen, attempt) })
+	})
+	r.mu.Unlock()
+	emitBridgeEvent(cli, map[string]any{"type": "reconnect_attempt", "attempt": attempt, "delay_ms": delay.Milliseconds()})
+	emitConnectionState(cli, "reconnect_scheduled", map[string]any{"attempt": attempt, "delay_ms": delay.Milliseconds()})
+}
+
+func (r *reconnector) try(cli *wa.Client, gen, attempt int) {
+	r.mu.Lock()
+	if r.gen != gen || r.timer == nil {
+		r.mu.Unlock()
+		return
+	}
+	r.timer = nil
+	r.mu.Unlock()
+	emitConnectionState(cli, "reconnecting", map[string]any{"attempt": attempt})
+	cli.AutoReconnectErrors = attempt
+	err := connectClient(cli)
+	if err == nil || errors.Is(err, wa.ErrAlreadyConnected) {
+		r.mu.Lock()
+		if r.gen == gen {
+			r.finishLocked()
+		}
+		r.mu.Unlock()
+		return
+	}
+	emitBridgeEvent(cli, map[string]any{"type": "reconnect_failed", "attempt": attempt, "error": err.Error()})
+	r.next(cli, gen)
+}
+
+// wake runs the pending attempt now; false if no outage is being handled.
+func (r *reconnector) wake(cli *wa.Client) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.active {
+		return false
+	}
+	// a timer that already fired has its attempt queued or running
+	if r.timer != nil && r.timer.Stop() {
+		gen, attempt := r.gen, r.attempt
+		submitReconnect(cli, func() { r.try(cli, gen, attempt) })
+	}
+	return true
+}
+
+//export WmClientSetAutoReconnect
+func WmClientSetAutoReconnect(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client  uint64 `json:"client"`
+		Enabled bool   `json:"enabled"`
+		reconnectPolicy
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	policy := payload.reconnectPolicy
+	if policy.InitialDelayMs <= 0 {
+		policy.InitialDelayMs = 1000
+	}
+	if policy.MaxDelayMs <= 0 {
+		policy.MaxDelayMs = 120_000
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = 2
+	}
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		return fail(errors.New("jitter must be between 0 and 1"))
+	}
+	stopReconnect(cli)
+	cli.EnableAutoReconnect = !payload.Enabled
+	cfg := configFor(cli)
+	cfg.mu.Lock()
+	cfg.reconnect = nil
+	if payload.Enabled {
+		cfg.reconnect = &reconnector{policy: policy}
+	}
+	cfg.mu.Unlock()
+	if !payload.Enabled {
+		return success(map[string]any{"enabled": false})
+	}
+	return success(map[string]any{"enabled": true, "policy": policy})
+}
+
+//export WmClientReconnectNow
+func WmClientReconnectNow(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if r := configFor(cli).reconnector(); r != nil && r.wake(cli) {
+		return success(map[string]any{"woke_loop": true})
+	}
+	cli.Disconnect()
+	emitConnectionState(cli, "connecting", nil)
+	if err := connectClient(cli); err != nil {
+		return fail(err)
+	}
+	return success(map[string]any{"woke_loop": false})
+}
@@ -0,0 +1,303 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Messages the server only has a placeholder for (undecryptable_message with
+// is_unavailable, mostly from linked-device sessions) can be asked for again
+// from our phone, which re-sends them as a peer message; whatsmeow delivers the
+// copy as a regular message event carrying unavailable_request_id. With
+// WmClientSetMessageRecovery in auto mode the bridge takes over whatsmeow's
+// own re-request: each unavailable message is requested after delay_ms and
+// again every retry_after_ms until it arrives (message_recovered, linked to
+// the original by chat and message_id) or max_attempts requests went
+// unanswered (message_recovery_failed). WmRequestUnavailableMessage starts the
+// same flow for one message.
+
+type recoveryPolicy struct {
+	Auto         bool  `json:"auto"`
+	DelayMs      int64 `json:"delay_ms"`
+	RetryAfterMs int64 `json:"retry_after_ms"`
+	MaxAttempts  int   `json:"max_attempts"`
+}
+
+func (p *recoveryPolicy) applyDefaults() {
+	if p.DelayMs <= 0 {
+		p.DelayMs = 5000
+	}
+	if p.RetryAfterMs <= 0 {
+		p.RetryAfterMs = 30_000
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+}
+
+type pendingRecovery struct {
+	chat      types.JID
+	sender    types.JID
+	id        types.MessageID
+	attempts  int
+	requestID types.MessageID // of the latest request
+	started   time.Time
+	timer     *time.Timer
+}
+
+type messageRecovery struct {
+	policy recoveryPolicy
+
+	mu      sync.Mutex
+	pending map[string]*pendingRecovery // by recoveryKey
+}
+
+func recoveryKey(chat types.JID, id types.MessageID) string {
+	return chat.ToNonAD().String() + "|" + string(id)
+}
+
+func (cfg *clientConfig) messageRecovery() *messageRecovery {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.recovery
+}
+
+// recoveryFor returns the client's recovery state, creating a manual-only one
+// with the default policy if recovery was never configured.
+func recoveryFor(cli *wa.Client) *messageRecovery {
+	cfg := configFor(cli)
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	if cfg.recovery == nil {
+		policy := recoveryPolicy{}
+		policy.applyDefaults()
+		cfg.recovery = &messageRecovery{policy: policy, pending: map[string]*pendingRecovery{}}
+	}
+	return cfg.recovery
+}
+
+func (r *messageRecovery) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, p := range r.pending {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+		delete(r.pending, key)
+	}
+}
+
+func stopMessageRecovery(cli *wa.Client) {
+	if r := configFor(cli).messageRecovery(); r != nil {
+		r.stop()
+	}
+}
+
+// track starts recovering a message unless it already is. The first request
+// is sent after delay, or left to the caller if delay is 0.
+func (r *messageRecovery) track(cli *wa.Client, chat, sender types.JID, id types.MessageID, delay time.Duration) string {
+	key := recoveryKey(chat, id)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending[key] != nil {
+		return key
+	}
+	p := &pendingRecovery{chat: chat, sender: sender, id: id, started: time.Now()}
+	if delay > 0 {
+		p.timer = time.AfterFunc(delay, func() {
+			submitTask(cli, func() { _, _ = r.attempt(cli, key) })
+		})
+	}
+	r.pending[key] = p
+	return key
+}
+
+// attempt sends the next request for a pending message, or gives up on it.
+// It returns the request's ID.
+func (r *messageRecovery) attempt(cli *wa.Client, key string) (types.MessageID, error) {
+	r.mu.Lock()
+	p := r.pending[key]
+	if p == nil {
+		r.mu.Unlock()
+		return "", nil
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	if p.attempts >= r.policy.MaxAttempts {
+		delete(r.pending, key)
+		ev := map[string]any{
+			"type":       "message_recovery_failed",
+			"chat":       p.chat.String(),
+			"sender":     p.sender.String(),
+			"message_id": string(p.id),
+			"attempts":   p.attempts,
+		}
+		if p.requestID != "" {
+			ev["request_id"] = string(p.requestID)
+		}
+		r.mu.Unlock()
+		emitBridgeEvent(cli, ev)
+		return "", nil
+	}
+	p.attempts++
+	p.timer = time.AfterFunc(time.Duration(r.policy.RetryAfterMs)*time.Millisecond, func() {
+		submitTask(cli, func() { _, _ = r.attempt(cli, key) })
+	})
+	r.mu.Unlock()
+	requestID, err := requestFromPhone(cli, p.chat, p.sender, p.id)
+	if err != nil {
+		cli.Log.Warnf("Failed to request unavailable message %s from phone: %v", p.id, err)
+		return "", err
+	}
+	r.mu.Lock()
+	p.requestID = requestID
+	r.mu.Unlock()
+	return requestID, nil
+}
+
+func requestFromPhone(cli *wa.Client, chat, sender types.JID, id types.MessageID) (types.MessageID, error) {
+	ownID := cli.Store.GetJID()
+	if ownID.IsEmpty() {
+		return "", wa.ErrNotLoggedIn
+	}
+	msg := cli.BuildUnavailableMessageRequest(chat, sender, id)
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	resp, err := cli.SendMessage(ctx, ownID.ToNonAD(), msg, wa.SendRequestExtra{Peer: true})
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// recoverUnavailable starts the automatic recovery of an unavailable message.
+func recoverUnavailable(cli *wa.Client, evt *events.UndecryptableMessage) {
+	r := configFor(cli).messageRecovery()
+	if r == nil || !r.policy.Auto || !evt.IsUnavailable {
+		return
+	}
+	r.track(cli, evt.Info.Chat, evt.Info.Sender, evt.Info.ID, time.Duration(r.policy.DelayMs)*time.Millisecond)
+}
+
+// linkRecoveredMessage reports a message re-delivered by the phone and ends
+// its recovery.
+func linkRecoveredMessage(cli *wa.Client, evt *events.Message) {
+	if evt.UnavailableRequestID == "" {
+		return
+	}
+	ev := map[string]any{
+		"type":       "message_recovered",
+		"chat":       evt.Info.Chat.String(),
+		"sender":     evt.Info.Sender.String(),
+		"message_id": string(evt.Info.ID),
+		"request_id": string(evt.UnavailableRequestID),
+		"managed":    false,
+	}
+	if r := configFor(cli).messageRecovery(); r != nil {
+		key := recoveryKey(evt.Info.Chat, evt.Info.ID)
+		r.mu.Lock()
+		if p := r.pending[key]; p != nil {
+			if p.timer != nil {
+				p.timer.Stop()
+			}
+			delete(r.pending, key)
+			ev["managed"] = true
+			ev["attempts"] = p.attempts
+			ev["elapsed_ms"] = time.Since(p.started).Milliseconds()
+		}
+		r.mu.Unlock()
+	}
+	emitBridgeEvent(cli, ev)
+}
+
+//export WmClientSetMessageRecovery
+func WmClientSetMessageRecovery(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client  uint64 `json:"client"`
+		Enabled bool   `json:"enabled"`
+		recoveryPolicy
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	stopMessageRecovery(cli)
+	cfg := configFor(cli)
+	cfg.mu.Lock()
+	cfg.recovery = nil
+	if payload.Enabled {
+		policy := payload.recoveryPolicy
+		policy.applyDefaults()
+		cfg.recovery = &messageRecovery{policy: policy, pending: map[string]*pendingRecovery{}}
+	}
+	if payload.Enabled && payload.Auto {
+		// the bridge requests them now, don't ask twice
+		if cfg.phoneRerequest == nil {
+			prev := cli.AutomaticMessageRerequestFromPhone
+			cfg.phoneRerequest = &prev
+		}
+		cli.AutomaticMessageRerequestFromPhone = false
+	} else if cfg.phoneRerequest != nil {
+		cli.AutomaticMessageRerequestFromPhone = *cfg.phoneRerequest
+		cfg.phoneRerequest = nil
+	}
+	cfg.mu.Unlock()
+	if !payload.Enabled {
+		return success(map[string]any{"enabled": false})
+	}
+	return success(map[string]any{"enabled": true, "policy": cfg.messageRecovery().policy})
+}
+
+//export WmRequestUnavailableMessage
+func WmRequestUnavailableMessage(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		Chat   string `json:"chat"`
+		Sender string `json:"sender"`
+		ID     string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	chat, err := types.ParseJID(payload.Chat)
+	if err != nil {
+		return fail(err)
+	}
+	sender, err := types.ParseJID(payload.Sender)
+	if err != nil {
+		return fail(err)
+	}
+	if payload.ID == "" {
+		return fail(errors.New("id is required"))
+	}
+	// an already pending message is requested again right away
+	r := recoveryFor(cli)
+	key := r.track(cli, chat, sender, types.MessageID(payload.ID), 0)
+	requestID, err := r.attempt(cli, key)
+	if err != nil {
+		return fail(err)
+	} else if requestID == "" {
+		return fail(errors.New("gave up on the message after max_attempts requests"))
+	}
+	return success(map[string]any{"request_id": string(requestID)})
+}
@@ -0,0 +1,90 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// When a contact keeps failing to decrypt our messages, WmClientResetSession
+// drops our Signal sessions with all their devices (under both the phone number
+// and the LID) and, unless probe is false, sends a message that apps don't show
+// (the removal of a reaction to a message that doesn't exist), so the fresh
+// sessions are established right away with pre-key messages instead of on the
+// next real message. The probe goes through the send gate like other sends.
+
+//export WmClientResetSession
+func WmClientResetSession(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		JID    string `json:"jid"`
+		// defaults to true
+		Probe *bool `json:"probe"`
+		// also forget the stored identity keys
+		Identity bool `json:"identity"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	jid, err := types.ParseJID(payload.JID)
+	if err != nil {
+		return fail(err)
+	}
+	user := jid.ToNonAD()
+	if user.Server != types.DefaultUserServer && user.Server != types.HiddenUserServer {
+		return fail(errors.New("jid must be a user"))
+	}
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	forms := []types.JID{user}
+	var other types.JID
+	if user.Server == types.DefaultUserServer {
+		other, _ = cli.Store.LIDs.GetLIDForPN(ctx, user)
+	} else {
+		other, _ = cli.Store.LIDs.GetPNForLID(ctx, user)
+	}
+	if !other.IsEmpty() {
+		forms = append(forms, other.ToNonAD())
+	}
+	reset := make([]string, 0, len(forms))
+	for _, form := range forms {
+		if err = cli.Store.Sessions.DeleteAllSessions(ctx, form.SignalAddressUser()); err != nil {
+			return fail(err)
+		}
+		if payload.Identity {
+			if err = cli.Store.Identities.DeleteAllIdentities(ctx, form.SignalAddressUser()); err != nil {
+				return fail(err)
+			}
+		}
+		reset = append(reset, form.String())
+	}
+	out := map[string]any{"reset": reset, "probe": nil}
+	if payload.Probe != nil && !*payload.Probe {
+		return success(out)
+	}
+	own := cli.Store.GetJID().ToNonAD()
+	msg := cli.BuildReaction(user, own, cli.GenerateMessageID(), "")
+	if err = throttleSend(ctx, cli, user); err != nil {
+		return fail(fmt.Errorf("sessions reset, probe not sent: %w", err))
+	}
+	resp, err := cli.SendMessage(ctx, user, msg, sendExtra(cli, nil, "")...)
+	if err != nil {
+		return fail(fmt.Errorf("sessions reset, probe failed: %w", err))
+	}
+	enc, err := encodeReturn(reflect.ValueOf(resp))
+	if err != nil {
+		return fail(err)
+	}
+	out["probe"] = enc
+	return success(out)
+}
@@ -0,0 +1,254 @@
+package main
+
+import "C"
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WmRestServerStart serves the bridge over HTTP for processes that can't load
+// it through FFI, or several Node workers sharing the sessions of one bridge:
+//
+//	GET  /v1                                   names of the callable functions
+//	POST /v1/{function}                        an export, e.g. /v1/WmClientSendPresence;
+//	                                           the body is its JSON payload
+//	POST /v1/clients/{client}/methods/{method} WmClientCall, the body is the args
+//	GET  /v1/clients/{client}/events           WebSocket event push, see wsevents.go
+//
+// Every request needs "Authorization: Bearer <token>". Responses are the usual
+// {ok, data | error} objects, with status 400 when ok is false. Responses
+// compressed by WmSetCompression are sent with Content-Encoding instead.
+//
+// Exports in restHiddenExports can't be called over HTTP: they manage the
+// bridge itself, write files at paths the caller picks, or take over a
+// device's key storage, so a leaked token would reach well beyond the sessions.
+
+const maxRestBody = 64 << 20
+
+var restHiddenExports = map[string]bool{
+	// lifecycle
+	"WmShutdown":        true,
+	"WmRestServerStart": true,
+	"WmRelease":         true,
+	"WmOpenContainer":   true,
+	// files and sockets on the host
+	"WmEventSocketListen":     true,
+	"WmClientSetLogSink":      true,
+	"WmClientSetStanzaTap":    true,
+	"WmClientSetAutoDownload": true,
+	"WmHistoryMediaJobStart":  true,
+	// key storage
+	"WmStoreBackendCreate":    true,
+	"WmStoreNext":             true,
+	"WmStoreRespond":          true,
+	"WmDeviceUseStoreBackend": true,
+}
+
+// restCallable reports whether the REST server exposes the export name.
+func restCallable(name string) bool {
+	_, ok := exportsByName[name]
+	return ok && !restHiddenExports[name]
+}
+
+type restServer struct {
+	srv   *http.Server
+	addr  string
+	token []byte
+	// ctx is the base of request contexts; cancelled on close to end WebSockets
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+var (
+	restServersMu sync.RWMutex
+	restServers   = map[handle]*restServer{}
+)
+
+func (s *restServer) close() {
+	s.cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.srv.Shutdown(ctx); err != nil {
+		_ = s.srv.Close()
+	}
+}
+
+func (s *restServer) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok && websocket.IsWebSocketUpgrade(r) {
+		token, ok = r.URL.Query().Get("access_token"), true
+	}
+	return ok && subtle.ConstantTimeCompare([]byte(token), s.token) == 1
+}
+
+func (s *restServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1", func(w http.ResponseWriter, r *http.Request) {
+		names := slices.DeleteFunc(slices.Sorted(maps.Keys(exportsByName)), func(name string) bool {
+			return restHiddenExports[name]
+		})
+		writeRestResponse(w, mustMarshal(jsonResp{Ok: true, Data: map[string]any{"functions": names}}))
+	})
+	mux.HandleFunc("POST /v1/{function}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("function")
+		if !restCallable(name) {
+			restError(w, http.StatusNotFound, "unknown function "+name)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			restError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		if len(bytes.TrimSpace(body)) == 0 {
+			body = []byte("{}")
+		}
+		writeRestResponse(w, callByName(name, body))
+	})
+	mux.HandleFunc("POST /v1/clients/{client}/methods/{method}", func(w http.ResponseWriter, r *http.Request) {
+		client, err := strconv.ParseUint(r.PathValue("client"), 10, 64)
+		if err != nil {
+			restError(w, http.StatusBadRequest, "invalid client handle")
+			return
+		}
+		args, err := io.ReadAll(r.Body)
+		if err != nil {
+			restError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		if len(bytes.TrimSpace(args)) == 0 {
+			args = []byte("null")
+		}
+		var opID uint64
+		if v := r.URL.Query().Get("op_id"); v != "" {
+			if opID, err = strconv.ParseUint(v, 10, 64); err != nil {
+				restError(w, http.StatusBadRequest, "invalid op_id")
+				return
+			}
+		}
+		input, _ := json.Marshal(map[string]any{
+			"client": client,
+			"method": r.PathValue("method"),
+			"args":   json.RawMessage(args),
+			"op_id":  opID,
+		})
+		writeRestResponse(w, callByName("WmClientCall", input))
+	})
+	mux.HandleFunc("GET /v1/clients/{client}/events", serveEventsWebSocket)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			restError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxRestBody)
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func mustMarshal(v any) []byte {
+	b, _ := json.Marshal(v)
+	return b
+}
+
+func restError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(mustMarshal(jsonResp{Ok: false, Error: msg}))
+}
+
+// writeRestResponse writes a call's output, turning bridge compression into
+// Content-Encoding.
+func writeRestResponse(w http.ResponseWriter, out []byte) {
+	h := w.Header()
+	h.Set("Content-Type", "application/json")
+	switch {
+	case bytes.HasPrefix(out, []byte{0x1f, 0x8b}):
+		h.Set("Content-Encoding", "gzip")
+	case bytes.HasPrefix(out, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		h.Set("Content-Encoding", "zstd")
+	case bytes.HasPrefix(out, []byte(`{"encoding":"`)):
+		var env struct {
+			Encoding string `json:"encoding"`
+			Payload  []byte `json:"payload"`
+		}
+		if json.Unmarshal(out, &env) == nil {
+			h.Set("Content-Encoding", env.Encoding)
+			out = env.Payload
+		}
+	case bytes.HasPrefix(out, []byte(`{"ok":false`)):
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	_, _ = w.Write(out)
+}
+
+//export WmRestServerStart
+func WmRestServerStart(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Addr     string `json:"addr"`
+		Token    string `json:"token"`
+		CertFile string `json:"cert_file"`
+		KeyFile  string `json:"key_file"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	if payload.Token == "" {
+		return fail(errors.New("token is required"))
+	}
+	if (payload.CertFile == "") != (payload.KeyFile == "") {
+		return fail(errors.New("cert_file and key_file must be set together"))
+	}
+	if payload.Addr == "" {
+		payload.Addr = "127.0.0.1:0"
+	}
+	var tlsConfig *tls.Config
+	if payload.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(payload.CertFile, payload.KeyFile)
+		if err != nil {
+			return fail(err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	ln, err := net.Listen("tcp", payload.Addr)
+	if err != nil {
+		return fail(err)
+	}
+	s := &restServer{addr: ln.Addr().String(), token: []byte(payload.Token)}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.srv = &http.Server{
+		Handler:           s.handler(),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return s.ctx },
+	}
+	h := newHandle()
+	restServersMu.Lock()
+	restServers[h] = s
+	restServersMu.Unlock()
+	go func() {
+		if tlsConfig != nil {
+			_ = s.srv.ServeTLS(ln, "", "")
+		} else {
+			_ = s.srv.Serve(ln)
+		}
+	}()
+	return success(map[string]any{"handle": uint64(h), "addr": s.addr, "tls": tlsConfig != nil})
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestRestHiddenExportsExist(t *testing.T) {
+	for name := range restHiddenExports {
+		if _, ok := exportsByName[name]; !ok {
+			t.Errorf("hidden export %s isn't in exportsByName", name)
+		}
+	}
+}
+
+func TestRestCallable(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"WmClientSendPresence", true},
+		{"WmClientCall", false}, // binary only, served by /v1/clients/{client}/methods
+		{"WmShutdown", false},
+		{"WmOpenContainer", false},
+		{"WmClientSetLogSink", false},
+		{"WmEventSocketListen", false},
+		{"WmNoSuchExport", false},
+	}
+	for _, tt := range tests {
+		if got := restCallable(tt.name); got != tt.want {
+			t.Errorf("restCallable(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Retry receipts ask us to re-encrypt and resend a message the recipient failed
+// to decrypt. With a retry policy set, every such request is reported as a
+// retry_receipt event and may be denied, either by a retry count limit or, in
+// "ask" mode, by Node answering the event's decision_id.
+//
+// Retry receipts are also counted per chat, whether a policy is set or not:
+// incoming ones, outgoing ones (sent by whatsmeow for every message we fail to
+// decrypt), resends and denials, read with WmClientGetRetryStats. A policy can
+// cap the resends to a peer within window_ms, and report peers whose retries
+// in either direction reach alert_threshold within the window as a
+// retry_threshold_exceeded event, which usually means a broken session.
+
+const (
+	retryPolicyObserve = "observe"
+	retryPolicyAsk     = "ask"
+)
+
+type retryPolicy struct {
+	Mode       string `json:"mode"`
+	MaxRetries int    `json:"max_retries"` // deny retries above this count, 0 means no limit
+	TimeoutMs  int    `json:"timeout_ms"`  // ask mode: how long to wait before allowing
+	// deny resends to a peer beyond this many within the window, 0 means no limit
+	MaxPerPeer     int   `json:"max_per_peer"`
+	AlertThreshold int   `json:"alert_threshold"` // 0 disables retry_threshold_exceeded
+	WindowMs       int64 `json:"window_ms"`
+}
+
+type chatRetryStats struct {
+	Incoming int   `json:"incoming"`
+	Outgoing int   `json:"outgoing"`
+	Resent   int   `json:"resent"`
+	Denied   int   `json:"denied"`
+	LastMs   int64 `json:"last_ms"`
+}
+
+// retryStats counts the retries of a client. Peer windows hold the times of
+// recent retries by peer (user JID) and direction.
+type retryStats struct {
+	mu      sync.Mutex
+	policy  *retryPolicy
+	chats   map[string]*chatRetryStats
+	windows map[string][]time.Time
+	alerted map[string]time.Time // when a peer window last raised an alert
+}
+
+func (cfg *clientConfig) retryStats() *retryStats {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	if cfg.retries == nil {
+		cfg.retries = &retryStats{chats: map[string]*chatRetryStats{}, windows: map[string][]time.Time{}, alerted: map[string]time.Time{}}
+	}
+	return cfg.retries
+}
+
+func (rs *retryStats) chatLocked(chat types.JID) *chatRetryStats {
+	st := rs.chats[chat.String()]
+	if st == nil {
+		st = &chatRetryStats{}
+		rs.chats[chat.String()] = st
+	}
+	st.LastMs = time.Now().UnixMilli()
+	return st
+}
+
+// windowLocked adds now to a peer window, if add is set, and returns how many
+// entries are within the window.
+func (rs *retryStats) windowLocked(key string, add bool) int {
+	window := 10 * time.Minute
+	if rs.policy != nil && rs.policy.WindowMs > 0 {
+		window = time.Duration(rs.policy.WindowMs) * time.Millisecond
+	}
+	now := time.Now()
+	times := rs.windows[key]
+	i := 0
+	for i < len(times) && now.Sub(times[i]) > window {
+		i++
+	}
+	times = times[i:]
+	if add {
+		times = append(times, now)
+	}
+	if len(times) == 0 {
+		delete(rs.windows, key)
+	} else {
+		rs.windows[key] = times
+	}
+	return len(times)
+}
+
+// record counts a retry receipt in direction "incoming" or "outgoing" and
+// raises an alert when the peer crosses the threshold.
+func (rs *retryStats) record(cli *wa.Client, chat, peer types.JID, direction string) {
+	rs.mu.Lock()
+	st := rs.chatLocked(chat)
+	if direction == "incoming" {
+		st.Incoming++
+	} else {
+		st.Outgoing++
+	}
+	key := direction + "|" + peer.ToNonAD().String()
+	count := rs.windowLocked(key, true)
+	var ev map[string]any
+	if p := rs.policy; p != nil && p.AlertThreshold > 0 && count >= p.AlertThreshold {
+		window := time.Duration(p.WindowMs) * time.Millisecond
+		if last, ok := rs.alerted[key]; !ok || time.Since(last) > window {
+			rs.alerted[key] = time.Now()
+			ev = map[string]any{
+				"type":      "retry_threshold_exceeded",
+				"peer":      peer.ToNonAD().String(),
+				"chat":      chat.String(),
+				"direction": direction,
+				"count":     count,
+				"window_ms": p.WindowMs,
+			}
+		}
+	}
+	rs.mu.Unlock()
+	if ev != nil {
+		emitBridgeEvent(cli, ev)
+	}
+}
+
+// recordRetryEvent counts the retry receipts whatsmeow reports: received
+// retry receipts and the ones it sends for undecryptable messages.
+func recordRetryEvent(cli *wa.Client, raw any) {
+	switch evt := raw.(type) {
+	case *events.Receipt:
+		if evt.Type != types.ReceiptTypeRetry {
+			return
+		}
+		rs := configFor(cli).retryStats()
+		for range evt.MessageIDs {
+			rs.record(cli, evt.Chat, evt.Sender, "incoming")
+		}
+	case *events.UndecryptableMessage:
+		if evt.IsUnavailable {
+			return
+		}
+		configFor(cli).retryStats().record(cli, evt.Info.Chat, evt.Info.Sender, "outgoing")
+	}
+}
+
+// allowResend applies the per-peer cap, counting the resend if allowed.
+func (rs *retryStats) allowResend(chat, peer types.JID) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	st := rs.chatLocked(chat)
+	key := "resent|" + peer.ToNonAD().String()
+	if p := rs.policy; p != nil && p.MaxPerPeer > 0 && rs.windowLocked(key, false) >= p.MaxPerPeer {
+		st.Denied++
+		return false
+	}
+	rs.windowLocked(key, true)
+	st.Resent++
+	return true
+}
+
+func (rs *retryStats) countDenied(chat types.JID) {
+	rs.mu.Lock()
+	rs.chatLocked(chat).Denied++
+	rs.mu.Unlock()
+}
+
+func (p retryPolicy) callback(cli *wa.Client) func(*events.Receipt, types.MessageID, int, *waE2E.Message) bool {
+	return func(receipt *events.Receipt, id types.MessageID, retryCount int, msg *waE2E.Message) bool {
+		ev := map[string]any{
+			"type":        "retry_receipt",
+			"chat":        receipt.Chat.String(),
+			"sender":      receipt.Sender.String(),
+			"message_id":  string(id),
+			"retry_count": retryCount,
+			"has_message": msg != nil,
+		}
+		rs := configFor(cli).retryStats()
+		if p.MaxRetries > 0 && retryCount > p.MaxRetries {
+			rs.countDenied(receipt.Chat)
+			ev["allowed"] = false
+			ev["reason"] = "max_retries"
+			emitBridgeEvent(cli, ev)
+			return false
+		}
+		if p.Mode == retryPolicyAsk {
+			if !awaitDecision(cli, ev, time.Duration(p.TimeoutMs)*time.Millisecond, true) {
+				rs.countDenied(receipt.Chat)
+				return false
+			}
+			// the peer cap still applies to resends Node allowed
+			return rs.allowResend(receipt.Chat, receipt.Sender)
+		}
+		if !rs.allowResend(receipt.Chat, receipt.Sender) {
+			ev["allowed"] = false
+			ev["reason"] = "max_per_peer"
+			emitBridgeEvent(cli, ev)
+			return false
+		}
+		ev["allowed"] = true
+		emitBridgeEvent(cli, ev)
+		return true
+	}
+}
+
+//export WmClientSetRetryPolicy
+func WmClientSetRetryPolicy(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client  uint64 `json:"client"`
+		Enabled bool   `json:"enabled"`
+		retryPolicy
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	rs := configFor(cli).retryStats()
+	if !payload.Enabled {
+		cli.PreRetryCallback = nil
+		rs.mu.Lock()
+		rs.policy = nil
+		rs.mu.Unlock()
+		return success(map[string]any{"enabled": false})
+	}
+	switch payload.Mode {
+	case "":
+		payload.Mode = retryPolicyObserve
+	case retryPolicyObserve, retryPolicyAsk:
+	default:
+		return fail(fmt.Errorf("unknown retry policy mode: %s", payload.Mode))
+	}
+	if payload.TimeoutMs <= 0 {
+		payload.TimeoutMs = 5000
+	}
+	if payload.WindowMs <= 0 {
+		payload.WindowMs = 600_000
+	}
+	policy := payload.retryPolicy
+	rs.mu.Lock()
+	rs.policy = &policy
+	rs.mu.Unlock()
+	cli.PreRetryCallback = policy.callback(cli)
+	return success(map[string]any{
+		"enabled": true, "mode": policy.Mode, "max_retries": policy.MaxRetries, "timeout_ms": policy.TimeoutMs,
+		"max_per_peer": policy.MaxPerPeer, "alert_threshold": policy.AlertThreshold, "window_ms": policy.WindowMs,
+	})
+}
+
+//export WmClientGetRetryStats
+func WmClientGetRetryStats(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		// only this chat
+		Chat string `json:"chat"`
+		// clear the counters after reading them
+		Reset bool `json:"reset"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	rs := configFor(cli).retryStats()
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	var total chatRetryStats
+	chats := []map[string]any{}
+	for chat, st := range rs.chats {
+		if payload.Chat != "" && chat != payload.Chat {
+			continue
+		}
+		total.Incoming += st.Incoming
+		total.Outgoing += st.Outgoing
+		total.Resent += st.Resent
+		total.Denied += st.Denied
+		total.LastMs = max(total.LastMs, st.LastMs)
+		chats = append(chats, map[string]any{
+			"chat": chat, "incoming": st.Incoming, "outgoing": st.Outgoing,
+			"resent": st.Resent, "denied": st.Denied, "last_ms": st.LastMs,
+		})
+		if payload.Reset {
+			delete(rs.chats, chat)
+		}
+	}
+	sort.Slice(chats, func(i, j int) bool { return chats[i]["last_ms"].(int64) > chats[j]["last_ms"].(int64) })
+	return success(map[string]any{"total": total, "chats": chats})
+}
@@ -0,0 +1,141 @@
+package main
+
+import "C"
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.mau.fi/libsignal/state/record"
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// The security code shown on a contact's encryption screen is Signal's numeric
+// fingerprint: 30 digits derived from each side's phone number and identity
+// key, the lower one first. WmClientGetSafetyNumber computes it the same way, so
+// both ends see the same 60 digits once the keys match. The contact's key is
+// the one of the Signal session with their primary device, so there must have
+// been a message exchanged; without a jid only our own half is returned.
+
+const (
+	fingerprintVersion    = 0
+	fingerprintIterations = 5200
+)
+
+// numericFingerprint returns the 30 digit fingerprint of one side.
+func numericFingerprint(identifier string, pub [32]byte) string {
+	key := append([]byte{0x05}, pub[:]...) // DJB type prefix of serialized keys
+	hash := append([]byte{0, fingerprintVersion}, key...)
+	hash = append(hash, identifier...)
+	for range fingerprintIterations {
+		h := sha512.New()
+		h.Write(hash)
+		h.Write(key)
+		hash = h.Sum(nil)
+	}
+	var sb strings.Builder
+	for i := 0; i < 30; i += 5 {
+		chunk := uint64(hash[i])<<32 | uint64(hash[i+1])<<24 | uint64(hash[i+2])<<16 | uint64(hash[i+3])<<8 | uint64(hash[i+4])
+		fmt.Fprintf(&sb, "%05d", chunk%100000)
+	}
+	return sb.String()
+}
+
+// groupDigits splits a safety number in the blocks of 5 the apps display.
+func groupDigits(digits string) string {
+	blocks := make([]string, 0, len(digits)/5)
+	for i := 0; i+5 <= len(digits); i += 5 {
+		blocks = append(blocks, digits[i:i+5])
+	}
+	return strings.Join(blocks, " ")
+}
+
+// remoteIdentityKey returns the identity key of the session with the primary
+// device of user, under its phone number or LID address.
+func remoteIdentityKey(ctx context.Context, cli *wa.Client, user types.JID) ([32]byte, error) {
+	candidates := []types.JID{user}
+	if lid, err := cli.Store.LIDs.GetLIDForPN(ctx, user); err == nil && !lid.IsEmpty() {
+		candidates = append(candidates, lid.ToNonAD())
+	}
+	for _, jid := range candidates {
+		data, err := cli.Store.Sessions.GetSession(ctx, jid.SignalAddress().String())
+		if err != nil {
+			return [32]byte{}, err
+		} else if len(data) == 0 {
+			continue
+		}
+		sess, err := record.NewSessionFromBytes(data, store.SignalProtobufSerializer.Session, store.SignalProtobufSerializer.State)
+		if err != nil {
+			return [32]byte{}, fmt.Errorf("failed to parse session with %s: %w", jid, err)
+		}
+		if key := sess.SessionState().RemoteIdentityKey(); key != nil {
+			return key.PublicKey().PublicKey(), nil
+		}
+	}
+	return [32]byte{}, fmt.Errorf("no Signal session with %s yet, a message must be exchanged first", user)
+}
+
+//export WmClientGetSafetyNumber
+func WmClientGetSafetyNumber(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		JID    string `json:"jid"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	own := cli.Store.GetJID()
+	if own.IsEmpty() {
+		return fail(wa.ErrNotLoggedIn)
+	}
+	ownPub := *cli.Store.IdentityKey.Pub
+	local := numericFingerprint(own.User, ownPub)
+	out := map[string]any{
+		"own": map[string]any{
+			"jid":          own.ToNonAD().String(),
+			"fingerprint":  local,
+			"identity_key": hex.EncodeToString(ownPub[:]),
+		},
+	}
+	if payload.JID == "" {
+		return success(out)
+	}
+	jid, err := types.ParseJID(payload.JID)
+	if err != nil {
+		return fail(err)
+	}
+	ctx := context.Background()
+	// the fingerprint is keyed by the phone number
+	user := identityUser(ctx, cli, jid)
+	if user.Server != types.DefaultUserServer {
+		return fail(fmt.Errorf("phone number of %s is unknown", jid))
+	}
+	pub, err := remoteIdentityKey(ctx, cli, user)
+	if err != nil {
+		return fail(err)
+	}
+	remote := numericFingerprint(user.User, pub)
+	number := local + remote
+	if remote < local {
+		number = remote + local
+	}
+	out["contact"] = map[string]any{
+		"jid":          user.String(),
+		"fingerprint":  remote,
+		"identity_key": hex.EncodeToString(pub[:]),
+	}
+	out["safety_number"] = number
+	out["display"] = groupDigits(number)
+	return success(out)
+}
@@ -0,0 +1,222 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sync"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// Background work the bridge starts for a client (pre-key checks, call
+// auto-rejects, auto-downloads, message recovery) runs on a shared, bounded
+// pool instead of a goroutine per task. Every client has its own FIFO; idle
+// workers take the next task from the client at the front of the ready ring
+// and put it back at the end, so a client with a burst of tasks can't starve
+// the others, and at most maxPerClient of one client's tasks run at once.
+// Workers exit when there's nothing left to do. Reconnect attempts run on a
+// pool of their own, one at a time per client, so a backlog of downloads
+// can't hold a session offline. Waits (reconnect backoff) are timers that
+// submit a task when they fire.
+//
+// Only these tasks are pooled; nothing long-lived is multiplexed. QR codes and
+// events cost no bridge goroutine while the caller pulls them (WmQRNext,
+// WmEventNext), but whatsmeow's own socket, keepalive and QR goroutines still
+// run per client, newsletter live update renewals per subscription, and event
+// socket and websocket connections hold goroutines of their own while open.
+
+type taskQueue struct {
+	tasks   []func()
+	running int
+	ready   bool // in scheduler.ready
+}
+
+type scheduler struct {
+	mu           sync.Mutex
+	queues       map[*wa.Client]*taskQueue
+	ready        []*wa.Client
+	workers      int
+	busy         int // workers running a task
+	maxWorkers   int
+	maxPerClient int
+	completed    uint64
+	panics       uint64
+}
+
+var (
+	tasks = &scheduler{
+		queues:       map[*wa.Client]*taskQueue{},
+		maxWorkers:   max(16, 4*runtime.GOMAXPROCS(0)),
+		maxPerClient: 4,
+	}
+	reconnectTasks = &scheduler{
+		queues:       map[*wa.Client]*taskQueue{},
+		maxWorkers:   max(16, 4*runtime.GOMAXPROCS(0)),
+		maxPerClient: 1,
+	}
+)
+
+// submitTask queues fn to run on the pool on behalf of cli.
+func submitTask(cli *wa.Client, fn func()) {
+	tasks.submit(cli, fn)
+}
+
+// submitReconnect queues a reconnect step of cli on the reconnect pool.
+func submitReconnect(cli *wa.Client, fn func()) {
+	reconnectTasks.submit(cli, fn)
+}
+
+func (s *scheduler) submit(cli *wa.Client, fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queues[cli]
+	if q == nil {
+		q = &taskQueue{}
+		s.queues[cli] = q
+	}
+	q.tasks = append(q.tasks, fn)
+	s.markReady(cli, q)
+	s.spawn()
+}
+
+func (s *scheduler) markReady(cli *wa.Client, q *taskQueue) {
+	if !q.ready && len(q.tasks) > 0 && q.running < s.maxPerClient {
+		q.ready = true
+		s.ready = append(s.ready, cli)
+	}
+}
+
+// spawn starts workers until every ready client has an idle one, up to maxWorkers.
+func (s *scheduler) spawn() {
+	for s.workers < s.maxWorkers && s.workers-s.busy < len(s.ready) {
+		s.workers++
+		go s.work()
+	}
+}
+
+func (s *scheduler) work() {
+	s.mu.Lock()
+	for len(s.ready) > 0 {
+		cli := s.ready[0]
+		s.ready = s.ready[1:]
+		q := s.queues[cli]
+		q.ready = false
+		fn := q.tasks[0]
+		q.tasks = q.tasks[1:]
+		q.running++
+		s.busy++
+		s.markReady(cli, q)
+		s.spawn()
+		s.mu.Unlock()
+
+		panicked := runTask(cli, fn)
+
+		s.mu.Lock()
+		q.running--
+		s.busy--
+		s.completed++
+		if panicked {
+			s.panics++
+		}
+		if len(q.tasks) == 0 && q.running == 0 {
+			delete(s.queues, cli)
+		} else {
+			s.markReady(cli, q)
+		}
+	}
+	s.workers--
+	s.mu.Unlock()
+}
+
+func runTask(cli *wa.Client, fn func()) (panicked bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			panicked = true
+			cli.Log.Errorf("Background task panicked: %v\n%s", err, debug.Stack())
+		}
+	}()
+	fn()
+	return false
+}
+
+// dropTasks discards the queued (not running) tasks of cli on both pools.
+func dropTasks(cli *wa.Client) {
+	tasks.drop(cli)
+	reconnectTasks.drop(cli)
+}
+
+func (s *scheduler) drop(cli *wa.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q := s.queues[cli]; q != nil {
+		q.tasks = nil
+		if q.ready {
+			q.ready = false
+			s.ready = slices.DeleteFunc(s.ready, func(c *wa.Client) bool { return c == cli })
+		}
+		if q.running == 0 {
+			delete(s.queues, cli)
+		}
+	}
+}
+
+func (s *scheduler) stats() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queued := 0
+	for _, q := range s.queues {
+		queued += len(q.tasks)
+	}
+	return map[string]any{
+		"workers":        s.workers,
+		"max_workers":    s.maxWorkers,
+		"max_per_client": s.maxPerClient,
+		"queued":         queued,
+		"clients":        len(s.queues),
+		"completed":      s.completed,
+		"panics":         s.panics,
+	}
+}
+
+//export WmSetSchedulerOptions
+func WmSetSchedulerOptions(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		MaxWorkers   int `json:"max_workers"`
+		MaxPerClient int `json:"max_per_client"`
+		// the reconnect pool always runs one attempt per client at a time
+		ReconnectMaxWorkers int `json:"reconnect_max_workers"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	if payload.MaxWorkers < 0 || payload.MaxPerClient < 0 || payload.ReconnectMaxWorkers < 0 {
+		return fail(errors.New("limits must not be negative"))
+	}
+	tasks.resize(payload.MaxWorkers, payload.MaxPerClient)
+	reconnectTasks.resize(payload.ReconnectMaxWorkers, 0)
+	out := tasks.stats()
+	out["reconnects"] = reconnectTasks.stats()
+	return success(out)
+}
+
+// resize changes the limits of s, leaving those given as 0 unchanged.
+func (s *scheduler) resize(maxWorkers, maxPerClient int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if maxWorkers > 0 {
+		s.maxWorkers = maxWorkers
+	}
+	if maxPerClient > 0 {
+		s.maxPerClient = maxPerClient
+		for cli, q := range s.queues {
+			s.markReady(cli, q)
+		}
+	}
+	s.spawn()
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+func newTestScheduler(maxWorkers, maxPerClient int) *scheduler {
+	return &scheduler{
+		queues:       map[*wa.Client]*taskQueue{},
+		maxWorkers:   maxWorkers,
+		maxPerClient: maxPerClient,
+	}
+}
+
+func waitIdle(t *testing.T, s *scheduler) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		idle := s.workers == 0 && len(s.queues) == 0
+		s.mu.Unlock()
+		if idle {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("scheduler didn't drain")
+}
+
+func TestSchedulerFairness(t *testing.T) {
+	s := newTestScheduler(1, 4)
+	busy, quiet := &wa.Client{}, &wa.Client{}
+	var mu sync.Mutex
+	var order []*wa.Client
+	record := func(cli *wa.Client) func() {
+		return func() {
+			mu.Lock()
+			order = append(order, cli)
+			mu.Unlock()
+		}
+	}
+	// hold the only worker until both clients have queued their tasks
+	release := make(chan struct{})
+	s.submit(busy, func() { <-release })
+	for range 10 {
+		s.submit(busy, record(busy))
+	}
+	s.submit(quiet, record(quiet))
+	close(release)
+	waitIdle(t, s)
+
+	if len(order) != 11 {
+		t.Fatalf("ran %d tasks, want 11", len(order))
+	}
+	for i, cli := range order {
+		if cli == quiet {
+			if i > 1 {
+				t.Errorf("quiet client's task ran at position %d, behind the busy client's backlog", i)
+			}
+			return
+		}
+	}
+	t.Error("quiet client's task didn't run")
+}
+
+func TestSchedulerPerClientLimit(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxWorkers   int
+		maxPerClient int
+	}{
+		{"one per client", 8, 1},
+		{"two per client", 8, 2},
+		{"fewer workers than the limit", 2, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestScheduler(tt.maxWorkers, tt.maxPerClient)
+			cli := &wa.Client{}
+			var mu sync.Mutex
+			running, peak := 0, 0
+			for range 20 {
+				s.submit(cli, func() {
+					mu.Lock()
+					running++
+					peak = max(peak, running)
+					mu.Unlock()
+					time.Sleep(2 * time.Millisecond)
+					mu.Lock()
+					running--
+					mu.Unlock()
+				})
+			}
+			waitIdle(t, s)
+			if limit := min(tt.maxWorkers, tt.maxPerClient); peak > limit {
+				t.Errorf("%d tasks ran at once, want at most %d", peak, limit)
+			}
+			if stats := s.stats(); stats["completed"] != uint64(20) {
+				t.Errorf("completed = %v, want 20", stats["completed"])
+			}
+		})
+	}
+}
+
+func TestSchedulerDrop(t *testing.T) {
+	s := newTestScheduler(1, 1)
+	cli := &wa.Client{}
+	release := make(chan struct{})
+	ran := 0
+	s.submit(cli, func() { <-release })
+	for range 5 {
+		s.submit(cli, func() { ran++ })
+	}
+	s.drop(cli)
+	close(release)
+	waitIdle(t, s)
+	if ran != 0 {
+		t.Errorf("%d dropped tasks ran", ran)
+	}
+}
+
+func TestSchedulerResize(t *testing.T) {
+	s := newTestScheduler(1, 4)
+	cli := &wa.Client{}
+	release := make(chan struct{})
+	for range 3 {
+		s.submit(cli, func() { <-release })
+	}
+	s.resize(3, 0)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		workers := s.workers
+		s.mu.Unlock()
+		if workers == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d workers after growing the pool, want 3", workers)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	waitIdle(t, s)
+	if stats := s.stats(); stats["max_per_client"] != 4 {
+		t.Errorf("max_per_client = %v, want 4 (0 keeps it)", stats["max_per_client"])
+	}
+}
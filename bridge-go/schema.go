@@ -0,0 +1,287 @@
+package main
+
+import "C"
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// eventSchemaVersion is stamped on every event as schema_version. Bump it when
+// a field is removed, renamed or changes type; adding fields doesn't need a bump.
+const eventSchemaVersion = 1
+
+// eventSchemaSamples lists every event with an explicit serializer. WmEventSchema
+// runs them through serializeEvent, so the descriptor can't drift from the code.
+var eventSchemaSamples = []interface{}{
+	&events.Connected{}, &events.Disconnected{}, &events.ManualLoginReconnect{}, &events.StreamReplaced{},
+	&events.ClientOutdated{}, &events.QRScannedWithoutMultidevice{}, &events.PairSuccess{}, &events.PairError{},
+	&events.LoggedOut{}, &events.CATRefreshError{}, &events.ConnectFailure{}, &events.StreamError{},
+	&events.TemporaryBan{}, &events.KeepAliveTimeout{}, &events.KeepAliveRestored{},
+	&events.Receipt{}, &events.Presence{}, &events.ChatPresence{},
+	&events.Message{}, &events.UndecryptableMessage{}, &events.FBMessage{}, &events.HistorySync{},
+	&events.JoinedGroup{}, &events.GroupInfo{}, &events.Picture{}, &events.UserAbout{}, &events.IdentityChange{},
+	&events.PrivacySettings{}, &events.OfflineSyncPreview{}, &events.OfflineSyncCompleted{}, &events.MediaRetry{},
+	&events.Blocklist{}, &events.NewsletterJoin{}, &events.NewsletterLeave{}, &events.NewsletterMuteChange{},
+	&events.NewsletterLiveUpdate{},
+	&events.Contact{}, &events.PushName{}, &events.BusinessName{}, &events.Pin{}, &events.Star{},
+	&events.DeleteForMe{}, &events.Mute{}, &events.Archive{}, &events.MarkChatAsRead{}, &events.ClearChat{},
+	&events.DeleteChat{}, &events.PushNameSetting{}, &events.UnarchiveChatsSetting{}, &events.UserStatusMute{},
+	&events.LabelEdit{}, &events.LabelAssociationChat{}, &events.LabelAssociationMessage{}, &events.AppState{},
+	&events.AppStateSyncComplete{},
+	&events.CallOffer{}, &events.CallAccept{}, &events.CallPreAccept{}, &events.CallTransport{},
+	&events.CallOfferNotice{}, &events.CallRelayLatency{}, &events.CallTerminate{}, &events.CallReject{},
+	&events.UnknownCallEvent{},
+}
+
+// messageExtraSchema describes the fields handleBridgeEvent merges into message
+// events (the extra of deliverEvent). None of them is on every message.
+var messageExtraSchema = map[string]string{
+	"was_duplicate": "number", "auto_download": "object", "edit_of": "string", "comment": "object",
+	"order": "object", "native_flow": "object", "native_flow_response": "object", "enc_reaction": "object",
+	"group_invite": "object",
+}
+
+// bridgeEventSchemas describes events generated by the bridge itself (see emitBridgeEvent).
+// Fields suffixed with "?" are optional.
+var bridgeEventSchemas = map[string]map[string]string{
+	"app_state_recovery": {
+		"recovery_id": "number", "stage": "string", "name?": "string", "attempt?": "number", "error?": "string",
+		"recovered?": "boolean",
+	},
+	"call_auto_rejected": {
+		"call_id": "string", "from": "string", "policy": "string",
+		"reply_sent": "boolean", "reply_error?": "string", "error?": "string",
+	},
+	"connection_state": {
+		"state": "string", "attempt?": "number", "delay_ms?": "number", "attempts?": "number", "idle_ms?": "number",
+	},
+	"events_dropped":       {"count": "number", "total_dropped": "number"},
+	"identity_quarantined": {"jid": "string", "changed": "string", "implicit": "boolean", "since": "number"},
+	"media_auto_downloaded": {
+		"chat": "string", "id": "string", "media_type": "string", "mimetype": "string", "size": "number",
+		"path?": "string", "cache_key?": "string",
+	},
+	"media_auto_download_failed": {
+		"chat": "string", "id": "string", "media_type": "string", "mimetype": "string", "error": "string",
+		"path?": "string",
+	},
+	"message_edit": {
+		"chat": "string", "original_id": "string", "edit_id": "string", "sender": "string",
+		"timestamp": "string", "timestamp_ms": "number", "new_message": "object", "previous_message": "object",
+		"original_timestamp?": "string", "original_timestamp_ms?": "number",
+	},
+	"message_recovered": {
+		"chat": "string", "sender": "string", "message_id": "string", "request_id": "string", "managed": "boolean",
+		"attempts?": "number", "elapsed_ms?": "number",
+	},
+	"message_recovery_failed": {
+		"chat": "string", "sender": "string", "message_id": "string", "attempts": "number", "request_id?": "string",
+	},
+	"newsletter_live_updates_error": {"jid": "string", "error": "string"},
+	"order_details": {
+		"chat": "string", "message_id": "string", "order_id": "string", "products?": "array",
+		"total_amount_1000?": "number", "currency?": "string", "error?": "string",
+	},
+	"pair_request": {
+		"jid": "string", "platform": "string", "business_name": "string",
+		"allowed?": "boolean", "reason?": "string", "decision_id?": "number",
+	},
+	"poll_vote": {
+		"chat": "string", "poll_id": "string", "poll_name": "string", "voter": "string", "vote_id": "string",
+		"timestamp": "string", "timestamp_ms": "number", "selected_options": "array", "unknown_option_hashes?": "array",
+	},
+	"reaction_summary": {
+		"chat": "string", "message_id": "string", "sender": "string", "emoji": "string", "total": "number",
+		"reactions": "array",
+	},
+	"prekeys_low":       {"server_count": "number", "watermark": "number"},
+	"reconnect_attempt": {"attempt": "number", "delay_ms": "number"},
+	"reconnect_failed":  {"attempt": "number", "error": "string"},
+	"reconnect_gave_up": {"attempts": "number"},
+	"retry_receipt": {
+		"chat": "string", "sender": "string", "message_id": "string", "retry_count": "number", "has_message": "boolean",
+		"allowed?": "boolean", "reason?": "string", "decision_id?": "number",
+	},
+	"retry_threshold_exceeded": {
+		"peer": "string", "chat": "string", "direction": "string", "count": "number", "window_ms": "number",
+	},
+	"send_throttled": {"chat": "string", "limit": "string", "wait_ms": "number", "action": "string"},
+	"stanza": {
+		"direction": "string", "size": "number", "node?": "object", "truncated?": "boolean", "error?": "string",
+	},
+	"warmup_quota_reached":    {"day": "number", "days": "number", "limit": "number", "resets_at": "number"},
+	"webhook_delivery_failed": {"event_id": "number", "attempts": "number", "error": "string", "event": "object"},
+}
+
+type schemaField struct {
+	Types    []string `json:"types"`
+	Optional bool     `json:"optional,omitempty"`
+}
+
+type schemaEvent struct {
+	Type   string                  `json:"type"`
+	Source string                  `json:"source"`
+	GoType string                  `json:"go_type,omitempty"`
+	Fields map[string]*schemaField `json:"fields"`
+}
+
+// buildEventSchema serializes each sample twice, once zero-valued and once with
+// its optional pointers/strings filled in, and with both proto encodings. A field
+// missing from any variant is optional; a field that was null in one is nullable.
+func buildEventSchema() []*schemaEvent {
+	out := make([]*schemaEvent, 0, len(eventSchemaSamples)+len(bridgeEventSchemas))
+	for _, sample := range eventSchemaSamples {
+		var variants []map[string]any
+		for _, raw := range []interface{}{sample, populatedSample(sample)} {
+			for _, opts := range []serializeOptions{{}, {RawProto: true}, {LazyBody: true}} {
+				if ev := trySerializeSample(raw, opts); ev != nil {
+					variants = append(variants, ev)
+				}
+			}
+		}
+		if len(variants) == 0 {
+			continue
+		}
+		entry := &schemaEvent{Source: "whatsmeow", GoType: fmt.Sprintf("%T", sample), Fields: map[string]*schemaField{}}
+		entry.Type, _ = variants[0]["type"].(string)
+		for i, ev := range variants {
+			for name, val := range ev {
+				f := entry.Fields[name]
+				if f == nil {
+					f = &schemaField{Optional: i > 0}
+					entry.Fields[name] = f
+				}
+				if t := jsonTypeOf(val); !slices.Contains(f.Types, t) {
+					f.Types = append(f.Types, t)
+				}
+			}
+			for name, f := range entry.Fields {
+				if _, ok := ev[name]; !ok {
+					f.Optional = true
+				}
+			}
+		}
+		if _, ok := sample.(*events.Message); ok {
+			for field, typ := range messageExtraSchema {
+				entry.Fields[field] = &schemaField{Types: []string{typ}, Optional: true}
+			}
+		}
+		out = append(out, entry)
+	}
+	for name, fields := range bridgeEventSchemas {
+		entry := &schemaEvent{Type: name, Source: "bridge", Fields: map[string]*schemaField{
+			"type":           {Types: []string{"string"}},
+			"schema_version": {Types: []string{"number"}},
+		}}
+		for field, typ := range fields {
+			optional := field[len(field)-1] == '?'
+			if optional {
+				field = field[:len(field)-1]
+			}
+			entry.Fields[field] = &schemaField{Types: []string{typ}, Optional: optional}
+		}
+		out = append(out, entry)
+	}
+	for _, entry := range out {
+		// the journal numbers every event it stores
+		entry.Fields["seq"] = &schemaField{Types: []string{"number"}, Optional: true}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Type < out[j].Type })
+	return out
+}
+
+func trySerializeSample(raw interface{}, opts serializeOptions) (ev map[string]any) {
+	defer func() {
+		if recover() != nil {
+			ev = nil
+		}
+	}()
+	return serializeEvent(raw, opts)
+}
+
+// populatedSample returns a copy of sample with nil pointers, empty strings and
+// nil errors set, so serializer branches guarded by presence checks are taken.
+func populatedSample(sample interface{}) interface{} {
+	v := reflect.New(reflect.TypeOf(sample).Elem())
+	s := v.Elem()
+	for i := 0; i < s.NumField(); i++ {
+		f := s.Field(i)
+		if !f.CanSet() {
+			continue
+		}
+		switch {
+		case f.Type() == typeOfError:
+			f.Set(reflect.ValueOf(errors.New("sample")))
+		case f.Kind() == reflect.Pointer && f.Type().Elem().Kind() == reflect.Struct:
+			f.Set(reflect.New(f.Type().Elem()))
+		case f.Kind() == reflect.String:
+			f.SetString("sample")
+		}
+	}
+	return v.Interface()
+}
+
+var typeOfTextMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// jsonTypeOf reports the JSON type val encodes to.
+func jsonTypeOf(val any) string {
+	if val == nil {
+		return "null"
+	}
+	if _, ok := val.(json.RawMessage); ok {
+		return "object"
+	}
+	v := reflect.ValueOf(val)
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return "null"
+	}
+	if v.Type().Implements(typeOfTextMarshaler) {
+		return "string"
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		return jsonTypeOf(v.Elem().Interface())
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+		if v.IsNil() {
+			return "null"
+		}
+		return "array"
+	case reflect.Array:
+		return "array"
+	case reflect.Map:
+		if v.IsNil() {
+			return "null"
+		}
+		return "object"
+	default:
+		return "object"
+	}
+}
+
+//export WmEventSchema
+func WmEventSchema(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	return success(map[string]any{
+		"schema_version": eventSchemaVersion,
+		"events":         buildEventSchema(),
+		"unknown_events": "types prefixed with \"unknown:\" carry the event's exported fields in snake_case",
+	})
+}
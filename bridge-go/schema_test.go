@@ -0,0 +1,162 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestMessageExtraSchema checks that every field handleBridgeEvent merges into
+// message events is described in messageExtraSchema, and that it lists no others.
+func TestMessageExtraSchema(t *testing.T) {
+	funcs := packageFuncs(t)
+	handler := funcs["handleBridgeEvent"]
+	if handler == nil {
+		t.Fatal("handleBridgeEvent not found")
+	}
+	var clause *ast.CaseClause
+	ast.Inspect(handler.Body, func(n ast.Node) bool {
+		if cc, ok := n.(*ast.CaseClause); ok && len(cc.List) == 1 && isMessageEventType(cc.List[0]) {
+			clause = cc
+		}
+		return clause == nil
+	})
+	if clause == nil {
+		t.Fatal("handleBridgeEvent has no *events.Message case")
+	}
+
+	emitted := map[string]bool{}
+	var collect func(expr ast.Expr)
+	collect = func(expr ast.Expr) {
+		switch expr := expr.(type) {
+		case *ast.CompositeLit:
+			for _, key := range literalKeys(expr) {
+				emitted[key] = true
+			}
+		case *ast.CallExpr:
+			name, ok := expr.Fun.(*ast.Ident)
+			if !ok || funcs[name.Name] == nil {
+				t.Errorf("can't follow extra fields from %T", expr.Fun)
+				return
+			}
+			ast.Inspect(funcs[name.Name].Body, func(n ast.Node) bool {
+				if ret, ok := n.(*ast.ReturnStmt); ok && len(ret.Results) == 1 {
+					if lit, ok := ret.Results[0].(*ast.CompositeLit); ok {
+						collect(lit)
+					}
+				}
+				// returns of nested closures don't reach the event
+				_, closure := n.(*ast.FuncLit)
+				return !closure
+			})
+		}
+	}
+	for _, stmt := range clause.Body {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.AssignStmt:
+				if len(n.Lhs) == 1 && len(n.Rhs) == 1 && isIdent(n.Lhs[0], "extra") {
+					collect(n.Rhs[0])
+				}
+			case *ast.CallExpr:
+				if isIdent(n.Fun, "mergeExtra") && len(n.Args) == 2 {
+					collect(n.Args[1])
+				}
+			}
+			return true
+		})
+	}
+
+	if len(emitted) == 0 {
+		t.Fatal("no extra message fields found")
+	}
+	for field := range emitted {
+		if _, ok := messageExtraSchema[field]; !ok {
+			t.Errorf("message events get %q, but messageExtraSchema doesn't describe it", field)
+		}
+	}
+	for field := range messageExtraSchema {
+		if !emitted[field] {
+			t.Errorf("messageExtraSchema describes %q, but message events never get it", field)
+		}
+	}
+}
+
+func TestEventSchemaMessageFields(t *testing.T) {
+	for _, entry := range buildEventSchema() {
+		if entry.GoType != "*events.Message" {
+			continue
+		}
+		for field := range messageExtraSchema {
+			if f := entry.Fields[field]; f == nil || !f.Optional {
+				t.Errorf("message schema field %q = %+v, want an optional field", field, f)
+			}
+		}
+		return
+	}
+	t.Fatal("schema has no message event")
+}
+
+func packageFuncs(t *testing.T) map[string]*ast.FuncDecl {
+	t.Helper()
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	funcs := map[string]*ast.FuncDecl{}
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := parser.ParseFile(fset, name, src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil {
+				funcs[fn.Name.Name] = fn
+			}
+		}
+	}
+	return funcs
+}
+
+func isMessageEventType(expr ast.Expr) bool {
+	star, ok := expr.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	return ok && isIdent(sel.X, "events") && sel.Sel.Name == "Message"
+}
+
+func isIdent(expr ast.Expr, name string) bool {
+	id, ok := expr.(*ast.Ident)
+	return ok && id.Name == name
+}
+
+func literalKeys(lit *ast.CompositeLit) []string {
+	var keys []string
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if key, ok := kv.Key.(*ast.BasicLit); ok && key.Kind == token.STRING {
+			if s, err := strconv.Unquote(key.Value); err == nil {
+				keys = append(keys, s)
+			}
+		}
+	}
+	return keys
+}
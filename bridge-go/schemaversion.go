@@ -0,0 +1,100 @@
+package main
+
+import "C"
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.mau.fi/whatsmeow/store/sqlstore/upgrades"
+)
+
+// whatsmeow keeps its schema version in whatsmeow_version and migrates on open.
+// Operators sharing one database between bridge versions can open containers
+// with upgrade: false to fail on an outdated schema instead, and migrate at a
+// time of their choosing. The bridge's own wmnode_ tables are only ever added
+// to, so they're still created when missing.
+
+func whatsmeowSchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRowContext(ctx, "SELECT version FROM whatsmeow_version LIMIT 1").Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	} else if err != nil {
+		// a fresh database has no version table yet
+		var exists int
+		if db.QueryRowContext(ctx, "SELECT 1 FROM whatsmeow_version").Scan(&exists) != nil {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return version, nil
+}
+
+func latestSchemaVersion() int {
+	return len(upgrades.Table)
+}
+
+func checkSchemaVersion(ctx context.Context, db *sql.DB) error {
+	version, err := whatsmeowSchemaVersion(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if latest := latestSchemaVersion(); version < latest {
+		return fmt.Errorf("database schema is at version %d but this bridge needs %d, and upgrades are disabled", version, latest)
+	}
+	return nil
+}
+
+//export WmContainerGetVersion
+func WmContainerGetVersion(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var req withHandle
+	if err := json.Unmarshal([]byte(C.GoString(input)), &req); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	containersMu.RLock()
+	cont := containers[handle(req.Handle)]
+	containersMu.RUnlock()
+	if cont == nil {
+		return fail(errors.New("container handle not found"))
+	}
+	bridgeDBsMu.RLock()
+	bdb := bridgeDBs[cont]
+	bridgeDBsMu.RUnlock()
+	if bdb == nil {
+		return fail(errNoBridgeDB)
+	}
+	version, err := whatsmeowSchemaVersion(context.Background(), bdb.db)
+	if err != nil {
+		return fail(err)
+	}
+	latest := latestSchemaVersion()
+	return success(map[string]any{
+		"version":       version,
+		"latest":        latest,
+		"needs_upgrade": version < latest,
+		"dialect":       bdb.dialect,
+	})
+}
+
+//export WmContainerUpgrade
+func WmContainerUpgrade(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var req withHandle
+	if err := json.Unmarshal([]byte(C.GoString(input)), &req); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	containersMu.RLock()
+	cont := containers[handle(req.Handle)]
+	containersMu.RUnlock()
+	if cont == nil {
+		return fail(errors.New("container handle not found"))
+	}
+	if err := cont.Upgrade(context.Background()); err != nil {
+		return fail(fmt.Errorf("failed to upgrade database: %w", err))
+	}
+	return success(map[string]any{"version": latestSchemaVersion()})
+}
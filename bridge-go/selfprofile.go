@@ -0,0 +1,115 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// WmClientGetSelfProfile gathers what a session usually looks up about itself
+// at startup in one call: the JID and LID and push name from the store, and
+// from the server (queried concurrently) the about text, profile picture and,
+// for business accounts, the business profile. A failed query leaves its field
+// null and its error under errors, the rest is still returned; a missing
+// picture or business profile is just null.
+
+//export WmClientGetSelfProfile
+func WmClientGetSelfProfile(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client    uint64 `json:"client"`
+		TimeoutMs int64  `json:"timeout_ms"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	own := cli.Store.GetJID().ToNonAD()
+	if own.IsEmpty() {
+		return fail(wa.ErrNotLoggedIn)
+	}
+	if payload.TimeoutMs <= 0 {
+		payload.TimeoutMs = 20_000
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(payload.TimeoutMs)*time.Millisecond)
+	defer cancel()
+
+	out := map[string]any{
+		"jid":           own.String(),
+		"lid":           nil,
+		"push_name":     cli.Store.PushName,
+		"business_name": cli.Store.BusinessName,
+		"about":         nil,
+		"picture":       nil,
+		"business":      nil,
+	}
+	if lid := cli.Store.GetLID(); !lid.IsEmpty() {
+		out["lid"] = lid.ToNonAD().String()
+	}
+	var mu sync.Mutex
+	errs := map[string]string{}
+	set := func(field string, value any, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs[field] = err.Error()
+			return
+		}
+		if value == nil || reflect.ValueOf(value).IsNil() {
+			return
+		}
+		enc, err := encodeReturn(reflect.ValueOf(value))
+		if err != nil {
+			errs[field] = err.Error()
+			return
+		}
+		out[field] = enc
+	}
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		info, err := cli.GetUserInfo(ctx, []types.JID{own})
+		if err != nil {
+			set("about", nil, err)
+			return
+		}
+		mu.Lock()
+		out["about"] = info[own].Status
+		mu.Unlock()
+	}()
+	go func() {
+		defer wg.Done()
+		pic, err := cli.GetProfilePictureInfo(ctx, own, &wa.GetProfilePictureParams{})
+		if errors.Is(err, wa.ErrProfilePictureNotSet) {
+			return
+		}
+		set("picture", pic, err)
+	}()
+	go func() {
+		defer wg.Done()
+		business, err := cli.GetBusinessProfile(ctx, own)
+		if err != nil && cli.Store.BusinessName == "" {
+			// most likely not a business account
+			return
+		}
+		set("business", business, err)
+	}()
+	wg.Wait()
+	if len(errs) > 0 {
+		out["errors"] = errs
+	}
+	return success(out)
+}
@@ -0,0 +1,114 @@
+package main
+
+import "C"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// sendDefaults fills the SendRequestExtra of every send made through the bridge,
+// both WmClientCall methods taking one (SendMessage and friends) and the bridge's
+// own sends. Fields set on a call win over the defaults.
+type sendDefaults struct {
+	TimeoutMs   int64  `json:"timeout_ms"`
+	IDPrefix    string `json:"id_prefix"`
+	Peer        bool   `json:"peer"`
+	MediaHandle string `json:"media_handle"`
+}
+
+var typeOfSendExtras = reflect.TypeOf([]wa.SendRequestExtra{})
+
+func (cfg *clientConfig) sendDefaults() *sendDefaults {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.sendOpts
+}
+
+// idempotentMessageID derives the message ID of a send from an idempotency key
+// given by Node, so an application retrying a send it isn't sure went out reuses
+// the ID of the first attempt, which recipients and our other devices treat as
+// the same message. It has the shape of GenerateMessageID's IDs and is scoped to
+// our own JID, so the same key used by two accounts gives different IDs.
+func idempotentMessageID(cli *wa.Client, key string) types.MessageID {
+	hash := sha256.Sum256([]byte(cli.Store.GetJID().ToNonAD().String() + "\x00" + key))
+	return types.MessageID("3EB0" + strings.ToUpper(hex.EncodeToString(hash[:9])))
+}
+
+// sendExtra returns the request extras of a send after applying the client's
+// defaults. A non-empty idempotency key sets the ID unless the call has one;
+// id_prefix applies to both random and derived IDs.
+func sendExtra(cli *wa.Client, extra []wa.SendRequestExtra, idempotencyKey string) []wa.SendRequestExtra {
+	d := configFor(cli).sendDefaults()
+	if d == nil && idempotencyKey == "" {
+		return extra
+	}
+	if d == nil {
+		d = &sendDefaults{}
+	}
+	var req wa.SendRequestExtra
+	if len(extra) > 0 {
+		req = extra[0]
+	}
+	if req.Timeout == 0 && d.TimeoutMs > 0 {
+		req.Timeout = time.Duration(d.TimeoutMs) * time.Millisecond
+	}
+	if req.ID == "" && idempotencyKey != "" {
+		req.ID = types.MessageID(d.IDPrefix + string(idempotentMessageID(cli, idempotencyKey)))
+	} else if req.ID == "" && d.IDPrefix != "" {
+		req.ID = types.MessageID(d.IDPrefix + string(cli.GenerateMessageID()))
+	}
+	if req.MediaHandle == "" {
+		req.MediaHandle = d.MediaHandle
+	}
+	req.Peer = req.Peer || d.Peer
+	return []wa.SendRequestExtra{req}
+}
+
+// applySendDefaults rewrites the variadic SendRequestExtra argument of a
+// reflected call, if the method has one.
+func applySendDefaults(cli *wa.Client, args []reflect.Value, idempotencyKey string) {
+	if len(args) == 0 || args[len(args)-1].Type() != typeOfSendExtras {
+		return
+	}
+	extra := args[len(args)-1].Interface().([]wa.SendRequestExtra)
+	args[len(args)-1] = reflect.ValueOf(sendExtra(cli, extra, idempotencyKey))
+}
+
+//export WmClientSetSendDefaults
+func WmClientSetSendDefaults(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		sendDefaults
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if payload.TimeoutMs < 0 {
+		return fail(errors.New("timeout_ms must not be negative"))
+	}
+	defaults := payload.sendDefaults
+	cfg := configFor(cli)
+	cfg.mu.Lock()
+	if defaults == (sendDefaults{}) {
+		cfg.sendOpts = nil
+	} else {
+		cfg.sendOpts = &defaults
+	}
+	cfg.mu.Unlock()
+	return success(defaults)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func clientWithJID(t *testing.T, s string) *wa.Client {
+	t.Helper()
+	jid, err := types.ParseJID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &wa.Client{Store: &store.Device{ID: &jid}}
+}
+
+func TestIdempotentMessageID(t *testing.T) {
+	shape := regexp.MustCompile(`^3EB0[0-9A-F]{18}$`)
+	alice := clientWithJID(t, "111111111@s.whatsapp.net")
+	aliceDevice := clientWithJID(t, "111111111:7@s.whatsapp.net")
+	bob := clientWithJID(t, "222222222@s.whatsapp.net")
+
+	tests := []struct {
+		name   string
+		a, b   *wa.Client
+		keyA   string
+		keyB   string
+		sameID bool
+	}{
+		{"same key", alice, alice, "order-42", "order-42", true},
+		{"other key", alice, alice, "order-42", "order-43", false},
+		{"other device of the account", alice, aliceDevice, "order-42", "order-42", true},
+		{"other account", alice, bob, "order-42", "order-42", false},
+		{"empty key", bob, bob, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idA := idempotentMessageID(tt.a, tt.keyA)
+			idB := idempotentMessageID(tt.b, tt.keyB)
+			for _, id := range []types.MessageID{idA, idB} {
+				if !shape.MatchString(string(id)) {
+					t.Errorf("ID %q doesn't look like a generated message ID", id)
+				}
+			}
+			if (idA == idB) != tt.sameID {
+				t.Errorf("IDs %q and %q, want same = %v", idA, idB, tt.sameID)
+			}
+		})
+	}
+}
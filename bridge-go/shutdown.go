@@ -0,0 +1,162 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// WmShutdown tears the whole bridge down for a clean restart of the addon. It
+// refuses new work from then on (new containers, clients, and every client
+// export fail with errShuttingDown), waits for the calls already
+// running and the queued background tasks (receipts, downloads, order
+// lookups) up to timeout_ms, then releases every handle: streams first, then
+// clients (disconnected like WmRelease does), devices, containers (their
+// databases closed) and store backends. It returns once all of that is done.
+
+var errShuttingDown = errors.New("bridge is shutting down")
+
+var (
+	shuttingDown atomic.Bool
+	// calls that must finish before shutdown hold a read lock
+	callGate sync.RWMutex
+)
+
+// beginCall admits a call unless shutdown started; the returned func ends it.
+func beginCall() (func(), error) {
+	if shuttingDown.Load() || !callGate.TryRLock() {
+		return nil, errShuttingDown
+	}
+	return callGate.RUnlock, nil
+}
+
+// beginClientCall is the client lookup of client exports. It admits the call
+// like beginCall; the returned func ends it. wake is for calls that need the
+// connection: they count as activity for the idle policy and reconnect the
+// client first if the policy parked it (idle.go).
+func beginClientCall(client uint64, wake bool) (*wa.Client, func(), error) {
+	clientsMu.RLock()
+	cli := clients[handle(client)]
+	clientsMu.RUnlock()
+	if cli == nil {
+		return nil, nil, errors.New("client handle not found")
+	}
+	end, err := beginCall()
+	if err != nil {
+		return nil, nil, err
+	}
+	if wake {
+		if err = wakeIdleClient(cli); err != nil {
+			end()
+			return nil, nil, err
+		}
+	}
+	return cli, end, nil
+}
+
+func checkShutdown() error {
+	if shuttingDown.Load() {
+		return errShuttingDown
+	}
+	return nil
+}
+
+// waitUntil polls done until it returns true or the deadline passes.
+func waitUntil(deadline time.Time, done func() bool) bool {
+	for !done() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return true
+}
+
+func handleKeys[T any](mu *sync.RWMutex, m map[handle]T) []handle {
+	mu.RLock()
+	defer mu.RUnlock()
+	keys := make([]handle, 0, len(m))
+	for h := range m {
+		keys = append(keys, h)
+	}
+	return keys
+}
+
+//export WmShutdown
+func WmShutdown(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		TimeoutMs int64 `json:"timeout_ms"`
+	}
+	if s := C.GoString(input); s != "" {
+		if err := json.Unmarshal([]byte(s), &payload); err != nil {
+			return fail(fmt.Errorf("invalid json: %w", err))
+		}
+	}
+	if payload.TimeoutMs <= 0 {
+		payload.TimeoutMs = 10_000
+	}
+	if !shuttingDown.CompareAndSwap(false, true) {
+		return fail(errors.New("shutdown already started"))
+	}
+	start := time.Now()
+	deadline := start.Add(time.Duration(payload.TimeoutMs) * time.Millisecond)
+
+	drained := make(chan struct{})
+	go func() {
+		callGate.Lock()
+		close(drained)
+	}()
+	callsDone := true
+	select {
+	case <-drained:
+	case <-time.After(time.Until(deadline)):
+		callsDone = false
+	}
+	tasksDone := waitUntil(deadline, func() bool {
+		tasks.mu.Lock()
+		defer tasks.mu.Unlock()
+		return len(tasks.queues) == 0
+	})
+
+	var opHandles []handle
+	opsMu.Lock()
+	for id := range ops {
+		opHandles = append(opHandles, handle(id))
+	}
+	opsMu.Unlock()
+	groups := [][]handle{
+		handleKeys(&eventsMu, eventsMap),
+		handleKeys(&qrsMu, qrs),
+		handleKeys(&mediaJobsMu, mediaJobs),
+		handleKeys(&eventSocketsMu, eventSockets),
+		handleKeys(&logStreamsMu, logStreams),
+		handleKeys(&restServersMu, restServers),
+		opHandles,
+		handleKeys(&clientsMu, clients),
+		handleKeys(&devicesMu, devices),
+		handleKeys(&containersMu, containers),
+		handleKeys(&storeBackendsMu, storeBackends),
+	}
+	released := 0
+	for _, group := range groups {
+		for _, h := range group {
+			// containers release their devices and clients, so some are gone already
+			if releaseHandle(h) == nil {
+				released++
+			}
+		}
+	}
+	return success(map[string]any{
+		"released":    released,
+		"calls_done":  callsDone,
+		"tasks_done":  tasksDone,
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// clientLookups are the helpers that admit a client call through the shutdown gate.
+var clientLookups = map[string]bool{"beginClientCall": true, "clientForRaw": true}
+
+// exports with a "client" field that isn't a handle to look up
+var notClientExports = map[string]bool{
+	"WmListHandles":    true, // a field of the listing
+	"WmSetLogOptions":  true, // the client log level
+	"WmLogStreamStart": true, // only filters the stream, 0 is every client
+}
+
+// TestClientExportsAreGated checks that every export taking a client handle
+// looks it up through beginClientCall, so none runs during WmShutdown.
+func TestClientExportsAreGated(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	checked := 0
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Doc == nil || !strings.HasPrefix(fn.Doc.List[len(fn.Doc.List)-1].Text, "//export ") {
+				continue
+			}
+			if notClientExports[fn.Name.Name] || !takesClientHandle(fn) {
+				continue
+			}
+			checked++
+			if !callsAny(fn, clientLookups) {
+				t.Errorf("%s (%s) takes a client handle without beginClientCall", fn.Name.Name, name)
+			}
+		}
+	}
+	if checked == 0 {
+		t.Fatal("no client exports found")
+	}
+}
+
+func takesClientHandle(fn *ast.FuncDecl) bool {
+	found := false
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		field, ok := n.(*ast.Field)
+		if ok && field.Tag != nil {
+			tag := reflect.StructTag(strings.Trim(field.Tag.Value, "`"))
+			if name, _, _ := strings.Cut(tag.Get("json"), ","); name == "client" {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+func callsAny(fn *ast.FuncDecl, names map[string]bool) bool {
+	found := false
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if ident, ok := call.Fun.(*ast.Ident); ok && names[ident.Name] {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
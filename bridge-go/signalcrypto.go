@@ -0,0 +1,197 @@
+package main
+
+import "C"
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.mau.fi/libsignal/protocol"
+	"go.mau.fi/libsignal/session"
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// WmClientSignalEncrypt and WmClientSignalDecrypt run arbitrary bytes through
+// the Signal session with one device, for custom peer messages that don't fit
+// SendMessage. They use the same sessions as regular messages: every call
+// advances the ratchet, so ciphertexts must reach the other side in order and
+// a decrypt of something that wasn't encrypted for us can't be undone. whatsmeow
+// only establishes sessions from prekey bundles inside its send path, so
+// encrypting needs an existing session (a message sent to or received from the
+// device). pad applies the random padding WhatsApp uses for message protobufs.
+// whatsmeow's send and receive paths ratchet the same sessions under locks of
+// their own, so these are offline-only tools: both exports refuse to run while
+// the client is connected, and hold its offline lock so the connects the bridge
+// starts (WmClientConnect, reconnects, idle wakes, fleet connects) wait for them.
+// whatsmeow's built-in auto reconnect doesn't take the lock; it never runs after
+// an explicit disconnect.
+
+var (
+	errNoSignalSession = errors.New("no Signal session with the device, exchange a message first")
+	errSignalConnected = errors.New("client is connected, disconnect it before using its Signal sessions")
+)
+
+// beginOffline holds the offline lock of cli for an offline-only operation,
+// failing if the client is connected. end releases it.
+func beginOffline(cli *wa.Client) (end func(), err error) {
+	cfg := configFor(cli)
+	cfg.offlineMu.Lock()
+	if cli.IsConnected() {
+		cfg.offlineMu.Unlock()
+		return nil, errSignalConnected
+	}
+	return cfg.offlineMu.Unlock, nil
+}
+
+// connectClient connects cli once no offline-only operation is running on it.
+func connectClient(cli *wa.Client) error {
+	cfg := configFor(cli)
+	cfg.offlineMu.Lock()
+	defer cfg.offlineMu.Unlock()
+	return cli.Connect()
+}
+
+func signalCipher(cli *wa.Client, jid types.JID) *session.Cipher {
+	address := jid.SignalAddress()
+	builder := session.NewBuilderFromSignal(cli.Store, address, store.SignalProtobufSerializer)
+	return session.NewCipher(builder, address)
+}
+
+// padPlaintext adds 1-16 bytes each holding the padding length.
+func padPlaintext(plaintext []byte) []byte {
+	var b [1]byte
+	_, _ = rand.Read(b[:])
+	n := int(b[0]&0x0f) + 1
+	padded := make([]byte, len(plaintext), len(plaintext)+n)
+	copy(padded, plaintext)
+	for range n {
+		padded = append(padded, byte(n))
+	}
+	return padded
+}
+
+func unpadPlaintext(plaintext []byte) ([]byte, error) {
+	if len(plaintext) == 0 {
+		return nil, errors.New("plaintext is empty")
+	}
+	n := int(plaintext[len(plaintext)-1])
+	if n == 0 || n > len(plaintext) {
+		return nil, fmt.Errorf("invalid padding length %d", n)
+	}
+	return plaintext[:len(plaintext)-n], nil
+}
+
+//export WmClientSignalEncrypt
+func WmClientSignalEncrypt(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		// device JID; without a device part the primary device
+		JID       string `json:"jid"`
+		Plaintext []byte `json:"plaintext"` // base64
+		Pad       bool   `json:"pad"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	endOffline, err := beginOffline(cli)
+	if err != nil {
+		return fail(err)
+	}
+	defer endOffline()
+	jid, err := types.ParseJID(payload.JID)
+	if err != nil {
+		return fail(err)
+	}
+	ctx := context.Background()
+	has, err := cli.Store.Sessions.HasSession(ctx, jid.SignalAddress().String())
+	if err != nil {
+		return fail(err)
+	} else if !has {
+		return fail(fmt.Errorf("%w: %s", errNoSignalSession, jid))
+	}
+	plaintext := payload.Plaintext
+	if payload.Pad {
+		plaintext = padPlaintext(plaintext)
+	}
+	ciphertext, err := signalCipher(cli, jid).Encrypt(ctx, plaintext)
+	if err != nil {
+		return fail(fmt.Errorf("failed to encrypt for %s: %w", jid, err))
+	}
+	encType := "msg"
+	if ciphertext.Type() == protocol.PREKEY_TYPE {
+		encType = "pkmsg"
+	}
+	return success(map[string]any{"jid": jid.String(), "type": encType, "ciphertext": ciphertext.Serialize()})
+}
+
+//export WmClientSignalDecrypt
+func WmClientSignalDecrypt(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		// sending device JID
+		JID        string `json:"jid"`
+		Type       string `json:"type"`       // msg or pkmsg, as returned by WmClientSignalEncrypt
+		Ciphertext []byte `json:"ciphertext"` // base64
+		Unpad      bool   `json:"unpad"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	endOffline, err := beginOffline(cli)
+	if err != nil {
+		return fail(err)
+	}
+	defer endOffline()
+	jid, err := types.ParseJID(payload.JID)
+	if err != nil {
+		return fail(err)
+	}
+	ctx := context.Background()
+	cipher := signalCipher(cli, jid)
+	serializer := store.SignalProtobufSerializer
+	var plaintext []byte
+	switch payload.Type {
+	case "pkmsg":
+		msg, err := protocol.NewPreKeySignalMessageFromBytes(payload.Ciphertext, serializer.PreKeySignalMessage, serializer.SignalMessage)
+		if err != nil {
+			return fail(fmt.Errorf("invalid pkmsg: %w", err))
+		}
+		plaintext, err = cipher.DecryptMessage(ctx, msg)
+		if err != nil {
+			return fail(fmt.Errorf("failed to decrypt from %s: %w", jid, err))
+		}
+	case "msg":
+		msg, err := protocol.NewSignalMessageFromBytes(payload.Ciphertext, serializer.SignalMessage)
+		if err != nil {
+			return fail(fmt.Errorf("invalid msg: %w", err))
+		}
+		plaintext, err = cipher.Decrypt(ctx, msg)
+		if err != nil {
+			return fail(fmt.Errorf("failed to decrypt from %s: %w", jid, err))
+		}
+	default:
+		return fail(fmt.Errorf("unknown ciphertext type %q, expected msg or pkmsg", payload.Type))
+	}
+	if payload.Unpad {
+		if plaintext, err = unpadPlaintext(plaintext); err != nil {
+			return fail(err)
+		}
+	}
+	return success(map[string]any{"jid": jid.String(), "plaintext": plaintext})
+}
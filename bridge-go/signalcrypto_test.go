@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"testing"
+)
+
+func TestPadPlaintext(t *testing.T) {
+	for _, plaintext := range [][]byte{{}, []byte("a"), []byte("hello world"), bytes.Repeat([]byte{0x10}, 64)} {
+		for range 32 {
+			padded := padPlaintext(plaintext)
+			n := len(padded) - len(plaintext)
+			if n < 1 || n > 16 {
+				t.Fatalf("padding length %d out of range", n)
+			}
+			if !bytes.Equal(padded[:len(plaintext)], plaintext) {
+				t.Fatalf("padding changed the plaintext %q", plaintext)
+			}
+			for _, b := range padded[len(plaintext):] {
+				if int(b) != n {
+					t.Fatalf("padding byte %d, want %d", b, n)
+				}
+			}
+			unpadded, err := unpadPlaintext(padded)
+			if err != nil {
+				t.Fatalf("unpad(pad(%q)): %v", plaintext, err)
+			}
+			if !bytes.Equal(unpadded, plaintext) {
+				t.Fatalf("unpad(pad(%q)) = %q", plaintext, unpadded)
+			}
+		}
+	}
+}
+
+func TestUnpadPlaintext(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []byte
+		want    []byte
+		wantErr bool
+	}{
+		{"empty", nil, nil, true},
+		{"zero length", []byte{'a', 0}, nil, true},
+		{"longer than input", []byte{'a', 3}, nil, true},
+		{"single byte", []byte{'a', 1}, []byte("a"), false},
+		{"only padding", []byte{2, 2}, []byte{}, false},
+		{"full block", append([]byte("ab"), bytes.Repeat([]byte{16}, 16)...), []byte("ab"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unpadPlaintext(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestConnectsWaitForOfflineLock checks that the bridge only connects clients
+// through connectClient, so none connects during a raw Signal operation.
+func TestConnectsWaitForOfflineLock(t *testing.T) {
+	for name, fn := range packageFuncs(t) {
+		if name == "connectClient" {
+			continue
+		}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpr); ok {
+				if sel, ok := call.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Connect" && len(call.Args) == 0 {
+					t.Errorf("%s connects a client without connectClient", name)
+				}
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// When a contact's messages keep failing to decrypt, dropping the Signal
+// session (and possibly the stored identity) of just that contact makes the next
+// message establish a fresh one, without unlinking the whole device.
+
+//export WmClientListSignalSessions
+func WmClientListSignalSessions(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		JID    string `json:"jid"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	jid, err := types.ParseJID(payload.JID)
+	if err != nil {
+		return fail(err)
+	}
+	ctx := context.Background()
+	// a JID with a device part only asks about that device, otherwise every
+	// device the server currently lists for the user
+	deviceJIDs := []types.JID{jid}
+	if jid.Device == 0 {
+		if deviceJIDs, err = cli.GetUserDevices(ctx, []types.JID{jid.ToNonAD()}); err != nil {
+			return fail(err)
+		}
+	}
+	sessions := make([]map[string]any, 0, len(deviceJIDs))
+	for _, dev := range deviceJIDs {
+		address := dev.SignalAddress().String()
+		has, err := cli.Store.Sessions.HasSession(ctx, address)
+		if err != nil {
+			return fail(err)
+		}
+		sessions = append(sessions, map[string]any{"jid": dev.String(), "address": address, "has_session": has})
+	}
+	return success(map[string]any{"sessions": sessions})
+}
+
+//export WmClientDeleteSignalSession
+func WmClientDeleteSignalSession(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		JID    string `json:"jid"`
+		// every device of the user instead of only the one in jid (device 0 is
+		// the primary phone)
+		All bool `json:"all"`
+		// also forget the stored identity key, so a changed key is accepted again
+		Identity bool `json:"identity"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	jid, err := types.ParseJID(payload.JID)
+	if err != nil {
+		return fail(err)
+	}
+	ctx := context.Background()
+	if !payload.All {
+		address := jid.SignalAddress().String()
+		if err = cli.Store.Sessions.DeleteSession(ctx, address); err != nil {
+			return fail(err)
+		}
+		if payload.Identity {
+			if err = cli.Store.Identities.DeleteIdentity(ctx, address); err != nil {
+				return fail(err)
+			}
+		}
+		return success(map[string]any{"scope": "device"})
+	}
+	user := jid.SignalAddressUser()
+	if err = cli.Store.Sessions.DeleteAllSessions(ctx, user); err != nil {
+		return fail(err)
+	}
+	if payload.Identity {
+		if err = cli.Store.Identities.DeleteAllIdentities(ctx, user); err != nil {
+			return fail(err)
+		}
+	}
+	return success(map[string]any{"scope": "user"})
+}
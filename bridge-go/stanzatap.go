@@ -0,0 +1,233 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// whatsmeow logs every node it sends and receives as XML on the Client/Send
+// and Client/Recv debug loggers. WmClientSetStanzaTap picks those lines up for
+// one client (whatever its log level), decodes them into {tag, attrs,
+// children, content} trees and mirrors them as "stanza" events and/or JSON
+// lines appended to a file. Contents of key material tags are replaced by
+// their length, and stanzas over max_bytes are reported without the tree.
+// Binary contents are already shortened by whatsmeow.
+
+var defaultRedactTags = []string{
+	"enc", "key", "skey", "identity", "signature", "registration", "device-identity", "plaintext",
+}
+
+type stanzaTap struct {
+	cli      *wa.Client
+	events   bool
+	file     *os.File
+	path     string
+	maxBytes int
+	redact   map[string]bool
+	mu       sync.Mutex // serializes file writes
+}
+
+var (
+	stanzaTapsMu sync.RWMutex
+	stanzaTaps   = map[handle]*stanzaTap{}
+	// stanzaTapCount lets loggers skip the lookup when no tap is on
+	stanzaTapCount atomic.Int32
+)
+
+// tapLogLine is called for the debug lines of client loggers.
+func tapLogLine(client handle, module, msg string, args []interface{}) {
+	var direction string
+	switch {
+	case strings.HasSuffix(module, "/Send"):
+		direction = "out"
+	case strings.HasSuffix(module, "/Recv"):
+		direction = "in"
+	default:
+		return
+	}
+	stanzaTapsMu.RLock()
+	tap := stanzaTaps[client]
+	stanzaTapsMu.RUnlock()
+	if tap != nil {
+		tap.record(direction, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (t *stanzaTap) record(direction, raw string) {
+	ev := map[string]any{"type": "stanza", "direction": direction, "size": len(raw), "time": time.Now().UnixMilli()}
+	if len(raw) > t.maxBytes {
+		ev["truncated"] = true
+	} else if node, err := t.decode(raw); err != nil {
+		ev["error"] = err.Error()
+	} else {
+		ev["node"] = node
+	}
+	if t.file != nil {
+		line, _ := json.Marshal(ev)
+		t.mu.Lock()
+		_, _ = t.file.Write(append(line, '\n'))
+		t.mu.Unlock()
+	}
+	if t.events {
+		delete(ev, "time")
+		emitBridgeEvent(t.cli, ev)
+	}
+}
+
+// decode parses the XMLString form of a node.
+func (t *stanzaTap) decode(raw string) (map[string]any, error) {
+	dec := xml.NewDecoder(strings.NewReader(raw))
+	dec.Strict = false
+	var stack []map[string]any
+	var root map[string]any
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			node := map[string]any{"tag": tok.Name.Local}
+			if len(tok.Attr) > 0 {
+				attrs := make(map[string]any, len(tok.Attr))
+				for _, a := range tok.Attr {
+					attrs[a.Name.Local] = a.Value
+				}
+				node["attrs"] = attrs
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				children, _ := parent["children"].([]map[string]any)
+				parent["children"] = append(children, node)
+			} else if root == nil {
+				root = node
+			}
+			stack = append(stack, node)
+		case xml.CharData:
+			text := strings.TrimSpace(string(tok))
+			if text != "" && len(stack) > 0 {
+				node := stack[len(stack)-1]
+				prev, _ := node["content"].(string)
+				node["content"] = prev + text
+			}
+		case xml.EndElement:
+			if len(stack) > 0 {
+				node := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if t.redact[node["tag"].(string)] {
+					t.redactNode(node)
+				}
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("no node in log line")
+	}
+	return root, nil
+}
+
+func (t *stanzaTap) redactNode(node map[string]any) {
+	size := 0
+	if content, ok := node["content"].(string); ok {
+		size = len(content)
+	}
+	if children, ok := node["children"].([]map[string]any); ok {
+		size += len(children)
+	}
+	delete(node, "content")
+	delete(node, "children")
+	node["redacted"] = size
+}
+
+func (t *stanzaTap) close() {
+	if t.file != nil {
+		_ = t.file.Close()
+	}
+}
+
+func removeStanzaTap(h handle) {
+	stanzaTapsMu.Lock()
+	defer stanzaTapsMu.Unlock()
+	if tap := stanzaTaps[h]; tap != nil {
+		tap.close()
+		delete(stanzaTaps, h)
+		stanzaTapCount.Add(-1)
+	}
+}
+
+func stopStanzaTaps(cli *wa.Client) {
+	stanzaTapsMu.Lock()
+	defer stanzaTapsMu.Unlock()
+	for h, tap := range stanzaTaps {
+		if tap.cli == cli {
+			tap.close()
+			delete(stanzaTaps, h)
+			stanzaTapCount.Add(-1)
+		}
+	}
+}
+
+//export WmClientSetStanzaTap
+func WmClientSetStanzaTap(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client     uint64    `json:"client"`
+		Enabled    bool      `json:"enabled"`
+		Events     *bool     `json:"events"` // default true
+		File       string    `json:"file"`
+		MaxBytes   int       `json:"max_bytes"`
+		RedactTags *[]string `json:"redact_tags"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	h := handle(payload.Client)
+	removeStanzaTap(h)
+	if !payload.Enabled {
+		return success(map[string]any{"enabled": false})
+	}
+	tap := &stanzaTap{cli: cli, events: payload.Events == nil || *payload.Events, path: payload.File, maxBytes: payload.MaxBytes, redact: map[string]bool{}}
+	if tap.maxBytes <= 0 {
+		tap.maxBytes = 64 << 10
+	}
+	redact := defaultRedactTags
+	if payload.RedactTags != nil {
+		redact = *payload.RedactTags
+	}
+	for _, tag := range redact {
+		tap.redact[tag] = true
+	}
+	if !tap.events && tap.path == "" {
+		return fail(errors.New("a tap needs events or a file"))
+	}
+	if tap.path != "" {
+		f, err := os.OpenFile(tap.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return fail(err)
+		}
+		tap.file = f
+	}
+	stanzaTapsMu.Lock()
+	stanzaTaps[h] = tap
+	stanzaTapCount.Add(1)
+	stanzaTapsMu.Unlock()
+	return success(map[string]any{"enabled": true, "events": tap.events, "file": tap.path, "max_bytes": tap.maxBytes, "redact_tags": redact})
+}
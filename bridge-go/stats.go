@@ -0,0 +1,86 @@
+package main
+
+import "C"
+import (
+	"runtime"
+	"sync"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// WmRuntimeStats is a snapshot for monitoring an embedded bridge: Go
+// runtime numbers, how many handles each registry holds, the queue of every
+// event stream and the connection state of every client.
+
+func registryCount[T any](mu *sync.RWMutex, m map[handle]T) int {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(m)
+}
+
+//export WmRuntimeStats
+func WmRuntimeStats(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	clientsMu.RLock()
+	clientHandles := make(map[*wa.Client]handle, len(clients))
+	clientStates := make([]map[string]any, 0, len(clients))
+	for h, cli := range clients {
+		clientHandles[cli] = h
+		state := map[string]any{
+			"handle":    uint64(h),
+			"connected": cli.IsConnected(),
+			"logged_in": cli.IsLoggedIn(),
+		}
+		if jid := cli.Store.GetJID(); !jid.IsEmpty() {
+			state["jid"] = jid.String()
+		}
+		clientStates = append(clientStates, state)
+	}
+	clientsMu.RUnlock()
+
+	eventsMu.RLock()
+	streams := make([]map[string]any, 0, len(eventsMap))
+	for h, es := range eventsMap {
+		st := es.stats()
+		st["handle"] = uint64(h)
+		st["client"] = uint64(clientHandles[es.client])
+		streams = append(streams, st)
+	}
+	eventsMu.RUnlock()
+
+	opsMu.Lock()
+	opCount := len(ops)
+	opsMu.Unlock()
+
+	return success(map[string]any{
+		"goroutines": runtime.NumGoroutine(),
+		"memory": map[string]any{
+			"heap_alloc":   mem.HeapAlloc,
+			"heap_inuse":   mem.HeapInuse,
+			"heap_objects": mem.HeapObjects,
+			"sys":          mem.Sys,
+			"num_gc":       mem.NumGC,
+		},
+		"handles": map[string]any{
+			"containers":     registryCount(&containersMu, containers),
+			"devices":        registryCount(&devicesMu, devices),
+			"clients":        len(clientStates),
+			"qr_channels":    registryCount(&qrsMu, qrs),
+			"event_streams":  len(streams),
+			"media_jobs":     registryCount(&mediaJobsMu, mediaJobs),
+			"event_sockets":  registryCount(&eventSocketsMu, eventSockets),
+			"log_streams":    registryCount(&logStreamsMu, logStreams),
+			"store_backends": registryCount(&storeBackendsMu, storeBackends),
+			"rest_servers":   registryCount(&restServersMu, restServers),
+			"operations":     opCount,
+		},
+		"event_streams": streams,
+		"clients":       clientStates,
+		"media":         globalMediaSlots.stats(),
+		"scheduler":     tasks.stats(),
+		"reconnects":    reconnectTasks.stats(),
+	})
+}
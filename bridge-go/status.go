@@ -0,0 +1,149 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+const statusLifetime = 24 * time.Hour
+
+// pruneExpiredStatuses drops archived statuses older than statusLifetime, they
+// can't be downloaded or viewed anymore.
+func pruneExpiredStatuses(ctx context.Context, db *bridgeDB, ourJID string) error {
+	_, err := db.db.ExecContext(ctx, `DELETE FROM wmnode_messages WHERE our_jid=$1 AND chat=$2 AND timestamp<$3`,
+		ourJID, types.StatusBroadcastJID.String(), time.Now().Add(-statusLifetime).UnixMilli())
+	return err
+}
+
+//export WmClientListStatuses
+func WmClientListStatuses(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		Sender string `json:"sender"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return fail(err)
+	}
+	ctx := context.Background()
+	ourJID := cli.Store.GetJID().ToNonAD().String()
+	cutoff := time.Now().Add(-statusLifetime).UnixMilli()
+	_ = pruneExpiredStatuses(ctx, db, ourJID)
+	query := `SELECT ` + archivedMessageColumns + ` FROM wmnode_messages WHERE our_jid=$1 AND chat=$2 AND timestamp>=$3`
+	args := []any{ourJID, types.StatusBroadcastJID.String(), cutoff}
+	if payload.Sender != "" {
+		sender, err := types.ParseJID(payload.Sender)
+		if err != nil {
+			return fail(err)
+		}
+		query += ` AND sender=$4`
+		args = append(args, sender.ToNonAD().String())
+	}
+	rows, err := db.db.QueryContext(ctx, query+` ORDER BY timestamp`, args...)
+	if err != nil {
+		return fail(err)
+	}
+	defer rows.Close()
+	statuses := []map[string]any{}
+	for rows.Next() {
+		msg, err := scanArchivedMessage(rows)
+		if err != nil {
+			return fail(err)
+		}
+		statuses = append(statuses, serializeArchivedMessage(msg))
+	}
+	if err := rows.Err(); err != nil {
+		return fail(err)
+	}
+	return success(map[string]any{"statuses": statuses})
+}
+
+//export WmClientDownloadStatus
+func WmClientDownloadStatus(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+		ID     string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	ctx, cancel := clientContext(cli)
+	defer cancel()
+	msg, err := getArchivedMessage(ctx, cli, types.StatusBroadcastJID, types.MessageID(payload.ID))
+	if err != nil {
+		return fail(err)
+	}
+	if msg == nil {
+		return fail(fmt.Errorf("status %s not found", payload.ID))
+	}
+	dl, kind, mimetype := downloadableFromMessage(msg.Message)
+	if dl == nil {
+		return fail(errors.New("status has no media"))
+	}
+	release, err := acquireMedia(ctx, cli)
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+	data, err := cli.Download(ctx, dl)
+	if err != nil {
+		return fail(err)
+	}
+	return success(map[string]any{"data": base64.StdEncoding.EncodeToString(data), "media_type": kind, "mimetype": mimetype})
+}
+
+//export WmClientMarkStatusViewed
+func WmClientMarkStatusViewed(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64   `json:"client"`
+		Sender string   `json:"sender"`
+		IDs    []string `json:"ids"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	if len(payload.IDs) == 0 {
+		return fail(errors.New("ids is required"))
+	}
+	sender, err := types.ParseJID(payload.Sender)
+	if err != nil {
+		return fail(err)
+	}
+	ids := make([]types.MessageID, len(payload.IDs))
+	for i, id := range payload.IDs {
+		ids[i] = types.MessageID(id)
+	}
+	// Status views are plain read receipts in the status@broadcast chat with the poster as participant.
+	if err := cli.MarkRead(ids, time.Now(), types.StatusBroadcastJID, sender); err != nil {
+		return fail(err)
+	}
+	return success(map[string]any{})
+}
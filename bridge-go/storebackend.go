@@ -0,0 +1,239 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mau.fi/whatsmeow/store"
+)
+
+// A store backend lets Node persist a device's signal and app state keys in its
+// own database. The bridge implements the whatsmeow store interfaces on top of a
+// small key-value protocol (get, put, delete, delete_prefix, scan within a
+// namespace, itself within a per-device scope); each operation is queued for
+// Node, which picks it up with WmStoreNext and answers with WmStoreRespond. The
+// device record itself (JID, identity and noise keys) stays in the container's
+// sqlstore. Exports block the Node thread calling them while they wait for the
+// store, so requests must be served from another thread (serveStoreBackend runs
+// the backend in a worker).
+
+type storeRequest struct {
+	ID        uint64 `json:"id"`
+	Op        string `json:"op"`
+	Scope     string `json:"scope"`
+	Namespace string `json:"ns"`
+	Key       string `json:"key,omitempty"`
+	Value     []byte `json:"value,omitempty"`
+	Prefix    string `json:"prefix,omitempty"`
+}
+
+type storeEntry struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type storeReply struct {
+	Value   []byte       `json:"value"`
+	Entries []storeEntry `json:"entries"`
+	Error   string       `json:"error"`
+}
+
+type storeBackend struct {
+	requests chan *storeRequest
+	timeout  time.Duration
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	mu      sync.Mutex
+	nextID  atomic.Uint64
+	pending map[uint64]chan storeReply
+}
+
+var (
+	storeBackendsMu sync.RWMutex
+	storeBackends   = map[handle]*storeBackend{}
+)
+
+var errStoreBackendClosed = errors.New("store backend closed")
+
+func (b *storeBackend) do(ctx context.Context, req *storeRequest) (storeReply, error) {
+	req.ID = b.nextID.Add(1)
+	ch := make(chan storeReply, 1)
+	b.mu.Lock()
+	b.pending[req.ID] = ch
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.pending, req.ID)
+		b.mu.Unlock()
+	}()
+	timer := time.NewTimer(b.timeout)
+	defer timer.Stop()
+	select {
+	case b.requests <- req:
+	case <-b.ctx.Done():
+		return storeReply{}, errStoreBackendClosed
+	case <-ctx.Done():
+		return storeReply{}, ctx.Err()
+	case <-timer.C:
+		return storeReply{}, fmt.Errorf("store backend didn't pick up %s %s in time", req.Op, req.Namespace)
+	}
+	select {
+	case reply := <-ch:
+		if reply.Error != "" {
+			return reply, fmt.Errorf("store backend: %s", reply.Error)
+		}
+		return reply, nil
+	case <-b.ctx.Done():
+		return storeReply{}, errStoreBackendClosed
+	case <-ctx.Done():
+		return storeReply{}, ctx.Err()
+	case <-timer.C:
+		return storeReply{}, fmt.Errorf("store backend didn't answer %s %s in time", req.Op, req.Namespace)
+	}
+}
+
+func (b *storeBackend) close() {
+	b.cancel()
+}
+
+//export WmStoreBackendCreate
+func WmStoreBackendCreate(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		TimeoutMs int `json:"timeout_ms"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	if payload.TimeoutMs <= 0 {
+		payload.TimeoutMs = 10_000
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &storeBackend{
+		requests: make(chan *storeRequest),
+		timeout:  time.Duration(payload.TimeoutMs) * time.Millisecond,
+		ctx:      ctx,
+		cancel:   cancel,
+		pending:  map[uint64]chan storeReply{},
+	}
+	h := newHandle()
+	storeBackendsMu.Lock()
+	storeBackends[h] = b
+	storeBackendsMu.Unlock()
+	return success(map[string]any{"handle": uint64(h)})
+}
+
+//export WmStoreNext
+func WmStoreNext(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Handle    uint64 `json:"handle"`
+		TimeoutMs int    `json:"timeoutMs"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	storeBackendsMu.RLock()
+	b := storeBackends[handle(payload.Handle)]
+	storeBackendsMu.RUnlock()
+	if b == nil {
+		return fail(errors.New("store backend handle not found"))
+	}
+	var timeout <-chan time.Time
+	if payload.TimeoutMs > 0 {
+		timeout = time.After(time.Duration(payload.TimeoutMs) * time.Millisecond)
+	} else {
+		timeout = make(<-chan time.Time)
+	}
+	select {
+	case req := <-b.requests:
+		return success(req)
+	case <-timeout:
+		return success(map[string]any{"op": "timeout"})
+	case <-b.ctx.Done():
+		return success(map[string]any{"op": "closed"})
+	}
+}
+
+//export WmStoreRespond
+func WmStoreRespond(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Handle uint64 `json:"handle"`
+		ID     uint64 `json:"id"`
+		storeReply
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	storeBackendsMu.RLock()
+	b := storeBackends[handle(payload.Handle)]
+	storeBackendsMu.RUnlock()
+	if b == nil {
+		return fail(errors.New("store backend handle not found"))
+	}
+	b.mu.Lock()
+	ch := b.pending[payload.ID]
+	b.mu.Unlock()
+	if ch == nil {
+		return fail(errors.New("store request not pending (already answered or timed out)"))
+	}
+	select {
+	case ch <- payload.storeReply:
+	default:
+	}
+	return success(map[string]any{})
+}
+
+//export WmDeviceUseStoreBackend
+func WmDeviceUseStoreBackend(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Device  uint64 `json:"device"`
+		Backend uint64 `json:"backend"`
+		// keeps devices sharing a backend apart, defaults to the device JID
+		Scope string `json:"scope"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	devicesMu.RLock()
+	dev := devices[handle(payload.Device)]
+	devicesMu.RUnlock()
+	if dev == nil {
+		return fail(errors.New("device handle not found"))
+	}
+	storeBackendsMu.RLock()
+	b := storeBackends[handle(payload.Backend)]
+	storeBackendsMu.RUnlock()
+	if b == nil {
+		return fail(errors.New("store backend handle not found"))
+	}
+	if payload.Scope == "" {
+		if dev.ID == nil {
+			return fail(errors.New("scope is required for devices that aren't paired yet"))
+		}
+		payload.Scope = dev.ID.ToNonAD().String()
+	}
+	useKVStore(dev, b, payload.Scope)
+	return success(map[string]any{"scope": payload.Scope})
+}
+
+// useKVStore points the key stores of dev at the backend. It must run before a
+// client is created for the device.
+func useKVStore(dev *store.Device, b *storeBackend, scope string) {
+	kv := &kvStore{backend: b, scope: scope}
+	dev.Identities = kv
+	dev.Sessions = kv
+	dev.PreKeys = kv
+	dev.SenderKeys = kv
+	dev.AppStateKeys = kv
+	dev.AppState = kv
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Stores can be encrypted at rest with SQLCipher. whatsmeow reads and writes its
+// key material itself, so encrypting single columns would need a fork of
+// sqlstore; encrypting the whole file covers those and the bridge tables alike.
+// The bridge must be linked against SQLCipher for this (see the README), which
+// is checked when the container is opened rather than failing later.
+
+// cipherDeferredPragmas are the go-sqlite3 DSN parameters whose PRAGMA may read
+// the database file. go-sqlite3 runs them before the connect hook, which is too
+// early for an encrypted file, so they're taken out of the DSN and run after
+// the key instead.
+var cipherDeferredPragmas = map[string]string{
+	"_journal_mode": "journal_mode",
+	"_journal":      "journal_mode",
+	"_synchronous":  "synchronous",
+	"_sync":         "synchronous",
+	"_auto_vacuum":  "auto_vacuum",
+	"_vacuum":       "auto_vacuum",
+	"_foreign_keys": "foreign_keys",
+	"_fk":           "foreign_keys",
+	"_locking_mode": "locking_mode",
+	"_locking":      "locking_mode",
+}
+
+// cipherConnector opens connections keyed with passphrase. Being a connector
+// rather than a registered driver, each container keeps its own key without
+// adding a driver to database/sql's global registry.
+type cipherConnector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+func (c *cipherConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *cipherConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func isPragmaValue(v string) bool {
+	for _, c := range v {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return v != ""
+}
+
+func newCipherConnector(address, passphrase string) (*cipherConnector, error) {
+	base, rawQuery, _ := strings.Cut(address, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sqlite address parameters: %w", err)
+	}
+	// the key must be the first statement on every new connection
+	statements := []string{"PRAGMA key = '" + strings.ReplaceAll(passphrase, "'", "''") + "'"}
+	for _, param := range slices.Sorted(maps.Keys(cipherDeferredPragmas)) {
+		if !query.Has(param) {
+			continue
+		}
+		pragma, value := cipherDeferredPragmas[param], query.Get(param)
+		query.Del(param)
+		if !isPragmaValue(value) {
+			return nil, fmt.Errorf("invalid %s value %q", param, value)
+		}
+		statements = append(statements, fmt.Sprintf("PRAGMA %s = %s", pragma, value))
+	}
+	dsn := base
+	if len(query) > 0 {
+		dsn += "?" + query.Encode()
+	}
+	return &cipherConnector{
+		dsn: dsn,
+		driver: &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				for _, stmt := range statements {
+					if _, err := conn.Exec(stmt, nil); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	}, nil
+}
+
+func openEncryptedSQLite(address, passphrase string) (*sql.DB, error) {
+	if passphrase == "" {
+		return nil, errors.New("encryption passphrase is empty")
+	}
+	connector, err := newCipherConnector(address, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(connector)
+	var version string
+	err = db.QueryRow("PRAGMA cipher_version").Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && version == "") {
+		_ = db.Close()
+		return nil, errors.New("store encryption needs the bridge to be built against SQLCipher")
+	}
+	var tables int
+	if err == nil {
+		err = db.QueryRow("SELECT count(*) FROM sqlite_master").Scan(&tables)
+	}
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("wrong passphrase or unencrypted database: %w", err)
+	}
+	return db, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+)
+
+// Several containers can be open at once, one per tenant. On postgres, tenants
+// can share a database by giving each container its own schema: the schema is
+// created when missing and put on the connection's search_path, so whatsmeow's
+// fixed table names resolve inside it. SQLite tenants simply use separate files.
+//
+// Devices and clients belong to the container they were loaded from, so
+// releasing a container first releases them, along with the event streams, QR
+// channels, media jobs and log streams of those clients.
+
+var schemaNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
+// tenantSchemaOptions adds the search_path for a tenant schema to the driver options.
+func tenantSchemaOptions(dialect, schema string, opts map[string]string) (map[string]string, error) {
+	if schema == "" {
+		return opts, nil
+	}
+	if dialect != "postgres" {
+		return nil, fmt.Errorf("schemas are only supported for postgres, use a separate file per tenant with %s", dialect)
+	}
+	if !schemaNamePattern.MatchString(schema) {
+		return nil, fmt.Errorf("invalid schema name %q", schema)
+	}
+	if _, ok := opts["search_path"]; ok {
+		return nil, fmt.Errorf("schema and the search_path driver option can't be combined")
+	}
+	withSchema := map[string]string{"search_path": schema}
+	for k, v := range opts {
+		withSchema[k] = v
+	}
+	return withSchema, nil
+}
+
+func createTenantSchema(ctx context.Context, db *sql.DB, schema string) error {
+	// the name is validated above, so quoting is enough
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS "%s"`, schema)); err != nil {
+		return fmt.Errorf("failed to create schema %s: %w", schema, err)
+	}
+	return nil
+}
+
+// teardownClient stops everything the bridge runs for a client and disconnects it.
+func teardownClient(cl *wa.Client) {
+	stopNewsletterLiveUpdates(cl)
+	stopWebhook(cl)
+	stopAutoDownload(cl)
+	stopReconnect(cl)
+	stopIdleWatch(cl)
+	dropRateBuckets(cl)
+	stopMessageRecovery(cl)
+	stopStanzaTaps(cl)
+	stopLogSinks(cl)
+	dropTasks(cl)
+	dropClientConfig(cl)
+	cl.Disconnect()
+}
+
+// releaseClientStreams drops the handles that read from a client.
+func releaseClientStreams(h handle, cl *wa.Client) {
+	eventsMu.Lock()
+	for k, es := range eventsMap {
+		if es.client == cl {
+			es.cancel()
+			delete(eventsMap, k)
+		}
+	}
+	eventsMu.Unlock()
+	qrsMu.Lock()
+	for k, st := range qrs {
+		if st.client == cl {
+			st.cancel()
+			delete(qrs, k)
+		}
+	}
+	qrsMu.Unlock()
+	mediaJobsMu.Lock()
+	for k, job := range mediaJobs {
+		if job.client == cl {
+			job.cancel()
+			delete(mediaJobs, k)
+		}
+	}
+	mediaJobsMu.Unlock()
+	logStreamsMu.Lock()
+	for k, ls := range logStreams {
+		if ls.client == h {
+			ls.cancel()
+			delete(logStreams, k)
+			logStreamCount.Add(-1)
+		}
+	}
+	logStreamsMu.Unlock()
+}
+
+// releaseContainerDependents releases the clients and device handles of a container.
+func releaseContainerDependents(cont *sqlstore.Container) {
+	owned := map[handle]*wa.Client{}
+	clientsMu.Lock()
+	for h, cl := range clients {
+		if cl.Store.Container == cont {
+			owned[h] = cl
+			delete(clients, h)
+		}
+	}
+	clientsMu.Unlock()
+	for h, cl := range owned {
+		releaseClientStreams(h, cl)
+		teardownClient(cl)
+		dropPingRTT(h)
+	}
+	devicesMu.Lock()
+	for h, dev := range devices {
+		if dev.Container == cont {
+			delete(devices, h)
+		}
+	}
+	devicesMu.Unlock()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// eventTime marks a timestamp inside a serialized event. serializeEvent rewrites
+// it according to the stream's timestamp_format before the event leaves the
+// bridge; if one slips through it still marshals as an RFC3339 string. Zero
+// times are "" and 0 rather than year 1.
+type eventTime time.Time
+
+func (t eventTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.rfc3339())
+}
+
+func (t eventTime) rfc3339() string {
+	if time.Time(t).IsZero() {
+		return ""
+	}
+	return time.Time(t).Format(time.RFC3339)
+}
+
+func (t eventTime) unixMilli() int64 {
+	if time.Time(t).IsZero() {
+		return 0
+	}
+	return time.Time(t).UnixMilli()
+}
+
+// Timestamp formats accepted in serializeOptions. The default ("" or "both")
+// keeps the RFC3339 string and adds the unix-ms value under <field>_ms.
+const (
+	timestampFormatBoth    = "both"
+	timestampFormatRFC3339 = "rfc3339"
+	timestampFormatUnixMs  = "unix_ms"
+)
+
+func (o *serializeOptions) normalize() error {
+	switch o.TimestampFormat {
+	case "", timestampFormatBoth:
+		o.TimestampFormat = ""
+	case timestampFormatRFC3339, timestampFormatUnixMs:
+	default:
+		return fmt.Errorf("unknown timestamp_format %q", o.TimestampFormat)
+	}
+	return nil
+}
+
+// formatEventTimes replaces the eventTime values in m (and nested maps) in place.
+func formatEventTimes(m map[string]any, format string) {
+	for key, val := range m {
+		switch v := val.(type) {
+		case eventTime:
+			switch format {
+			case timestampFormatRFC3339:
+				m[key] = v.rfc3339()
+			case timestampFormatUnixMs:
+				m[key] = v.unixMilli()
+			default:
+				m[key] = v.rfc3339()
+				m[key+"_ms"] = v.unixMilli()
+			}
+		case map[string]any:
+			formatEventTimes(v, format)
+		case []map[string]any:
+			for _, item := range v {
+				formatEventTimes(item, format)
+			}
+		case []any:
+			for _, item := range v {
+				if mm, ok := item.(map[string]any); ok {
+					formatEventTimes(mm, format)
+				}
+			}
+		}
+	}
+}
+
+// cloneEventMap copies the map structure of ev so it can be formatted per stream.
+// Leaf values are shared.
+func cloneEventMap(ev map[string]any) map[string]any {
+	out := make(map[string]any, len(ev))
+	for key, val := range ev {
+		switch v := val.(type) {
+		case map[string]any:
+			out[key] = cloneEventMap(v)
+		case []map[string]any:
+			items := make([]map[string]any, len(v))
+			for i, item := range v {
+				items[i] = cloneEventMap(item)
+			}
+			out[key] = items
+		case []any:
+			items := make([]any, len(v))
+			for i, item := range v {
+				if mm, ok := item.(map[string]any); ok {
+					items[i] = cloneEventMap(mm)
+				} else {
+					items[i] = item
+				}
+			}
+			out[key] = items
+		default:
+			out[key] = val
+		}
+	}
+	return out
+}
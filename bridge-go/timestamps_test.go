@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventTimeZero(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		t      eventTime
+		format string
+		want   map[string]any
+	}{
+		{"both", eventTime(ts), "", map[string]any{"at": "2024-05-01T12:30:00Z", "at_ms": ts.UnixMilli()}},
+		{"zero both", eventTime{}, "", map[string]any{"at": "", "at_ms": int64(0)}},
+		{"zero rfc3339", eventTime{}, timestampFormatRFC3339, map[string]any{"at": ""}},
+		{"zero unix_ms", eventTime{}, timestampFormatUnixMs, map[string]any{"at": int64(0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := map[string]any{"at": tt.t}
+			formatEventTimes(m, tt.format)
+			if len(m) != len(tt.want) {
+				t.Fatalf("got %v, want %v", m, tt.want)
+			}
+			for k, v := range tt.want {
+				if m[k] != v {
+					t.Errorf("%s = %#v, want %#v", k, m[k], v)
+				}
+			}
+		})
+	}
+}
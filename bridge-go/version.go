@@ -0,0 +1,113 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store"
+)
+
+// WmVersion reports what is running: the bridge version and whatsmeow commit
+// (stamped by scripts/build-go.mjs with -ldflags, "dev"/"" in other builds) and
+// the WhatsApp web version clients advertise when connecting. That version is
+// pinned by whatsmeow and the server eventually refuses it as outdated
+// (client_outdated events). WmSetWAVersion overrides it process-wide without a
+// rebuild, with an explicit version or the latest one published by WhatsApp
+// web; it applies to the next connection of every client.
+
+var (
+	bridgeVersion   = "dev"
+	whatsmeowCommit = ""
+)
+
+// pinnedWAVersion is whatsmeow's own version, restored by WmSetWAVersion with reset.
+var pinnedWAVersion = store.GetWAVersion()
+
+// whatsmeowModuleVersion falls back to the module version from the build info
+// when the commit wasn't stamped.
+func whatsmeowModuleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != "go.mau.fi/whatsmeow" {
+			continue
+		}
+		if dep.Replace != nil && dep.Replace.Version != "" {
+			return dep.Replace.Version
+		}
+		return dep.Version
+	}
+	return ""
+}
+
+func waVersionInfo() map[string]any {
+	current := store.GetWAVersion()
+	return map[string]any{
+		"wa_version":        current.String(),
+		"wa_version_pinned": pinnedWAVersion.String(),
+		"overridden":        current != pinnedWAVersion,
+	}
+}
+
+//export WmVersion
+func WmVersion(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	out := waVersionInfo()
+	out["bridge"] = bridgeVersion
+	out["whatsmeow_commit"] = whatsmeowCommit
+	out["whatsmeow_version"] = whatsmeowModuleVersion()
+	out["go"] = runtime.Version()
+	return success(out)
+}
+
+//export WmSetWAVersion
+func WmSetWAVersion(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		// e.g. "2.3000.1023456789"
+		Version string `json:"version"`
+		// fetch the version currently served by web.whatsapp.com
+		Latest bool `json:"latest"`
+		// go back to the version whatsmeow was built with
+		Reset     bool  `json:"reset"`
+		TimeoutMs int64 `json:"timeout_ms"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	switch {
+	case payload.Reset:
+		store.SetWAVersion(pinnedWAVersion)
+	case payload.Latest:
+		timeout := 15 * time.Second
+		if payload.TimeoutMs > 0 {
+			timeout = time.Duration(payload.TimeoutMs) * time.Millisecond
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		latest, err := wa.GetLatestVersion(ctx, http.DefaultClient)
+		if err != nil {
+			return fail(fmt.Errorf("failed to fetch the latest version: %w", err))
+		}
+		store.SetWAVersion(*latest)
+	case payload.Version != "":
+		version, err := store.ParseVersion(payload.Version)
+		if err != nil {
+			return fail(err)
+		}
+		store.SetWAVersion(version)
+	default:
+		return fail(errors.New("one of version, latest and reset is required"))
+	}
+	return success(waVersionInfo())
+}
@@ -0,0 +1,300 @@
+package main
+
+import "C"
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// Newly paired accounts that send a lot right away are the likeliest to be
+// banned. WmClientSetWarmup enrolls a device in a warm-up: for `days` days its
+// sends are capped per day, the ceiling growing from start_per_day to
+// end_per_day (linearly or exponentially), after which the warm-up is over. The
+// enrollment, its profile and the day's count live in wmnode_warmup, so they
+// survive restarts without configuring the client again. Days are counted in
+// 24 hour periods from the enrollment. Every send attempt counts, checked by
+// the same gate as the rate limits (ratelimit.go); once the day's ceiling is
+// reached sends fail until the next day and a warmup_quota_reached event is
+// emitted. WmClientGetWarmupQuota reports the remaining quota.
+
+var errWarmupQuota = errors.New("daily warm-up quota reached")
+
+type warmupProfile struct {
+	Days        int    `json:"days"`
+	StartPerDay int    `json:"start_per_day"`
+	EndPerDay   int    `json:"end_per_day"`
+	Curve       string `json:"curve"` // linear or exponential
+}
+
+func (p *warmupProfile) applyDefaults() error {
+	if p.Days <= 0 {
+		p.Days = 14
+	}
+	if p.StartPerDay <= 0 {
+		p.StartPerDay = 20
+	}
+	if p.EndPerDay <= 0 {
+		p.EndPerDay = 200
+	}
+	if p.EndPerDay < p.StartPerDay {
+		return errors.New("end_per_day must not be lower than start_per_day")
+	}
+	switch p.Curve {
+	case "":
+		p.Curve = "linear"
+	case "linear", "exponential":
+	default:
+		return fmt.Errorf("unknown curve %q", p.Curve)
+	}
+	return nil
+}
+
+// ceiling returns the send limit of a day (starting at 0) of the warm-up.
+func (p *warmupProfile) ceiling(day int) int {
+	if p.Days <= 1 {
+		return p.StartPerDay
+	}
+	frac := float64(day) / float64(p.Days-1)
+	start, end := float64(p.StartPerDay), float64(p.EndPerDay)
+	if p.Curve == "exponential" {
+		return int(math.Round(start * math.Pow(end/start, frac)))
+	}
+	return int(math.Round(start + (end-start)*frac))
+}
+
+type warmupState struct {
+	mu       sync.Mutex
+	loaded   bool
+	enrolled bool
+	profile  warmupProfile
+	started  time.Time
+	day      int // of sent
+	sent     int
+	notified bool // warmup_quota_reached was emitted for day
+}
+
+func (cfg *clientConfig) warmupState() *warmupState {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	if cfg.warmup == nil {
+		cfg.warmup = &warmupState{}
+	}
+	return cfg.warmup
+}
+
+// resetLocked forgets the enrollment so the next loadLocked reads it again. The
+// fields are cleared one by one, overwriting *w would also reset the held mu.
+func (w *warmupState) resetLocked() {
+	w.loaded, w.enrolled = false, false
+	w.profile, w.started = warmupProfile{}, time.Time{}
+	w.day, w.sent, w.notified = 0, 0, false
+}
+
+// loadLocked reads the enrollment of cli once.
+func (w *warmupState) loadLocked(ctx context.Context, cli *wa.Client) error {
+	if w.loaded {
+		return nil
+	}
+	jid := cli.Store.GetJID()
+	if jid.IsEmpty() {
+		// not paired yet, look again once it is
+		return nil
+	}
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return err
+	}
+	var profile string
+	var started, day, sent int64
+	err = db.db.QueryRowContext(ctx, `SELECT profile, started_at, day, sent FROM wmnode_warmup WHERE our_jid=$1`,
+		jid.ToNonAD().String()).Scan(&profile, &started, &day, &sent)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.loaded = true
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err = json.Unmarshal([]byte(profile), &w.profile); err != nil {
+		return fmt.Errorf("invalid stored warm-up profile: %w", err)
+	}
+	w.loaded, w.enrolled = true, true
+	w.started, w.day, w.sent = time.UnixMilli(started), int(day), int(sent)
+	return nil
+}
+
+// rollLocked moves the count to the current day.
+func (w *warmupState) rollLocked(now time.Time) {
+	if day := int(now.Sub(w.started) / (24 * time.Hour)); day != w.day {
+		w.day, w.sent, w.notified = day, 0, false
+	}
+}
+
+// reserveWarmupSend counts a send of cli against its warm-up quota, or fails
+// if the day's quota is used up.
+func reserveWarmupSend(ctx context.Context, cli *wa.Client) error {
+	w := configFor(cli).warmupState()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.loadLocked(ctx, cli); err != nil {
+		cli.Log.Warnf("Failed to load warm-up state: %v", err)
+		return nil
+	}
+	if !w.enrolled {
+		return nil
+	}
+	now := time.Now()
+	w.rollLocked(now)
+	if w.day >= w.profile.Days {
+		return nil
+	}
+	limit := w.profile.ceiling(w.day)
+	if w.sent >= limit {
+		resetsAt := w.started.Add(time.Duration(w.day+1) * 24 * time.Hour)
+		if !w.notified {
+			w.notified = true
+			emitBridgeEvent(cli, map[string]any{
+				"type":      "warmup_quota_reached",
+				"day":       w.day + 1,
+				"days":      w.profile.Days,
+				"limit":     limit,
+				"resets_at": resetsAt.UnixMilli(),
+			})
+		}
+		return fmt.Errorf("%w (%d sends on day %d of %d), resets at %s", errWarmupQuota, limit, w.day+1, w.profile.Days, resetsAt.Format(time.RFC3339))
+	}
+	w.sent++
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return nil
+	}
+	_, err = db.db.ExecContext(ctx, `UPDATE wmnode_warmup SET day=$2, sent=$3 WHERE our_jid=$1`,
+		cli.Store.GetJID().ToNonAD().String(), int64(w.day), int64(w.sent))
+	if err != nil {
+		cli.Log.Warnf("Failed to record warm-up send: %v", err)
+	}
+	return nil
+}
+
+func (w *warmupState) quotaLocked(now time.Time) map[string]any {
+	if !w.enrolled {
+		return map[string]any{"enrolled": false}
+	}
+	w.rollLocked(now)
+	out := map[string]any{
+		"enrolled":   true,
+		"profile":    w.profile,
+		"started_at": w.started.UnixMilli(),
+		"days":       w.profile.Days,
+		"day":        w.day + 1,
+		"completed":  w.day >= w.profile.Days,
+	}
+	if w.day < w.profile.Days {
+		limit := w.profile.ceiling(w.day)
+		out["limit"] = limit
+		out["sent"] = w.sent
+		out["remaining"] = max(limit-w.sent, 0)
+		out["resets_at"] = w.started.Add(time.Duration(w.day+1) * 24 * time.Hour).UnixMilli()
+	}
+	return out
+}
+
+//export WmClientSetWarmup
+func WmClientSetWarmup(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client  uint64 `json:"client"`
+		Enabled bool   `json:"enabled"`
+		// start the warm-up over from today; otherwise an existing enrollment
+		// only gets the new profile
+		Restart bool `json:"restart"`
+		warmupProfile
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	jid := cli.Store.GetJID()
+	if jid.IsEmpty() {
+		return fail(wa.ErrNotLoggedIn)
+	}
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return fail(err)
+	}
+	ctx := context.Background()
+	w := configFor(cli).warmupState()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !payload.Enabled {
+		if _, err = db.db.ExecContext(ctx, `DELETE FROM wmnode_warmup WHERE our_jid=$1`, jid.ToNonAD().String()); err != nil {
+			return fail(err)
+		}
+		w.resetLocked()
+		w.loaded = true
+		return success(map[string]any{"enrolled": false})
+	}
+	profile := payload.warmupProfile
+	if err = profile.applyDefaults(); err != nil {
+		return fail(err)
+	}
+	profileJSON, err := json.Marshal(profile)
+	if err != nil {
+		return fail(err)
+	}
+	now := time.Now()
+	_, err = db.db.ExecContext(ctx, `
+		INSERT INTO wmnode_warmup (our_jid, profile, started_at, day, sent)
+		VALUES ($1, $2, $3, 0, 0)
+		ON CONFLICT (our_jid) DO UPDATE SET profile=excluded.profile
+	`, jid.ToNonAD().String(), string(profileJSON), now.UnixMilli())
+	if err != nil {
+		return fail(err)
+	}
+	if payload.Restart {
+		_, err = db.db.ExecContext(ctx, `UPDATE wmnode_warmup SET started_at=$2, day=0, sent=0 WHERE our_jid=$1`,
+			jid.ToNonAD().String(), now.UnixMilli())
+		if err != nil {
+			return fail(err)
+		}
+	}
+	w.resetLocked()
+	if err = w.loadLocked(ctx, cli); err != nil {
+		return fail(err)
+	}
+	return success(w.quotaLocked(now))
+}
+
+//export WmClientGetWarmupQuota
+func WmClientGetWarmupQuota(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	w := configFor(cli).warmupState()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.loadLocked(context.Background(), cli); err != nil {
+		return fail(err)
+	}
+	return success(w.quotaLocked(time.Now()))
+}
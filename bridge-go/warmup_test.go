@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSetWarmupTwice(t *testing.T) {
+	client, _ := newTestClient(t, "111111111:1@s.whatsapp.net")
+	var quota struct {
+		Enrolled bool `json:"enrolled"`
+		Limit    int  `json:"limit"`
+		Sent     int  `json:"sent"`
+	}
+	steps := []struct {
+		name    string
+		payload map[string]any
+		want    bool
+		limit   int
+	}{
+		{"enable", map[string]any{"enabled": true, "start_per_day": 5, "end_per_day": 50}, true, 5},
+		{"update profile", map[string]any{"enabled": true, "start_per_day": 8, "end_per_day": 50}, true, 8},
+		{"restart", map[string]any{"enabled": true, "restart": true, "start_per_day": 8}, true, 8},
+		{"disable", map[string]any{"enabled": false}, false, 0},
+		{"disable again", map[string]any{"enabled": false}, false, 0},
+		{"enable again", map[string]any{"enabled": true}, true, 20},
+	}
+	for _, step := range steps {
+		step.payload["client"] = client
+		data := callExport(t, "WmClientSetWarmup", step.payload)
+		quota.Enrolled, quota.Limit = false, 0
+		if err := json.Unmarshal(data, &quota); err != nil {
+			t.Fatal(err)
+		}
+		if quota.Enrolled != step.want || quota.Limit != step.limit {
+			t.Errorf("%s: enrolled %v limit %d, want %v and %d", step.name, quota.Enrolled, quota.Limit, step.want, step.limit)
+		}
+	}
+	data := callExport(t, "WmClientGetWarmupQuota", map[string]any{"client": client})
+	if err := json.Unmarshal(data, &quota); err != nil {
+		t.Fatal(err)
+	}
+	if !quota.Enrolled || quota.Sent != 0 {
+		t.Errorf("quota after re-enrolling: %+v", quota)
+	}
+}
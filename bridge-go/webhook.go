@@ -0,0 +1,346 @@
+package main
+
+import "C"
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	wa "go.mau.fi/whatsmeow"
+)
+
+// webhookSink POSTs serialized events of a client to an HTTP endpoint. Events
+// go through a queue table in the container DB first, so anything not yet
+// acknowledged with a 2xx survives restarts and is retried in order.
+//
+// Each request carries X-Wmnode-Event-Id (increasing per account, never reused)
+// and X-Wmnode-Timestamp headers and,
+// when a secret is configured, X-Wmnode-Signature: sha256=HMAC(secret, timestamp + "." + body).
+type webhookSink struct {
+	url         string
+	secret      string
+	filter      *eventFilter
+	maxAttempts int
+	http        *http.Client
+
+	cli    *wa.Client
+	db     *bridgeDB
+	ctx    context.Context
+	cancel context.CancelFunc
+	kick   chan struct{}
+
+	mu        sync.Mutex
+	ourJID    string
+	nextID    int64
+	lastError string
+	delivered atomic.Uint64
+	failed    atomic.Uint64
+}
+
+const (
+	webhookIdleWait   = time.Minute
+	webhookMaxBackoff = 5 * time.Minute
+)
+
+func (cfg *clientConfig) webhookSink() *webhookSink {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.webhook
+}
+
+func stopWebhook(cli *wa.Client) {
+	cfg := configFor(cli)
+	cfg.mu.Lock()
+	if cfg.webhook != nil {
+		cfg.webhook.cancel()
+		cfg.webhook = nil
+	}
+	cfg.mu.Unlock()
+}
+
+// enqueue stores ev for delivery. Failures are logged, the event is then only lost for the webhook.
+func (w *webhookSink) enqueue(ev map[string]any) {
+	eventType, _ := ev["type"].(string)
+	// reporting a failed delivery through the webhook itself would loop
+	if eventType == "webhook_delivery_failed" || !w.filter.allows(eventType) {
+		return
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		w.cli.Log.Warnf("Failed to marshal event for webhook: %v", err)
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ctx := context.Background()
+	ourJID := w.cli.Store.GetJID().ToNonAD().String()
+	if ourJID != w.ourJID {
+		id, err := maxWebhookQueueID(ctx, w.db, ourJID)
+		if err != nil {
+			w.cli.Log.Warnf("Failed to load webhook queue position: %v", err)
+			return
+		}
+		w.ourJID, w.nextID = ourJID, id
+	}
+	err = w.insertLocked(ctx, ourJID, w.nextID+1, eventType, data)
+	if err != nil {
+		w.cli.Log.Warnf("Failed to queue %s event for webhook: %v", eventType, err)
+		return
+	}
+	w.nextID++
+	select {
+	case w.kick <- struct{}{}:
+	default:
+	}
+}
+
+// insertLocked queues an event and records its ID as the account's newest, so
+// IDs keep growing after the queue drains and the bridge restarts.
+func (w *webhookSink) insertLocked(ctx context.Context, ourJID string, id int64, eventType string, data []byte) error {
+	tx, err := w.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO wmnode_webhook_queue (our_jid, id, event_type, payload, next_attempt_at) VALUES ($1, $2, $3, $4, $5)`,
+		ourJID, id, eventType, string(data), time.Now().UnixMilli())
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO wmnode_webhook_seq (our_jid, last_id) VALUES ($1, $2)
+		ON CONFLICT (our_jid) DO UPDATE SET last_id=excluded.last_id
+	`, ourJID, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// maxWebhookQueueID returns the newest event ID given for ourJID, including
+// delivered ones. Queues from before wmnode_webhook_seq only have their rows.
+func maxWebhookQueueID(ctx context.Context, db *bridgeDB, ourJID string) (int64, error) {
+	var queued, last sql.NullInt64
+	err := db.db.QueryRowContext(ctx, `SELECT MAX(id) FROM wmnode_webhook_queue WHERE our_jid=$1`, ourJID).Scan(&queued)
+	if err != nil {
+		return 0, err
+	}
+	err = db.db.QueryRowContext(ctx, `SELECT last_id FROM wmnode_webhook_seq WHERE our_jid=$1`, ourJID).Scan(&last)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	return max(queued.Int64, last.Int64), nil
+}
+
+func (w *webhookSink) run() {
+	for {
+		wait := w.deliverPending()
+		timer := time.NewTimer(wait)
+		select {
+		case <-w.ctx.Done():
+			timer.Stop()
+			return
+		case <-w.kick:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// deliverPending sends queued events oldest first and returns how long to wait
+// before the next attempt. A failing event blocks the ones behind it so the
+// receiver always sees events in order.
+func (w *webhookSink) deliverPending() time.Duration {
+	ourJID := w.cli.Store.GetJID().ToNonAD().String()
+	for w.ctx.Err() == nil {
+		var id, attempts, nextAttempt int64
+		var payload string
+		err := w.db.db.QueryRowContext(w.ctx,
+			`SELECT id, payload, attempts, next_attempt_at FROM wmnode_webhook_queue WHERE our_jid=$1 ORDER BY id LIMIT 1`,
+			ourJID).Scan(&id, &payload, &attempts, &nextAttempt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return webhookIdleWait
+		} else if err != nil {
+			w.setLastError(err)
+			return time.Second
+		}
+		if wait := time.Until(time.UnixMilli(nextAttempt)); wait > 0 {
+			return wait
+		}
+		err = w.post(id, []byte(payload))
+		if err == nil {
+			w.delivered.Add(1)
+			_, _ = w.db.db.ExecContext(w.ctx, `DELETE FROM wmnode_webhook_queue WHERE our_jid=$1 AND id=$2`, ourJID, id)
+			continue
+		}
+		w.setLastError(err)
+		attempts++
+		if attempts >= int64(w.maxAttempts) {
+			w.failed.Add(1)
+			_, _ = w.db.db.ExecContext(w.ctx, `DELETE FROM wmnode_webhook_queue WHERE our_jid=$1 AND id=$2`, ourJID, id)
+			w.cli.Log.Warnf("Giving up on webhook delivery of event %d after %d attempts: %v", id, attempts, err)
+			emitBridgeEvent(w.cli, map[string]any{
+				"type":     "webhook_delivery_failed",
+				"event_id": id,
+				"attempts": attempts,
+				"error":    err.Error(),
+				"event":    json.RawMessage(payload),
+			})
+			continue
+		}
+		backoff := time.Second << min(attempts-1, 16)
+		if backoff > webhookMaxBackoff {
+			backoff = webhookMaxBackoff
+		}
+		_, _ = w.db.db.ExecContext(w.ctx,
+			`UPDATE wmnode_webhook_queue SET attempts=$1, next_attempt_at=$2, last_error=$3 WHERE our_jid=$4 AND id=$5`,
+			attempts, time.Now().Add(backoff).UnixMilli(), err.Error(), ourJID, id)
+		return backoff
+	}
+	return 0
+}
+
+func (w *webhookSink) post(id int64, body []byte) error {
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Wmnode-Event-Id", strconv.FormatInt(id, 10))
+	req.Header.Set("X-Wmnode-Timestamp", ts)
+	if w.secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.secret))
+		mac.Write([]byte(ts + "."))
+		mac.Write(body)
+		req.Header.Set("X-Wmnode-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := w.http.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (w *webhookSink) setLastError(err error) {
+	w.mu.Lock()
+	w.lastError = err.Error()
+	w.mu.Unlock()
+}
+
+func (w *webhookSink) status() map[string]any {
+	w.mu.Lock()
+	lastError := w.lastError
+	w.mu.Unlock()
+	var pending int64
+	_ = w.db.db.QueryRowContext(context.Background(), `SELECT COUNT(*) FROM wmnode_webhook_queue WHERE our_jid=$1`,
+		w.cli.Store.GetJID().ToNonAD().String()).Scan(&pending)
+	return map[string]any{
+		"enabled":    true,
+		"url":        w.url,
+		"pending":    pending,
+		"delivered":  w.delivered.Load(),
+		"failed":     w.failed.Load(),
+		"last_error": lastError,
+	}
+}
+
+//export WmClientSetWebhook
+func WmClientSetWebhook(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client      uint64   `json:"client"`
+		URL         string   `json:"url"`
+		Secret      string   `json:"secret"`
+		Include     []string `json:"include"`
+		Exclude     []string `json:"exclude"`
+		MaxAttempts int      `json:"max_attempts"`
+		TimeoutMs   int      `json:"timeout_ms"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	stopWebhook(cli)
+	if payload.URL == "" {
+		return success(map[string]any{"enabled": false})
+	}
+	u, err := url.Parse(payload.URL)
+	if err != nil {
+		return fail(err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fail(fmt.Errorf("unsupported webhook url scheme %q", u.Scheme))
+	}
+	db, err := bridgeDBForDevice(cli.Store)
+	if err != nil {
+		return fail(err)
+	}
+	if payload.MaxAttempts <= 0 {
+		payload.MaxAttempts = 10
+	}
+	if payload.TimeoutMs <= 0 {
+		payload.TimeoutMs = 10000
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &webhookSink{
+		url:         payload.URL,
+		secret:      payload.Secret,
+		filter:      newEventFilter(payload.Include, payload.Exclude),
+		maxAttempts: payload.MaxAttempts,
+		http:        &http.Client{Timeout: time.Duration(payload.TimeoutMs) * time.Millisecond},
+		cli:         cli,
+		db:          db,
+		ctx:         ctx,
+		cancel:      cancel,
+		kick:        make(chan struct{}, 1),
+	}
+	cfg := configFor(cli)
+	cfg.mu.Lock()
+	cfg.webhook = w
+	cfg.mu.Unlock()
+	go w.run()
+	return success(w.status())
+}
+
+//export WmClientWebhookStatus
+func WmClientWebhookStatus(input *C.char) (ret *C.char) {
+	defer recoverExport(&ret)
+	var payload struct {
+		Client uint64 `json:"client"`
+	}
+	if err := json.Unmarshal([]byte(C.GoString(input)), &payload); err != nil {
+		return fail(fmt.Errorf("invalid json: %w", err))
+	}
+	cli, end, err := beginClientCall(payload.Client, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer end()
+	w := configFor(cli).webhookSink()
+	if w == nil {
+		return success(map[string]any{"enabled": false})
+	}
+	return success(w.status())
+}
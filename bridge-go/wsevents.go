@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// The REST server also pushes events over WebSocket at
+// GET /v1/clients/{client}/events, {client} being a client handle or JID.
+// Browsers can't set headers on a WebSocket, so the token may be passed as
+// ?access_token= instead. The first message from the peer is the subscription,
+// shaped like an event socket hello without "client" ({include, exclude, chats,
+// exclude_chats, raw_proto, timestamp_format, lazy_body}); the bridge answers
+// {"ok":true,"handle":...} and then sends {"client":..., "event":{...}}
+// messages. Later subscription messages replace the filters and options of the
+// stream. A peer that stops reading is dropped after wsWriteTimeout.
+
+var wsUpgrader = websocket.Upgrader{
+	// the token is the access control; dashboards are usually served elsewhere
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+const (
+	wsPingInterval = 30 * time.Second
+	wsWriteTimeout = 10 * time.Second
+)
+
+type wsSubscription struct {
+	Include      []string `json:"include"`
+	Exclude      []string `json:"exclude"`
+	Chats        []string `json:"chats"`
+	ExcludeChats []string `json:"exclude_chats"`
+	serializeOptions
+}
+
+func clientRef(s string) json.RawMessage {
+	if _, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return json.RawMessage(s)
+	}
+	ref, _ := json.Marshal(s)
+	return ref
+}
+
+func serveEventsWebSocket(w http.ResponseWriter, r *http.Request) {
+	cli := findClient(clientRef(r.PathValue("client")))
+	if cli == nil {
+		restError(w, http.StatusNotFound, "client not found")
+		return
+	}
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(maxHelloFrame)
+	writeJSON := func(v any) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return conn.WriteJSON(v)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	var sub wsSubscription
+	if err = conn.ReadJSON(&sub); err != nil {
+		_ = writeJSON(map[string]any{"ok": false, "error": fmt.Sprintf("invalid subscription: %v", err)})
+		return
+	}
+	chats, err := newChatFilter(sub.Chats, sub.ExcludeChats)
+	if err == nil {
+		err = sub.serializeOptions.normalize()
+	}
+	if err != nil {
+		_ = writeJSON(map[string]any{"ok": false, "error": err.Error()})
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	es := &eventStream{ch: make(chan any, 1024), ctx: ctx, cancel: cancel, client: cli, filter: newEventFilter(sub.Include, sub.Exclude), chats: chats, opts: sub.serializeOptions}
+	h := newHandle()
+	eventsMu.Lock()
+	eventsMap[h] = es
+	eventsMu.Unlock()
+	defer func() {
+		eventsMu.Lock()
+		delete(eventsMap, h)
+		eventsMu.Unlock()
+	}()
+	if err = writeJSON(map[string]any{"ok": true, "handle": uint64(h)}); err != nil {
+		return
+	}
+
+	// only the writer loop below may write, so the reader hands replies over
+	replies := make(chan map[string]any, 4)
+	reply := func(msg map[string]any) {
+		select {
+		case replies <- msg:
+		case <-ctx.Done():
+		}
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * wsPingInterval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * wsPingInterval))
+	})
+	go func() {
+		defer cancel()
+		for {
+			var next wsSubscription
+			if err := conn.ReadJSON(&next); err != nil {
+				var syntaxErr *json.SyntaxError
+				var typeErr *json.UnmarshalTypeError
+				if !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) {
+					return // closed or broken connection
+				}
+				reply(map[string]any{"ok": false, "error": fmt.Sprintf("invalid subscription: %v", err)})
+				continue
+			}
+			chats, err := newChatFilter(next.Chats, next.ExcludeChats)
+			if err == nil {
+				err = next.serializeOptions.normalize()
+			}
+			if err != nil {
+				reply(map[string]any{"ok": false, "error": err.Error()})
+				continue
+			}
+			// filters and options are read under eventsMu by deliverEvent
+			eventsMu.Lock()
+			es.filter = newEventFilter(next.Include, next.Exclude)
+			es.chats = chats
+			es.opts = next.serializeOptions
+			eventsMu.Unlock()
+			reply(map[string]any{"ok": true, "handle": uint64(h)})
+		}
+	}()
+
+	clientHandle := uint64(handleOfClient(cli))
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		eventsMu.RLock()
+		filter := es.filter
+		eventsMu.RUnlock()
+		if n := es.pendingDrops.Swap(0); n > 0 && filter.allows("events_dropped") {
+			ev := map[string]any{"type": "events_dropped", "count": n, "total_dropped": es.dropped.Load(), "schema_version": eventSchemaVersion}
+			if writeJSON(map[string]any{"client": clientHandle, "event": ev}) != nil {
+				return
+			}
+		}
+		select {
+		case ev := <-es.ch:
+			es.popped()
+			err = writeJSON(map[string]any{"client": clientHandle, "event": ev})
+		case msg := <-replies:
+			err = writeJSON(msg)
+		case <-ping.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+		case <-ctx.Done():
+			_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -35,6 +35,16 @@ runGo(['mod', 'tidy'])
 // Build c-shared library
 const ext = outExt()
 const out = path.join('..', 'build', `whatsmeow.${ext}`)
-runGo(['build', '-buildmode=c-shared', '-o', out, '.'])
+// Extra build tags, e.g. WHATS_GO_TAGS=libsqlite3 to link a system SQLCipher
+const tags = process.env.WHATS_GO_TAGS ? ['-tags', process.env.WHATS_GO_TAGS] : []
+// Reported by WmVersion
+const pkg = JSON.parse(fs.readFileSync(path.join(__dirname, '..', 'package.json'), 'utf8'))
+const commit = spawnSync('git', ['rev-parse', 'HEAD'], {
+    cwd: path.join(__dirname, '..', 'whatsmeow'),
+    encoding: 'utf8'
+})
+const ldflags = [`-X main.bridgeVersion=${pkg.version}`]
+if (commit.status === 0) ldflags.push(`-X main.whatsmeowCommit=${commit.stdout.trim()}`)
+runGo(['build', '-buildmode=c-shared', ...tags, '-ldflags', ldflags.join(' '), '-o', out, '.'])
 
 console.log(`[whatsmeow-node] Built native: ${out}`)
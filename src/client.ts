@@ -1,5 +1,14 @@
 import { native } from './native.js'
-import { Handle, JID, OpenContainerOptions, QREvent, SendResponse } from './types.js'
+import {
+    EventStreamOptions,
+    Handle,
+    JID,
+    JsonResp,
+    LogRecord,
+    OpenContainerOptions,
+    QREvent,
+    SendResponse
+} from './types.js'
 import type * as proto from '../proto/whatsmeow.js'
 import type { SendRequestExtra } from './types.js'
 import type { ClientEvent } from './events.js'
@@ -29,6 +38,11 @@ export class Container {
         return new Device(res.handle)
     }
 
+    /** Call a sqlstore.Container method by name; devices are passed and returned as handles. */
+    async call<T = any>(method: string, ...args: any[]): Promise<T> {
+        return native.containerCall(this.handle, method, args)
+    }
+
     async close(): Promise<void> {
         native.release(this.handle)
     }
@@ -36,6 +50,14 @@ export class Container {
 
 export class Device {
     constructor(public readonly handle: Handle) {}
+
+    /**
+     * Call a store.Device method by name, or a method of one of its stores
+     * (e.g. store 'contacts' for GetAllContacts).
+     */
+    async call<T = any>(method: string, args: any[] = [], store?: string): Promise<T> {
+        return native.deviceCall(this.handle, method, args, store)
+    }
 }
 
 export class QRChannel {
@@ -53,8 +75,8 @@ export class QRChannel {
 export class Client {
     private constructor(public readonly handle: Handle) {}
 
-    static async create(device: Device): Promise<Client> {
-        const { handle } = native.newClient(device.handle)
+    static async create(device: Device, label?: string): Promise<Client> {
+        const { handle } = native.newClient(device.handle, label)
         return new Client(handle)
     }
 
@@ -109,12 +131,24 @@ export class Client {
         return native.clientCall(this.handle, method, args)
     }
 
+    /**
+     * Run several calls in one crossing. Results are in call order; failed calls
+     * come back as { ok: false, error } instead of throwing.
+     */
+    async callBatch(
+        calls: Array<{ method: string; args?: any[] }>,
+        opts?: { concurrent?: boolean; stopOnError?: boolean }
+    ): Promise<JsonResp<any>[]> {
+        return native.clientCallBatch(this.handle, calls, opts).results
+    }
+
     async sendPresence(state: 'available' | 'unavailable'): Promise<void> {
         native.clientSendPresence(this.handle, state)
     }
 
-    async subscribePresence(jid: JID): Promise<void> {
-        native.clientSubscribePresence(this.handle, jid)
+    // Resolves whether the contact's privacy token was present (see ClientFlags)
+    async subscribePresence(jid: JID): Promise<{ has_token: boolean; token_timestamp?: number }> {
+        return native.clientSubscribePresence(this.handle, jid)
     }
 
     async sendChatPresence(
@@ -171,7 +205,43 @@ export class Client {
         native.clientDisconnect(this.handle)
     }
 
-    events(timeoutMs = 60000): AsyncIterable<ClientEvent> {
+    /**
+     * Forward this client's log records to callback instead of stdout. The records can also
+     * be written as JSON lines to file; stop() restores the shared stdout logging.
+     */
+    onLog(
+        callback: (rec: LogRecord) => void,
+        opts: { level?: string; file?: string } = {}
+    ): { stop(): void } {
+        const client = this.handle as unknown as number
+        native.clientSetLogSink(client, { enabled: true, ...opts })
+        const { handle } = native.logStreamStart({ client })
+        let stopped = false
+        const poll = () => {
+            if (stopped) return
+            let idle = true
+            for (let i = 0; i < 256; i++) {
+                const rec = native.logNext(handle, 1)
+                if (rec.type === 'closed') return
+                if (rec.type !== 'log') break
+                idle = false
+                try {
+                    callback(rec)
+                } catch {}
+            }
+            setTimeout(poll, idle ? 20 : 0)
+        }
+        poll()
+        return {
+            stop() {
+                stopped = true
+                native.release(handle)
+                native.clientSetLogSink(client, { enabled: false })
+            }
+        }
+    }
+
+    events(timeoutMs = 60000, opts?: EventStreamOptions): AsyncIterable<ClientEvent> {
         const self = this
         return {
             [Symbol.asyncIterator](): AsyncIterator<ClientEvent> {
@@ -179,7 +249,7 @@ export class Client {
                 let h: Handle | null = null
                 const ensure = () => {
                     if (h === null) {
-                        const { handle } = native.clientStartEvents(self.handle)
+                        const { handle } = native.clientStartEvents(self.handle, opts)
                         h = handle
                     }
                 }
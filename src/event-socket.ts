@@ -0,0 +1,142 @@
+import { connect, type Socket } from 'node:net'
+import { EventEmitter } from 'node:events'
+import type { ClientEvent } from './events.js'
+import type { EventStreamOptions } from './types.js'
+
+export interface EventSocketSubscription {
+    /** Subscribe to events received over the socket. Returns an unsubscribe fn. */
+    onEvent(cb: (ev: ClientEvent, client: number) => void): () => void
+    /** Subscribe to connection / protocol errors. Returns an unsubscribe fn. */
+    onError(cb: (err: any) => void): () => void
+    /** Close the connection; the bridge drops the stream. */
+    close(): void
+    /**
+     * Iterate over the events received from now on. Errors nobody subscribed to
+     * with onError end the iteration by rejecting next().
+     */
+    events(): AsyncIterable<ClientEvent>
+    socket: Socket
+}
+
+/**
+ * Subscribe to a client's events through a socket opened with native.eventSocketListen.
+ * Works from any process on the same machine; `client` is the client handle or its JID.
+ * Only JSON-framed sockets are supported here.
+ */
+export function subscribeEventSocket(
+    path: string,
+    client: number | string,
+    opts?: EventStreamOptions
+): EventSocketSubscription {
+    const emitter = new EventEmitter()
+    const socket = connect(path)
+    let buf = Buffer.alloc(0)
+    let greeted = false
+    // iteration state, only buffered while events() is being iterated
+    let iterating = false
+    let ended = false
+    let failure: any = null
+    const queue: ClientEvent[] = []
+    let wake: (() => void) | null = null
+    const notify = () => {
+        const w = wake
+        wake = null
+        w?.()
+    }
+
+    const fail = (err: any) => {
+        if (emitter.listenerCount('error') > 0) {
+            emitter.emit('error', err)
+        } else if (failure === null) {
+            failure = err
+        }
+        notify()
+    }
+
+    const frame = (body: Buffer) => {
+        const header = Buffer.alloc(4)
+        header.writeUInt32BE(body.length)
+        return Buffer.concat([header, body])
+    }
+
+    socket.on('connect', () => {
+        socket.write(frame(Buffer.from(JSON.stringify({ client, ...opts }))))
+    })
+    socket.on('data', (chunk: Buffer) => {
+        buf = Buffer.concat([buf, chunk])
+        while (buf.length >= 4) {
+            const size = buf.readUInt32BE(0)
+            if (buf.length < 4 + size) break
+            const body = buf.subarray(4, 4 + size)
+            buf = buf.subarray(4 + size)
+            let msg: any
+            try {
+                msg = JSON.parse(body.toString('utf8'))
+            } catch (err) {
+                fail(new Error(`invalid event frame: ${(err as Error).message}`))
+                socket.destroy()
+                return
+            }
+            if (!greeted) {
+                greeted = true
+                if (!msg.ok) {
+                    fail(new Error(msg.error ?? 'subscription rejected'))
+                    socket.destroy()
+                    return
+                }
+                continue
+            }
+            emitter.emit('event', msg.event as ClientEvent, msg.client as number)
+            if (iterating) {
+                queue.push(msg.event as ClientEvent)
+                notify()
+            }
+        }
+    })
+    socket.on('error', fail)
+    socket.on('close', () => {
+        ended = true
+        notify()
+    })
+
+    return {
+        onEvent(cb) {
+            emitter.on('event', cb)
+            return () => emitter.off('event', cb)
+        },
+        onError(cb) {
+            emitter.on('error', cb)
+            return () => emitter.off('error', cb)
+        },
+        close() {
+            socket.destroy()
+        },
+        events() {
+            return {
+                [Symbol.asyncIterator](): AsyncIterator<ClientEvent> {
+                    iterating = true
+                    return {
+                        async next(): Promise<IteratorResult<ClientEvent>> {
+                            for (;;) {
+                                if (queue.length > 0) return { done: false, value: queue.shift()! }
+                                if (failure !== null) {
+                                    const err = failure
+                                    failure = null
+                                    ended = true
+                                    throw err
+                                }
+                                if (ended) return { done: true, value: undefined as any }
+                                await new Promise<void>((resolve) => (wake = resolve))
+                            }
+                        },
+                        async return(): Promise<IteratorResult<ClientEvent>> {
+                            socket.destroy()
+                            return { done: true, value: undefined as any }
+                        }
+                    }
+                }
+            }
+        },
+        socket
+    }
+}
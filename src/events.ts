@@ -1,12 +1,18 @@
 import type {
+    BinaryNode,
     JID,
     MessageInfo,
     MessageSource,
     NewsletterMetadata,
-    NewsletterLiveUpdateMessage
+    NewsletterLiveUpdateMessage,
+    OrderProduct,
+    ReactionSummary
 } from './types.js'
 import type * as proto from '../proto/whatsmeow.js'
 
+// Every event carries `schema_version` (see native.eventSchema), plus a `seq`
+// number when the client's event journal is enabled. Timestamp fields are typed
+// for the default timestamp_format and come with a unix-ms `<field>_ms` sibling.
 export type ClientEvent =
     // Connection lifecycle
     | { type: 'connected' }
@@ -26,9 +32,15 @@ export type ClientEvent =
       }
     | { type: 'logged_out'; on_connect: boolean; reason: string }
     | { type: 'cat_refresh_error'; error: string }
-    | { type: 'connect_failure'; reason: string; message: string }
+    | { type: 'connect_failure'; reason: string; message: string; raw: BinaryNode | null }
+    | { type: 'stream_error'; code: string; raw: BinaryNode | null }
     | { type: 'temporary_ban'; code: number; expire_ms: number }
-    | { type: 'keepalive_timeout'; error_count: number; last_success: string }
+    | {
+          type: 'keepalive_timeout'
+          error_count: number
+          last_success: string
+          last_success_ms: number
+      }
     | { type: 'keepalive_restored' }
 
     // Receipts & presence
@@ -37,10 +49,17 @@ export type ClientEvent =
           info: MessageSource
           message_ids: string[]
           timestamp: string
+          timestamp_ms: number
           receipt_type: string
           message_sender: JID
       }
-    | { type: 'presence'; from: JID; unavailable: boolean; last_seen: string }
+    | {
+          type: 'presence'
+          from: JID
+          unavailable: boolean
+          last_seen: string
+          last_seen_ms: number
+      }
     | {
           type: 'chat_presence'
           chat: JID
@@ -54,6 +73,8 @@ export type ClientEvent =
     | {
           type: 'message'
           info: MessageInfo
+          timestamp: string
+          timestamp_ms: number
           is_ephemeral: boolean
           is_view_once: boolean
           is_view_once_v2: boolean
@@ -66,12 +87,94 @@ export type ClientEvent =
           message?: proto.WAWebProtobufsE2E.IMessage
           raw_message?: proto.WAWebProtobufsE2E.IMessage
           source_web_msg?: proto.WAWebProtobufsWeb.IWebMessageInfo
+          // set instead of the objects above when the stream uses raw_proto
+          message_b64?: string
+          raw_message_b64?: string
+          source_web_msg_b64?: string
+          // set instead of the message when the stream uses lazy_body
+          body_seq?: number
+          text?: string
           unavailable_request_id?: string
-          newsletter_meta?: { edit_ts: string; original_ts: string }
+          newsletter_meta?: {
+              edit_ts: string
+              edit_ts_ms: number
+              original_ts: string
+              original_ts_ms: number
+          }
+          // ID of the edited message when this message is an edit (see message_edit)
+          edit_of?: string
+          // set when this message is a comment on a channel post or announcement;
+          // parent_server_id is known for channel posts the bridge has seen
+          comment?: {
+              parent_id: string
+              parent_chat: JID
+              parent_sender?: JID
+              parent_server_id?: number
+              encrypted: boolean
+              message?: proto.WAWebProtobufsE2E.IMessage
+              error?: string
+          }
+          // set on order messages; the cart follows as an order_details event
+          order?: {
+              order_id: string
+              title: string
+              item_count: number
+              status: 'inquiry' | 'accepted' | 'declined'
+              seller: JID
+              message: string
+              token: string
+              total_amount_1000: number
+              currency: string
+              catalog_type?: string
+          }
+          // set on encrypted reactions (community announcement groups) once decrypted
+          enc_reaction?: {
+              target_id: string
+              text?: string
+              error?: string
+          }
+          // set on group and community invites; accept with native.clientAcceptGroupInvite
+          group_invite?: {
+              group: JID
+              group_name: string
+              group_type: 'default' | 'parent'
+              inviter: JID
+              code: string
+              expiration: number
+              expired: boolean
+              caption?: string
+          }
+          // set on native flow interactive messages; params are parsed from their JSON
+          native_flow?: {
+              buttons: { name: string; params: unknown }[]
+              message_params: unknown
+              message_version: number
+          }
+          // set when a native flow button was answered; quoted_id is the interactive message
+          native_flow_response?: {
+              name: string
+              params: unknown
+              version: number
+              body: string
+              quoted_id?: string
+          }
+          // set when dedupe runs in annotate mode and this message was delivered before
+          was_duplicate?: number
+          // present when an auto-download rule matched the message media
+          auto_download?: {
+              status: 'pending' | 'skipped'
+              media_type: string
+              size: number
+              reason?: 'too_large'
+              path?: string
+              cache_key?: string
+          }
       }
     | {
           type: 'undecryptable_message'
           info: MessageInfo
+          timestamp: string
+          timestamp_ms: number
           is_unavailable: boolean
           unavailable_type: string
           decrypt_fail_mode: string
@@ -79,6 +182,8 @@ export type ClientEvent =
     | {
           type: 'fb_message'
           info: MessageInfo
+          timestamp: string
+          timestamp_ms: number
           retry_count: number
           transport?: proto.WAMsgTransport.IMessageTransport
           fb_application?: proto.WAMsgApplication.IMessageApplication
@@ -86,7 +191,13 @@ export type ClientEvent =
       }
 
     // History sync
-    | { type: 'history_sync'; data?: proto.WAWebProtobufsHistorySync.IHistorySync }
+    | {
+          type: 'history_sync'
+          sync_type: string
+          chunk_order: number
+          progress: number
+          data?: proto.WAWebProtobufsHistorySync.IHistorySync
+      }
 
     // Groups & users
     | {
@@ -106,6 +217,7 @@ export type ClientEvent =
           sender: JID
           sender_pn: JID
           timestamp: string
+          timestamp_ms: number
           [k: string]: any
       }
     | {
@@ -113,11 +225,18 @@ export type ClientEvent =
           jid: JID
           author: JID
           timestamp: string
+          timestamp_ms: number
           remove: boolean
           picture_id: string
       }
-    | { type: 'user_about'; jid: JID; status: string; timestamp: string }
-    | { type: 'identity_change'; jid: JID; timestamp: string; implicit: boolean }
+    | { type: 'user_about'; jid: JID; status: string; timestamp: string; timestamp_ms: number }
+    | {
+          type: 'identity_change'
+          jid: JID
+          timestamp: string
+          timestamp_ms: number
+          implicit: boolean
+      }
     | {
           type: 'privacy_settings'
           new_settings: any
@@ -144,6 +263,7 @@ export type ClientEvent =
           iv_b64?: string
           error?: { code: number }
           timestamp: string
+          timestamp_ms: number
           message_id: string
           chat_id: JID
           sender_id: JID
@@ -163,14 +283,17 @@ export type ClientEvent =
           type: 'newsletter_live_update'
           jid: JID
           time: string
+          time_ms: number
           messages: NewsletterLiveUpdateMessage[]
       }
+    | { type: 'newsletter_live_updates_error'; jid: JID; error: string }
 
     // AppState (sync actions)
     | {
           type: 'appstate_contact'
           jid: JID
           timestamp: string
+          timestamp_ms: number
           action?: proto.WASyncAction.IContactAction
           from_full_sync: boolean
       }
@@ -192,6 +315,7 @@ export type ClientEvent =
           type: 'appstate_pin'
           jid: JID
           timestamp: string
+          timestamp_ms: number
           action?: proto.WASyncAction.IPinAction
           from_full_sync: boolean
       }
@@ -202,6 +326,7 @@ export type ClientEvent =
           is_from_me: boolean
           message_id: string
           timestamp: string
+          timestamp_ms: number
           action?: proto.WASyncAction.IStarAction
           from_full_sync: boolean
       }
@@ -212,6 +337,7 @@ export type ClientEvent =
           is_from_me: boolean
           message_id: string
           timestamp: string
+          timestamp_ms: number
           action?: proto.WASyncAction.IDeleteMessageForMeAction
           from_full_sync: boolean
       }
@@ -219,6 +345,7 @@ export type ClientEvent =
           type: 'appstate_mute'
           jid: JID
           timestamp: string
+          timestamp_ms: number
           action?: proto.WASyncAction.IMuteAction
           from_full_sync: boolean
       }
@@ -226,6 +353,7 @@ export type ClientEvent =
           type: 'appstate_archive'
           jid: JID
           timestamp: string
+          timestamp_ms: number
           action?: proto.WASyncAction.IArchiveChatAction
           from_full_sync: boolean
       }
@@ -233,6 +361,7 @@ export type ClientEvent =
           type: 'appstate_mark_chat_as_read'
           jid: JID
           timestamp: string
+          timestamp_ms: number
           action?: proto.WASyncAction.IMarkChatAsReadAction
           from_full_sync: boolean
       }
@@ -240,6 +369,7 @@ export type ClientEvent =
           type: 'appstate_clear_chat'
           jid: JID
           timestamp: string
+          timestamp_ms: number
           action?: proto.WASyncAction.IClearChatAction
           from_full_sync: boolean
       }
@@ -247,18 +377,21 @@ export type ClientEvent =
           type: 'appstate_delete_chat'
           jid: JID
           timestamp: string
+          timestamp_ms: number
           action?: proto.WASyncAction.IDeleteChatAction
           from_full_sync: boolean
       }
     | {
           type: 'appstate_push_name_setting'
           timestamp: string
+          timestamp_ms: number
           action?: proto.WASyncAction.IPushNameSetting
           from_full_sync: boolean
       }
     | {
           type: 'appstate_unarchive_chats_setting'
           timestamp: string
+          timestamp_ms: number
           action?: proto.WASyncAction.IUnarchiveChatsSetting
           from_full_sync: boolean
       }
@@ -266,12 +399,14 @@ export type ClientEvent =
           type: 'appstate_user_status_mute'
           jid: JID
           timestamp: string
+          timestamp_ms: number
           action?: proto.WASyncAction.IUserStatusMuteAction
           from_full_sync: boolean
       }
     | {
           type: 'appstate_label_edit'
           timestamp: string
+          timestamp_ms: number
           label_id: string
           action?: proto.WASyncAction.ILabelEditAction
           from_full_sync: boolean
@@ -280,6 +415,7 @@ export type ClientEvent =
           type: 'appstate_label_association_chat'
           jid: JID
           timestamp: string
+          timestamp_ms: number
           label_id: string
           action?: proto.WASyncAction.ILabelAssociationAction
           from_full_sync: boolean
@@ -288,6 +424,7 @@ export type ClientEvent =
           type: 'appstate_label_association_message'
           jid: JID
           timestamp: string
+          timestamp_ms: number
           label_id: string
           message_id: string
           action?: proto.WASyncAction.ILabelAssociationAction
@@ -297,15 +434,220 @@ export type ClientEvent =
     | { type: 'appstate_sync_complete'; name: string }
 
     // Calls
-    | { type: 'call_offer'; basic: any; remote: any; data: any }
-    | { type: 'call_accept'; basic: any; remote: any; data: any }
-    | { type: 'call_pre_accept'; basic: any; remote: any; data: any }
-    | { type: 'call_transport'; basic: any; remote: any; data: any }
-    | { type: 'call_offer_notice'; basic: any; media: string; notice_type: string; data: any }
-    | { type: 'call_relay_latency'; basic: any; data: any }
-    | { type: 'call_terminate'; basic: any; reason: string; data: any }
-    | { type: 'call_reject'; basic: any; data: any }
-    | { type: 'call_unknown'; node: any }
+    | { type: 'call_offer'; basic: any; remote: any; data: BinaryNode | null }
+    | { type: 'call_accept'; basic: any; remote: any; data: BinaryNode | null }
+    | { type: 'call_pre_accept'; basic: any; remote: any; data: BinaryNode | null }
+    | { type: 'call_transport'; basic: any; remote: any; data: BinaryNode | null }
+    | {
+          type: 'call_offer_notice'
+          basic: any
+          media: string
+          notice_type: string
+          data: BinaryNode | null
+      }
+    | { type: 'call_relay_latency'; basic: any; data: BinaryNode | null }
+    | { type: 'call_terminate'; basic: any; reason: string; data: BinaryNode | null }
+    | { type: 'call_reject'; basic: any; data: BinaryNode | null }
+    | { type: 'call_unknown'; node: BinaryNode | null }
+
+    // Bridge-generated
+    | {
+          // progress of native.clientRecoverAppState; name is missing on the final "done" stage
+          type: 'app_state_recovery'
+          recovery_id: number
+          stage: 'missing_key' | 'retrying' | 'recovered' | 'failed' | 'done'
+          name?: string
+          attempt?: number
+          error?: string
+          recovered?: boolean
+      }
+    | {
+          type: 'call_auto_rejected'
+          call_id: string
+          from: JID
+          policy: string
+          reply_sent: boolean
+          reply_error?: string
+          error?: string
+      }
+
+    | {
+          type: 'connection_state'
+          state:
+              | 'connecting'
+              | 'connected'
+              | 'disconnected'
+              | 'reconnect_scheduled'
+              | 'reconnecting'
+              | 'gave_up'
+              | 'idle'
+          // reconnect_scheduled and reconnecting
+          attempt?: number
+          delay_ms?: number
+          // gave_up, and connected after a bridge-handled outage
+          attempts?: number
+          // idle: how long the client went without activity
+          idle_ms?: number
+      }
+    | { type: 'events_dropped'; count: number; total_dropped: number }
+    | {
+          // with the "quarantine" identity policy: sends to jid fail until native.trustIdentity.
+          // changed is the JID the identity change was reported for
+          type: 'identity_quarantined'
+          jid: JID
+          changed: JID
+          implicit: boolean
+          since: number
+      }
+    | {
+          type: 'message_edit'
+          chat: JID
+          original_id: string
+          edit_id: string
+          sender: JID
+          timestamp: string
+          timestamp_ms: number
+          new_message: proto.WAWebProtobufsE2E.IMessage | null
+          // content before this edit, null when the original isn't in the archive
+          previous_message: proto.WAWebProtobufsE2E.IMessage | null
+          original_timestamp?: string
+          original_timestamp_ms?: number
+      }
+    | ({ type: 'reaction_summary'; sender: JID; emoji: string } & ReactionSummary)
+    | {
+          // an unavailable message re-delivered by the phone; managed is true when the
+          // bridge requested it (attempts and elapsed_ms are set then)
+          type: 'message_recovered'
+          chat: JID
+          sender: JID
+          message_id: string
+          request_id: string
+          managed: boolean
+          attempts?: number
+          elapsed_ms?: number
+      }
+    | {
+          type: 'message_recovery_failed'
+          chat: JID
+          sender: JID
+          message_id: string
+          attempts: number
+          request_id?: string
+      }
+    | {
+          type: 'media_auto_downloaded'
+          chat: JID
+          id: string
+          media_type: string
+          mimetype: string
+          size: number
+          path?: string
+          cache_key?: string
+      }
+    | {
+          type: 'media_auto_download_failed'
+          chat: JID
+          id: string
+          media_type: string
+          mimetype: string
+          error: string
+          path?: string
+      }
+    | {
+          type: 'order_details'
+          chat: JID
+          message_id: string
+          order_id: string
+          products?: OrderProduct[]
+          total_amount_1000?: number
+          currency?: string
+          error?: string
+      }
+    | {
+          // a phone is about to pair, with a pair approval policy set. decision_id is set when
+          // Node is asked (native.resolveDecision), allowed when allowed_users decided
+          type: 'pair_request'
+          jid: JID
+          platform: string
+          business_name: string
+          allowed?: boolean
+          reason?: 'user_not_allowed'
+          decision_id?: number
+      }
+    | {
+          type: 'poll_vote'
+          chat: JID
+          poll_id: string
+          poll_name: string
+          voter: JID
+          vote_id: string
+          timestamp: string
+          timestamp_ms: number
+          selected_options: string[]
+          unknown_option_hashes?: string[]
+      }
+    | { type: 'prekeys_low'; server_count: number; watermark: number }
+    | { type: 'reconnect_attempt'; attempt: number; delay_ms: number }
+    | { type: 'reconnect_failed'; attempt: number; error: string }
+    | { type: 'reconnect_gave_up'; attempts: number }
+    | {
+          // with a retry policy in "ask" mode, decision_id is set instead of allowed:
+          // answer it with native.resolveDecision or the resend is allowed after timeout_ms
+          type: 'retry_receipt'
+          chat: JID
+          sender: JID
+          message_id: string
+          retry_count: number
+          has_message: boolean
+          allowed?: boolean
+          reason?: 'max_retries' | 'max_per_peer'
+          decision_id?: number
+      }
+    | {
+          // a peer's retries in one direction reached the policy's alert_threshold
+          type: 'retry_threshold_exceeded'
+          peer: JID
+          chat: JID
+          direction: 'incoming' | 'outgoing'
+          count: number
+          window_ms: number
+      }
+    | {
+          // a send was delayed (queued) or refused (rejected) by the limit of native.setRateLimits
+          type: 'send_throttled'
+          chat: JID
+          limit: 'global' | 'client' | 'chat'
+          wait_ms: number
+          action: 'queued' | 'rejected'
+      }
+    | {
+          // from native.clientSetStanzaTap; node is missing when the stanza was over max_bytes,
+          // redacted nodes carry the length of their content instead of it
+          type: 'stanza'
+          direction: 'in' | 'out'
+          size: number
+          node?: BinaryNode & { redacted?: number }
+          truncated?: boolean
+          error?: string
+      }
+    | {
+          // sends fail until resets_at (unix ms); day counts from 1
+          type: 'warmup_quota_reached'
+          day: number
+          days: number
+          limit: number
+          resets_at: number
+      }
+    | {
+          type: 'webhook_delivery_failed'
+          event_id: number
+          attempts: number
+          error: string
+          event: ClientEvent
+      }
+
+    // Event types without a dedicated serializer, fields walked generically (snake_case)
+    | { type: `unknown:${string}`; [field: string]: unknown }
 
     // internal control events from eventNext
     | { type: 'timeout' }
@@ -5,4 +5,12 @@ export * from './protos.js'
 export { spawnEventWorker } from './worker-events.js'
 export type { EventWorkerController } from './worker-events.js'
 export { spawnQRWorker } from './worker-qr.js'
+export { subscribeEventSocket } from './event-socket.js'
+export type { EventSocketSubscription } from './event-socket.js'
+export { serveStoreBackend } from './store-backend.js'
+export type {
+    KVStoreBackend,
+    KVStoreBackendModule,
+    StoreBackendServer
+} from './store-backend.js'
 export type { QRWorkerController } from './worker-qr.js'
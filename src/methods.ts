@@ -8,6 +8,7 @@ import type { proto } from './types.js'
 // - time.Duration        <-> number (milliseconds)
 // - *waE2E.Message       <-> any (serialized via protojson on return, accept plain object on input)
 // - []byte               <-> base64 string (when applicable)
+// - map[types.JID]T      -> object keyed by JID string, values converted as above
 // - error (last return)  -> throws on the JS side
 //
 // For methods not listed here, client.call<string>(...) is still available with loose typing.
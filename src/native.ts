@@ -1,8 +1,38 @@
 import path from 'node:path'
 import fs from 'node:fs'
 import { fileURLToPath } from 'node:url'
+import zlib from 'node:zlib'
 import koffi from 'koffi'
-import { JsonResp } from './types.js'
+import {
+    BinaryNode,
+    CatalogProduct,
+    ClientFlags,
+    ClientLocale,
+    ClientMethodInfo,
+    DeviceInfo,
+    EventSchema,
+    EventStreamOptions,
+    FleetResults,
+    JsonErr,
+    JsonResp,
+    KeepaliveSettings,
+    LogStreamItem,
+    MediaSlots,
+    OpenContainerOptions,
+    OrderProduct,
+    OutgoingNode,
+    PollResults,
+    ReactionSummary,
+    RetryStats,
+    RuntimeStats,
+    SchedulerStats,
+    SendDefaults,
+    SendResponse,
+    WAVersionInfo,
+    WarmupQuota,
+    WebhookStatus
+} from './types.js'
+import type * as proto from '../proto/whatsmeow.js'
 
 function resolveDirname(): string {
     return path.dirname(fileURLToPath(import.meta.url))
@@ -48,6 +78,31 @@ const fns = {
     WmFreeCString: mk('void', 'WmFreeCString', ['char*'])
 } as const
 
+// Errors keep the Go stack of a recovered panic as goStack.
+function bridgeError(data: JsonErr): Error {
+    const err = new Error(data.error)
+    if (data.stack) (err as Error & { goStack?: string }).goStack = data.stack
+    return err
+}
+
+// Responses over the WmSetCompression threshold arrive compressed: wrapped in an
+// envelope by the C string exports, as bare gzip/zstd bytes from WmCallBinary.
+const zstdDecompress = (zlib as any).zstdDecompressSync as ((buf: Buffer) => Buffer) | undefined
+
+function inflate(buf: Buffer, encoding: string): Buffer {
+    if (encoding === 'gzip') return zlib.gunzipSync(buf)
+    if (encoding === 'zstd' && zstdDecompress) return zstdDecompress(buf)
+    throw new Error(`cannot decompress ${encoding} response`)
+}
+
+function parseResp<T>(json: string): JsonResp<T> {
+    const data = JSON.parse(json)
+    if (data.ok && data.encoding) {
+        return JSON.parse(inflate(Buffer.from(data.payload, 'base64'), data.encoding).toString())
+    }
+    return data
+}
+
 function call<T>(fn: keyof typeof fns | string, payload: any): T {
     const input = JSON.stringify(payload)
     // Debug markers to trace where it stops in case of crashes
@@ -62,8 +117,8 @@ function call<T>(fn: keyof typeof fns | string, payload: any): T {
     }
     try {
         const json = typeof out === 'string' ? out : koffi.decode(out as Buffer, 'str')
-        const data = JSON.parse(json) as JsonResp<T>
-        if (!data.ok) throw new Error((data as any).error)
+        const data = parseResp<T>(json)
+        if (!data.ok) throw bridgeError(data)
         return data.data
     } finally {
         // When using 'str' return type, Koffi copies the C string, so we must not free.
@@ -73,30 +128,82 @@ function call<T>(fn: keyof typeof fns | string, payload: any): T {
     }
 }
 
+const callBinaryFn = lib.func('WmCallBinary', 'void *', ['str', 'const uint8_t *', 'size_t'])
+const freeBufferFn = lib.func('WmFreeBuffer', 'void', ['void *'])
+
+// Length-prefixed variant of call: input and output are raw bytes. Only WmClientCall
+// skips the C string conversions, so only its payloads may contain NUL.
+function callBinary(fn: string, input: Buffer): Buffer {
+    const ptr = callBinaryFn(fn, input, input.length)
+    try {
+        const len = koffi.decode(ptr, 'uint32_t') as number
+        const body = koffi.decode(ptr, 4, koffi.array('uint8_t', len, 'Typed')) as Uint8Array
+        return Buffer.from(body)
+    } finally {
+        freeBufferFn(ptr)
+    }
+}
+
+function callBinaryJSON<T>(fn: string, payload: any): T {
+    let out = callBinary(fn, Buffer.from(JSON.stringify(payload)))
+    if (out[0] === 0x1f && out[1] === 0x8b) out = inflate(out, 'gzip')
+    else if (out.readUInt32LE(0) === 0xfd2fb528) out = inflate(out, 'zstd')
+    const data = parseResp<T>(out.toString())
+    if (!data.ok) throw bridgeError(data)
+    return data.data
+}
+
 export const native = {
-    setLogOptions: (opts: { database?: string; client?: string; color?: boolean }) =>
-        call<{}>('WmSetLogOptions', opts),
-    openContainer: (opts: { dialect: string; address: string }) =>
+    setLogOptions: (opts: {
+        database?: string
+        client?: string
+        color?: boolean
+        stdout?: boolean
+    }) => call<{}>('WmSetLogOptions', opts),
+    openContainer: (opts: OpenContainerOptions) =>
         call<{ handle: number }>('WmOpenContainer', opts),
+    containerGetVersion: (handle: number) =>
+        call<{ version: number; latest: number; needs_upgrade: boolean; dialect: string }>(
+            'WmContainerGetVersion',
+            { handle }
+        ),
+    containerUpgrade: (handle: number) =>
+        call<{ version: number }>('WmContainerUpgrade', { handle }),
+    containerPrune: (handle: number, dryRun?: boolean) =>
+        call<{ tables: Record<string, number>; total: number; dry_run: boolean }>(
+            'WmContainerPrune',
+            { handle, dry_run: dryRun }
+        ),
     containerGetFirstDevice: (handle: number) =>
         call<{ handle: number }>('WmContainerGetFirstDevice', { handle }),
     containerGetAllDevices: (handle: number) =>
         call<{ handles: number[] }>('WmContainerGetAllDevices', { handle }),
     containerGetDevice: (handle: number, jid: string) =>
         call<{ handle: number; found: boolean }>('WmContainerGetDevice', { handle, jid }),
-    newClient: (device: number) => call<{ handle: number }>('WmNewClient', { device }),
+    deviceGetInfo: (handle: number) => call<DeviceInfo>('WmDeviceGetInfo', { handle }),
+    deviceCall: (device: number, method: string, args: any, store?: string, opId?: number) =>
+        call<any>('WmDeviceCall', { device, store, method, args, op_id: opId }),
+    containerCall: (handle: number, method: string, args: any, opId?: number) =>
+        call<any>('WmContainerCall', { handle, method, args, op_id: opId }),
+    newClient: (device: number, label?: string) =>
+        call<{ handle: number }>('WmNewClient', { device, label }),
     clientConnect: (client: number) => call<{}>('WmClientConnect', { client }),
     clientHasStoreID: (client: number) => call<{ has: boolean }>('WmClientHasStoreID', { client }),
     clientGetQR: (client: number) => call<{ handle: number }>('WmClientGetQRChannel', { client }),
     qrNext: (qr: number, timeoutMs: number) => call<any>('WmQRNext', { handle: qr, timeoutMs }),
     clientSendPresence: (client: number, state: string) =>
         call<{}>('WmClientSendPresence', { client, state }),
+    // has_token: whether we hold the contact's privacy token, without which the server may
+    // ignore the subscription
     clientSubscribePresence: (client: number, jid: string) =>
-        call<{}>('WmClientSubscribePresence', { client, jid }),
+        call<{ has_token: boolean; token_timestamp?: number }>('WmClientSubscribePresence', {
+            client,
+            jid
+        }),
     clientSendChatPresence: (client: number, jid: string, state: string, media: string) =>
         call<{}>('WmClientSendChatPresence', { client, jid, state, media }),
-    clientUpload: (client: number, dataB64: string, type: string) =>
-        call<any>('WmClientUpload', { client, data: dataB64, type }),
+    clientUpload: (client: number, dataB64: string, type: string, opId?: number) =>
+        call<any>('WmClientUpload', { client, data: dataB64, type, op_id: opId }),
     clientDownloadByPath: (
         client: number,
         p: {
@@ -107,7 +214,8 @@ export const native = {
             file_length: number
             type: string
             mms_type?: string
-        }
+        },
+        opId?: number
     ) =>
         call<{ data: string }>('WmClientDownloadByPath', {
             client,
@@ -117,7 +225,8 @@ export const native = {
             media_key: p.media_key,
             file_length: p.file_length,
             type: p.type,
-            mms_type: p.mms_type ?? ''
+            mms_type: p.mms_type ?? '',
+            op_id: opId
         }),
     clientGetGroupInviteLink: (client: number, jid: string, reset?: boolean) =>
         call<{ link: string }>('WmClientGetGroupInviteLink', { client, jid, reset: !!reset }),
@@ -133,16 +242,1001 @@ export const native = {
             method: 'PairPhone',
             args: [phone, !!showPushNotification, clientType, clientDisplayName]
         }),
-    clientStartEvents: (client: number) =>
-        call<{ handle: number }>('WmClientStartEvents', { client }),
+    clientStartEvents: (client: number, opts?: EventStreamOptions) =>
+        call<{ handle: number }>('WmClientStartEvents', { client, ...opts }),
     eventNext: (handle: number, timeoutMs: number) =>
         call<any>('WmEventNext', { handle, timeoutMs }),
+    // Message protos of a lazy_body message event; recent messages only.
+    eventGetBody: (bodySeq: number, rawProto = false) =>
+        call<{
+            message?: proto.WAWebProtobufsE2E.IMessage
+            raw_message?: proto.WAWebProtobufsE2E.IMessage
+            source_web_msg?: proto.WAWebProtobufsWeb.IWebMessageInfo
+            message_b64?: string
+            raw_message_b64?: string
+            source_web_msg_b64?: string
+        }>('WmEventGetBody', { seq: bodySeq, raw_proto: rawProto }),
+    eventStats: (handle: number) =>
+        call<{
+            delivered: number
+            dropped: number
+            queue_depth: number
+            queue_cap: number
+            oldest_queued: string
+        }>('WmEventStats', { handle }),
     clientIsLoggedIn: (client: number) =>
         call<{ isLoggedIn: boolean }>('WmClientIsLoggedIn', { client }),
     clientDisconnect: (client: number) => call<{}>('WmClientDisconnect', { client }),
     clientWaitForConnection: (client: number, timeoutMs: number) =>
         call<{ ok: boolean }>('WmClientWaitForConnection', { client, timeoutMs }),
-    clientCall: (client: number, method: string, args: any) =>
-        call<any>('WmClientCall', { client, method, args }),
+    clientListMethods: () => call<{ methods: ClientMethodInfo[] }>('WmClientListMethods', {}),
+    // idempotencyKey (sends only) derives the message ID, so retrying a send reuses its ID
+    clientCall: (
+        client: number,
+        method: string,
+        args: any,
+        opId?: number,
+        idempotencyKey?: string
+    ) =>
+        call<any>('WmClientCall', {
+            client,
+            method,
+            args,
+            op_id: opId,
+            idempotency_key: idempotencyKey
+        }),
+    clientCallBatch: (
+        client: number,
+        calls: Array<{ method: string; args?: any; op_id?: number; idempotency_key?: string }>,
+        opts?: { concurrent?: boolean; stopOnError?: boolean }
+    ) =>
+        call<{ results: JsonResp<any>[] }>('WmClientCallBatch', {
+            client,
+            calls,
+            concurrent: opts?.concurrent,
+            stop_on_error: opts?.stopOnError
+        }),
+    // an op_id for clientCall & co. that cancel() can abort from another thread
+    opNew: () => call<{ op_id: number }>('WmOpNew', {}),
+    cancel: (opId: number) => call<{ running: boolean }>('WmCancel', { op_id: opId }),
+    historyMediaJobStart: (
+        client: number,
+        opts: {
+            // 'archive' downloads the media of the message archive, optionally only of chats
+            source?: 'history_sync' | 'archive'
+            history_sync?: any
+            history_sync_b64?: string
+            chats?: string[]
+            dir: string
+            concurrency?: number
+            retries?: number
+            backoffMs?: number
+            types?: Array<'image' | 'video' | 'audio' | 'document' | 'sticker'>
+            overwrite?: boolean
+        }
+    ) => call<{ handle: number; total: number }>('WmHistoryMediaJobStart', { client, ...opts }),
+    mediaJobNext: (handle: number, timeoutMs: number) =>
+        call<any>('WmMediaJobNext', { handle, timeoutMs }),
+    historySyncStatus: (client: number) => call<any>('WmHistorySyncStatus', { client }),
+    historySyncMarkProcessed: (client: number, sync_type: string, chunk_order: number) =>
+        call<{ updated: boolean }>('WmHistorySyncMarkProcessed', { client, sync_type, chunk_order }),
+    clientCreateNewsletter: (
+        client: number,
+        opts: { name: string; description?: string; picture?: string }
+    ) => call<any>('WmClientCreateNewsletter', { client, ...opts }),
+    clientGetNewsletterInfo: (client: number, jid: string) =>
+        call<any>('WmClientGetNewsletterInfo', { client, jid }),
+    clientGetNewsletterInfoWithInvite: (client: number, key: string) =>
+        call<any>('WmClientGetNewsletterInfoWithInvite', { client, key }),
+    clientNewsletterLiveUpdates: (client: number, jid: string, enabled: boolean) =>
+        call<{ subscribed: boolean; expires_at?: number }>('WmClientNewsletterLiveUpdates', {
+            client,
+            jid,
+            enabled
+        }),
+    clientNewsletterLiveSubscriptions: (client: number) =>
+        call<{ subscriptions: Array<{ jid: string; expires_at: number }> }>(
+            'WmClientNewsletterLiveSubscriptions',
+            { client }
+        ),
+    clientResolveNewsletterLink: (client: number, link: string) =>
+        call<{ key: string; jid: string; newsletter: any }>('WmClientResolveNewsletterLink', {
+            client,
+            link
+        }),
+    // calls can only be rejected, the protocol has no busy or unavailable signal
+    clientRejectCall: (client: number, call_id: string, from: string) =>
+        call<{}>('WmClientRejectCall', { client, call_id, from }),
+    clientSetCallPolicy: (
+        client: number,
+        mode: 'never' | 'always' | 'from-non-contacts',
+        reply?: string
+    ) => call<{ mode: string; reply: string }>('WmClientSetCallPolicy', { client, mode, reply }),
+    clientSetMessageArchive: (client: number, enabled: boolean) =>
+        call<{ enabled: boolean }>('WmClientSetMessageArchive', { client, enabled }),
+    clientGetArchivedMessage: (client: number, chat: string, id: string) =>
+        call<any>('WmClientGetArchivedMessage', { client, chat, id }),
+    clientListStatuses: (client: number, sender?: string) =>
+        call<{ statuses: any[] }>('WmClientListStatuses', { client, sender }),
+    clientDownloadStatus: (client: number, id: string) =>
+        call<{ data: string; media_type: string; mimetype: string }>('WmClientDownloadStatus', {
+            client,
+            id
+        }),
+    clientMarkStatusViewed: (client: number, sender: string, ids: string[]) =>
+        call<{}>('WmClientMarkStatusViewed', { client, sender, ids }),
+    clientSetEventJournal: (client: number, enabled: boolean) =>
+        call<{ enabled: boolean; last_seq?: number }>('WmClientSetEventJournal', {
+            client,
+            enabled
+        }),
+    eventReplay: (client: number, fromSeq: number, limit?: number) =>
+        call<{ events: any[]; next_seq: number; last_seq: number }>('WmEventReplay', {
+            client,
+            fromSeq,
+            limit
+        }),
+    eventJournalTrim: (client: number, beforeSeq: number) =>
+        call<{ deleted: number }>('WmEventJournalTrim', { client, beforeSeq }),
+    clientSetWebhook: (
+        client: number,
+        opts: {
+            url: string
+            secret?: string
+            include?: string[]
+            exclude?: string[]
+            max_attempts?: number
+            timeout_ms?: number
+        }
+    ) => call<WebhookStatus>('WmClientSetWebhook', { client, ...opts }),
+    clientWebhookStatus: (client: number) =>
+        call<WebhookStatus>('WmClientWebhookStatus', { client }),
+    clientSetAutoDownload: (
+        client: number,
+        opts: {
+            rules: Array<{
+                type: 'image' | 'video' | 'audio' | 'document' | 'sticker'
+                max_bytes?: number
+            }>
+            dir?: string
+            concurrency?: number
+            retries?: number
+            cache_bytes?: number
+        }
+    ) => call<{ enabled: boolean }>('WmClientSetAutoDownload', { client, ...opts }),
+    clientGetCachedMedia: (client: number, chat: string, id: string) =>
+        call<{ found: boolean; data?: string; mimetype?: string }>('WmClientGetCachedMedia', {
+            client,
+            chat,
+            id
+        }),
+    eventSocketListen: (path: string, format?: 'json' | 'proto') =>
+        call<{ handle: number; path: string; format: string }>('WmEventSocketListen', {
+            path,
+            format
+        }),
+    getReactions: (client: number, chat: string, id: string) =>
+        call<ReactionSummary>('WmGetReactions', { client, chat, id }),
+    // comments on a channel post (by parent_id or the post's parent_server_id) or on a
+    // community announcement (parent_sender required unless parent_from_me)
+    clientSendComment: (
+        client: number,
+        comment: {
+            chat: string
+            parent_id?: string
+            parent_server_id?: number
+            parent_sender?: string
+            parent_from_me?: boolean
+            text?: string
+            message?: proto.WAWebProtobufsE2E.IMessage
+            idempotency_key?: string
+        }
+    ) => call<SendResponse>('WmClientSendComment', { client, ...comment }),
+    // one page of a business catalog; pass next_cursor back as cursor for the next one
+    clientGetCatalog: (
+        client: number,
+        jid: string,
+        opts?: {
+            limit?: number
+            cursor?: string
+            image_width?: number
+            image_height?: number
+            timeout_ms?: number
+            op_id?: number
+        }
+    ) =>
+        call<{ jid: string; products: CatalogProduct[]; next_cursor?: string }>(
+            'WmClientGetCatalog',
+            { client, jid, ...opts }
+        ),
+    // image / catalog.image are uploaded imageMessages (see clientUpload)
+    clientSendProduct: (
+        client: number,
+        to: string,
+        msg: {
+            business_owner?: string
+            product: {
+                id: string
+                title?: string
+                description?: string
+                currency?: string
+                price_amount_1000?: number
+                sale_price_amount_1000?: number
+                retailer_id?: string
+                url?: string
+                image_count?: number
+                image?: proto.WAWebProtobufsE2E.IImageMessage
+            }
+            catalog?: {
+                title?: string
+                description?: string
+                image?: proto.WAWebProtobufsE2E.IImageMessage
+            }
+            body?: string
+            footer?: string
+            idempotency_key?: string
+        }
+    ) => call<SendResponse>('WmClientSendProduct', { client, to, ...msg }),
+    clientGetOrderDetails: (
+        client: number,
+        orderId: string,
+        token: string,
+        opts?: { timeout_ms?: number; op_id?: number }
+    ) =>
+        call<{
+            order_id: string
+            products: OrderProduct[]
+            total_amount_1000?: number
+            currency?: string
+        }>('WmClientGetOrderDetails', { client, order_id: orderId, token, ...opts }),
+    // Adds to to the group, or sends an invite message when their privacy settings
+    // don't allow it (or when an add request code is given)
+    clientSendGroupInvite: (
+        client: number,
+        group: string,
+        to: string,
+        opts?: {
+            code?: string
+            expiration?: number
+            caption?: string
+            thumbnail_b64?: string
+            idempotency_key?: string
+        }
+    ) =>
+        call<{
+            added: boolean
+            invited: boolean
+            code?: string
+            expiration?: number
+            message?: SendResponse
+        }>('WmClientSendGroupInvite', { client, group, to, ...opts }),
+    // takes the group_invite object of a message event
+    clientAcceptGroupInvite: (
+        client: number,
+        invite: { group: string; inviter: string; code: string; expiration?: number }
+    ) => call<{ group: string }>('WmClientAcceptGroupInvite', { client, ...invite }),
+    clientSendInteractive: (
+        client: number,
+        to: string,
+        message: {
+            body?: string
+            footer?: string
+            header?: proto.WAWebProtobufsE2E.InteractiveMessage.IHeader
+            buttons?: { name: string; params?: unknown }[]
+            message_params?: unknown
+            interactive?: proto.WAWebProtobufsE2E.IInteractiveMessage
+            idempotency_key?: string
+        }
+    ) => call<SendResponse>('WmClientSendInteractive', { client, to, ...message }),
+    clientSendInteractiveResponse: (
+        client: number,
+        to: string,
+        response: {
+            name: string
+            params?: unknown
+            body?: string
+            version?: number
+            quoted_id?: string
+            quoted_sender?: string
+            idempotency_key?: string
+        }
+    ) => call<SendResponse>('WmClientSendInteractiveResponse', { client, to, ...response }),
+    // attachment takes the fields of a clientUpload result
+    clientSendInvoice: (
+        client: number,
+        to: string,
+        invoice: {
+            token: string
+            note?: string
+            attachment?: {
+                type: 'image' | 'pdf'
+                mimetype: string
+                direct_path: string
+                media_key: string
+                file_sha256: string
+                file_enc_sha256: string
+                thumbnail_b64?: string
+            }
+            idempotency_key?: string
+        }
+    ) => call<SendResponse>('WmClientSendInvoice', { client, to, ...invoice }),
+    // only delivered where WhatsApp payments are available; expiry is in unix seconds
+    clientSendPaymentRequest: (
+        client: number,
+        to: string,
+        request: {
+            currency: string
+            amount_1000: number
+            request_from?: string
+            note?: string
+            expiry?: number
+            idempotency_key?: string
+        }
+    ) => call<SendResponse>('WmClientSendPaymentRequest', { client, to, ...request }),
+    getPollResults: (client: number, chat: string, id: string) =>
+        call<PollResults>('WmGetPollResults', { client, chat, id }),
+    // decrypts a poll vote outside the event flow; poll_message / poll_secret are only
+    // needed for polls the store has no secret for. record adds it to getPollResults
+    clientDecryptPollVote: (
+        client: number,
+        vote: {
+            chat: string
+            sender: string
+            id: string
+            from_me?: boolean
+            timestamp?: number
+            message: proto.WAWebProtobufsE2E.IMessage
+            poll_message?: proto.WAWebProtobufsE2E.IMessage
+            poll_secret?: string
+            record?: boolean
+        }
+    ) =>
+        call<{
+            poll_id: string
+            voter: string
+            selected_hashes: string[]
+            poll_name?: string
+            selected_options?: string[]
+            unknown_option_hashes?: string[]
+        }>('WmClientDecryptPollVote', { client, ...vote }),
+    clientSetDedupe: (
+        client: number,
+        enabled: boolean,
+        opts?: { window?: number; mode?: 'drop' | 'annotate' }
+    ) =>
+        call<{ enabled: boolean; window?: number; mode?: string }>('WmClientSetDedupe', {
+            client,
+            enabled,
+            ...opts
+        }),
+    clientGetEditHistory: (client: number, chat: string, id: string) =>
+        call<{
+            found: boolean
+            current?: any
+            versions?: Array<{ message: any; edit_id: string; edited_at: string }>
+        }>('WmClientGetEditHistory', { client, chat, id }),
+    clientSetProxy: (
+        client: number,
+        url: string,
+        opts?: {
+            username?: string
+            password?: string
+            media_url?: string
+            no_websocket?: boolean
+            no_media?: boolean
+            only_login?: boolean
+        }
+    ) =>
+        call<{ url: string | null; media_url: string | null }>('WmClientSetProxy', {
+            client,
+            url,
+            ...opts
+        }),
+    clientSetAutoReconnect: (
+        client: number,
+        enabled: boolean,
+        policy?: {
+            initial_delay_ms?: number
+            max_delay_ms?: number
+            multiplier?: number
+            jitter?: number
+            max_attempts?: number
+        }
+    ) =>
+        call<{ enabled: boolean; policy?: any }>('WmClientSetAutoReconnect', {
+            client,
+            enabled,
+            ...policy
+        }),
+    // Disconnects the client after idle_ms without calls; the next call or send reconnects it
+    clientSetIdlePolicy: (
+        client: number,
+        enabled: boolean,
+        policy?: { idle_ms?: number; wake_timeout_ms?: number }
+    ) =>
+        call<{ enabled: boolean; policy?: { idle_ms: number; wake_timeout_ms: number } }>(
+            'WmClientSetIdlePolicy',
+            { client, enabled, ...policy }
+        ),
+    // Caps daily sends of a newly paired account, ramping from start_per_day to end_per_day
+    // over `days` days; persisted per device. restart starts the ramp over from today.
+    clientSetWarmup: (
+        client: number,
+        enabled: boolean,
+        opts?: {
+            days?: number
+            start_per_day?: number
+            end_per_day?: number
+            curve?: 'linear' | 'exponential'
+            restart?: boolean
+        }
+    ) => call<WarmupQuota>('WmClientSetWarmup', { client, enabled, ...opts }),
+    clientGetWarmupQuota: (client: number) =>
+        call<WarmupQuota>('WmClientGetWarmupQuota', { client }),
+    clientReconnectNow: (client: number) =>
+        call<{ woke_loop: boolean }>('WmClientReconnectNow', { client }),
+    // Pass {} to read the current values
+    clientSetFlags: (client: number, flags: Partial<ClientFlags>) =>
+        call<ClientFlags>('WmClientSetFlags', { client, flags }),
+    clientSetRetryPolicy: (
+        client: number,
+        enabled: boolean,
+        opts?: {
+            mode?: 'observe' | 'ask'
+            max_retries?: number
+            timeout_ms?: number
+            max_per_peer?: number
+            alert_threshold?: number
+            window_ms?: number
+        }
+    ) =>
+        call<{
+            enabled: boolean
+            mode?: string
+            max_retries?: number
+            timeout_ms?: number
+            max_per_peer?: number
+            alert_threshold?: number
+            window_ms?: number
+        }>('WmClientSetRetryPolicy', { client, enabled, ...opts }),
+    // Groups are asked from the server unless cached is set and a value was recorded;
+    // private chats only know what the bridge saw (known is false otherwise)
+    clientGetDisappearingTimer: (client: number, chat: string, cached?: boolean) =>
+        call<{
+            chat: string
+            known: boolean
+            enabled: boolean
+            timer_seconds: number
+            source?: 'setting_message' | 'message' | 'group_info' | 'history_sync' | 'set'
+            setting_timestamp?: number
+        }>('WmClientGetDisappearingTimer', { client, chat, cached }),
+    // Retry receipt counters per chat, most recent first; reset clears what was read
+    // ping adds a live server round trip; idle means disconnected by the idle policy
+    clientHealth: (client: number, opts?: { ping?: boolean; timeout_ms?: number }) =>
+        call<{
+            status: 'ok' | 'logged_out' | 'idle' | 'disconnected' | 'unresponsive'
+            connected: boolean
+            logged_in: boolean
+            ping?: { ok: boolean; rtt_ms?: number; error?: string }
+            last_alive_ms: number | null
+            last_event_ms: number | null
+            keepalive: {
+                failing: boolean
+                error_count: number
+                last_timeout_ms: number | null
+                // round trip of answered server pings, null until one was seen
+                rtt_ms: number | null
+                avg_rtt_ms: number | null
+                rtt_samples: number
+            }
+            pending: { recoveries: number; reconnect_attempt: number; tasks: number }
+            event_backlog: number
+            oldest_queued?: string
+        }>('WmClientHealth', { client, ...opts }),
+    // A failed server query leaves its field null with the error under errors
+    clientGetSelfProfile: (client: number, timeoutMs?: number) =>
+        call<{
+            jid: string
+            lid: string | null
+            push_name: string
+            business_name: string
+            about: string | null
+            picture: any | null
+            business: any | null
+            errors?: Partial<Record<'about' | 'picture' | 'business', string>>
+        }>('WmClientGetSelfProfile', { client, timeout_ms: timeoutMs }),
+    clientGetRetryStats: (client: number, opts?: { chat?: string; reset?: boolean }) =>
+        call<{ total: RetryStats; chats: ({ chat: string } & RetryStats)[] }>(
+            'WmClientGetRetryStats',
+            { client, ...opts }
+        ),
+    // auto requests every unavailable message from the phone instead of whatsmeow
+    clientSetMessageRecovery: (
+        client: number,
+        enabled: boolean,
+        opts?: {
+            auto?: boolean
+            delay_ms?: number
+            retry_after_ms?: number
+            max_attempts?: number
+        }
+    ) =>
+        call<{
+            enabled: boolean
+            policy?: {
+                auto: boolean
+                delay_ms: number
+                retry_after_ms: number
+                max_attempts: number
+            }
+        }>('WmClientSetMessageRecovery', { client, enabled, ...opts }),
+    requestUnavailableMessage: (client: number, chat: string, sender: string, id: string) =>
+        call<{ request_id: string }>('WmRequestUnavailableMessage', { client, chat, sender, id }),
+    // "quarantine" blocks sends to contacts whose identity changed until trustIdentity; omit
+    // mode to read the policy and the quarantined contacts
+    clientSetIdentityPolicy: (client: number, mode?: 'auto' | 'quarantine') =>
+        call<{ mode: 'auto' | 'quarantine'; quarantined: { jid: string; since: number }[] }>(
+            'WmClientSetIdentityPolicy',
+            { client, mode }
+        ),
+    // Security code of the encryption screen; without jid only our own fingerprint. The contact's
+    // key comes from the Signal session, so a message must have been exchanged
+    clientGetSafetyNumber: (client: number, jid?: string) =>
+        call<{
+            own: { jid: string; fingerprint: string; identity_key: string }
+            contact?: { jid: string; fingerprint: string; identity_key: string }
+            // 60 digits, and grouped in blocks of 5 as the apps display it
+            safety_number?: string
+            display?: string
+        }>('WmClientGetSafetyNumber', { client, jid }),
+    // Raw Signal encryption with one device's existing session, bytes as base64. Offline
+    // only: each call advances the session ratchet shared with regular messages, so these
+    // fail while the client is connected, and connecting waits for a running call. Use
+    // them after clientDisconnect (whatsmeow's auto reconnect doesn't wait for them)
+    clientSignalEncrypt: (client: number, jid: string, plaintextB64: string, pad?: boolean) =>
+        call<{ jid: string; type: 'msg' | 'pkmsg'; ciphertext: string }>('WmClientSignalEncrypt', {
+            client,
+            jid,
+            plaintext: plaintextB64,
+            pad
+        }),
+    clientSignalDecrypt: (
+        client: number,
+        jid: string,
+        type: 'msg' | 'pkmsg',
+        ciphertextB64: string,
+        unpad?: boolean
+    ) =>
+        call<{ jid: string; plaintext: string }>('WmClientSignalDecrypt', {
+            client,
+            jid,
+            type,
+            ciphertext: ciphertextB64,
+            unpad
+        }),
+    trustIdentity: (client: number, jid: string) =>
+        call<{ jid: string; was_quarantined: boolean }>('WmTrustIdentity', { client, jid }),
+    // Pairings not answered within timeout_ms (default 30s) are rejected unless allow_on_timeout.
+    // With allowed_users, other numbers are rejected and listed ones paired without asking
+    // unless ask is set
+    clientSetPairApproval: (
+        client: number,
+        enabled: boolean,
+        opts?: {
+            timeout_ms?: number
+            allow_on_timeout?: boolean
+            allowed_users?: string[]
+            ask?: boolean
+        }
+    ) =>
+        call<{
+            enabled: boolean
+            policy?: {
+                timeout_ms: number
+                allow_on_timeout: boolean
+                allowed_users: string[]
+                ask: boolean
+            }
+        }>('WmClientSetPairApproval', { client, enabled, ...opts }),
+    resolveDecision: (decisionId: number, allow: boolean) =>
+        call<{}>('WmResolveDecision', { decision_id: decisionId, allow }),
+    // Applied to every SendMessage-style call; fields set on a call take precedence
+    clientSetSendDefaults: (client: number, defaults: SendDefaults) =>
+        call<SendDefaults>('WmClientSetSendDefaults', { client, ...defaults }),
+    // Blocks until the collections failing on a missing app state key are recovered or timeout_ms
+    // (default 60s) runs out; progress comes as app_state_recovery events
+    clientRecoverAppState: (client: number, opts?: { names?: string[]; timeout_ms?: number }) =>
+        call<{
+            recovery_id: number
+            recovered: boolean
+            results: Array<{
+                name: string
+                status: 'ok' | 'recovered' | 'failed' | 'missing_key'
+                attempts: number
+                error?: string
+            }>
+        }>('WmClientRecoverAppState', { client, ...opts }),
+    // Drops our Signal sessions with every device of the contact and, unless probe is false,
+    // sends an invisible message so new sessions are set up right away
+    clientResetSession: (
+        client: number,
+        jid: string,
+        opts?: { probe?: boolean; identity?: boolean }
+    ) =>
+        call<{ reset: string[]; probe: SendResponse | null }>('WmClientResetSession', {
+            client,
+            jid,
+            ...opts
+        }),
+    // Mute, pin and archive state of a chat from the app state sync; muted_until is unix ms
+    clientGetChatSettings: (client: number, jid: string) =>
+        call<{
+            chat: string
+            found: boolean
+            muted: boolean
+            muted_until: number | null
+            muted_forever: boolean
+            pinned: boolean
+            archived: boolean
+        }>('WmClientGetChatSettings', { client, jid }),
+    // Disabled, push names of senders and history syncs aren't written to the contact store
+    // anymore (and push_name events stop); names already stored stay
+    clientSetPushNameStorage: (client: number, enabled: boolean) =>
+        call<{ enabled: boolean }>('WmClientSetPushNameStorage', { client, enabled }),
+    clientDumpContactNames: (client: number, pushNamesOnly?: boolean) =>
+        call<{
+            contacts: Array<{
+                jid: string
+                push_name?: string
+                full_name?: string
+                first_name?: string
+                business_name?: string
+            }>
+            total: number
+        }>('WmClientDumpContactNames', { client, push_names_only: pushNamesOnly }),
+    // Deadline for every call on the client (WmClientCall, media, typed helpers) that doesn't
+    // bring its own; 0 removes it
+    clientSetDefaultDeadline: (client: number, timeoutMs: number) =>
+        call<{ timeout_ms: number }>('WmClientSetDefaultDeadline', {
+            client,
+            timeout_ms: timeoutMs
+        }),
+    // Locale reported when logging in, so server-generated text comes in that language; applies
+    // from the next connection. Pass {} to go back to the process default
+    clientSetLocale: (
+        client: number,
+        locale: { language?: string; country?: string; timezone?: string }
+    ) =>
+        call<ClientLocale & { applies_on_reconnect: boolean }>('WmClientSetLocale', {
+            client,
+            ...locale
+        }),
+    clientGetLocale: (client: number) => call<ClientLocale>('WmClientGetLocale', { client }),
+    // Messenger / Instagram E2EE mode; the device must come from a Meta login
+    clientSetMessengerConfig: (
+        client: number,
+        opts:
+            | { enabled: false }
+            | {
+                  enabled: true
+                  user_agent: string
+                  base_url: string
+                  websocket_url?: string
+                  facebook_uuid?: string
+              }
+    ) =>
+        call<{ enabled: boolean; facebook_uuid?: string }>('WmClientSetMessengerConfig', {
+            client,
+            ...opts
+        }),
+    // Exactly one of consumer_application / armadillo, as protojson objects
+    clientSendFBMessage: (
+        client: number,
+        to: string,
+        message: {
+            consumer_application?: any
+            armadillo?: any
+            metadata?: any
+            extra?: any
+            idempotency_key?: string
+        }
+    ) => call<any>('WmClientSendFBMessage', { client, to, ...message }),
+    // Key-value store backend served from JS, see serveStoreBackend
+    storeBackendCreate: (opts: { timeout_ms?: number }) =>
+        call<{ handle: number }>('WmStoreBackendCreate', opts),
+    storeNext: (handle: number, timeoutMs: number) =>
+        call<any>('WmStoreNext', { handle, timeoutMs }),
+    storeRespond: (
+        handle: number,
+        id: number,
+        reply: { value?: string | null; entries?: { key: string; value: string }[]; error?: string }
+    ) => call<{}>('WmStoreRespond', { handle, id, ...reply }),
+    deviceUseStoreBackend: (device: number, backend: number, scope?: string) =>
+        call<{ scope: string }>('WmDeviceUseStoreBackend', { device, backend, scope }),
+    clientGetMessageSecret: (client: number, chat: string, sender: string, id: string) =>
+        call<{ found: boolean; secret?: string }>('WmClientGetMessageSecret', {
+            client,
+            chat,
+            sender,
+            id
+        }),
+    // Each item needs either secret (base64) or the original message (protojson)
+    clientPutMessageSecrets: (
+        client: number,
+        secrets: Array<{ chat: string; sender: string; id: string; secret?: string; message?: any }>
+    ) => call<{ stored: number }>('WmClientPutMessageSecrets', { client, secrets }),
+    // Key of one use case of a message secret (looked up unless given); bot_message
+    // keys don't depend on the message, the others come with their additional data
+    clientDeriveMessageKey: (
+        client: number,
+        useCase:
+            | 'poll_vote'
+            | 'reaction'
+            | 'comment'
+            | 'report_token'
+            | 'event_response'
+            | 'event_edit'
+            | 'bot_message',
+        message: {
+            chat?: string
+            sender?: string
+            id?: string
+            secret?: string
+            modification_sender?: string
+        }
+    ) =>
+        call<{ key: string; additional_data?: string }>('WmClientDeriveMessageKey', {
+            client,
+            use_case: useCase,
+            ...message
+        }),
+    // Deletes our copy only (synced to our other devices), unlike a revoke. timestamp (unix
+    // seconds), and the sender in groups, are looked up in the message archive when missing
+    clientDeleteMessageForMe: (
+        client: number,
+        chat: string,
+        message: {
+            id: string
+            sender?: string
+            from_me?: boolean
+            timestamp?: number
+            delete_media?: boolean
+        }
+    ) =>
+        call<{ chat: string; id: string }>('WmClientDeleteMessageForMe', {
+            client,
+            chat,
+            ...message
+        }),
+    // encrypted defaults to true only in community announcement groups
+    clientSendReaction: (
+        client: number,
+        chat: string,
+        target: { id: string; sender?: string; from_me?: boolean },
+        emoji: string,
+        encrypted?: boolean,
+        idempotencyKey?: string
+    ) =>
+        call<SendResponse>('WmClientSendReaction', {
+            client,
+            chat,
+            ...target,
+            emoji,
+            encrypted,
+            idempotency_key: idempotencyKey
+        }),
+    clientListSignalSessions: (client: number, jid: string) =>
+        call<{ sessions: Array<{ jid: string; address: string; has_session: boolean }> }>(
+            'WmClientListSignalSessions',
+            { client, jid }
+        ),
+    // Drops the session with the device in jid (a bare JID is the primary phone), or with
+    // every device of the user when all is set
+    clientDeleteSignalSession: (client: number, jid: string, identity?: boolean, all?: boolean) =>
+        call<{ scope: 'device' | 'user' }>('WmClientDeleteSignalSession', {
+            client,
+            jid,
+            identity,
+            all
+        }),
+    clientPreKeyStatus: (client: number) =>
+        call<{
+            server_count: number
+            uploaded_count: number
+            min_count: number
+            wanted_count: number
+            watermark: number
+        }>('WmClientPreKeyStatus', { client }),
+    clientUploadPreKeys: (client: number) =>
+        call<{ before: number; server_count: number; uploaded: boolean }>(
+            'WmClientUploadPreKeys',
+            { client }
+        ),
+    clientSetPreKeyWatermark: (client: number, watermark: number) =>
+        call<{ watermark: number }>('WmClientSetPreKeyWatermark', { client, watermark }),
+    callBinary,
+    callBinaryJSON,
+    // Compresses successful responses of at least thresholdBytes (default 64 KiB).
+    // zstd needs a Node version with zlib.zstdDecompressSync.
+    setCompression: (algorithm: 'gzip' | 'zstd' | 'none', thresholdBytes?: number) => {
+        if (algorithm === 'zstd' && !zstdDecompress) {
+            throw new Error('zstd is not supported by this Node version')
+        }
+        return call<{ algorithm: string; threshold_bytes?: number }>('WmSetCompression', {
+            algorithm,
+            threshold_bytes: thresholdBytes
+        })
+    },
+    // Serves the bridge over HTTP (token auth); stop it with release(handle).
+    restServerStart: (opts: {
+        addr?: string
+        token: string
+        cert_file?: string
+        key_file?: string
+    }) =>
+        call<{ handle: number; addr: string; tls: boolean }>('WmRestServerStart', opts),
+    // Protocol escape hatch: sends a raw node, optionally waiting for the reply with
+    // the same id (generated when the node has none).
+    clientSendNode: (
+        client: number,
+        node: OutgoingNode,
+        opts?: { wait_response?: boolean; timeout_ms?: number; op_id?: number }
+    ) =>
+        call<{ id?: string; response?: BinaryNode }>('WmClientSendNode', {
+            client,
+            node,
+            ...opts
+        }),
+    // Sends an <iq> (to s.whatsapp.net unless `to` is set) and returns the reply.
+    clientSendIQ: (
+        client: number,
+        iq: {
+            namespace: string
+            type: 'get' | 'set'
+            to?: string
+            target?: string
+            attrs?: OutgoingNode['attrs']
+            content?: OutgoingNode[]
+            timeout_ms?: number
+            op_id?: number
+        }
+    ) =>
+        call<{ id: string; response: BinaryNode; is_error: boolean }>('WmClientSendIQ', {
+            client,
+            ...iq
+        }),
+    // mirrors the client's stanzas as 'stanza' events and/or JSON lines appended to file;
+    // redact_tags defaults to the key material tags (enc, key, skey, identity, ...)
+    clientSetStanzaTap: (
+        client: number,
+        opts: {
+            enabled: boolean
+            events?: boolean
+            file?: string
+            max_bytes?: number
+            redact_tags?: string[]
+        }
+    ) =>
+        call<{
+            enabled: boolean
+            events?: boolean
+            file?: string
+            max_bytes?: number
+            redact_tags?: string[]
+        }>('WmClientSetStanzaTap', { client, ...opts }),
+    // replaces the client's stdout logging with JSON lines to file and/or stdout; level
+    // (default INFO) also applies to log streams of the client
+    clientSetLogSink: (
+        client: number,
+        opts: { enabled: boolean; level?: string; file?: string; stdout?: boolean }
+    ) =>
+        call<{ enabled: boolean; file?: string; stdout?: boolean }>('WmClientSetLogSink', {
+            client,
+            ...opts
+        }),
+    logStreamStart: (opts?: { level?: string; client?: number }) =>
+        call<{ handle: number }>('WmLogStreamStart', { ...opts }),
+    logNext: (handle: number, timeoutMs: number) =>
+        call<LogStreamItem>('WmLogNext', { handle, timeoutMs }),
+    // a leased handle is released by the bridge unless renewed within ttlMs; 0 removes the lease
+    leaseSet: (handle: number, ttlMs: number) =>
+        call<{ expires_at?: number }>('WmLeaseSet', { handle, ttl_ms: ttlMs }),
+    leaseRenew: (handles: number[]) =>
+        call<{ renewed: number; missing: number[] | null }>('WmLeaseRenew', { handles }),
+    listHandles: () =>
+        call<{
+            handles: Array<{
+                handle: number
+                kind: string
+                container?: number
+                client?: number
+                jid?: string
+                label?: string
+                lease_expires_at?: number
+            }>
+        }>('WmListHandles', {}),
+    // connection_state is the last connection_state event, or disconnected
+    listClients: (label?: string) =>
+        call<{
+            clients: Array<{
+                handle: number
+                label: string
+                jid?: string
+                logged_in: boolean
+                connected: boolean
+                connection_state:
+                    | 'connecting'
+                    | 'connected'
+                    | 'disconnected'
+                    | 'reconnect_scheduled'
+                    | 'reconnecting'
+                    | 'gave_up'
+                    | 'idle'
+            }>
+        }>('WmListClients', { label }),
+    // Per-client results instead of stopping at the first failure; unpaired clients are skipped
+    // by connectAll unless include_unpaired
+    connectAll: (opts?: {
+        label?: string
+        concurrency?: number
+        include_unpaired?: boolean
+        wait_ms?: number
+    }) => call<FleetResults>('WmConnectAll', opts ?? {}),
+    disconnectAll: (opts?: { label?: string; concurrency?: number }) =>
+        call<FleetResults>('WmDisconnectAll', opts ?? {}),
+    runtimeStats: () => call<RuntimeStats>('WmRuntimeStats', {}),
+    version: () =>
+        call<
+            {
+                bridge: string
+                whatsmeow_commit: string
+                whatsmeow_version: string
+                go: string
+            } & WAVersionInfo
+        >('WmVersion', {}),
+    // Overrides the WhatsApp web version every client advertises from its next connection:
+    // an explicit version ("2.3000.1023456789"), the latest one from web.whatsapp.com or reset
+    setWAVersion: (opts: {
+        version?: string
+        latest?: boolean
+        reset?: boolean
+        timeout_ms?: number
+    }) => call<WAVersionInfo>('WmSetWAVersion', opts),
+    // Process-wide keepalive timings of every client; unset fields are kept, {} reads them.
+    // Changes are refused while any client is connected, set them before connecting.
+    setKeepalive: (settings: Partial<KeepaliveSettings>) =>
+        call<KeepaliveSettings>('WmSetKeepalive', settings),
+    // Token buckets for every send of every client: per_minute messages, bursts of burst.
+    // queue mode waits up to max_wait_ms (default 60s) for a slot, reject mode fails right away.
+    setRateLimits: (
+        enabled: boolean,
+        limits?: {
+            global?: { per_minute: number; burst?: number }
+            per_client?: { per_minute: number; burst?: number }
+            per_chat?: { per_minute: number; burst?: number }
+            mode?: 'queue' | 'reject'
+            max_wait_ms?: number
+        }
+    ) => call<{ enabled: boolean; limits?: any }>('WmSetRateLimits', { enabled, ...limits }),
+    // Waits for running calls and background tasks (up to timeoutMs, default 10s), then
+    // releases every handle; the bridge refuses new work afterwards.
+    shutdown: (timeoutMs?: number) =>
+        call<{ released: number; calls_done: boolean; tasks_done: boolean; duration_ms: number }>(
+            'WmShutdown',
+            { timeout_ms: timeoutMs }
+        ),
+    // Sizes the pool for background tasks (auto-downloads, pre-key checks, call
+    // rejects) and the reconnect pool, which runs one attempt per client at a time;
+    // omitted or 0 keeps the current value.
+    setSchedulerOptions: (opts: {
+        max_workers?: number
+        max_per_client?: number
+        reconnect_max_workers?: number
+    }) => call<SchedulerStats & { reconnects: SchedulerStats }>('WmSetSchedulerOptions', opts),
+    // Limits concurrent media uploads/downloads of a client, or of all clients when
+    // client is 0. 0 means unlimited; omit maxConcurrent to only read the state.
+    setMediaConcurrency: (client: number, maxConcurrent?: number) =>
+        call<MediaSlots>('WmSetMediaConcurrency', { client, max_concurrent: maxConcurrent }),
+    eventSchema: () => call<EventSchema>('WmEventSchema', {}),
     release: (handle: number) => call<{}>('WmRelease', { handle })
 }
@@ -0,0 +1,99 @@
+import { Worker } from 'node:worker_threads'
+import { EventEmitter } from 'node:events'
+import path from 'node:path'
+import { pathToFileURL } from 'node:url'
+import { native } from './native.js'
+import type { Device } from './client.js'
+
+/**
+ * Key-value storage for a device's signal and app state keys. `scope` separates
+ * devices sharing one backend; `ns` is a fixed namespace like "session" or "prekey".
+ * Values are opaque bytes. get returns null for missing keys.
+ */
+export interface KVStoreBackend {
+    get(scope: string, ns: string, key: string): Promise<Buffer | null>
+    put(scope: string, ns: string, key: string, value: Buffer): Promise<void>
+    delete(scope: string, ns: string, key: string): Promise<void>
+    deletePrefix(scope: string, ns: string, prefix: string): Promise<void>
+    scan(scope: string, ns: string, prefix: string): Promise<Array<[string, Buffer]>>
+}
+
+/**
+ * What the module given to serveStoreBackend exports. It's loaded in the worker
+ * thread serving the backend, data is the one passed in the options.
+ */
+export interface KVStoreBackendModule {
+    createBackend(data?: any): KVStoreBackend | Promise<KVStoreBackend>
+}
+
+export interface StoreBackendServer {
+    handle: number
+    /** Point a device's key stores at this backend. Call before creating its client. */
+    attach(device: Device | number, scope?: string): { scope: string }
+    /** Subscribe to errors coming from the worker. Returns an unsubscribe fn. */
+    onError(cb: (err: any) => void): () => void
+    /** Stop serving requests and release the backend; pending operations fail. */
+    stop(): Promise<void>
+    /** Access to the underlying Node Worker if needed. */
+    worker: Worker
+}
+
+/**
+ * Serve the bridge's store requests from a JavaScript key-value backend. Native calls
+ * block the calling thread, so the backend runs in a worker thread: module is the
+ * absolute path, URL or package name of a module exporting createBackend (see
+ * KVStoreBackendModule), called there with opts.data. pollMs is the longest the worker
+ * waits for a request at a time.
+ */
+export function serveStoreBackend(
+    module: string | URL,
+    opts?: { timeoutMs?: number; pollMs?: number; data?: any }
+): StoreBackendServer {
+    const { handle } = native.storeBackendCreate({ timeout_ms: opts?.timeoutMs })
+    const href =
+        typeof module === 'string' && path.isAbsolute(module)
+            ? pathToFileURL(module).href
+            : String(module)
+    const workerURL = new URL('./workers/store-worker.js', import.meta.url)
+    const worker = new Worker(workerURL, {
+        workerData: { handle, module: href, data: opts?.data, pollMs: opts?.pollMs ?? 50 },
+        type: 'module'
+    } as any)
+
+    const emitter = new EventEmitter()
+    const onError = (err: any) => {
+        if (emitter.listenerCount('error') > 0) emitter.emit('error', err)
+    }
+
+    worker.on('message', (msg: any) => {
+        if (msg && msg.type === 'worker_error') onError(new Error(msg.error))
+    })
+    worker.on('error', onError)
+    worker.on('exit', (code) => {
+        if (code !== 0) onError(new Error(`store worker exited with code ${code}`))
+    })
+
+    return {
+        handle,
+        attach(device, scope) {
+            const dev = typeof device === 'number' ? device : (device.handle as unknown as number)
+            return native.deviceUseStoreBackend(dev, handle, scope)
+        },
+        onError(cb) {
+            emitter.on('error', cb)
+            return () => emitter.off('error', cb)
+        },
+        async stop() {
+            try {
+                worker.postMessage({ type: 'stop' })
+            } catch {}
+            // Give the worker a tick to cleanly finish
+            await new Promise((r) => setTimeout(r, 10))
+            try {
+                await worker.terminate()
+            } catch {}
+            native.release(handle)
+        },
+        worker
+    }
+}
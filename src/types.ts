@@ -8,6 +8,30 @@ export type JID = string
 export interface OpenContainerOptions {
     dialect: 'sqlite3' | 'postgres'
     address: string
+    // database/sql driver, defaults to the dialect name; 'pgx' is available for postgres
+    driver?: 'sqlite3' | 'postgres' | 'pgx' | (string & {})
+    // extra connection parameters, added to the address in the driver's syntax
+    driver_options?: Record<string, string>
+    pool?: {
+        max_open_conns?: number
+        max_idle_conns?: number
+        conn_max_lifetime_ms?: number
+        conn_max_idle_time_ms?: number
+    }
+    // Applied to every pooled connection. WAL plus a busy_timeout avoids
+    // "database is locked" errors when several clients share one file.
+    sqlite?: {
+        journal_mode?: 'DELETE' | 'TRUNCATE' | 'PERSIST' | 'MEMORY' | 'WAL' | 'OFF'
+        busy_timeout_ms?: number
+        foreign_keys?: boolean
+        synchronous?: 'OFF' | 'NORMAL' | 'FULL' | 'EXTRA'
+    }
+    // SQLCipher encryption of the whole sqlite3 store; needs a SQLCipher build (see README)
+    encryption?: { passphrase: string }
+    // false: fail on an outdated whatsmeow schema instead of migrating (see containerUpgrade)
+    upgrade?: boolean
+    // postgres only: keep this tenant's tables in their own schema (created when missing)
+    schema?: string
 }
 
 // Mirrors whatsmeow.SendRequestExtra (subset, aligned to JSON marshal casing)
@@ -38,6 +62,314 @@ export interface SendResponse {
     }
 }
 
+// Options accepted when opening an event stream.
+export interface EventStreamOptions {
+    include?: string[]
+    exclude?: string[]
+    // only deliver messages, receipts and presence for these chats / skip these chats
+    chats?: string[]
+    exclude_chats?: string[]
+    // ship message protos as base64 wire bytes (message_b64, raw_message_b64, ...)
+    // instead of protojson objects; decode with proto.WAWebProtobufsE2E.Message.decode
+    raw_proto?: boolean
+    // 'both' (default): RFC3339 strings plus a unix-ms `<field>_ms` next to each;
+    // 'rfc3339': strings only; 'unix_ms': integers in place of the strings
+    timestamp_format?: 'both' | 'rfc3339' | 'unix_ms'
+    // leave the protos out of message events: they carry body_seq (and text for
+    // plain text messages) instead; fetch the rest with native.eventGetBody
+    lazy_body?: boolean
+}
+
+// Delivery state of a client's webhook sink.
+export interface WebhookStatus {
+    enabled: boolean
+    url?: string
+    pending?: number
+    delivered?: number
+    failed?: number
+    last_error?: string
+}
+
+// Machine-readable descriptor of the event payloads, as returned by WmEventSchema.
+export interface EventSchema {
+    schema_version: number
+    events: Array<{
+        type: string
+        source: 'whatsmeow' | 'bridge'
+        go_type?: string
+        fields: Record<
+            string,
+            {
+                types: Array<'string' | 'number' | 'boolean' | 'object' | 'array' | 'null'>
+                optional?: boolean
+            }
+        >
+    }>
+    unknown_events: string
+}
+
+// Reactions on a message grouped by emoji, most used first. An empty emoji
+// removes a sender's reaction, so senders appear under one emoji at most.
+export interface ReactionSummary {
+    chat: JID
+    message_id: string
+    total: number
+    reactions: Array<{ emoji: string; count: number; senders: JID[] }>
+}
+
+// Retry receipt counters: incoming ones asked us to resend (resent or denied),
+// outgoing ones were sent by whatsmeow for messages it failed to decrypt.
+export interface RetryStats {
+    incoming: number
+    outgoing: number
+    resent: number
+    denied: number
+    last_ms: number
+}
+
+export interface WAVersionInfo {
+    wa_version: string
+    // the version whatsmeow was built with
+    wa_version_pinned: string
+    overridden: boolean
+}
+
+export interface KeepaliveSettings {
+    interval_min_ms: number
+    interval_max_ms: number
+    // how long a ping may go unanswered before KeepAliveTimeout
+    response_deadline_ms: number
+    // failing that long forces a reconnect
+    max_fail_time_ms: number
+}
+
+// Warm-up state of a device (native.clientSetWarmup). day counts from 1; limit, sent,
+// remaining and resets_at (unix ms) are only set while the warm-up isn't completed.
+export interface WarmupQuota {
+    enrolled: boolean
+    profile?: { days: number; start_per_day: number; end_per_day: number; curve: string }
+    started_at?: number
+    days?: number
+    day?: number
+    completed?: boolean
+    limit?: number
+    sent?: number
+    remaining?: number
+    resets_at?: number
+}
+
+// Latest votes of every voter on a poll, tallied per option. Options follow the
+// poll's order when the poll is known (known_poll); a voter who picked several
+// options counts towards each, and unknown_votes are picks matching no option.
+export interface PollResults {
+    chat: JID
+    poll_id: string
+    known_poll: boolean
+    poll_name?: string
+    selectable_count?: number
+    total_voters: number
+    unknown_votes: number
+    options: Array<{ name: string; count: number; voters: JID[] }>
+}
+
+// A product of a business catalog, see native.clientGetCatalog. Prices are in
+// thousandths of the currency unit, as in product messages.
+export interface CatalogProduct {
+    id: string
+    name: string
+    description: string
+    retailer_id: string
+    url: string
+    currency: string
+    price_amount_1000?: number
+    is_hidden: boolean
+    review_status?: string
+    images: Array<{ id: string; request_url: string; original_url: string }>
+}
+
+// A line of an order's cart, see the order_details event.
+export interface OrderProduct {
+    id: string
+    name: string
+    currency: string
+    image_url?: string
+    price_amount_1000?: number
+    quantity?: number
+}
+
+// Boolean whatsmeow client options, see native.clientSetFlags.
+export interface ClientFlags {
+    // don't ack messages to the server until the bridge handled (and journaled) them
+    synchronous_ack: boolean
+    // keep decrypted messages in the store until handled, so crashes don't lose them
+    enable_decrypted_event_buffer: boolean
+    // default true; when false, changed identities must be acted on after identity_change
+    auto_trust_identity: boolean
+    // emit contact/mute/archive/... events for the entries of the initial full app state sync
+    emit_app_state_events_on_full_sync: boolean
+    // clientSubscribePresence throws instead of trying when the contact's privacy token is missing
+    error_on_subscribe_presence_without_token: boolean
+}
+
+// Locale a client reports when logging in (native.clientSetLocale). language and country fall
+// back to the process default; timezone is only kept for the application, WhatsApp's login
+// payload has none.
+export interface ClientLocale {
+    language: string
+    country: string
+    timezone: string | null
+    overridden: boolean
+}
+
+// Stored metadata of a device handle, see native.deviceGetInfo. jid and lid are
+// missing until the device is paired.
+export interface DeviceInfo {
+    jid?: JID
+    lid?: JID
+    registration_id: number
+    platform: string
+    push_name: string
+    business_name: string
+    initialized: boolean
+    paired: boolean
+}
+
+// A whatsmeow Client method as seen through client.call, see native.clientListMethods.
+// Types are JSON names: string, number, boolean, bytes (base64), jid, duration_ms,
+// time, proto:<full name>, object:<go type>, map<key, value>, any, with [] for arrays.
+export interface ClientMethodInfo {
+    name: string
+    params: Array<{ type: string; variadic?: boolean }>
+    returns: string[]
+    // the method returns an error, which call() throws
+    errors: boolean
+    // false when a parameter (channel, callback) can't be passed from JSON
+    callable: boolean
+}
+
+// Result of native.connectAll / native.disconnectAll, one entry per matching client.
+export interface FleetResults {
+    results: Array<{
+        handle: number
+        label: string
+        jid?: string
+        status:
+            | 'connected'
+            | 'already_connected'
+            | 'skipped_unpaired'
+            | 'disconnected'
+            | 'already_disconnected'
+            | 'failed'
+        error?: string
+    }>
+    total: number
+    failed: number
+}
+
+// Snapshot returned by native.runtimeStats. Memory figures are bytes.
+export interface RuntimeStats {
+    goroutines: number
+    memory: {
+        heap_alloc: number
+        heap_inuse: number
+        heap_objects: number
+        sys: number
+        num_gc: number
+    }
+    handles: Record<
+        | 'containers'
+        | 'devices'
+        | 'clients'
+        | 'qr_channels'
+        | 'event_streams'
+        | 'media_jobs'
+        | 'event_sockets'
+        | 'log_streams'
+        | 'store_backends'
+        | 'operations',
+        number
+    >
+    event_streams: Array<{
+        handle: number
+        client: number
+        delivered: number
+        dropped: number
+        queue_depth: number
+        queue_cap: number
+        oldest_queued: string
+    }>
+    clients: Array<{ handle: number; jid?: JID; connected: boolean; logged_in: boolean }>
+    // global media transfer limiter
+    media: MediaSlots
+    scheduler: SchedulerStats
+    // pool running reconnect attempts, one at a time per client
+    reconnects: SchedulerStats
+}
+
+// State of the worker pool running the bridge's background tasks.
+export interface SchedulerStats {
+    workers: number
+    max_workers: number
+    max_per_client: number
+    queued: number
+    // clients with queued or running tasks
+    clients: number
+    completed: number
+    panics: number
+}
+
+// A media concurrency limiter; limit 0 means unlimited.
+export interface MediaSlots {
+    limit: number
+    active: number
+    waiting: number
+}
+
+// Per-client defaults for SendRequestExtra. Pass {} to clear them.
+export interface SendDefaults {
+    timeout_ms?: number
+    // message IDs become id_prefix + a generated ID unless the call sets one
+    id_prefix?: string
+    peer?: boolean
+    media_handle?: string
+}
+
+// A log line of a client or database logger, read with native.logNext.
+// client / container is the handle of the session that produced it.
+export interface LogRecord {
+    type: 'log'
+    level: 'DEBUG' | 'INFO' | 'WARN' | 'ERROR'
+    module: string
+    message: string
+    time: string
+    client?: number
+    container?: number
+}
+
+export type LogStreamItem =
+    | LogRecord
+    | { type: 'logs_dropped'; count: number }
+    | { type: 'timeout' | 'closed' }
+
+// Generic JSON form of a binary XML node (waBinary.Node) as produced by the bridge.
+export interface BinaryNode {
+    tag: string
+    attrs?: Record<string, string | number | boolean>
+    children?: BinaryNode[]
+    content_b64?: string
+    content?: string
+}
+
+// A node to send with native.clientSendNode / clientSendIQ. JID attributes can be
+// given as { jid }; to, from, participant etc. are parsed as JIDs anyway.
+export interface OutgoingNode {
+    tag: string
+    attrs?: Record<string, string | number | boolean | { jid: string }>
+    children?: OutgoingNode[]
+    content_b64?: string
+    content?: string
+}
+
 export type QREvent =
     | { event: 'code'; code: string; timeoutMs: number }
     | { event: 'success' }
@@ -55,6 +387,8 @@ export interface JsonOk<T> {
 export interface JsonErr {
     ok: false
     error: string
+    // Go stack trace when the call panicked
+    stack?: string
 }
 
 export type JsonResp<T> = JsonOk<T> | JsonErr
@@ -155,6 +489,7 @@ export interface NewsletterLiveUpdateMessage {
     MessageID: string
     Type: string
     Timestamp: string
+    Timestamp_ms: number
     ViewsCount: number
     ReactionCounts: Record<string, number>
     Message?: proto.WAWebProtobufsE2E.IMessage
@@ -0,0 +1,101 @@
+import { parentPort, workerData } from 'node:worker_threads'
+import { native } from '../native.js'
+import type { KVStoreBackend } from '../store-backend.js'
+
+// Worker that serves a store backend's requests. Native calls block the thread
+// they're made on, so the backend can't live on the main thread: a synchronous
+// export there (sending a message, reading a session...) would wait for a store
+// request nobody is left to answer. The backend is created here from the module
+// given to serveStoreBackend. Send message { type: 'stop' } to end the loop.
+
+type WorkerData = {
+    handle: number
+    module: string
+    data: any
+    pollMs: number
+}
+
+const port = parentPort!
+const { handle, module, data, pollMs } = workerData as WorkerData
+
+let running = true
+let inflight = 0
+
+port.on('message', (msg: any) => {
+    if (msg && msg.type === 'stop') {
+        running = false
+    }
+})
+
+const b64 = (v: string | undefined) => (v ? Buffer.from(v, 'base64') : Buffer.alloc(0))
+
+async function run(backend: KVStoreBackend, req: any) {
+    try {
+        switch (req.op) {
+            case 'get': {
+                const value = await backend.get(req.scope, req.ns, req.key)
+                native.storeRespond(handle, req.id, {
+                    value: value ? value.toString('base64') : null
+                })
+                return
+            }
+            case 'put':
+                await backend.put(req.scope, req.ns, req.key, b64(req.value))
+                break
+            case 'delete':
+                await backend.delete(req.scope, req.ns, req.key)
+                break
+            case 'delete_prefix':
+                await backend.deletePrefix(req.scope, req.ns, req.prefix ?? '')
+                break
+            case 'scan': {
+                const entries = await backend.scan(req.scope, req.ns, req.prefix ?? '')
+                native.storeRespond(handle, req.id, {
+                    entries: entries.map(([key, value]) => ({
+                        key,
+                        value: value.toString('base64')
+                    }))
+                })
+                return
+            }
+            default:
+                throw new Error(`unknown store op ${req.op}`)
+        }
+        native.storeRespond(handle, req.id, {})
+    } catch (err: any) {
+        try {
+            native.storeRespond(handle, req.id, { error: String(err?.message ?? err) })
+        } catch {}
+    }
+}
+
+;(async () => {
+    const mod = await import(module)
+    const backend: KVStoreBackend = await (mod.createBackend ?? mod.default?.createBackend)(data)
+    await new Promise<void>((resolve) => {
+        const poll = () => {
+            if (!running) return resolve()
+            for (let i = 0; i < 64; i++) {
+                // while requests are in flight only peek, so their promises can settle
+                const req = native.storeNext(handle, inflight > 0 ? 1 : pollMs)
+                if (req.op === 'closed') return resolve()
+                if (req.op === 'timeout') break
+                inflight++
+                void run(backend, req).finally(() => inflight--)
+            }
+            setImmediate(poll)
+        }
+        poll()
+    })
+})()
+    .catch((err) => {
+        try {
+            const error = (err as Error)?.message ?? String(err)
+            port.postMessage({ type: 'worker_error', error })
+        } catch {}
+    })
+    .finally(() => {
+        try {
+            port.close()
+        } catch {}
+    })
@@ -0,0 +1,29 @@
+// In-memory KVStoreBackend for the store backend tests, created in the worker.
+export function createBackend() {
+    const data = new Map()
+    const id = (scope, ns, key) => `${scope}\u0000${ns}\u0000${key}`
+    return {
+        async get(scope, ns, key) {
+            return data.get(id(scope, ns, key)) ?? null
+        },
+        async put(scope, ns, key, value) {
+            // answer asynchronously like a real database driver would
+            await new Promise((r) => setTimeout(r, 1))
+            data.set(id(scope, ns, key), value)
+        },
+        async delete(scope, ns, key) {
+            data.delete(id(scope, ns, key))
+        },
+        async deletePrefix(scope, ns, prefix) {
+            for (const k of [...data.keys()]) {
+                if (k.startsWith(id(scope, ns, prefix))) data.delete(k)
+            }
+        },
+        async scan(scope, ns, prefix) {
+            const start = id(scope, ns, prefix)
+            return [...data]
+                .filter(([k]) => k.startsWith(start))
+                .map(([k, v]) => [k.slice(id(scope, ns, '').length), v])
+        }
+    }
+}
@@ -0,0 +1,36 @@
+import { test } from 'node:test'
+import assert from 'node:assert/strict'
+import fs from 'node:fs'
+import os from 'node:os'
+import path from 'node:path'
+import { openContainer, serveStoreBackend } from '../dist/index.js'
+import { native } from '../dist/native.js'
+
+// Exports called from the main thread block it until they return, so store requests
+// they make must be answered elsewhere (the backend's worker) or they'd time out.
+test('synchronous store access from the main thread is served by the backend', async () => {
+    const dir = fs.mkdtempSync(path.join(os.tmpdir(), 'wm-store-backend-'))
+    const container = await openContainer({
+        dialect: 'sqlite3',
+        address: `file:${path.join(dir, 'store.db')}?_foreign_keys=on`
+    })
+    const server = serveStoreBackend(new URL('./fixtures/memory-backend.mjs', import.meta.url), {
+        timeoutMs: 2000
+    })
+    try {
+        const { handle: device } = native.containerCall(container.handle, 'NewDevice', [])
+        assert.deepEqual(server.attach(device, 'test'), { scope: 'test' })
+
+        const session = Buffer.from('session bytes').toString('base64')
+        const started = Date.now()
+        // the same path SendMessage takes to load and save sessions
+        native.deviceCall(device, 'PutSession', ['123:0', session], 'sessions')
+        assert.equal(native.deviceCall(device, 'HasSession', ['123:0'], 'sessions'), true)
+        assert.equal(native.deviceCall(device, 'GetSession', ['123:0'], 'sessions'), session)
+        assert.equal(native.deviceCall(device, 'HasSession', ['456:0'], 'sessions'), false)
+        assert.ok(Date.now() - started < 2000, 'store requests waited for the timeout')
+    } finally {
+        await server.stop()
+        fs.rmSync(dir, { recursive: true, force: true })
+    }
+})